@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/handler"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/internal/service"
+	"streamerrio-backend/pkg/buildinfo"
+	"streamerrio-backend/pkg/conntoken"
+	"streamerrio-backend/pkg/counter"
+	"streamerrio-backend/pkg/health"
+	"streamerrio-backend/pkg/joincode"
+	"streamerrio-backend/pkg/metrics"
+	"streamerrio-backend/pkg/pubsub"
+	"streamerrio-backend/pkg/registry"
+	"streamerrio-backend/pkg/tracing"
+	"streamerrio-backend/pkg/viewertoken"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	elog "github.com/labstack/gommon/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// app: 接続済みの DB / Redis から組み立てたサーバ一式
+type app struct {
+	server *server
+	events *service.EventService // 起動前の確認 (VerifyEventTypes) に使う
+}
+
+// newApp: サービス・ハンドラ・ルーティング・バックグラウンド処理・停止処理を組み立てる (起動はしない)
+// main と停止処理のテストで同じ組み立てを使う。db / rdb のクローズは返したサーバの停止処理が行う。
+func newApp(ctx context.Context, cfg *config.Config, db *sqlx.DB, rdb *redis.Client, appLogger *slog.Logger) (*app, error) {
+	log := appLogger.With(slog.String("component", "bootstrap"))
+
+	// 1. メトリクス (/metrics で公開するプロセス内レジストリ)
+	appMetrics := metrics.New()
+
+	// 2. トレース (OTEL_TRACES_EXPORTER: none / otlp / stdout)
+	shutdownTracing, err := tracing.Init(ctx, tracing.Config{
+		Exporter:       cfg.TracesExporter,
+		ServiceName:    serviceName,
+		ServiceVersion: buildinfo.Get().Version,
+		InstanceID:     cfg.InstanceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tracing init: %w", err)
+	}
+	log.Info("tracing configured", slog.String("exporter", cfg.TracesExporter))
+
+	// 3. カウンタ (イベント数 / 視聴者アクティビティ)
+	rdb.AddHook(appMetrics.RedisHook()) // 全コマンドの遅延を記録
+	redisCounter := counter.NewRedisCounter(rdb, cfg.RedisOpTimeout, appLogger.With(slog.String("component", "redis_counter")))
+
+	// 4. Pub/Sub 初期化 (REST API → WebSocket サーバーへのイベント配信)
+	// Redis Streams: ルーム単位の seq を付与し、Unity 再接続時 (since=N) の再送に対応
+	// 発行側のトレースはペイロードの "trace" フィールドで購読側へ引き継ぐ (ハンドラへ渡す前に取り除く)
+	ps := pubsub.Instrument(pubsub.WithTracing(pubsub.NewRedisStreamPubSub(rdb, cfg.InstanceID, appLogger.With(slog.String("component", "pubsub")))), appMetrics)
+
+	// 4.1 Unity 接続の所有レジストリ (どのインスタンスがどのルームのソケットを持つか)
+	ownership := registry.NewRedisRegistry(rdb, appLogger.With(slog.String("component", "ws_registry")))
+	log.Info("instance identity", slog.String("instance_id", cfg.InstanceID), slog.Duration("ws_ownership_ttl", cfg.WSOwnershipTTL))
+
+	// 5. リポジトリ (永続層) 準備
+	repoLogger := appLogger.With(slog.String("component", "repository"))
+	eventRepo := repository.NewEventRepository(db, appMetrics, cfg.DBQueryTimeout, repoLogger.With(slog.String("repository", "event")))
+	roomRepo := repository.NewRoomRepository(db, appMetrics, cfg.DBQueryTimeout, repoLogger.With(slog.String("repository", "room")))
+	viewerRepo := repository.NewViewerRepository(db, appMetrics, cfg.DBQueryTimeout, repoLogger.With(slog.String("repository", "viewer")))
+	streamerRepo := repository.NewStreamerRepository(db, appMetrics, cfg.DBQueryTimeout, repoLogger.With(slog.String("repository", "streamer")))
+	// 5.1 押下イベントは write-behind (押下処理は DB を待たずにキューへ積み、バックグラウンドでまとめて INSERT)
+	var eventWriter *repository.BufferedEventRepository
+	if cfg.EventWriteBehind {
+		eventWriter = repository.NewBufferedEventRepository(eventRepo, repository.EventBufferConfig{
+			BatchSize:      cfg.EventBatchSize,
+			FlushInterval:  cfg.EventFlushInterval,
+			QueueSize:      cfg.EventQueueSize,
+			EnqueueTimeout: cfg.EventEnqueueTimeout,
+			MaxRetries:     cfg.EventFlushRetries,
+		}, appMetrics, repoLogger.With(slog.String("repository", "event_writer")))
+		eventRepo = eventWriter
+	}
+
+	// 6. サービス層生成
+	roomService := service.NewRoomService(roomRepo, cfg)
+	catalogService := service.NewCatalogService(roomRepo, appLogger.With(slog.String("component", "catalog_service")))
+	wsHandlerLogger := appLogger.With(slog.String("component", "websocket_handler"))
+	wsHandler := handler.NewWebSocketHandler(ps, wsHandlerLogger)
+	wsHandler.SetRoomService(roomService)
+	wsHandler.SetMetrics(appMetrics)
+	wsHandler.SetCatalogService(catalogService)
+	// 配信者認証: API キー / 1回限りの接続トークン (Redis) で Unity 接続とルーム所有を紐付け
+	connTokens := conntoken.NewRedisStore(rdb, appLogger.With(slog.String("component", "conn_tokens")))
+	streamerService := service.NewStreamerService(streamerRepo, connTokens, cfg.StreamerConnTokenTTL, appLogger.With(slog.String("component", "streamer_service")))
+	wsHandler.SetStreamerService(streamerService)
+	// 参加導線: 参加 URL (JOIN_BASE_URL) / QR / 短い参加コード (Redis)
+	joinCodes := joincode.NewRedisStore(rdb, appLogger.With(slog.String("component", "join_codes")))
+	joinService := service.NewJoinService(roomService, joinCodes, cfg.JoinBaseURL, appLogger.With(slog.String("component", "join_service")))
+	wsHandler.SetJoinService(joinService)
+	log.Info("streamer auth", slog.Bool("required", cfg.StreamerAuthRequired), slog.Duration("conn_token_ttl", cfg.StreamerConnTokenTTL))
+	wsHandler.SetRegistry(ownership, cfg.InstanceID, cfg.WSOwnershipTTL)
+	wsHandler.SetConnOptions(handler.ConnOptions{
+		PingInterval:  cfg.WSPingInterval,
+		PongWait:      cfg.WSPongWait,
+		WriteWait:     cfg.WSWriteWait,
+		SendQueueSize: cfg.WSSendQueueSize,
+	})
+	sender := webSocketAdapter{ws: wsHandler}
+	eventLogger := appLogger.With(slog.String("component", "event_service"))
+	sessionLogger := appLogger.With(slog.String("component", "session_service"))
+	eventService := service.NewEventService(redisCounter, eventRepo, ps, catalogService, eventLogger)
+	eventService.SetRegistry(ownership)
+	eventService.SetMetrics(appMetrics)
+	sessionService := service.NewGameSessionService(roomService, catalogService, eventRepo, viewerRepo, redisCounter, sender, sessionLogger)
+	viewerService := service.NewViewerService(viewerRepo)
+	viewerFeed := service.NewViewerFeed(ps, eventService.GetRoomStats, cfg.ViewerStatsInterval, appLogger.With(slog.String("component", "viewer_feed")))
+	eventService.SetViewerFeed(viewerFeed)
+	sessionService.SetViewerFeed(viewerFeed)
+	viewerStream := handler.NewViewerStreamHandler(roomService, eventService, ps, appLogger.With(slog.String("component", "viewer_stream")))
+	viewerStream.SetMetrics(appMetrics)
+	wsHandler.SetGameSessionService(sessionService)
+	apiHandler := handler.NewAPIHandler(roomService, eventService, sessionService, viewerService, catalogService)
+	apiHandler.SetJoinService(joinService)
+	sessionService.SetJoinService(joinService)
+	streamerHandler := handler.NewStreamerHandler(streamerService, roomService, sessionService)
+	pressGuard := service.NewPressGuard(
+		counter.NewRedisRateLimiter(rdb, cfg.RedisOpTimeout, appLogger.With(slog.String("component", "rate_limiter"))),
+		service.PressGuardConfig{
+			Viewer:          cfg.RateLimitViewer,
+			IP:              cfg.RateLimitIP,
+			Room:            cfg.RateLimitRoom,
+			IntervalSamples: cfg.AbuseIntervalSamples,
+			IntervalMaxCV:   cfg.AbuseIntervalMaxCV,
+			IPViewerLimit:   cfg.AbuseIPViewerLimit,
+			IPViewerWindow:  cfg.AbuseIPViewerWindow,
+			ReducedWeight:   cfg.AbuseReducedWeight,
+			FlagTTL:         cfg.AbuseFlagTTL,
+		},
+		appLogger.With(slog.String("component", "press_guard")),
+	)
+	apiHandler.SetPressGuard(pressGuard)
+
+	// 6.1 視聴者トークン (署名付き視聴者 ID)
+	if err := cfg.CheckServe(); err != nil {
+		return nil, err
+	}
+	tokenKeys := cfg.ViewerTokenKeys
+	if len(tokenKeys) == 0 {
+		// 鍵未設定 (CheckServe が許すのは APP_ENV=development のみ): 起動ごとの一時鍵 (再起動や別インスタンスでは既存トークンが無効になる)
+		log.Warn("VIEWER_TOKEN_KEYS not set, using an ephemeral signing key (development only)")
+		tokenKeys = []viewertoken.Key{ephemeralTokenKey()}
+	}
+	viewerTokens, err := viewertoken.NewSigner(tokenKeys, cfg.ViewerTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid viewer token config: %w", err)
+	}
+	apiHandler.SetViewerTokens(viewerTokens, cfg.ViewerTokenRequired)
+
+	// 7. バックグラウンド処理 (停止時にまとめてキャンセル)
+	reaper := service.NewRoomReaper(roomService, sessionService, wsHandler, cfg, appLogger.With(slog.String("component", "room_reaper")))
+	workers := []worker{
+		// REST APIからのイベントをWebSocketで受信してUnityに配信
+		{name: "unity_pubsub", run: wsHandler.StartPubSubSubscription},
+		// 視聴者向けライブ更新の購読
+		{name: "viewer_pubsub", run: viewerStream.StartPubSubSubscription},
+		// 所有レジストリのハートビート
+		{name: "ownership_heartbeat", run: wsHandler.StartOwnershipHeartbeat},
+		// 期限切れ/放置ルームの回収
+		{name: "room_reaper", run: reaper.Run},
+	}
+	flushes := []shutdownStep{
+		{name: "viewer_stats", fn: viewerFeed.Flush},
+	}
+	if eventWriter != nil {
+		// 押下イベントの書き出し (停止時は workers の終了後に残りを書き出す)
+		workers = append(workers, worker{name: "event_writer", run: eventWriter.Run})
+		flushes = append(flushes, shutdownStep{name: "press_events", fn: eventWriter.Flush})
+	}
+	flushes = append(flushes, shutdownStep{name: "tracing", fn: shutdownTracing}) // 他の書き出し中のスパンも含めて送り出すため最後
+
+	// 7.1 稼働確認 (liveness: プロセス内部のみ / readiness: 依存先を含む)
+	liveness := health.NewChecker(serviceName, cfg.HealthCheckTimeout)
+	liveness.Add("unity_pubsub", subscriptionCheck(wsHandler.Subscribed))
+	liveness.Add("viewer_pubsub", subscriptionCheck(viewerStream.Subscribed))
+	readiness := health.NewChecker(serviceName, cfg.HealthCheckTimeout)
+	readiness.Add("database", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, db.PingContext(ctx)
+	})
+	readiness.Add("redis", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, rdb.Ping(ctx).Err()
+	})
+	readiness.Add("unity_pubsub", subscriptionCheck(wsHandler.Subscribed))
+	readiness.Add("viewer_pubsub", subscriptionCheck(viewerStream.Subscribed))
+	readiness.Add("websocket", func(ctx context.Context) (map[string]interface{}, error) {
+		details := map[string]interface{}{"connections": wsHandler.ConnectionCount(), "viewer_streams": viewerStream.StreamCount()}
+		if wsHandler.Draining() {
+			return details, errors.New("draining for shutdown")
+		}
+		return details, nil
+	})
+	healthHandler := handler.NewHealthHandler(liveness, readiness, appLogger.With(slog.String("component", "health")))
+	log.Info("build info", slog.String("version", buildinfo.Get().Version), slog.String("revision", buildinfo.Get().Revision))
+
+	// 8. Echo フレームワーク初期化 & ミドルウェア
+	e := echo.New()
+	e.Logger.SetLevel(elog.DEBUG)
+	// 送信元 IP は X-Forwarded-For を右から辿り、信頼済み (プライベート/ループバック) 以外の最初のアドレスを採用
+	// (先頭要素はクライアントが偽装できるため、IP 単位のレート制限に使わない)
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		// 稼働確認・メトリクス収集は定期的に叩かれるためアクセスログから除く
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/healthz" || c.Path() == "/readyz" || c.Path() == "/metrics"
+		},
+	})) // アクセスログ
+	// リクエストごとのトレース (server スパンをリクエストの context に載せる / 稼働確認・メトリクス収集は除く)
+	e.Use(handler.Tracing("/healthz", "/readyz", "/metrics"))
+	e.Use(middleware.Recover()) // パニック回復 (トレースの内側で 500 として記録させる)
+	// 視聴者トークン検証 (検証済みの視聴者をリクエストの context に載せる)
+	e.Use(handler.ViewerAuth(viewerTokens, cfg.ViewerTokenRequired, appLogger.With(slog.String("component", "viewer_auth"))))
+
+	// 9. CORS 設定
+	// 認証付き（Cookie 同送）要求に対応するため AllowCredentials=true とし、
+	// オリジンは allowlist（環境変数 FRONTEND_URL）に限定する。
+	// 注意: AllowCredentials=true の場合、"*" は使用できない。
+	allowCredentials := true
+	allowOrigins := []string{cfg.FrontendURL}
+	if cfg.FrontendURL == "*" {
+		// デフォルト設定時は資格情報を扱わない想定
+		allowCredentials = false
+	}
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     allowOrigins,
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:     []string{"ngrok-skip-browser-warning", echo.HeaderContentType, echo.HeaderAuthorization},
+		AllowCredentials: allowCredentials,
+	}))
+
+	// 10. ルーティング定義
+	e.GET("/", healthHandler.Liveness)
+	e.GET("/healthz", healthHandler.Liveness)
+	e.GET("/readyz", healthHandler.Readiness)
+	e.GET("/metrics", echo.WrapHandler(appMetrics.Handler()), handler.MetricsAuth(cfg.MetricsToken))
+	e.GET("/get_viewer_id", apiHandler.GetOrCreateViewerID)
+	adminAuth := handler.AdminAuth(cfg.AdminToken)
+	// WebSocket
+	e.GET("/ws-unity", wsHandler.HandleUnityConnection)
+	e.GET("/clients", wsHandler.ListClients, adminAuth)
+	// REST API
+	api := e.Group("/api")
+	api.GET("/rooms/:id", apiHandler.GetRoom)
+	api.POST("/rooms/:id/events", apiHandler.SendEvent)
+	api.GET("/rooms/:id/stats", apiHandler.GetRoomStats)
+	api.GET("/rooms/:id/catalog", apiHandler.GetRoomCatalog)
+	api.GET("/rooms/:id/triggers", apiHandler.GetRoomTriggers)
+	api.GET("/rooms/:id/live", viewerStream.HandleStream) // 視聴者向け SSE
+	api.GET("/rooms/:id/qr.png", apiHandler.GetRoomQR)
+	api.GET("/rooms/:id/results", apiHandler.GetRoomResult)
+	api.POST("/viewers/set_name", apiHandler.SetViewerName)
+	api.GET("/join/:code", apiHandler.ResolveJoinCode)
+	// 配信者 (作成は運用者のみ / 以降は API キー認証)
+	api.POST("/streamers", streamerHandler.Register, adminAuth)
+	streamer := api.Group("/streamer", handler.StreamerAuth(streamerService, appLogger.With(slog.String("component", "streamer_auth"))))
+	streamer.GET("/me", streamerHandler.Me)
+	streamer.GET("/keys", streamerHandler.ListKeys)
+	streamer.POST("/keys", streamerHandler.CreateKey)
+	streamer.DELETE("/keys/:id", streamerHandler.RevokeKey)
+	streamer.POST("/connection-token", streamerHandler.CreateConnectionToken)
+	streamer.GET("/rooms", streamerHandler.ListRooms)
+	streamer.POST("/rooms/:id/end", streamerHandler.EndRoom)
+
+	// 11. 停止順: HTTP / 長寿命接続 → workers (Pub/Sub 購読など) → 未発行データの書き出し → 外部接続のクローズ
+	srv := &server{
+		echo:            e,
+		addr:            ":" + cfg.Port,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		drains: []shutdownStep{
+			{name: "unity_connections", fn: wsHandler.Drain},
+			{name: "viewer_streams", fn: viewerStream.Drain},
+		},
+		workers: workers,
+		flushes: flushes,
+		closers: []shutdownStep{
+			closeStep("pubsub", ps.Close),
+			closeStep("redis", rdb.Close),
+			closeStep("database", db.Close),
+		},
+		logger: appLogger.With(slog.String("component", "server")),
+	}
+	return &app{server: srv, events: eventService}, nil
+}
+
+// serviceName: 稼働確認レポートに載せるサービス名
+const serviceName = "streamerrio"
+
+// subscriptionCheck: Pub/Sub 購読の goroutine が動作中かの確認
+func subscriptionCheck(subscribed func() bool) health.CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if !subscribed() {
+			return nil, errors.New("subscription not running")
+		}
+		return nil, nil
+	}
+}
+
+// webSocketAdapter: 既存 WebSocketHandler をサービス側インタフェースに適合させる薄いアダプタ
+// ローカルに接続が無い場合は所有インスタンスへ転送する。
+type webSocketAdapter struct{ ws *handler.WebSocketHandler }
+
+func (a webSocketAdapter) SendEventToUnity(roomID string, payload map[string]interface{}) error {
+	return a.ws.DeliverToUnity(roomID, payload)
+}
+
+// ephemeralTokenKey: ランダムな一時署名鍵 (開発用)
+func ephemeralTokenKey() viewertoken.Key {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return viewertoken.Key{ID: "ephemeral", Secret: secret}
+}
@@ -4,25 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"streamerrio-backend/internal/config"
-	"streamerrio-backend/internal/handler"
-	"streamerrio-backend/internal/repository"
-	"streamerrio-backend/internal/service"
-	"streamerrio-backend/pkg/counter"
 	"streamerrio-backend/pkg/logger"
-	"streamerrio-backend/pkg/pubsub"
 
 	// PostgreSQLドライバー
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	elog "github.com/labstack/gommon/log"
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 )
@@ -57,9 +50,21 @@ func main() {
 		log.Error("failed to connect to database", slog.Any("error", err))
 		os.Exit(1)
 	}
-	defer db.Close()
 
-	// 5. Redis 初期化 & カウンタ (イベント数 / 視聴者アクティビティ)
+	// 4.1 スキーマ: `server migrate ...` はマイグレーション操作のみ行って終了
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrateCommand(context.Background(), db.DB, os.Args[2:], appLogger.With(slog.String("component", "migrate")))
+		db.Close()
+		os.Exit(code)
+	}
+	if cfg.DBAutoMigrate {
+		if err := autoMigrate(context.Background(), db.DB, appLogger.With(slog.String("component", "migrate"))); err != nil {
+			log.Error("schema migration failed", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	// 5. Redis 接続
 	var rdb *redis.Client
 	if strings.HasPrefix(cfg.RedisURL, "redis://") || strings.HasPrefix(cfg.RedisURL, "rediss://") {
 		opt, err := redis.ParseURL(cfg.RedisURL)
@@ -71,98 +76,26 @@ func main() {
 	} else {
 		rdb = redis.NewClient(&redis.Options{Addr: cfg.RedisURL})
 	}
-	redisCounter := counter.NewRedisCounter(rdb, appLogger.With(slog.String("component", "redis_counter")))
-
-	// 6. Pub/Sub 初期化 (REST API → WebSocket サーバーへのイベント配信)
-	ps := pubsub.NewRedisPubSub(rdb, appLogger.With(slog.String("component", "pubsub")))
-
-	// 7. リポジトリ (永続層) 準備
-	repoLogger := appLogger.With(slog.String("component", "repository"))
-	eventRepo := repository.NewEventRepository(db, repoLogger.With(slog.String("repository", "event")))
-	roomRepo := repository.NewRoomRepository(db, repoLogger.With(slog.String("repository", "room")))
-	viewerRepo := repository.NewViewerRepository(db, repoLogger.With(slog.String("repository", "viewer")))
-
-	// 8. サービス層生成
-	roomService := service.NewRoomService(roomRepo, cfg)
-	wsHandlerLogger := appLogger.With(slog.String("component", "websocket_handler"))
-	wsHandler := handler.NewWebSocketHandler(ps, wsHandlerLogger)
-	wsHandler.SetRoomService(roomService)
-	sender := webSocketAdapter{ws: wsHandler}
-	eventLogger := appLogger.With(slog.String("component", "event_service"))
-	sessionLogger := appLogger.With(slog.String("component", "session_service"))
-	eventService := service.NewEventService(redisCounter, eventRepo, ps, eventLogger)
-	sessionService := service.NewGameSessionService(roomService, eventRepo, viewerRepo, redisCounter, sender, sessionLogger)
-	viewerService := service.NewViewerService(viewerRepo)
-	wsHandler.SetGameSessionService(sessionService)
-	apiHandler := handler.NewAPIHandler(roomService, eventService, sessionService, viewerService)
-
-	// 9. Pub/Sub 購読開始 (別goroutine)
-	// REST APIからのイベントをWebSocketで受信してUnityに配信
-	go func() {
-		ctx := context.Background()
-		if err := wsHandler.StartPubSubSubscription(ctx); err != nil {
-			log.Error("pubsub subscription terminated", slog.Any("error", err))
-		}
-	}()
-
-	// 10. Echo フレームワーク初期化 & ミドルウェア
-	e := echo.New()
-	e.Logger.SetLevel(elog.DEBUG)
-	e.Use(middleware.Logger())  // アクセスログ
-	e.Use(middleware.Recover()) // パニック回復
 
-	// 11. CORS 設定
-	// 認証付き（Cookie 同送）要求に対応するため AllowCredentials=true とし、
-	// オリジンは allowlist（環境変数 FRONTEND_URL）に限定する。
-	// 注意: AllowCredentials=true の場合、"*" は使用できない。
-	allowCredentials := true
-	allowOrigins := []string{cfg.FrontendURL}
-	if cfg.FrontendURL == "*" {
-		// デフォルト設定時は資格情報を扱わない想定
-		allowCredentials = false
+	// 6. サービス・ルーティング・停止処理の組み立て (newApp)
+	a, err := newApp(context.Background(), cfg, db, rdb, appLogger)
+	if err != nil {
+		log.Error("server setup failed", slog.Any("error", err))
+		os.Exit(1)
 	}
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins:     allowOrigins,
-		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodOptions},
-		AllowHeaders:     []string{"ngrok-skip-browser-warning", echo.HeaderContentType},
-		AllowCredentials: allowCredentials,
-	}))
-
-	// 12. ルーティング定義
-	e.GET("/", healthCheck)
-	e.GET("/get_viewer_id", apiHandler.GetOrCreateViewerID)
-	// WebSocket
-	e.GET("/ws-unity", wsHandler.HandleUnityConnection)
-	e.GET("/clients", wsHandler.ListClients)
-	// REST API
-	api := e.Group("/api")
-	api.GET("/rooms/:id", apiHandler.GetRoom)
-	api.POST("/rooms/:id/events", apiHandler.SendEvent)
-	api.GET("/rooms/:id/stats", apiHandler.GetRoomStats)
-	api.GET("/rooms/:id/results", apiHandler.GetRoomResult)
-	api.POST("/viewers/set_name", apiHandler.SetViewerName)
-
-	// 13. サーバ起動
-	log.Info("starting http server", slog.String("port", cfg.Port))
-	if err := e.Start(":" + cfg.Port); err != nil {
-		log.Error("server stopped", slog.Any("error", err))
+	// 扱うイベント種別を DB が受け付けるか確認 (古いスキーマのまま起動して押下の記録に失敗し続けるのを防ぐ)
+	if err := a.events.VerifyEventTypes(context.Background()); err != nil {
+		log.Error("event type verification failed", slog.Any("error", err))
 		os.Exit(1)
 	}
-}
 
-func healthCheck(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
-		"status":  "ok",
-		"service": "streamerrio",
-		"version": "1.0.0",
-	})
-}
-
-// webSocketAdapter: 既存 WebSocketHandler をサービス側インタフェースに適合させる薄いアダプタ
-type webSocketAdapter struct{ ws *handler.WebSocketHandler }
-
-func (a webSocketAdapter) SendEventToUnity(roomID string, payload map[string]interface{}) error {
-	return a.ws.SendEventToUnity(roomID, payload)
+	// 7. サーバ起動 & 停止シグナル (Cloud Run は停止前に SIGTERM を送る) で graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.server.run(ctx); err != nil {
+		stop()
+		os.Exit(1)
+	}
 }
 
 // extractConnInfo: DSN/URL から host/port/dbname/sslmode を抽出（ログ用途）
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"streamerrio-backend/db"
+	"streamerrio-backend/pkg/migrate"
+)
+
+// migrationTable: マイグレーションの適用履歴テーブル
+const migrationTable = "schema_migrations"
+
+const migrateUsage = `usage: server migrate <command>
+  status              適用状況を表示
+  up [version]        未適用を適用 (version 指定時はそこまで)
+  down [steps]        直近の適用を steps 件 (既定1) 巻き戻す
+  baseline <version>  手動で適用済みの DB に version までを適用済みとして記録 (SQL は実行しない)`
+
+func newMigrator(conn *sql.DB, logger *slog.Logger) (*migrate.Migrator, error) {
+	migrations, err := migrate.Load(db.Migrations())
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return migrate.New(migrate.NewPostgresDriver(conn, migrationTable), migrations, logger), nil
+}
+
+// autoMigrate: 起動時に未適用のマイグレーションを適用 (複数インスタンスの同時起動は advisory lock で直列化)
+// 履歴の無い手動適用済み DB は二重適用を避けて何もしない (baseline するまで警告を出し続ける)。
+func autoMigrate(ctx context.Context, conn *sql.DB, logger *slog.Logger) error {
+	m, err := newMigrator(conn, logger)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx, 0)
+	if errors.Is(err, migrate.ErrUnversioned) {
+		logger.Warn("schema has no migration history; skipping auto migration (run `server migrate baseline <version>` once)", slog.Int64("latest", m.Latest()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("schema up to date", slog.Int("applied", len(applied)), slog.Int64("version", m.Latest()))
+	return nil
+}
+
+// runMigrateCommand: `server migrate ...` サブコマンド。終了コードを返す
+func runMigrateCommand(ctx context.Context, conn *sql.DB, args []string, logger *slog.Logger) int {
+	m, err := newMigrator(conn, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	intArg := func(def int64) (int64, error) {
+		if len(args) < 2 {
+			if def < 0 {
+				return 0, errors.New("version required")
+			}
+			return def, nil
+		}
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid number %q", args[1])
+		}
+		return v, nil
+	}
+
+	var done []migrate.Migration
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(ctx, m)
+	case "up":
+		target, argErr := intArg(0)
+		if argErr != nil {
+			fmt.Fprintln(os.Stderr, argErr)
+			return 2
+		}
+		done, err = m.Up(ctx, target)
+	case "down":
+		steps, argErr := intArg(1)
+		if argErr != nil {
+			fmt.Fprintln(os.Stderr, argErr)
+			return 2
+		}
+		done, err = m.Down(ctx, int(steps))
+	case "baseline":
+		version, argErr := intArg(-1)
+		if argErr != nil {
+			fmt.Fprintln(os.Stderr, argErr)
+			return 2
+		}
+		done, err = m.Baseline(ctx, version)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	for _, mig := range done {
+		fmt.Printf("%s %03d_%s\n", args[0], mig.Version, mig.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", args[0], err)
+		if errors.Is(err, migrate.ErrUnversioned) {
+			fmt.Fprintln(os.Stderr, "hint: record the already-applied migrations with `server migrate baseline <version>` first")
+		}
+		return 1
+	}
+	if len(done) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, m *migrate.Migrator) int {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate status: %v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED_AT")
+	for _, s := range statuses {
+		state, at := "pending", ""
+		switch {
+		case s.Missing:
+			state = "applied (unknown to this binary)"
+		case s.Modified:
+			state = "applied (MODIFIED)"
+		case s.Applied:
+			state = "applied"
+		}
+		if s.AppliedAt != nil {
+			at = s.AppliedAt.Format("2006-01-02 15:04:05Z07:00")
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+	}
+	w.Flush()
+	return 0
+}
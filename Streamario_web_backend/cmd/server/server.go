@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// shutdownStep: 停止処理の1段階 (name はログ用)
+type shutdownStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// worker: 稼働中に動かし続けるバックグラウンド処理 (ctx のキャンセルで終了する)
+type worker struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// server: HTTP サーバとバックグラウンド処理の起動・停止をまとめる
+// 停止は次の順で行い、全体を shutdownTimeout 以内に収める:
+//  1. 新規リクエストの受付停止と処理中リクエストの完了待ち。並行して drains (Unity WebSocket / SSE など
+//     http.Server が待たない長寿命接続) に再接続を促して閉じる
+//  2. workers (Pub/Sub 購読・ハートビート・回収) を止めて終了を待つ
+//  3. flushes で未発行のデータを書き出す
+//  4. closers で外部接続 (Redis / DB) を閉じる (期限切れでも必ず実行)
+type server struct {
+	echo            *echo.Echo
+	addr            string
+	shutdownTimeout time.Duration
+	drains          []shutdownStep
+	workers         []worker
+	flushes         []shutdownStep
+	closers         []shutdownStep
+	logger          *slog.Logger
+}
+
+// run: workers と HTTP サーバを起動し、ctx のキャンセル (停止シグナル) かサーバの異常終了で停止処理を行う
+// 停止処理まで正常に終えれば nil を返す。
+func (s *server) run(ctx context.Context) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			if err := w.run(workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+				s.logger.Error("background worker terminated", slog.String("worker", w.name), slog.Any("error", err))
+			}
+		}(w)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		s.logger.Info("starting http server", slog.String("addr", s.addr))
+		serveErr <- s.echo.Start(s.addr)
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutdown signal received", slog.Duration("timeout", s.shutdownTimeout))
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("server stopped", slog.Any("error", err))
+			runErr = err
+		}
+	}
+	return errors.Join(runErr, s.shutdown(stopWorkers, &wg))
+}
+
+// shutdown: 停止処理本体 (各段階の失敗はログに残して次へ進む)
+func (s *server) shutdown(stopWorkers context.CancelFunc, workers *sync.WaitGroup) error {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	// 1. 受付停止 + 長寿命接続の整理 (Shutdown は SSE ハンドラの終了を待つため並行に実行)
+	stage := append([]shutdownStep{{name: "http", fn: s.echo.Shutdown}}, s.drains...)
+	errs := make([]error, len(stage))
+	var wg sync.WaitGroup
+	for i, step := range stage {
+		wg.Add(1)
+		go func(i int, step shutdownStep) {
+			defer wg.Done()
+			errs[i] = s.runStep(ctx, step)
+		}(i, step)
+	}
+	wg.Wait()
+
+	// 2. バックグラウンド処理の停止
+	errs = append(errs, s.runStep(ctx, shutdownStep{name: "workers", fn: func(ctx context.Context) error {
+		stopWorkers()
+		done := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}))
+
+	// 3. 未発行データの書き出し
+	for _, step := range s.flushes {
+		errs = append(errs, s.runStep(ctx, step))
+	}
+
+	// 4. 外部接続のクローズ (期限切れでも接続は返す)
+	for _, step := range s.closers {
+		errs = append(errs, s.runStep(context.Background(), step))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		s.logger.Error("shutdown finished with errors", slog.Duration("elapsed", time.Since(start)), slog.Any("error", err))
+		return err
+	}
+	s.logger.Info("shutdown complete", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+func (s *server) runStep(ctx context.Context, step shutdownStep) error {
+	start := time.Now()
+	if err := step.fn(ctx); err != nil {
+		s.logger.Warn("shutdown step failed", slog.String("step", step.name), slog.Duration("elapsed", time.Since(start)), slog.Any("error", err))
+		return fmt.Errorf("%s: %w", step.name, err)
+	}
+	s.logger.Info("shutdown step done", slog.String("step", step.name), slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// closeStep: io.Closer 風の Close をそのまま停止処理の1段階にする
+func closeStep(name string, close func() error) shutdownStep {
+	return shutdownStep{name: name, fn: func(context.Context) error { return close() }}
+}
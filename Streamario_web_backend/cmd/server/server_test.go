@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/websocket"
+)
+
+// helperAddrEnv: 設定されていれば TestShutdownHelperProcess がこのアドレスでサーバとして動く
+const helperAddrEnv = "STREAMARIO_SHUTDOWN_HELPER_ADDR"
+
+// slowRequestDelay: 停止シグナルをまたいで処理中にしておくリクエストの所要時間
+const slowRequestDelay = time.Second
+
+// TestShutdownOnSignal: 実プロセスへ SIGTERM を送り、graceful shutdown を確認する
+// Unity へ再接続の通知が届くこと、処理中のリクエストが完了すること、期限内に終了コード 0 で終わることを見る。
+func TestShutdownOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not supported on windows")
+	}
+	addr := freeAddr(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownHelperProcess$")
+	cmd.Env = append(os.Environ(), helperAddrEnv+"="+addr)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start helper: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	defer func() {
+		if cmd.ProcessState == nil {
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		if t.Failed() {
+			t.Logf("helper output:\n%s", out.String())
+		}
+	}()
+	waitHTTP(t, "http://"+addr+"/")
+
+	// Unity 接続 (protocol v2)
+	ws, err := websocket.Dial("ws://"+addr+"/ws-unity?protocol=2", "", "http://"+addr+"/")
+	if err != nil {
+		t.Fatalf("dial unity: %v", err)
+	}
+	defer ws.Close()
+	roomID := receiveType(t, ws, "room_created")["room_id"]
+
+	// 停止シグナルをまたぐリクエスト
+	slow := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- "error: " + err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		slow <- res.Status + " " + string(body)
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+
+	evicted := receiveType(t, ws, "evicted")
+	if evicted["reason"] != "server_shutdown" || evicted["reconnect"] != true || evicted["room_id"] != roomID {
+		t.Fatalf("unexpected eviction notice: %v", evicted)
+	}
+	if got := <-slow; got != "200 OK done" {
+		t.Fatalf("in-flight request should complete, got %q", got)
+	}
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("helper exited with error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("helper did not exit within the shutdown deadline")
+	}
+	// main の停止順: HTTP / Unity 接続 → Pub/Sub 購読などの workers → 押下イベントの書き出し → Pub/Sub → Redis → DB
+	logs := out.String()
+	last := -1
+	for _, want := range []string{`"step":"http"`, `"step":"unity_connections"`, `"step":"workers"`, `"step":"press_events"`, `"step":"pubsub"`, `"step":"redis"`, `"step":"database"`, "shutdown complete"} {
+		i := strings.Index(logs, want)
+		switch {
+		case i < 0:
+			t.Errorf("helper output missing %s", want)
+		case want != `"step":"unity_connections"` && i < last: // http と並行に閉じる
+			t.Errorf("%s ran out of order", want)
+		}
+		last = max(last, i)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Error("listener should be closed after shutdown")
+	}
+}
+
+// TestShutdownHelperProcess: TestShutdownOnSignal から別プロセスとして起動されるサーバ
+// main と同じ newApp で組み立てる (Redis は miniredis、DB は接続しない宛先で、DB を使う処理は失敗をログに残すだけ)。
+func TestShutdownHelperProcess(t *testing.T) {
+	addr := os.Getenv(helperAddrEnv)
+	if addr == "" {
+		t.Skip("helper process for TestShutdownOnSignal")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("helper addr: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("PORT", port)
+	t.Setenv("SHUTDOWN_TIMEOUT", "5s")
+	t.Setenv("REDIS_URL", mr.Addr())
+	t.Setenv("DATABASE_URL", "postgres://streamerio@127.0.0.1:1/streamerio?sslmode=disable")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	db, err := sqlx.Open("postgres", cfg.DatabaseURL) // 接続は最初のクエリまで張らない
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	a, err := newApp(context.Background(), cfg, db, redis.NewClient(&redis.Options{Addr: cfg.RedisURL}), logger)
+	if err != nil {
+		t.Fatalf("newApp: %v", err)
+	}
+	a.server.echo.GET("/slow", func(c echo.Context) error {
+		time.Sleep(slowRequestDelay)
+		return c.String(http.StatusOK, "done")
+	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.server.run(ctx); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func waitHTTP(t *testing.T, url string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if res, err := http.Get(url); err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("server did not become ready: %s", url)
+}
+
+// receiveType: 指定 type のメッセージが届くまで読み進める (ping などは読み飛ばす)
+func receiveType(t *testing.T, ws *websocket.Conn, msgType string) map[string]interface{} {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var raw string
+		if err := websocket.Message.Receive(ws, &raw); err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", raw, err)
+		}
+		if msg["type"] == msgType {
+			return msg
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package db: サーバに埋め込む DB スキーマ定義
+package db
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations: マイグレーション SQL (<version>_<name>.sql / <version>_<name>.down.sql) をルートに置いた FS
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		panic(err) // embed のパスは固定のため到達しない
+	}
+	return sub
+}
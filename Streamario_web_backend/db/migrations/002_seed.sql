@@ -1,4 +1,6 @@
 -- 002_seed.sql (idempotent seed)
+-- 追加した ENUM 値を同じファイル内で使うため、トランザクション外で1文ずつ実行する
+-- migrate:no-transaction
 
 -- 1. ENUM 値を不足分だけ追加
 DO $$
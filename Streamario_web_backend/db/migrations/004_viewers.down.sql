@@ -0,0 +1,3 @@
+-- 004_viewers.down.sql
+
+DROP TABLE IF EXISTS viewers;
@@ -0,0 +1,11 @@
+-- 005_event_catalog.sql : ルームごとのイベントカタログ対応
+-- ボタン種別はルームの settings.event_catalog で宣言されるため、
+-- ENUM による固定列挙をやめて TEXT に変更する（新ボタン追加時の ALTER TYPE を不要にする）。
+-- 巻き戻し不可: TEXT 化後は ENUM に無い種別を記録できるため、down は用意しない (migrate down は 006 までで止まる)。
+
+ALTER TABLE events ALTER COLUMN event_type TYPE TEXT USING event_type::text;
+ALTER TABLE game_events ALTER COLUMN event_type TYPE TEXT USING event_type::text;
+
+-- settings 未設定の既存ルームは空オブジェクトに揃える（NULL だと読み出し時に扱いづらい）
+UPDATE rooms SET settings = '{}'::jsonb WHERE settings IS NULL;
+ALTER TABLE rooms ALTER COLUMN settings SET DEFAULT '{}'::jsonb;
@@ -0,0 +1,7 @@
+-- 006_trigger_history.down.sql
+
+DROP INDEX IF EXISTS idx_game_events_room_sent;
+
+ALTER TABLE game_events DROP COLUMN IF EXISTS viewer_count;
+ALTER TABLE game_events DROP COLUMN IF EXISTS level;
+ALTER TABLE game_events DROP COLUMN IF EXISTS threshold;
@@ -0,0 +1,8 @@
+-- 006_trigger_history.sql : 発動履歴 (game_events) の記録項目を拡張
+
+ALTER TABLE game_events ADD COLUMN IF NOT EXISTS threshold INT NOT NULL DEFAULT 0;
+ALTER TABLE game_events ADD COLUMN IF NOT EXISTS level INT NOT NULL DEFAULT 1;
+ALTER TABLE game_events ADD COLUMN IF NOT EXISTS viewer_count INT NOT NULL DEFAULT 0;
+
+-- ルーム単位の時系列ページングと種別集計用
+CREATE INDEX IF NOT EXISTS idx_game_events_room_sent ON game_events (room_id, sent_at DESC, id DESC);
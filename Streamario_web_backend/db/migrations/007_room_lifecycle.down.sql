@@ -0,0 +1,20 @@
+-- 007_room_lifecycle.down.sql : 状態値を TEXT + CHECK 制約から ENUM (room_status) へ戻す
+-- 旧 ENUM に無い状態は近いものへ読み替える (running/paused → active, created/lobby → inactive)。
+
+ALTER TABLE rooms DROP CONSTRAINT IF EXISTS rooms_status_check;
+ALTER TABLE rooms ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE rooms ALTER COLUMN status DROP NOT NULL;
+
+UPDATE rooms SET status = 'active' WHERE status IN ('running', 'paused');
+UPDATE rooms SET status = 'inactive' WHERE status IN ('created', 'lobby');
+
+-- 001 の定義に 003 で追加した ended を含める
+CREATE TYPE room_status AS ENUM('active', 'inactive', 'expired', 'ended');
+ALTER TABLE rooms ALTER COLUMN status TYPE room_status USING status::room_status;
+ALTER TABLE rooms ALTER COLUMN status SET DEFAULT 'active';
+
+ALTER TABLE rooms DROP COLUMN IF EXISTS expired_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS resumed_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS paused_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS started_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS lobby_at;
@@ -0,0 +1,27 @@
+-- 007_room_lifecycle.sql : ルームのライフサイクル (created → lobby → running ⇄ paused → ended/expired)
+
+-- 状態値を ENUM から TEXT + CHECK 制約へ変更（ENUM への値追加は同一トランザクションで使えないため）
+ALTER TABLE rooms ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE rooms ALTER COLUMN status TYPE TEXT USING status::text;
+
+-- 旧ステータスを新しい状態へ読み替え
+UPDATE rooms SET status = 'running' WHERE status = 'active';
+UPDATE rooms SET status = 'lobby' WHERE status = 'inactive';
+UPDATE rooms SET status = 'created' WHERE status IS NULL;
+
+ALTER TABLE rooms ALTER COLUMN status SET NOT NULL;
+ALTER TABLE rooms ALTER COLUMN status SET DEFAULT 'created';
+ALTER TABLE rooms ADD CONSTRAINT rooms_status_check
+    CHECK (status IN ('created', 'lobby', 'running', 'paused', 'ended', 'expired'));
+
+-- 各状態へ遷移した時刻（paused/resumed は直近のもの）
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS lobby_at TIMESTAMP;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS started_at TIMESTAMP;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS resumed_at TIMESTAMP;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP;
+
+-- 既存の進行中ルームは作成時刻を開始時刻とみなす
+UPDATE rooms SET started_at = created_at WHERE status IN ('running', 'ended') AND started_at IS NULL;
+
+DROP TYPE IF EXISTS room_status;
@@ -0,0 +1,4 @@
+-- 008_room_expiry.down.sql
+
+DROP INDEX IF EXISTS idx_events_room_triggered;
+DROP INDEX IF EXISTS idx_rooms_open_expires;
@@ -0,0 +1,7 @@
+-- 008_room_expiry.sql : ルーム期限切れ/放置回収 (reaper) 向けインデックス
+
+-- 未終了ルームの期限検索
+CREATE INDEX IF NOT EXISTS idx_rooms_open_expires ON rooms (expires_at) WHERE status NOT IN ('ended', 'expired');
+
+-- ルームごとの最終押下時刻 (MAX(triggered_at)) 検索
+CREATE INDEX IF NOT EXISTS idx_events_room_triggered ON events (room_id, triggered_at DESC);
@@ -0,0 +1,5 @@
+-- 009_streamers.down.sql (配信者が所有していたルームの streamer_id はそのまま残る)
+
+DROP INDEX IF EXISTS idx_rooms_streamer_created;
+DROP TABLE IF EXISTS streamer_api_keys;
+DROP TABLE IF EXISTS streamers;
@@ -0,0 +1,24 @@
+-- 009_streamers.sql : 配信者アカウントと API キー (ルーム所有者の認証)
+
+CREATE TABLE IF NOT EXISTS streamers (
+    id VARCHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+-- API キー: 平文は発行時に一度だけ返し、SHA-256 ハッシュのみ保存する
+CREATE TABLE IF NOT EXISTS streamer_api_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    streamer_id VARCHAR(36) NOT NULL REFERENCES streamers(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    secret_hash BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_streamer_api_keys_streamer ON streamer_api_keys (streamer_id, created_at DESC);
+
+-- 配信者ごとの過去ルーム一覧 (rooms.streamer_id は旧来の匿名ルームでは 'unity' のまま)
+CREATE INDEX IF NOT EXISTS idx_rooms_streamer_created ON rooms (streamer_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- 010_event_type_check.down.sql (event_type_enum は 005 以降どの列にも使われていないため再作成しない)
+
+ALTER TABLE game_events DROP CONSTRAINT IF EXISTS game_events_event_type_check;
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_event_type_check;
@@ -0,0 +1,36 @@
+-- 010_event_type_check.sql : イベント種別を ENUM の固定列挙から TEXT + CHECK 制約へ
+-- 005 で列は TEXT 化済みだが値の制約が無く、使われなくなった event_type_enum が残っていた。
+-- 制約はカタログの種別 ID 検証 (internal/model/catalog.go の identPattern) と同じ形式にそろえる。
+-- 新しいボタン種別の追加にスキーマ変更は不要 (Unity のカタログ宣言だけで使える)。
+
+-- 既存データの正規化 (大文字/前後の空白を含む旧データを種別 ID の形式へ)
+UPDATE events SET event_type = lower(btrim(event_type)) WHERE event_type <> lower(btrim(event_type));
+UPDATE game_events SET event_type = lower(btrim(event_type)) WHERE event_type <> lower(btrim(event_type));
+
+-- 新規行には即座に適用し、既存行は検証できた場合のみ VALID にする
+-- (形式外の旧データが残っていても移行自体は止めない。残存行は NOTICE で件数を出す)
+ALTER TABLE events ADD CONSTRAINT events_event_type_check
+    CHECK (event_type ~ '^[a-z0-9][a-z0-9_-]{0,31}$') NOT VALID;
+ALTER TABLE game_events ADD CONSTRAINT game_events_event_type_check
+    CHECK (event_type ~ '^[a-z0-9][a-z0-9_-]{0,31}$') NOT VALID;
+
+DO $$
+DECLARE
+    invalid BIGINT;
+BEGIN
+    SELECT count(*) INTO invalid FROM events WHERE event_type !~ '^[a-z0-9][a-z0-9_-]{0,31}$';
+    IF invalid = 0 THEN
+        ALTER TABLE events VALIDATE CONSTRAINT events_event_type_check;
+    ELSE
+        RAISE NOTICE 'events: % rows with legacy event_type left unvalidated', invalid;
+    END IF;
+
+    SELECT count(*) INTO invalid FROM game_events WHERE event_type !~ '^[a-z0-9][a-z0-9_-]{0,31}$';
+    IF invalid = 0 THEN
+        ALTER TABLE game_events VALIDATE CONSTRAINT game_events_event_type_check;
+    ELSE
+        RAISE NOTICE 'game_events: % rows with legacy event_type left unvalidated', invalid;
+    END IF;
+END$$;
+
+DROP TYPE IF EXISTS event_type_enum;
@@ -0,0 +1,10 @@
+-- 011_event_press_count.down.sql : 集約行を1押下1行へ展開してから press_count を削除
+
+INSERT INTO events (room_id, viewer_id, event_type, triggered_at, metadata)
+SELECT e.room_id, e.viewer_id, e.event_type, e.triggered_at, e.metadata
+FROM events e
+CROSS JOIN LATERAL generate_series(2, e.press_count)
+WHERE e.press_count > 1;
+
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_press_count_check;
+ALTER TABLE events DROP COLUMN IF EXISTS press_count;
@@ -0,0 +1,23 @@
+-- 011_event_press_count.sql : 押下を1クリック1行ではなく、押下数 (press_count) 付きの集約行で記録する
+-- 1回の送信分 (push_count) を1行にまとめ、集計は COUNT(*) ではなく SUM(press_count) で行う。
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS press_count INT NOT NULL DEFAULT 1;
+ALTER TABLE events ADD CONSTRAINT events_press_count_check CHECK (press_count > 0);
+
+-- 既存行の圧縮: ルーム・視聴者・種別・時刻・metadata が同じ行を最小 id の1行にまとめる
+-- (旧実装は1回の送信分を同じ時刻の行として一括挿入していたため、送信単位の行に戻る)
+WITH grouped AS (
+    SELECT id,
+           min(id) OVER w AS keep_id,
+           count(*) OVER w AS presses
+    FROM events
+    WINDOW w AS (PARTITION BY room_id, viewer_id, event_type, triggered_at, metadata)
+), merged AS (
+    UPDATE events e
+    SET press_count = g.presses
+    FROM grouped g
+    WHERE e.id = g.id AND g.id = g.keep_id AND g.presses > 1
+)
+DELETE FROM events e
+USING grouped g
+WHERE e.id = g.id AND g.id <> g.keep_id;
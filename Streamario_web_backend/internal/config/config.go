@@ -1,21 +1,85 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/tracing"
+	"streamerrio-backend/pkg/viewertoken"
 )
 
+// defaultJoinBaseURL: JOIN_BASE_URL / FRONTEND_URL とも未指定時の視聴者ページ
+const defaultJoinBaseURL = "https://streamerio.vercel.app"
+
 // Config: アプリケーション全体の設定値コンテナ
 // 取得元は基本的に環境変数。存在しない項目はデフォルトを適用。
 type Config struct {
-	Port         string // APIサーバ待受ポート
-	FrontendURL  string // CORS 許可先 ("*" は全許可)
-	DatabaseURL  string // PostgreSQL 接続 DSN or URL
-	RedisURL     string // Redis アドレス (host:port)
-	LogLevel     string // ログレベル (debug/info/warn/error)
-	LogFormat    string // ログ出力フォーマット (text/json)
-	LogAddSource bool   // ログに呼び出し元を付与するか
+	AppEnv        string // 実行環境 (production / development)。development 以外では必須の秘密情報が無いと起動しない
+	Port          string // APIサーバ待受ポート
+	FrontendURL   string // CORS 許可先 ("*" は全許可)
+	JoinBaseURL   string // 視聴者ページのベース URL (参加 URL / QR の生成元)
+	DatabaseURL   string // PostgreSQL 接続 DSN or URL
+	DBAutoMigrate bool   // 起動時に未適用のマイグレーションを適用するか
+	RedisURL      string // Redis アドレス (host:port)
+	LogLevel      string // ログレベル (debug/info/warn/error)
+	LogFormat     string // ログ出力フォーマット (text/json)
+	LogAddSource  bool   // ログに呼び出し元を付与するか
+
+	RoomAutoStart      bool          // Unity 接続時に lobby → running へ自動遷移するか (game_start 非対応クライアント向け)
+	RoomTTL            time.Duration // ルーム作成から期限切れまでの時間 (0 で無期限)
+	RoomIdleTimeout    time.Duration // 押下/状態変化が無いルームを放置とみなすまでの時間 (0 で無効)
+	RoomReaperInterval time.Duration // 期限切れ/放置ルームの回収間隔
+
+	InstanceID     string        // このプロセスの識別子 (WebSocket 所有レジストリ / インスタンス宛てチャネルで使用)
+	WSOwnershipTTL time.Duration // Unity 接続所有エントリの TTL (ハートビートは TTL/3 間隔)
+
+	WSPingInterval  time.Duration // Unity への ping 間隔
+	WSPongWait      time.Duration // この時間 Unity から受信 (v1 は ping 制御フレームへの pong を含む) が無ければ切断
+	WSWriteWait     time.Duration // 1メッセージの書き込み期限
+	WSSendQueueSize int           // 接続ごとの送信キュー長 (溢れたら切断)
+
+	ViewerStatsInterval time.Duration // 視聴者向け統計スナップショットの最小発行間隔 (ルームごと)
+
+	RateLimitViewer      model.RateLimit // 押下の既定レート制限 (視聴者ごと / "rate:burst" 形式)
+	RateLimitIP          model.RateLimit // 押下の既定レート制限 (IP ごと)
+	RateLimitRoom        model.RateLimit // 押下の既定レート制限 (ルーム全体)
+	AbuseIntervalSamples int             // 押下間隔の判定に使う直近の間隔数
+	AbuseIntervalMaxCV   float64         // 押下間隔の変動係数がこれ未満なら機械的とみなす (0 で無効)
+	AbuseIPViewerLimit   int             // 1 IP から窓内に押下した視聴者 ID の上限 (超過でフラグ / 0 で無効)
+	AbuseIPViewerWindow  time.Duration   // 同一 IP の視聴者を数える窓
+	AbuseReducedWeight   float64         // reduce フラグ付き視聴者の押下に掛ける重み (0..1)
+	AbuseFlagTTL         time.Duration   // 不正フラグの有効期間 (0 ならルーム終了まで)
+
+	ViewerTokenKeys     []viewertoken.Key // 視聴者トークンの署名鍵 (先頭で署名し、残りは検証のみ / サーバ起動時は development のみ空を許し、起動ごとに一時鍵を生成)
+	ViewerTokenTTL      time.Duration     // 視聴者トークンの有効期間 (半分を過ぎたら /get_viewer_id で再発行)
+	ViewerTokenRequired bool              // true: トークン無しで viewer_id を名乗るリクエストを拒否 (旧クライアント移行後に有効化)
+
+	StreamerAuthRequired bool          // true: 資格情報の無い Unity 接続を拒否 (false なら匿名ルームとして受け入れ)
+	StreamerConnTokenTTL time.Duration // Unity 接続トークンの有効期間 (発行から接続まで)
+
+	ShutdownTimeout    time.Duration // SIGTERM/SIGINT 受信から停止処理 (接続の整理・書き出し・クローズ) を打ち切るまでの期限
+	HealthCheckTimeout time.Duration // /healthz・/readyz の確認1件あたりの期限
+	DBQueryTimeout     time.Duration // DB クエリ1件あたりの期限 (リクエストの期限が先に来ればそちらで打ち切る)
+	RedisOpTimeout     time.Duration // カウンタ / レート制限の Redis 操作1件あたりの期限
+
+	EventWriteBehind    bool          // true: 押下イベントをメモリに溜めてまとめて書き込む (false なら押下ごとに同期 INSERT)
+	EventBatchSize      int           // 1回の INSERT にまとめる最大件数
+	EventFlushInterval  time.Duration // 件数に満たなくても書き出す間隔
+	EventQueueSize      int           // 書き込み待ちの上限 (超えると押下を待たせる)
+	EventEnqueueTimeout time.Duration // 書き込み待ちの空きを待つ上限 (超えたら 503)
+	EventFlushRetries   int           // 書き込み失敗時の再試行回数
+
+	MetricsToken string // /metrics に必要な Bearer トークン (空なら認証なし)
+	AdminToken   string // 運用者向けエンドポイント (配信者作成 / 接続一覧) に必要な Bearer トークン (空なら無効)
+
+	TracesExporter string // トレースの出力先 (none / otlp / stdout)。OTLP の送信先やサンプリングは標準の OTEL_* 環境変数で指定
 }
 
 // Load: 環境変数から設定を組み立て (不足はデフォルト補完)
@@ -26,12 +90,47 @@ type Config struct {
 func Load() (*Config, error) {
 	cfg := &Config{}
 
+	// Environment
+	cfg.AppEnv = strings.ToLower(getEnv("APP_ENV", "production"))
+
 	// Port
 	cfg.Port = getEnv("PORT", "8888")
 
+	// Graceful shutdown (Cloud Run は SIGTERM から 10 秒後に強制終了するため既定はそれより短くする)
+	cfg.ShutdownTimeout = getEnvDuration("SHUTDOWN_TIMEOUT", 8*time.Second)
+	if cfg.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("SHUTDOWN_TIMEOUT must be positive")
+	}
+	cfg.HealthCheckTimeout = getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	if cfg.HealthCheckTimeout <= 0 {
+		return nil, fmt.Errorf("HEALTH_CHECK_TIMEOUT must be positive")
+	}
+
+	// Metrics
+	cfg.MetricsToken = os.Getenv("METRICS_TOKEN")
+
+	// Admin
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	// Tracing
+	cfg.TracesExporter = strings.ToLower(getEnv("OTEL_TRACES_EXPORTER", tracing.ExporterNone))
+	if !tracing.ValidExporter(cfg.TracesExporter) {
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER must be one of none, otlp, stdout: %q", cfg.TracesExporter)
+	}
+
 	// Frontend (CORS)
 	cfg.FrontendURL = getEnv("FRONTEND_URL", "*")
 
+	// Viewer join URL (未指定なら FRONTEND_URL、それも "*" なら公開中のフロントエンド)
+	joinBase := cfg.FrontendURL
+	if joinBase == "*" {
+		joinBase = defaultJoinBaseURL
+	}
+	cfg.JoinBaseURL = getEnv("JOIN_BASE_URL", joinBase)
+	if u, err := url.Parse(cfg.JoinBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("JOIN_BASE_URL must be an absolute http(s) URL: %q", cfg.JoinBaseURL)
+	}
+
 	// Database URL (Supabase/Postgres)
 	// 優先順:
 	//  1. DATABASE_URL（Supabase推奨: ダッシュボードの接続文字列）
@@ -54,6 +153,35 @@ func Load() (*Config, error) {
 		)
 	}
 
+	cfg.DBAutoMigrate = getEnvBool("DB_AUTO_MIGRATE", true)
+
+	// 1操作あたりの期限 (クライアント切断時はリクエストの context で、応答の無い依存先はこの期限で打ち切る)
+	cfg.DBQueryTimeout = getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second)
+	cfg.RedisOpTimeout = getEnvDuration("REDIS_OP_TIMEOUT", 2*time.Second)
+	if cfg.DBQueryTimeout <= 0 || cfg.RedisOpTimeout <= 0 {
+		return nil, fmt.Errorf("DB_QUERY_TIMEOUT and REDIS_OP_TIMEOUT must be positive")
+	}
+
+	// 押下イベントの書き込み (write-behind)
+	cfg.EventWriteBehind = getEnvBool("EVENT_WRITE_BEHIND", true)
+	cfg.EventBatchSize = getEnvInt("EVENT_BATCH_SIZE", 500)
+	cfg.EventFlushInterval = getEnvDuration("EVENT_FLUSH_INTERVAL", 250*time.Millisecond)
+	cfg.EventQueueSize = getEnvInt("EVENT_QUEUE_SIZE", 50000)
+	cfg.EventEnqueueTimeout = getEnvDuration("EVENT_ENQUEUE_TIMEOUT", time.Second)
+	cfg.EventFlushRetries = getEnvInt("EVENT_FLUSH_RETRIES", 5)
+	if cfg.EventBatchSize <= 0 || cfg.EventBatchSize > 10922 {
+		return nil, fmt.Errorf("EVENT_BATCH_SIZE must be between 1 and 10922")
+	}
+	if cfg.EventFlushInterval <= 0 || cfg.EventEnqueueTimeout <= 0 {
+		return nil, fmt.Errorf("EVENT_FLUSH_INTERVAL and EVENT_ENQUEUE_TIMEOUT must be positive")
+	}
+	if cfg.EventQueueSize < cfg.EventBatchSize {
+		return nil, fmt.Errorf("EVENT_QUEUE_SIZE must be at least EVENT_BATCH_SIZE")
+	}
+	if cfg.EventFlushRetries < 0 {
+		return nil, fmt.Errorf("EVENT_FLUSH_RETRIES must not be negative")
+	}
+
 	// Redis URL (addr only)
 	if rurl := os.Getenv("REDIS_URL"); rurl != "" {
 		cfg.RedisURL = rurl
@@ -68,9 +196,95 @@ func Load() (*Config, error) {
 	cfg.LogFormat = getEnv("LOG_FORMAT", "text")
 	cfg.LogAddSource = getEnvBool("LOG_ADD_SOURCE", false)
 
+	// Room lifecycle
+	cfg.RoomAutoStart = getEnvBool("ROOM_AUTO_START", true)
+	cfg.RoomTTL = getEnvDuration("ROOM_TTL", 6*time.Hour)
+	cfg.RoomIdleTimeout = getEnvDuration("ROOM_IDLE_TIMEOUT", 30*time.Minute)
+	cfg.RoomReaperInterval = getEnvDuration("ROOM_REAPER_INTERVAL", time.Minute)
+	if cfg.RoomReaperInterval <= 0 {
+		return nil, fmt.Errorf("ROOM_REAPER_INTERVAL must be positive")
+	}
+
+	// Multi-instance
+	cfg.InstanceID = getEnv("INSTANCE_ID", defaultInstanceID())
+	cfg.WSOwnershipTTL = getEnvDuration("WS_OWNERSHIP_TTL", 30*time.Second)
+	if cfg.WSOwnershipTTL < 3*time.Second {
+		return nil, fmt.Errorf("WS_OWNERSHIP_TTL must be at least 3s")
+	}
+
+	// Unity socket liveness
+	cfg.WSPingInterval = getEnvDuration("WS_PING_INTERVAL", 15*time.Second)
+	cfg.WSPongWait = getEnvDuration("WS_PONG_WAIT", 45*time.Second)
+	cfg.WSWriteWait = getEnvDuration("WS_WRITE_WAIT", 10*time.Second)
+	cfg.WSSendQueueSize = getEnvInt("WS_SEND_QUEUE", 256)
+	if cfg.WSPingInterval <= 0 || cfg.WSWriteWait <= 0 || cfg.WSSendQueueSize <= 0 {
+		return nil, fmt.Errorf("WS_PING_INTERVAL, WS_WRITE_WAIT and WS_SEND_QUEUE must be positive")
+	}
+	if cfg.WSPongWait <= cfg.WSPingInterval {
+		return nil, fmt.Errorf("WS_PONG_WAIT must be longer than WS_PING_INTERVAL")
+	}
+
+	// Viewer live stream
+	cfg.ViewerStatsInterval = getEnvDuration("VIEWER_STATS_INTERVAL", 500*time.Millisecond)
+
+	// Rate limiting / anti-abuse
+	var err error
+	if cfg.RateLimitViewer, err = getEnvRateLimit("RATE_LIMIT_VIEWER", model.RateLimit{Rate: 15, Burst: 30}); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitIP, err = getEnvRateLimit("RATE_LIMIT_IP", model.RateLimit{Rate: 60, Burst: 120}); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitRoom, err = getEnvRateLimit("RATE_LIMIT_ROOM", model.RateLimit{Rate: 1000, Burst: 2000}); err != nil {
+		return nil, err
+	}
+	cfg.AbuseIntervalSamples = getEnvInt("ABUSE_INTERVAL_SAMPLES", 12)
+	cfg.AbuseIntervalMaxCV = getEnvFloat("ABUSE_INTERVAL_MAX_CV", 0.05)
+	cfg.AbuseIPViewerLimit = getEnvInt("ABUSE_IP_VIEWER_LIMIT", 8)
+	cfg.AbuseIPViewerWindow = getEnvDuration("ABUSE_IP_VIEWER_WINDOW", 10*time.Minute)
+	cfg.AbuseReducedWeight = getEnvFloat("ABUSE_REDUCED_WEIGHT", 0.25)
+	cfg.AbuseFlagTTL = getEnvDuration("ABUSE_FLAG_TTL", 10*time.Minute)
+	if cfg.AbuseIntervalSamples < 2 {
+		return nil, fmt.Errorf("ABUSE_INTERVAL_SAMPLES must be at least 2")
+	}
+	if cfg.AbuseReducedWeight < 0 || cfg.AbuseReducedWeight > 1 {
+		return nil, fmt.Errorf("ABUSE_REDUCED_WEIGHT must be between 0 and 1")
+	}
+	if cfg.AbuseFlagTTL < 0 {
+		return nil, fmt.Errorf("ABUSE_FLAG_TTL must not be negative")
+	}
+
+	// Viewer identity tokens
+	if cfg.ViewerTokenKeys, err = viewertoken.ParseKeys(os.Getenv("VIEWER_TOKEN_KEYS")); err != nil {
+		return nil, fmt.Errorf("VIEWER_TOKEN_KEYS: %w", err)
+	}
+	cfg.ViewerTokenTTL = getEnvDuration("VIEWER_TOKEN_TTL", 30*24*time.Hour)
+	cfg.ViewerTokenRequired = getEnvBool("VIEWER_TOKEN_REQUIRED", false)
+
+	// Streamer accounts
+	cfg.StreamerAuthRequired = getEnvBool("STREAMER_AUTH_REQUIRED", false)
+	cfg.StreamerConnTokenTTL = getEnvDuration("STREAMER_CONN_TOKEN_TTL", 2*time.Minute)
+	if cfg.StreamerConnTokenTTL <= 0 {
+		return nil, fmt.Errorf("STREAMER_CONN_TOKEN_TTL must be positive")
+	}
+
 	return cfg, nil
 }
 
+// CheckServe: API サーバの起動にだけ必要な設定を確認 (`server migrate` では確認しないため、鍵の設定前でもマイグレーションできる)
+func (c *Config) CheckServe() error {
+	if len(c.ViewerTokenKeys) == 0 && !c.IsDevelopment() {
+		// 一時鍵ではインスタンスごとに署名鍵が異なり、再起動で全視聴者のトークンが無効になる
+		return fmt.Errorf("VIEWER_TOKEN_KEYS is required unless APP_ENV=development")
+	}
+	return nil
+}
+
+// IsDevelopment: 開発環境か (APP_ENV=development / dev)
+func (c *Config) IsDevelopment() bool {
+	return c.AppEnv == "development" || c.AppEnv == "dev"
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -89,3 +303,61 @@ func getEnvBool(key string, def bool) bool {
 	}
 	return def
 }
+
+// getEnvInt: 整数値を取得 (不正値はデフォルト)
+func getEnvInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// getEnvFloat: 小数値を取得 (不正値はデフォルト)
+func getEnvFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// getEnvRateLimit: "rate:burst" 形式 (例: "15:30" = 毎秒15回・連続30回まで) のレート制限を取得
+func getEnvRateLimit(key string, def model.RateLimit) (model.RateLimit, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	rate, burst, ok := strings.Cut(v, ":")
+	r, rerr := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+	b, berr := strconv.ParseInt(strings.TrimSpace(burst), 10, 64)
+	if !ok || rerr != nil || berr != nil || r <= 0 || b < 1 {
+		return def, fmt.Errorf("%s must be \"rate:burst\" with rate > 0 and burst >= 1, got %q", key, v)
+	}
+	return model.RateLimit{Rate: r, Burst: b}, nil
+}
+
+// getEnvDuration: time.ParseDuration 形式 (例: "6h", "90s") の値を取得 (不正値はデフォルト)
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+// defaultInstanceID: ホスト名 + ランダム接尾辞 (同一ホストでの複数起動や再起動でも衝突しない)
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "instance"
+	}
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return host
+	}
+	return host + "-" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad_ViewerTokenKeysCheckedOnlyForServe(t *testing.T) {
+	t.Setenv("VIEWER_TOKEN_KEYS", "")
+	tests := []struct {
+		name    string
+		appEnv  string
+		keys    string
+		wantErr bool
+	}{
+		{"production without keys", "production", "", true},
+		{"production with keys", "production", "k1:" + strings.Repeat("s", 32), false},
+		{"development without keys", "development", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tc.appEnv)
+			t.Setenv("VIEWER_TOKEN_KEYS", tc.keys)
+			// 鍵が無くても設定は読める (`server migrate` は鍵の設定前でも動く)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if err := cfg.CheckServe(); (err != nil) != tc.wantErr {
+				t.Fatalf("CheckServe err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminAuth: 運用者向けエンドポイントを Authorization: Bearer <token> で限定する
+// MetricsAuth と違い token 空なら素通しにせず 403 で閉じる (配信者の作成や全ルームの一覧を公開しないため)。
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if token == "" {
+			return func(c echo.Context) error {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "admin endpoints disabled"})
+			}
+		}
+		return func(c echo.Context) error {
+			if subtle.ConstantTimeCompare([]byte(bearerToken(c.Request())), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "admin token required"})
+			}
+			return next(c)
+		}
+	}
+}
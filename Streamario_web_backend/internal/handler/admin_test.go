@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAdminAuth(t *testing.T) {
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"disabled without token", "", "Bearer anything", http.StatusForbidden},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusNoContent},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/clients", nil)
+			if tc.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			if err := AdminAuth(tc.token)(ok)(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"streamerrio-backend/internal/model"
 	"streamerrio-backend/internal/service"
+	"streamerrio-backend/pkg/viewertoken"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,48 +19,102 @@ type APIHandler struct {
 	eventService   *service.EventService
 	sessionService *service.GameSessionService
 	viewerService  *service.ViewerService
+	catalogService *service.CatalogService
+	pressGuard     *service.PressGuard  // 押下のレート制限/不正検知 (nil なら無効)
+	joinService    *service.JoinService // 参加 URL / QR の生成
+
+	viewerTokens        *viewertoken.Signer // 視聴者トークンの発行/検証
+	viewerTokenRequired bool                // true: トークン無しで viewer_id を名乗るリクエストを拒否
 }
 
 // NewAPIHandler: 依存するサービスを束ねて構築
-func NewAPIHandler(roomService *service.RoomService, eventService *service.EventService, sessionService *service.GameSessionService, viewerService *service.ViewerService) *APIHandler {
-	return &APIHandler{roomService: roomService, eventService: eventService, sessionService: sessionService, viewerService: viewerService}
+func NewAPIHandler(roomService *service.RoomService, eventService *service.EventService, sessionService *service.GameSessionService, viewerService *service.ViewerService, catalogService *service.CatalogService) *APIHandler {
+	return &APIHandler{roomService: roomService, eventService: eventService, sessionService: sessionService, viewerService: viewerService, catalogService: catalogService}
+}
+
+// SetPressGuard: 押下のレート制限/不正検知を注入
+func (h *APIHandler) SetPressGuard(g *service.PressGuard) { h.pressGuard = g }
+
+// SetJoinService: 参加 URL / QR 生成サービスを注入
+func (h *APIHandler) SetJoinService(js *service.JoinService) { h.joinService = js }
+
+// SetViewerTokens: 視聴者トークンの署名器を注入 (required=true で旧形式の viewer_id を受け付けない)
+func (h *APIHandler) SetViewerTokens(signer *viewertoken.Signer, required bool) {
+	h.viewerTokens = signer
+	h.viewerTokenRequired = required
 }
 
-// GetOrCreateViewerID: 視聴者端末識別用の ID を払い出す
+// GetOrCreateViewerID: 視聴者端末識別用の ID を払い出し、署名付きトークンを発行する
+// 有効なトークンがあればその ID を使い続け、旧鍵で署名されている/期限が近い場合のみ再発行する。
+// 旧 viewer_id Cookie から引き継いだ ID には Legacy の印を付けて発行する (サーバ生成の ID とは区別する)。
+// トークンは HttpOnly Cookie に加えて本文でも返す (Cookie を使えないクライアントは Authorization: Bearer で送る)。
 func (h *APIHandler) GetOrCreateViewerID(c echo.Context) error {
-	var existing string
-	if cookie, err := c.Cookie("viewer_id"); err == nil {
-		existing = cookie.Value
+	ctx := c.Request().Context()
+	claims, verified := viewertoken.FromContext(c.Request().Context())
+	var existing, legacyID string
+	switch {
+	case verified:
+		existing = claims.ViewerID
+	case !h.viewerTokenRequired:
+		// 移行期間: 旧 Cookie の ID を引き継いでトークン化する (署名が無いため Legacy の印を付ける)
+		if cookie, err := c.Cookie(legacyViewerIDCookie); err == nil && cookie.Value != "" {
+			existing = cookie.Value
+			legacyID = cookie.Value
+		}
 	}
-	viewerID, err := h.viewerService.EnsureViewerID(existing)
+	viewerID, err := h.viewerService.EnsureViewerID(ctx, existing)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	viewer, err := h.viewerService.GetViewer(viewerID)
+	viewer, err := h.viewerService.GetViewer(ctx, viewerID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	// クロスサイト（フロント: vercel.app, バックエンド: Cloud Run）で
-	// Cookie を送受信できるように SameSite=None; Secure を指定する。
-	// NOTE: Secure=true は HTTPS 前提。本番環境（Cloud Run/Vercel）は HTTPS なので問題なし。
-	cookie := &http.Cookie{
-		Name:     "viewer_id",
-		Value:    viewerID,
-		Path:     "/",
-		MaxAge:   365 * 24 * 60 * 60,
-		Secure:   true,
-		HttpOnly: false,
-		SameSite: http.SameSiteNoneMode,
-	}
-	c.SetCookie(cookie)
+
+	token := ""
+	expiresAt := claims.ExpiresAt
+	if !verified || claims.ViewerID != viewerID || h.viewerTokens.NeedsRefresh(claims) {
+		issue := h.viewerTokens.Issue
+		if viewerID == legacyID || (verified && claims.Legacy && claims.ViewerID == viewerID) {
+			// 旧 Cookie 由来の ID は再発行しても印を残す (VIEWER_TOKEN_REQUIRED 有効化後は拒否される)
+			issue = h.viewerTokens.IssueLegacy
+		}
+		var issued viewertoken.Claims
+		token, issued, err = issue(viewerID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		expiresAt = issued.ExpiresAt
+		// クロスサイト（フロント: vercel.app, バックエンド: Cloud Run）で
+		// Cookie を送受信できるように SameSite=None; Secure を指定する。
+		// NOTE: Secure=true は HTTPS 前提。本番環境（Cloud Run/Vercel）は HTTPS なので問題なし。
+		c.SetCookie(&http.Cookie{
+			Name:     viewerTokenCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(h.viewerTokens.TTL().Seconds()),
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteNoneMode,
+		})
+		// 旧 Cookie は破棄 (署名が無く、他人の ID に書き換えられるため)
+		if _, err := c.Cookie(legacyViewerIDCookie); err == nil {
+			c.SetCookie(&http.Cookie{Name: legacyViewerIDCookie, Path: "/", MaxAge: -1, Secure: true, SameSite: http.SameSiteNoneMode})
+		}
+	}
 	var name interface{}
 	if viewer != nil && viewer.Name != nil {
 		name = *viewer.Name
 	}
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"viewer_id": viewerID,
-		"name":      name,
-	})
+	resp := map[string]interface{}{
+		"viewer_id":  viewerID,
+		"name":       name,
+		"expires_at": expiresAt,
+	}
+	if token != "" {
+		resp["token"] = token
+	}
+	return c.JSON(http.StatusOK, resp)
 }
 
 // SetViewerName: 視聴者名を登録/更新する
@@ -69,7 +126,11 @@ func (h *APIHandler) SetViewerName(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
 	}
-	viewer, err := h.viewerService.SetViewerName(req.ViewerID, req.Name)
+	viewerID, err := h.resolveViewerID(c, req.ViewerID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	viewer, err := h.viewerService.SetViewerName(c.Request().Context(), viewerID, req.Name)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
@@ -86,17 +147,60 @@ func (h *APIHandler) SetViewerName(c echo.Context) error {
 // GetRoom: ルーム情報取得 (存在しない場合 404)
 func (h *APIHandler) GetRoom(c echo.Context) error {
 	id := c.Param("id")
-	room, err := h.roomService.GetRoom(id)
+	room, err := h.roomService.GetRoom(c.Request().Context(), id)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
 	}
 	return c.JSON(http.StatusOK, room)
 }
 
+// GetRoomQR: ルームの参加 URL の QR を PNG で返す (OBS のブラウザソース/画像ソースから直接埋め込む用途)
+// ?size=ピクセル数 (64..1024, 既定512)
+func (h *APIHandler) GetRoomQR(c echo.Context) error {
+	if h.joinService == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "qr not available"})
+	}
+	size := service.DefaultQRSize
+	if raw := c.QueryParam("size"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid size"})
+		}
+		size = v
+	}
+	png, err := h.joinService.QRPNG(c.Request().Context(), c.Param("id"), size)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
+	}
+	// URL はルーム ID から決まるため内容は変わらない (期限切れ後は 404 になる)
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.Blob(http.StatusOK, "image/png", png)
+}
+
+// ResolveJoinCode: 参加コードからルームを引く (GET /api/join/:code / 小文字・ハイフン・空白は無視)
+func (h *APIHandler) ResolveJoinCode(c echo.Context) error {
+	if h.joinService == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "join code not found"})
+	}
+	room, err := h.joinService.Resolve(c.Request().Context(), c.Param("code"))
+	if errors.Is(err, service.ErrJoinCodeNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id":  room.ID,
+		"status":   room.Status,
+		"join_url": h.joinService.JoinURL(room.ID),
+	})
+}
+
 // SendEvent: イベントを受信し閾値チェックまで実施
 func (h *APIHandler) SendEvent(c echo.Context) error {
+	ctx := c.Request().Context()
 	roomID := c.Param("id")
-	room, err := h.roomService.GetRoom(roomID)
+	room, err := h.roomService.GetRoom(ctx, roomID)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
 	}
@@ -108,24 +212,27 @@ func (h *APIHandler) SendEvent(c echo.Context) error {
 
 	var req struct {
 		EventType  string      `json:"event_type"`
-		ViewerID   string      `json:"viewer_id"`
+		ViewerID   string      `json:"viewer_id"` // Deprecated: 視聴者トークンを使う
 		PushEvents []PushEvent `json:"push_events"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
 	}
+	if req.ViewerID, err = h.resolveViewerID(c, req.ViewerID); err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
 
 	var viewerID *string
 	if req.ViewerID != "" {
 		viewerID = &req.ViewerID
 	}
 
-	if room.Status == "ended" {
+	if room.Status == model.RoomStatusEnded {
 		if viewerID == nil {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "viewer_id is required after game end"})
 		}
-		summary, err := h.sessionService.GetViewerSummary(roomID, *viewerID)
+		summary, err := h.sessionService.GetViewerSummary(ctx, roomID, *viewerID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
@@ -135,9 +242,21 @@ func (h *APIHandler) SendEvent(c echo.Context) error {
 		})
 	}
 
+	// ゲーム進行中 (running) 以外の押下は受け付けない（開始前・一時停止中）
+	if room.Status != model.RoomStatusRunning {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":  "room is not running",
+			"status": room.Status,
+		})
+	}
+
 	// PushCount合計のバリデーション（連打攻撃防止）
+	// 0 以下は受け付けない (負の押下数でバケットを素通りしてカウントを減らせてしまう)
 	totalPushCount := int64(0)
 	for _, event := range req.PushEvents {
+		if event.PushCount <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "push_count must be positive"})
+		}
 		totalPushCount += event.PushCount
 	}
 	if totalPushCount > 20 {
@@ -150,8 +269,18 @@ func (h *APIHandler) SendEvent(c echo.Context) error {
 		defaultEventType = model.EventType(req.EventType)
 	}
 
+	// 押下パターンの記録と不正検知 (リクエスト単位)
+	press := service.PressRequest{RoomID: roomID, ViewerID: req.ViewerID, IP: c.RealIP(), Presses: totalPushCount, At: time.Now()}
+	var flag *model.ViewerFlag
+	if h.pressGuard != nil {
+		if flag, err = h.pressGuard.Inspect(ctx, press); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
 	// ProcessEventの戻り値を格納する配列
 	var eventResults []*model.EventResult
+	accepted, retryAfterMs := int64(0), int64(0)
 
 	for _, event := range req.PushEvents {
 		eventType := defaultEventType
@@ -164,15 +293,65 @@ func (h *APIHandler) SendEvent(c echo.Context) error {
 
 		pushCount := event.PushCount
 
-		res, err := h.eventService.ProcessEvent(roomID, eventType, pushCount, viewerID)
+		// レート制限/フラグに応じて反映する押下数を決定
+		var decision *model.PressDecision
+		if h.pressGuard != nil {
+			cfg, err := h.catalogService.Resolve(ctx, roomID, eventType)
+			if errors.Is(err, service.ErrUnknownEventType) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			if decision, err = h.pressGuard.Admit(ctx, press, cfg, pushCount, flag); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			pushCount = decision.Accepted
+			retryAfterMs = max(retryAfterMs, decision.RetryAfterMs)
+			if pushCount <= 0 && event.PushCount > 0 {
+				eventResults = append(eventResults, &model.EventResult{EventType: eventType, Moderation: decision})
+				continue
+			}
+		}
+		accepted += pushCount
+
+		res, err := h.eventService.ProcessEvent(c.Request().Context(), roomID, eventType, pushCount, viewerID)
+		if errors.Is(err, service.ErrUnknownEventType) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrEventBacklogged) {
+			// 記録が追いつくまで押下を受け付けない (クライアントは少し待って再送する)
+			c.Response().Header().Set("Retry-After", "1")
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		}
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
+		res.Moderation = decision
 
 		// 結果を配列に追加
 		eventResults = append(eventResults, res)
 	}
 
+	// 1件も受理されなかった場合: フラグによる拒否は 403、レート超過は 429 (Retry-After 付き)
+	if accepted == 0 && totalPushCount > 0 && h.pressGuard != nil {
+		if flag != nil && flag.Action == model.PressReject {
+			return c.JSON(http.StatusForbidden, map[string]interface{}{
+				"error":         "viewer is flagged",
+				"flag":          flag,
+				"event_results": eventResults,
+			})
+		}
+		if retryAfterMs > 0 {
+			c.Response().Header().Set("Retry-After", strconv.FormatInt((retryAfterMs+999)/1000, 10))
+			return c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+				"error":          "rate limited",
+				"retry_after_ms": retryAfterMs,
+				"event_results":  eventResults,
+			})
+		}
+	}
+
 	// 配列として結果を返す
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"event_results": eventResults,
@@ -181,11 +360,12 @@ func (h *APIHandler) SendEvent(c echo.Context) error {
 
 // GetRoomStats: 現在のイベント種別ごとのカウントと閾値を返す
 func (h *APIHandler) GetRoomStats(c echo.Context) error {
+	ctx := c.Request().Context()
 	roomID := c.Param("id")
-	if _, err := h.roomService.GetRoom(roomID); err != nil {
+	if _, err := h.roomService.GetRoom(ctx, roomID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
 	}
-	stats, err := h.eventService.GetRoomStats(roomID)
+	stats, err := h.eventService.GetRoomStats(ctx, roomID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -196,34 +376,100 @@ func (h *APIHandler) GetRoomStats(c echo.Context) error {
 	})
 }
 
-// GetRoomResult: 終了後の集計結果を取得
+// GetRoomTriggers: 閾値到達による発動履歴をページングして返す (期限切れ・終了後も参照できる)
+// クエリ: limit (既定50, 最大200) / offset / event_type (任意)
+func (h *APIHandler) GetRoomTriggers(c echo.Context) error {
+	ctx := c.Request().Context()
+	roomID := c.Param("id")
+	if _, err := h.roomService.FindRoom(ctx, roomID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid offset"})
+	}
+	history, err := h.eventService.ListTriggers(ctx, roomID, model.EventType(c.QueryParam("event_type")), limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id":     roomID,
+		"triggers":    history.Triggers,
+		"totals":      history.Totals,
+		"limit":       history.Limit,
+		"offset":      history.Offset,
+		"next_offset": history.NextOffset,
+	})
+}
+
+// queryInt: 整数クエリパラメータを取得 (未指定は 0)
+func queryInt(c echo.Context, name string) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// GetRoomCatalog: ルームで使用できるボタン定義 (イベントカタログ) を返す
+func (h *APIHandler) GetRoomCatalog(c echo.Context) error {
+	ctx := c.Request().Context()
+	roomID := c.Param("id")
+	if _, err := h.roomService.GetRoom(ctx, roomID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
+	}
+	catalog, err := h.catalogService.GetCatalog(ctx, roomID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id": roomID,
+		"events":  catalog.Events(),
+	})
+}
+
+// GetRoomResult: 終了後の集計結果を取得 (ROOM_TTL 経過後も参照できる)
 func (h *APIHandler) GetRoomResult(c echo.Context) error {
+	ctx := c.Request().Context()
 	roomID := c.Param("id")
-	room, err := h.roomService.GetRoom(roomID)
+	room, err := h.roomService.FindRoom(ctx, roomID)
 	if err != nil || room == nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
 	}
-	if room.Status != "ended" {
+	// 期限切れで回収されたルーム (expired) も結果を返す
+	if !room.Status.IsTerminal() {
 		return c.JSON(http.StatusConflict, map[string]string{"error": "room not ended"})
 	}
-	summary, err := h.sessionService.GetRoomResult(roomID)
+	summary, err := h.sessionService.GetRoomResult(ctx, roomID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 	var viewerSummary *model.ViewerSummary
-	if viewerID := c.QueryParam("viewer_id"); viewerID != "" {
-		if vs, err := h.sessionService.GetViewerSummary(roomID, viewerID); err == nil {
+	if viewerID, err := h.resolveViewerID(c, c.QueryParam("viewer_id")); err == nil && viewerID != "" {
+		if vs, err := h.sessionService.GetViewerSummary(ctx, roomID, viewerID); err == nil {
 			viewerSummary = vs
 		}
 	}
+	// 不正検知でフラグ付けされた視聴者 (集計には reduce 分の重みが反映済み)
+	flagged := []model.ViewerFlag{}
+	if h.pressGuard != nil {
+		if flags, err := h.pressGuard.Flags(ctx, roomID); err == nil {
+			flagged = flags
+		}
+	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"game_over":      true,
-		"room_id":        summary.RoomID,
-		"ended_at":       summary.EndedAt,
-		"top_by_event":   summary.TopByEvent,
-		"top_overall":    summary.TopOverall,
-		"event_totals":   summary.EventTotals,
-		"viewer_totals":  summary.ViewerTotals,
-		"viewer_summary": viewerSummary,
+		"game_over":       true,
+		"room_id":         summary.RoomID,
+		"ended_at":        summary.EndedAt,
+		"top_by_event":    summary.TopByEvent,
+		"top_overall":     summary.TopOverall,
+		"event_totals":    summary.EventTotals,
+		"viewer_totals":   summary.ViewerTotals,
+		"viewer_summary":  viewerSummary,
+		"flagged_viewers": flagged,
 	})
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// historyEventRepo: 発動履歴の参照だけを実装した EventRepository (rows は新しい順)
+type historyEventRepo struct {
+	repository.EventRepository
+	rows []model.GameEvent
+}
+
+func (r historyEventRepo) ListGameEvents(_ context.Context, _ string, _ model.EventType, limit, offset int) ([]model.GameEvent, error) {
+	if offset >= len(r.rows) {
+		return nil, nil
+	}
+	return r.rows[offset:min(offset+limit, len(r.rows))], nil
+}
+func (r historyEventRepo) ListTriggerTotals(context.Context, string) ([]model.EventTotal, error) {
+	return []model.EventTotal{{EventType: model.ENEMY1, Count: len(r.rows)}}, nil
+}
+
+func TestAPIHandler_GetRoomTriggers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rooms := ownedRoomRepo{room: &model.Room{ID: "room-a", Status: model.RoomStatusRunning}}
+	catalogs := service.NewCatalogService(rooms, logger)
+	events := historyEventRepo{rows: []model.GameEvent{
+		{ID: 3, RoomID: "room-a", EventType: model.ENEMY1, TriggerCount: 40, Threshold: 40, Level: 3},
+		{ID: 2, RoomID: "room-a", EventType: model.ENEMY1, TriggerCount: 20, Threshold: 20, Level: 2},
+		{ID: 1, RoomID: "room-a", EventType: model.ENEMY1, TriggerCount: 10, Threshold: 10, Level: 1},
+	}}
+	h := NewAPIHandler(service.NewRoomService(rooms, &config.Config{}), service.NewEventService(nil, events, nil, catalogs, logger), nil, nil, catalogs)
+
+	e := echo.New()
+	e.GET("/api/rooms/:id/triggers", h.GetRoomTriggers)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/api/rooms/room-a/triggers?limit=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Triggers   []model.GameEvent       `json:"triggers"`
+		Totals     map[model.EventType]int `json:"totals"`
+		NextOffset *int                    `json:"next_offset"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(body.Triggers) != 2 || body.Triggers[0].Level != 3 || body.Triggers[0].Threshold != 40 || body.NextOffset == nil || *body.NextOffset != 2 {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	// 発動の無い種別も 0 で返す
+	if body.Totals[model.ENEMY1] != 3 || body.Totals[model.SKILL1] != 0 || len(body.Totals) != len(service.DefaultEventCatalog().Types()) {
+		t.Fatalf("totals = %v", body.Totals)
+	}
+
+	if rec := get("/api/rooms/room-a/triggers?offset=-1"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative offset: status = %d", rec.Code)
+	}
+}
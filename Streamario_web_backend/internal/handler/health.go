@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"streamerrio-backend/pkg/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HealthHandler: 稼働確認エンドポイント
+// /healthz (liveness) はプロセス内部の状態のみ、/readyz (readiness) は DB / Redis など依存先も確認する。
+// いずれも全確認が成功すれば 200、1件でも失敗すれば 503 で同じ形式のレポートを返す。
+type HealthHandler struct {
+	liveness  *health.Checker
+	readiness *health.Checker
+	logger    *slog.Logger
+}
+
+// NewHealthHandler: liveness / readiness それぞれの確認を束ねて生成
+func NewHealthHandler(liveness, readiness *health.Checker, logger *slog.Logger) *HealthHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &HealthHandler{liveness: liveness, readiness: readiness, logger: logger}
+}
+
+// Liveness: GET /healthz (失敗が続けば再起動すべき状態か)
+func (h *HealthHandler) Liveness(c echo.Context) error {
+	return h.respond(c, "liveness", h.liveness)
+}
+
+// Readiness: GET /readyz (トラフィックを受けられる状態か)
+func (h *HealthHandler) Readiness(c echo.Context) error {
+	return h.respond(c, "readiness", h.readiness)
+}
+
+func (h *HealthHandler) respond(c echo.Context, probe string, checker *health.Checker) error {
+	report := checker.Run(c.Request().Context())
+	if !report.OK() {
+		failed := make([]string, 0, len(report.Checks))
+		for name, res := range report.Checks {
+			if res.Status != health.StatusOK {
+				failed = append(failed, name+": "+res.Error)
+			}
+		}
+		h.logger.Warn("health check failed", slog.String("probe", probe), slog.Any("failed", failed))
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
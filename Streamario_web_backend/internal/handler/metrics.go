@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MetricsAuth: /metrics の収集元を Authorization: Bearer <token> で限定する (token 空なら素通し)
+// ルーム ID をラベルに含むため、公開環境ではトークンを設定すること。
+func MetricsAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if token == "" {
+			return next
+		}
+		return func(c echo.Context) error {
+			if subtle.ConstantTimeCompare([]byte(bearerToken(c.Request())), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "metrics token required"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamerContextKey: StreamerAuth が認証済み配信者を格納する echo.Context のキー
+const streamerContextKey = "streamer"
+
+// 配信者のルーム一覧のページング上限
+const (
+	defaultStreamerRoomsLimit = 20
+	maxStreamerRoomsLimit     = 100
+)
+
+// StreamerAuth: API キー (Authorization: Bearer sk_...) を必須とし、配信者を context に載せる
+// 接続トークン (ct_...) は Unity のハンドシェイク専用のため受け付けない。
+func StreamerAuth(streamers *service.StreamerService, logger *slog.Logger) echo.MiddlewareFunc {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := bearerToken(c.Request())
+			if key == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "api key required"})
+			}
+			streamer, err := streamers.AuthenticateAPIKey(c.Request().Context(), key)
+			if errors.Is(err, service.ErrInvalidCredentials) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			}
+			if err != nil {
+				logger.Error("streamer auth failed", slog.String("path", c.Path()), slog.Any("error", err))
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "authentication unavailable"})
+			}
+			c.Set(streamerContextKey, streamer)
+			return next(c)
+		}
+	}
+}
+
+// currentStreamer: StreamerAuth 済みの配信者
+func currentStreamer(c echo.Context) *model.Streamer {
+	s, _ := c.Get(streamerContextKey).(*model.Streamer)
+	return s
+}
+
+// StreamerHandler: 配信者アカウント/資格情報/自分のルームの管理 API
+type StreamerHandler struct {
+	streamers      *service.StreamerService
+	roomService    *service.RoomService
+	sessionService *service.GameSessionService
+}
+
+// NewStreamerHandler: 依存注入してハンドラ生成
+func NewStreamerHandler(streamers *service.StreamerService, roomService *service.RoomService, sessionService *service.GameSessionService) *StreamerHandler {
+	return &StreamerHandler{streamers: streamers, roomService: roomService, sessionService: sessionService}
+}
+
+// Register: 配信者アカウント作成 (POST /api/streamers)
+// 返却する api_key は再取得できないため、Unity/ダッシュボード側で保管してもらう。
+func (h *StreamerHandler) Register(c echo.Context) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	streamer, key, secret, err := h.streamers.Register(c.Request().Context(), req.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"streamer": streamer,
+		"key":      key,
+		"api_key":  secret,
+	})
+}
+
+// Me: 認証中の配信者 (GET /api/streamer/me)
+func (h *StreamerHandler) Me(c echo.Context) error {
+	return c.JSON(http.StatusOK, currentStreamer(c))
+}
+
+// ListKeys: API キー一覧 (GET /api/streamer/keys / secret は含まない)
+func (h *StreamerHandler) ListKeys(c echo.Context) error {
+	keys, err := h.streamers.ListAPIKeys(c.Request().Context(), currentStreamer(c).ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// CreateKey: API キー追加発行 (POST /api/streamer/keys)
+func (h *StreamerHandler) CreateKey(c echo.Context) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	key, secret, err := h.streamers.IssueAPIKey(c.Request().Context(), currentStreamer(c).ID, req.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{"key": key, "api_key": secret})
+}
+
+// RevokeKey: API キー失効 (DELETE /api/streamer/keys/:id)
+// 使用中のキー自身も失効できる (漏えい時の即時無効化のため)。
+func (h *StreamerHandler) RevokeKey(c echo.Context) error {
+	revoked, err := h.streamers.RevokeAPIKey(c.Request().Context(), currentStreamer(c).ID, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if !revoked {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "key not found"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateConnectionToken: Unity 接続用の短命トークンを発行 (POST /api/streamer/connection-token)
+func (h *StreamerHandler) CreateConnectionToken(c echo.Context) error {
+	token, expiresAt, err := h.streamers.IssueConnectionToken(c.Request().Context(), currentStreamer(c).ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{"token": token, "expires_at": expiresAt})
+}
+
+// ListRooms: 自分のルーム履歴 (GET /api/streamer/rooms?status=&limit=&offset=)
+func (h *StreamerHandler) ListRooms(c echo.Context) error {
+	limit, offset := defaultStreamerRoomsLimit, 0
+	if raw := c.QueryParam("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = min(v, maxStreamerRoomsLimit)
+	}
+	if raw := c.QueryParam("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid offset"})
+		}
+		offset = v
+	}
+	status := model.RoomStatus(c.QueryParam("status"))
+	rooms, err := h.roomService.ListByStreamer(c.Request().Context(), currentStreamer(c).ID, status, limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"rooms": rooms, "limit": limit, "offset": offset})
+}
+
+// EndRoom: 自分のルームを終了させる (POST /api/streamer/rooms/:id/end / Unity が落ちたままのルームの後始末用)
+func (h *StreamerHandler) EndRoom(c echo.Context) error {
+	ctx := c.Request().Context()
+	roomID := c.Param("id")
+	if _, err := h.roomService.CheckOwner(ctx, roomID, currentStreamer(c).ID); errors.Is(err, service.ErrRoomForbidden) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	} else if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
+	}
+	summary, err := h.sessionService.EndGame(ctx, roomID)
+	if errors.Is(err, service.ErrInvalidTransition) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName: HTTP / WebSocket 処理のスパンを記録するトレーサー名
+const tracerName = "streamerrio-backend/internal/handler"
+
+// Tracing: リクエストごとに server スパンを開始し、リクエストの context に載せる
+// traceparent ヘッダがあれば上流のトレースを継続する。skip に一致するパス (稼働確認など) は記録しない。
+// 以降のサービス呼び出しや Pub/Sub 発行は c.Request().Context() を渡すことで同じトレースに連なる。
+func Tracing(skip ...string) echo.MiddlewareFunc {
+	tracer := otel.Tracer(tracerName)
+	skipped := make(map[string]bool, len(skip))
+	for _, p := range skip {
+		skipped[p] = true
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := c.Path()
+			if skipped[route] {
+				return next(c)
+			}
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", req.URL.Path),
+					attribute.String("client.address", c.RealIP()),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				// ステータスを確定させるためエラーハンドラをここで呼ぶ (Echo は応答済みなら二重に書かない)
+				c.Error(err)
+				span.RecordError(err)
+			}
+			status := c.Response().Status
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"streamerrio-backend/pkg/metrics"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// ack 待ちメッセージの再送設定
+const (
+	ackTimeout         = 3 * time.Second        // ack が来なければ再送するまでの時間
+	maxSendAttempts    = 5                      // 初回送信を含む最大送信回数
+	ackCheckInterval   = 500 * time.Millisecond // 再送判定の間隔
+	maxPendingMessages = 256                    // 接続ごとの ack 待ち上限 (超過分は ack 追跡しない)
+	evictNoticeWait    = time.Second            // 切断通知を書き込む際の期限
+)
+
+// 切断理由 (evicted メッセージの reason / ログ)
+const (
+	evictPongTimeout   = "pong_timeout"
+	evictSendQueueFull = "send_queue_full"
+	evictWriteFailed   = "write_failed"
+	evictShutdown      = "server_shutdown" // インスタンス停止 (別インスタンスへ再接続させる)
+)
+
+// errConnClosed: 切断済み接続への送信
+var errConnClosed = errors.New("connection closed")
+
+// ConnOptions: Unity 接続の死活監視と送信キューの設定
+type ConnOptions struct {
+	PingInterval  time.Duration // サーバ → Unity の ping 間隔
+	PongWait      time.Duration // この時間 Unity から何も受信しなければ切断 (read deadline。v1 は ping への pong も受信に数える)
+	WriteWait     time.Duration // 1フレームの書き込み期限
+	SendQueueSize int           // 接続ごとの送信キュー長 (溢れたら切断)
+}
+
+// DefaultConnOptions: 既定の接続設定
+func DefaultConnOptions() ConnOptions {
+	return ConnOptions{PingInterval: 15 * time.Second, PongWait: 45 * time.Second, WriteWait: 10 * time.Second, SendQueueSize: 256}
+}
+
+// pendingMessage: ack 待ちのメッセージ
+type pendingMessage struct {
+	data     []byte
+	msgType  string
+	attempts int
+	nextAt   time.Time
+}
+
+// outFrame: 送信キューの1要素
+type outFrame struct {
+	data []byte
+	ping bool // WebSocket の ping 制御フレーム (v1 向け)
+}
+
+// unityConn: Unity との1接続分の状態
+// 書き込みは送信キュー経由で writeLoop の1 goroutine に限定し、遅いクライアントが他ルームの配信を止めないようにする。
+// v2 以降ではサーバ→Unity メッセージを ack まで再送し、一定時間受信の無い接続を切断する。
+type unityConn struct {
+	ws          *websocket.Conn
+	roomID      string
+	version     int
+	opts        ConnOptions
+	out         chan outFrame
+	mu          sync.Mutex
+	pending     map[string]*pendingMessage
+	done        chan struct{}
+	closeOnce   sync.Once
+	evictReason atomic.Value // string
+	lastSeen    atomic.Int64 // 最終受信時刻 (UnixNano)
+	staleSent   atomic.Bool
+	metrics     *metrics.Metrics // 破棄したメッセージの記録先 (nil なら記録しない)
+	logger      *slog.Logger
+}
+
+func newUnityConn(ws *websocket.Conn, version int, opts ConnOptions, logger *slog.Logger) *unityConn {
+	u := &unityConn{
+		ws:      ws,
+		version: version,
+		opts:    opts,
+		out:     make(chan outFrame, opts.SendQueueSize),
+		pending: make(map[string]*pendingMessage),
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+	u.lastSeen.Store(time.Now().UnixNano())
+	return u
+}
+
+// acked: このバージョンで ack/再送・stale 警告を行うか (受信期限による切断は全バージョン共通)
+func (u *unityConn) acked() bool { return u.version >= 2 }
+
+// start: 書き込み・再送・ping の各ループを開始し、初回の受信期限を設定
+func (u *unityConn) start() {
+	u.touch()
+	go u.writeLoop()
+	go u.retryLoop()
+	go u.pingLoop()
+}
+
+// send: ペイロードを送信キューへ積む (v2 ならエンベロープ (id/version) を付けて ack 待ちに登録)
+func (u *unityConn) send(payload interface{}) error {
+	id := ulid.Make().String()
+	data, err := encodeOutbound(payload, Envelope{ID: id, Version: u.version})
+	if err != nil {
+		return err
+	}
+	if u.acked() {
+		u.mu.Lock()
+		if len(u.pending) < maxPendingMessages {
+			u.pending[id] = &pendingMessage{data: data, msgType: typeOf(payload), attempts: 1, nextAt: time.Now().Add(ackTimeout)}
+		} else {
+			u.logger.Warn("too many unacked messages, not tracking", slog.String("room_id", u.roomID), slog.String("id", id))
+		}
+		u.mu.Unlock()
+	}
+	if err := u.enqueue(outFrame{data: data}); err != nil {
+		u.forget(id)
+		return err
+	}
+	return nil
+}
+
+// reply: ack/error など ack 不要の制御メッセージを送信
+func (u *unityConn) reply(msg interface{}) error {
+	data, err := encodeOutbound(msg, Envelope{Version: u.version})
+	if err != nil {
+		return err
+	}
+	return u.enqueue(outFrame{data: data})
+}
+
+// enqueue: 送信キューへ積む (ブロックしない。溢れた場合は詰まった接続とみなして切断)
+func (u *unityConn) enqueue(f outFrame) error {
+	select {
+	case <-u.done:
+		return errConnClosed
+	default:
+	}
+	select {
+	case u.out <- f:
+		return nil
+	default:
+		u.metrics.DeliveryDropped(metrics.TargetUnity, evictSendQueueFull)
+		u.evict(evictSendQueueFull)
+		return fmt.Errorf("send queue full for roomID=%s", u.roomID)
+	}
+}
+
+// writeLoop: 送信キューを書き込み期限付きで順に書き出す (close まで)
+func (u *unityConn) writeLoop() {
+	for {
+		select {
+		case <-u.done:
+			return
+		case f := <-u.out:
+			if err := u.writeFrame(f); err != nil {
+				u.logger.Warn("unity write failed", slog.String("room_id", u.roomID), slog.Any("error", err))
+				u.evict(evictWriteFailed)
+				return
+			}
+		}
+	}
+}
+
+// writeFrame: 1フレーム書き込み (writeLoop からのみ呼ぶ)
+func (u *unityConn) writeFrame(f outFrame) error {
+	if err := u.ws.SetWriteDeadline(time.Now().Add(u.opts.WriteWait)); err != nil {
+		return err
+	}
+	if f.ping {
+		// PayloadType の切り替えは書き込み goroutine が1つなので安全
+		u.ws.PayloadType = websocket.PingFrame
+		_, err := u.ws.Write(nil)
+		u.ws.PayloadType = websocket.TextFrame
+		return err
+	}
+	if err := websocket.Message.Send(u.ws, string(f.data)); err != nil {
+		return fmt.Errorf("send failed: %v", err)
+	}
+	return nil
+}
+
+// touch: Unity からの受信を記録し、受信期限を延長
+// メッセージの受信に加え、activityConn 経由で pong などの制御フレームを含む任意の受信でも呼ばれる。
+func (u *unityConn) touch() {
+	now := time.Now()
+	u.lastSeen.Store(now.UnixNano())
+	u.staleSent.Store(false)
+	if u.opts.PongWait > 0 {
+		_ = u.ws.SetReadDeadline(now.Add(u.opts.PongWait))
+	}
+}
+
+// pingLoop: 定期的に ping を送り、v2 では応答の無い接続へ stale 警告を送る
+// v1 クライアントは JSON の ping/stale を解釈しないため ping 制御フレームを送る。
+// その pong (websocket パッケージ内で読み捨てられる) は activityConn が受信として数えるため、受信期限は v1 にも効く。
+func (u *unityConn) pingLoop() {
+	if u.opts.PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(u.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.done:
+			return
+		case now := <-ticker.C:
+			if !u.acked() {
+				_ = u.enqueue(outFrame{ping: true})
+				continue
+			}
+			idle := now.Sub(time.Unix(0, u.lastSeen.Load()))
+			if idle >= 2*u.opts.PingInterval && u.staleSent.CompareAndSwap(false, true) {
+				u.logger.Warn("unity connection stale", slog.String("room_id", u.roomID), slog.Duration("idle", idle))
+				_ = u.reply(map[string]interface{}{
+					"type":        "stale",
+					"room_id":     u.roomID,
+					"idle_ms":     idle.Milliseconds(),
+					"evict_in_ms": max(u.opts.PongWait-idle, 0).Milliseconds(),
+				})
+			}
+			_ = u.reply(map[string]interface{}{"type": "ping", "ts": now.UnixMilli()})
+		}
+	}
+}
+
+// activityConn: 受信したバイトがあるたびに onRead を呼ぶ net.Conn
+// golang.org/x/net/websocket は pong などの制御フレームを Receive の中で読み捨てるため、ソケットの読み出しで受信を検知する。
+type activityConn struct {
+	net.Conn
+	onRead func()
+}
+
+func (c *activityConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.onRead()
+	}
+	return n, err
+}
+
+// activityResponseWriter: Hijack したコネクションを activityConn で包む ResponseWriter
+type activityResponseWriter struct {
+	http.ResponseWriter
+	onRead func()
+}
+
+func (w activityResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	ac := &activityConn{Conn: conn, onRead: w.onRead}
+	r := io.Reader(ac)
+	if n := rw.Reader.Buffered(); n > 0 {
+		// ハンドシェイクと同時に届いていた分を先に読ませる
+		buffered, _ := rw.Reader.Peek(n)
+		r = io.MultiReader(bytes.NewReader(buffered), ac)
+	}
+	return ac, bufio.NewReadWriter(bufio.NewReader(r), rw.Writer), nil
+}
+
+// retryLoop: ack の来ないメッセージを再送 (close まで)
+func (u *unityConn) retryLoop() {
+	if !u.acked() {
+		return
+	}
+	ticker := time.NewTicker(ackCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.done:
+			return
+		case now := <-ticker.C:
+			for id, data := range u.dueRetries(now) {
+				if err := u.enqueue(outFrame{data: data}); err != nil {
+					u.logger.Warn("unity resend failed", slog.String("room_id", u.roomID), slog.String("id", id), slog.Any("error", err))
+					return
+				}
+			}
+		}
+	}
+}
+
+// dueRetries: 再送対象を取り出し、試行回数を超えたものは破棄
+func (u *unityConn) dueRetries(now time.Time) map[string][]byte {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	due := make(map[string][]byte)
+	for id, p := range u.pending {
+		if now.Before(p.nextAt) {
+			continue
+		}
+		if p.attempts >= maxSendAttempts {
+			delete(u.pending, id)
+			u.metrics.DeliveryDropped(metrics.TargetUnity, "retries_exhausted")
+			u.logger.Warn("unity message dropped after retries", slog.String("room_id", u.roomID), slog.String("id", id), slog.String("type", p.msgType), slog.Int("attempts", p.attempts))
+			continue
+		}
+		p.attempts++
+		p.nextAt = now.Add(ackTimeout)
+		due[id] = p.data
+	}
+	return due
+}
+
+// ack: Unity からの受信確認。追跡中なら true
+func (u *unityConn) ack(ref string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.pending[ref]; !ok {
+		return false
+	}
+	delete(u.pending, ref)
+	return true
+}
+
+// nack: Unity からの処理失敗通知。次回の再送判定で再送する
+func (u *unityConn) nack(ref string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p, ok := u.pending[ref]
+	if !ok {
+		return false
+	}
+	p.nextAt = time.Now()
+	return true
+}
+
+func (u *unityConn) forget(id string) {
+	u.mu.Lock()
+	delete(u.pending, id)
+	u.mu.Unlock()
+}
+
+// pendingCount: ack 待ち件数
+func (u *unityConn) pendingCount() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.pending)
+}
+
+// evict: 詰まった/応答の無い接続を切断 (ソケットを閉じて受信ループを終わらせる)
+func (u *unityConn) evict(reason string) {
+	u.closeOnce.Do(func() {
+		u.evictReason.Store(reason)
+		close(u.done)
+		u.logger.Warn("unity connection evicted", slog.String("room_id", u.roomID), slog.String("reason", reason))
+		if u.ws != nil {
+			u.ws.Close()
+		}
+	})
+}
+
+// evicted: 切断理由 (evict されていなければ空文字)
+func (u *unityConn) evicted() string {
+	if r, ok := u.evictReason.Load().(string); ok {
+		return r
+	}
+	return ""
+}
+
+// notifyEvicted: 切断直前に理由を直接書き込む (ベストエフォート。送信キューは経由しない)
+// server_shutdown は停止するインスタンス側の都合のため reconnect=true を付け、待たずに再接続してよいことを伝える。
+func (u *unityConn) notifyEvicted(reason string) {
+	payload := map[string]interface{}{"type": "evicted", "room_id": u.roomID, "reason": reason}
+	if reason == evictShutdown {
+		payload["reconnect"] = true
+	}
+	data, err := encodeOutbound(payload, Envelope{Version: u.version})
+	if err != nil {
+		return
+	}
+	_ = u.ws.SetWriteDeadline(time.Now().Add(evictNoticeWait))
+	_ = websocket.Message.Send(u.ws, string(data))
+}
+
+// close: 各ループを停止 (ソケット自体は HandleUnityConnection が閉じる)
+func (u *unityConn) close() {
+	u.closeOnce.Do(func() { close(u.done) })
+}
+
+// typeOf: ペイロードの type (ログ用)
+func typeOf(payload interface{}) string {
+	if m, ok := payload.(map[string]interface{}); ok {
+		if t, ok := m["type"].(string); ok {
+			return t
+		}
+	}
+	return ""
+}
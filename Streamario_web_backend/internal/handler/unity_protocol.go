@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"streamerrio-backend/internal/model"
+)
+
+// Unity WebSocket プロトコルのバージョン
+// v1: 旧来のフラットな JSON (ack なし)
+// v2: 共通エンベロープ (type/id/seq/version) + サーバ→Unity メッセージの ack/nack と再送
+const (
+	protocolVersion    = 2
+	minProtocolVersion = 1
+)
+
+// 制御メッセージの種別
+const (
+	msgTypeAck   = "ack"   // 受信確認 (ref = 対象メッセージの id)
+	msgTypeNack  = "nack"  // 処理失敗通知 (ref = 対象メッセージの id)
+	msgTypeError = "error" // 不正/未対応メッセージへの応答
+	msgTypePing  = "ping"  // 死活確認 (双方向)
+	msgTypePong  = "pong"  // ping への応答
+)
+
+// error メッセージの code
+const (
+	errCodeMalformed   = "malformed_message"
+	errCodeMissingType = "missing_type"
+	errCodeUnknownType = "unknown_type"
+	errCodeMissingRef  = "missing_ref"
+)
+
+// Envelope: 全メッセージ共通のヘッダ
+// 種別固有のフィールドは同じ階層に並べる (v1 クライアントとの互換のためネストしない)。
+type Envelope struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`      // メッセージ ID (ack/nack の ref で参照)
+	Seq     int64  `json:"seq,omitempty"`     // ルーム単位の配信連番 (Pub/Sub 経由のイベントのみ)
+	Version int    `json:"version,omitempty"` // 送信側のプロトコルバージョン
+}
+
+// inboundMessage: Unity → サーバのメッセージ
+type inboundMessage struct {
+	Envelope
+	Ref       string                   `json:"ref,omitempty"`   // ack/nack の対象 ID
+	Error     string                   `json:"error,omitempty"` // nack の理由
+	Events    []model.EventConfig      `json:"events,omitempty"`
+	Threshold *model.ThresholdSettings `json:"threshold,omitempty"`
+}
+
+// ackMessage: サーバ → Unity の受信確認
+type ackMessage struct {
+	Envelope
+	Ref string `json:"ref"`
+}
+
+// errorMessage: サーバ → Unity の型付きエラー応答
+type errorMessage struct {
+	Envelope
+	Ref     string `json:"ref,omitempty"` // 原因となったメッセージの id (不明なら省略)
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// protocolError: 受信メッセージの検証エラー
+type protocolError struct {
+	code    string
+	message string
+}
+
+func (e *protocolError) Error() string { return e.code + ": " + e.message }
+
+// inboundTypes: サーバが解釈する Unity → サーバのメッセージ種別
+var inboundTypes = map[string]bool{
+	msgTypeAck:            true,
+	msgTypeNack:           true,
+	msgTypePing:           true,
+	msgTypePong:           true,
+	"game_start":          true,
+	"game_pause":          true,
+	"game_resume":         true,
+	"game_end":            true,
+	"configure_events":    true,
+	"configure_threshold": true,
+}
+
+// negotiateVersion: クエリ (?protocol=N) からプロトコルバージョンを決定 (省略時は v1)
+func negotiateVersion(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return minProtocolVersion, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol version %q", raw)
+	}
+	if v < minProtocolVersion || v > protocolVersion {
+		return 0, fmt.Errorf("unsupported protocol version %d (supported %d..%d)", v, minProtocolVersion, protocolVersion)
+	}
+	return v, nil
+}
+
+// parseInbound: 受信メッセージをデコードし、エンベロープを検証
+func parseInbound(raw string) (*inboundMessage, *protocolError) {
+	var msg inboundMessage
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		return &msg, &protocolError{code: errCodeMalformed, message: err.Error()}
+	}
+	if msg.Type == "" {
+		return &msg, &protocolError{code: errCodeMissingType, message: "type is required"}
+	}
+	if !inboundTypes[msg.Type] {
+		return &msg, &protocolError{code: errCodeUnknownType, message: fmt.Sprintf("unknown message type %q", msg.Type)}
+	}
+	if (msg.Type == msgTypeAck || msg.Type == msgTypeNack) && msg.Ref == "" {
+		return &msg, &protocolError{code: errCodeMissingRef, message: msg.Type + " requires ref"}
+	}
+	return &msg, nil
+}
+
+// errInvalidPayload: Unity へ送るペイロードが JSON オブジェクトとして直列化できない
+var errInvalidPayload = errors.New("invalid unity payload")
+
+// encodeOutbound: 任意のペイロード (JSON オブジェクト) を直列化し、v2 クライアント宛てならエンベロープを重ねる
+// v1 (env.Version < 2) は旧来のフラットな JSON のまま送る (id / version を付けない)。
+// v2 ではペイロード側の type / seq は維持し、id / version はエンベロープの値で上書きする。type が無いペイロードもそのまま送る。
+func encodeOutbound(payload interface{}, env Envelope) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("%w: payload must be a JSON object", errInvalidPayload)
+	}
+	if env.Version < 2 {
+		return raw, nil
+	}
+	if env.Type != "" {
+		fields["type"], _ = json.Marshal(env.Type)
+	}
+	if env.ID != "" {
+		fields["id"], _ = json.Marshal(env.ID)
+	}
+	if env.Seq > 0 {
+		fields["seq"], _ = json.Marshal(env.Seq)
+	}
+	fields["version"], _ = json.Marshal(env.Version)
+	return json.Marshal(fields)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"1", 1, false},
+		{"2", 2, false},
+		{"3", 0, true},
+		{"0", 0, true},
+		{"v2", 0, true},
+	}
+	for _, tc := range cases {
+		got, err := negotiateVersion(tc.raw)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("negotiateVersion(%q) = %d, %v", tc.raw, got, err)
+		}
+	}
+}
+
+func TestParseInbound(t *testing.T) {
+	cases := []struct {
+		raw  string
+		code string
+	}{
+		{`{"type":"game_start","id":"m1"}`, ""},
+		{`{"type":"ack","ref":"01H"}`, ""},
+		{`not json`, errCodeMalformed},
+		{`{"id":"m2"}`, errCodeMissingType},
+		{`{"type":"launch_rocket","id":"m3"}`, errCodeUnknownType},
+		{`{"type":"nack"}`, errCodeMissingRef},
+	}
+	for _, tc := range cases {
+		_, perr := parseInbound(tc.raw)
+		got := ""
+		if perr != nil {
+			got = perr.code
+		}
+		if got != tc.code {
+			t.Errorf("parseInbound(%s): expected code %q, got %q", tc.raw, tc.code, got)
+		}
+	}
+
+	msg, _ := parseInbound(`{"type":"launch_rocket","id":"m3"}`)
+	if msg.ID != "m3" {
+		t.Fatalf("id should be kept for error reply ref, got %q", msg.ID)
+	}
+}
+
+func TestEncodeOutbound(t *testing.T) {
+	data, err := encodeOutbound(map[string]interface{}{"type": "game_event", "room_id": "r1", "seq": 7}, Envelope{ID: "01H", Version: 2})
+	if err != nil {
+		t.Fatalf("encodeOutbound failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got["type"] != "game_event" || got["id"] != "01H" || got["version"] != float64(2) || got["seq"] != float64(7) || got["room_id"] != "r1" {
+		t.Fatalf("unexpected envelope: %v", got)
+	}
+
+	data, err = encodeOutbound(errorMessage{Envelope: Envelope{Type: msgTypeError}, Ref: "m3", Code: errCodeUnknownType, Message: "x"}, Envelope{Version: 2})
+	if err != nil {
+		t.Fatalf("encodeOutbound failed: %v", err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil || got["type"] != "error" || got["code"] != errCodeUnknownType || got["ref"] != "m3" {
+		t.Fatalf("unexpected error reply: %s", data)
+	}
+
+	// type の無いペイロード (REST からの中継など) も送る
+	data, err = encodeOutbound(map[string]interface{}{"action": "spawn"}, Envelope{ID: "01J", Version: 2})
+	if err != nil {
+		t.Fatalf("payload without type: %v", err)
+	}
+	if got := string(data); got != `{"action":"spawn","id":"01J","version":2}` {
+		t.Fatalf("unexpected v2 payload without type: %s", got)
+	}
+
+	// v1 は旧来のフラットな JSON のまま (id / version を付けない)
+	data, err = encodeOutbound(map[string]interface{}{"type": "game_event", "seq": 7}, Envelope{ID: "01K", Version: 1})
+	if err != nil {
+		t.Fatalf("encodeOutbound v1 failed: %v", err)
+	}
+	if got := string(data); got != `{"seq":7,"type":"game_event"}` {
+		t.Fatalf("unexpected v1 payload: %s", got)
+	}
+
+	if _, err := encodeOutbound([]int{1}, Envelope{}); !errors.Is(err, errInvalidPayload) {
+		t.Fatalf("non-object payload: err = %v, want errInvalidPayload", err)
+	}
+}
+
+func TestUnityConnRetries(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := newUnityConn(nil, 2, DefaultConnOptions(), logger)
+	now := time.Now()
+	u.pending["a"] = &pendingMessage{data: []byte("a"), attempts: 1, nextAt: now.Add(ackTimeout)}
+	u.pending["b"] = &pendingMessage{data: []byte("b"), attempts: 1, nextAt: now.Add(ackTimeout)}
+
+	if due := u.dueRetries(now); len(due) != 0 {
+		t.Fatalf("nothing should be due yet: %v", due)
+	}
+	if !u.ack("a") || u.ack("a") {
+		t.Fatal("ack should remove the pending message exactly once")
+	}
+	if !u.nack("b") {
+		t.Fatal("nack should find the pending message")
+	}
+	now = time.Now()
+
+	// nack されたものは即再送、以後 ack が無ければ上限回数で破棄
+	for attempt := 2; attempt <= maxSendAttempts; attempt++ {
+		if due := u.dueRetries(now); len(due) != 1 {
+			t.Fatalf("attempt %d: expected resend, got %v", attempt, due)
+		}
+		now = now.Add(ackTimeout)
+	}
+	if due := u.dueRetries(now); len(due) != 0 || u.pendingCount() != 0 {
+		t.Fatalf("message should be dropped after %d attempts", maxSendAttempts)
+	}
+}
+
+func TestUnityConnEvictsOnFullQueue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts := DefaultConnOptions()
+	opts.SendQueueSize = 2
+	u := newUnityConn(nil, 1, opts, logger) // writeLoop 未起動 = 書き込みが詰まったクライアント
+
+	for i := 0; i < opts.SendQueueSize; i++ {
+		if err := u.send(map[string]interface{}{"type": "game_event"}); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+	if err := u.send(map[string]interface{}{"type": "game_event"}); err == nil {
+		t.Fatal("send should fail when the queue is full")
+	}
+	if u.evicted() != evictSendQueueFull {
+		t.Fatalf("expected eviction reason %q, got %q", evictSendQueueFull, u.evicted())
+	}
+	if err := u.send(map[string]interface{}{"type": "game_event"}); err != errConnClosed {
+		t.Fatalf("send after eviction should return errConnClosed, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"streamerrio-backend/pkg/viewertoken"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 視聴者トークンの受け渡し
+const (
+	viewerTokenCookie    = "viewer_token" // 署名付きトークン (HttpOnly)
+	legacyViewerIDCookie = "viewer_id"    // 旧形式 (署名なし / JS から読める)。移行期間のみ参照
+)
+
+// errViewerTokenRequired: 署名付きトークンなしで視聴者 ID を名乗った (VIEWER_TOKEN_REQUIRED 有効時)
+var errViewerTokenRequired = errors.New("viewer token required")
+
+// ViewerAuth: 署名付き視聴者トークン (Cookie または Authorization: Bearer) を検証し、視聴者をリクエストの context に載せる
+// トークンが無い/不正でもリクエストは拒否しない (匿名として扱い、要否は各ハンドラが判断する)。
+// required=true の場合、旧 viewer_id Cookie から引き継いだトークン (Claims.Legacy) も匿名として扱う。
+func ViewerAuth(signer *viewertoken.Signer, required bool, logger *slog.Logger) echo.MiddlewareFunc {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := bearerToken(c.Request())
+			if token == "" {
+				if cookie, err := c.Cookie(viewerTokenCookie); err == nil {
+					token = cookie.Value
+				}
+			}
+			if token == "" {
+				return next(c)
+			}
+			claims, err := signer.Verify(token)
+			if err != nil {
+				logger.Debug("viewer token rejected", slog.String("path", c.Path()), slog.Any("error", err))
+				return next(c)
+			}
+			if claims.Legacy && required {
+				logger.Debug("legacy viewer token rejected", slog.String("path", c.Path()), slog.String("viewer_id", claims.ViewerID))
+				return next(c)
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(viewertoken.NewContext(req.Context(), claims)))
+			return next(c)
+		}
+	}
+}
+
+// bearerToken: Authorization: Bearer <token> を取り出す (無ければ空文字)
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// resolveViewerID: リクエストの視聴者 ID を決める
+// 検証済みトークンの ID を優先し、本文/クエリで名乗った ID (claimed) は無視する。
+// トークンが無い場合、移行期間中 (required=false) は claimed を非推奨ヘッダ付きで受け付け、required=true なら拒否する。
+func (h *APIHandler) resolveViewerID(c echo.Context, claimed string) (string, error) {
+	if claims, ok := viewertoken.FromContext(c.Request().Context()); ok {
+		return claims.ViewerID, nil
+	}
+	if claimed == "" {
+		return "", nil
+	}
+	if h.viewerTokenRequired {
+		return "", errViewerTokenRequired
+	}
+	c.Response().Header().Set("Deprecation", "true")
+	c.Response().Header().Set("Warning", `299 - "viewer_id parameter is deprecated; use the viewer token from /get_viewer_id"`)
+	return claimed, nil
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"streamerrio-backend/pkg/viewertoken"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestViewerAuth_ResolveViewerID(t *testing.T) {
+	signer, err := viewertoken.NewSigner([]viewertoken.Key{{ID: "k1", Secret: []byte(strings.Repeat("s", 32))}}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	token, _, _ := signer.Issue("alice")
+	legacy, _, _ := signer.IssueLegacy("carol")
+
+	cases := []struct {
+		name       string
+		required   bool
+		setup      func(*http.Request)
+		claimed    string
+		want       string
+		wantErr    error
+		deprecated bool
+	}{
+		{name: "cookie token wins over body", setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: viewerTokenCookie, Value: token}) }, claimed: "mallory", want: "alice"},
+		{name: "bearer token", setup: func(r *http.Request) { r.Header.Set(echo.HeaderAuthorization, "Bearer "+token) }, want: "alice"},
+		{name: "invalid token is anonymous", setup: func(r *http.Request) { r.Header.Set(echo.HeaderAuthorization, "Bearer "+token+"x") }, want: ""},
+		{name: "legacy body id is deprecated", claimed: "bob", want: "bob", deprecated: true},
+		{name: "legacy body id rejected when required", required: true, claimed: "bob", wantErr: errViewerTokenRequired},
+		{name: "legacy-upgraded token during migration", setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: viewerTokenCookie, Value: legacy}) }, want: "carol"},
+		{name: "legacy-upgraded token rejected when required", required: true, setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: viewerTokenCookie, Value: legacy}) }, claimed: "carol", wantErr: errViewerTokenRequired},
+		{name: "server-issued token accepted when required", required: true, setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: viewerTokenCookie, Value: token}) }, want: "alice"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &APIHandler{viewerTokens: signer, viewerTokenRequired: tc.required}
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.setup != nil {
+				tc.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			var got string
+			var gotErr error
+			mw := ViewerAuth(signer, tc.required, nil)
+			_ = mw(func(c echo.Context) error {
+				got, gotErr = h.resolveViewerID(c, tc.claimed)
+				return nil
+			})(c)
+
+			if !errors.Is(gotErr, tc.wantErr) || got != tc.want {
+				t.Fatalf("resolveViewerID = %q, %v; want %q, %v", got, gotErr, tc.want, tc.wantErr)
+			}
+			if dep := rec.Header().Get("Deprecation") == "true"; dep != tc.deprecated {
+				t.Errorf("Deprecation header = %v, want %v", dep, tc.deprecated)
+			}
+		})
+	}
+}
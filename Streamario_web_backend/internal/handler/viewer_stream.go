@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/service"
+	"streamerrio-backend/pkg/metrics"
+	"streamerrio-backend/pkg/pubsub"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 視聴者ストリームの設定
+const (
+	viewerStreamBuffer    = 32               // 視聴者ごとの未送信メッセージ上限 (溢れた分は破棄)
+	viewerStreamKeepAlive = 20 * time.Second // SSE コメント行による keep-alive 間隔
+)
+
+// viewerSub: SSE 接続1本分の受信キュー
+type viewerSub struct {
+	ch chan []byte
+}
+
+// ViewerStreamHandler: 視聴者向けライブ更新 (SSE) の配信
+// ChannelViewerUpdates を購読し、このインスタンスに接続中の視聴者へ room_id ごとにファンアウトする。
+type ViewerStreamHandler struct {
+	roomService  *service.RoomService
+	eventService *service.EventService
+	pubsub       pubsub.PubSub
+	mu           sync.RWMutex
+	subs         map[string]map[*viewerSub]struct{} // roomID -> 接続中の視聴者
+	closing      chan struct{}                      // Drain で close (全ストリームへ再接続を促して閉じる)
+	closeOnce    sync.Once
+	subscribed   atomic.Bool // Pub/Sub 購読の goroutine が動作中
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+}
+
+// NewViewerStreamHandler: 依存を束ねて生成
+func NewViewerStreamHandler(roomService *service.RoomService, eventService *service.EventService, ps pubsub.PubSub, logger *slog.Logger) *ViewerStreamHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ViewerStreamHandler{
+		roomService:  roomService,
+		eventService: eventService,
+		pubsub:       ps,
+		subs:         make(map[string]map[*viewerSub]struct{}),
+		closing:      make(chan struct{}),
+		logger:       logger,
+	}
+}
+
+// SetMetrics: 視聴者数 / 破棄したメッセージの記録先を注入
+func (h *ViewerStreamHandler) SetMetrics(m *metrics.Metrics) { h.metrics = m }
+
+// HandleStream: GET /api/rooms/:id/live
+// 接続直後に現在の統計を送り、以降 room_stats / game_event / game_end_summary を SSE で push する。
+// 終了サマリーを送ったら、または終了済みルームへの接続ならストリームを閉じる。
+// インスタンス停止時は reconnect イベントを送って閉じ、停止中の新規接続は 503 で断る。
+func (h *ViewerStreamHandler) HandleStream(c echo.Context) error {
+	ctx := c.Request().Context()
+	if h.draining() {
+		c.Response().Header().Set("Retry-After", drainRetryAfter)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "server shutting down"})
+	}
+	roomID := c.Param("id")
+	room, err := h.roomService.GetRoom(ctx, roomID)
+	if err != nil || room == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "room not found"})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // リバースプロキシのバッファリング無効化
+	res.WriteHeader(http.StatusOK)
+
+	status := model.NormalizeRoomStatus(room.Status)
+	if status.IsTerminal() {
+		_ = writeSSE(res, "room_state", map[string]interface{}{"type": "room_state", "room_id": roomID, "status": status})
+		return nil
+	}
+
+	sub := &viewerSub{ch: make(chan []byte, viewerStreamBuffer)}
+	h.add(roomID, sub)
+	defer h.remove(roomID, sub)
+
+	// 初期スナップショット
+	if stats, err := h.eventService.GetRoomStats(ctx, roomID); err == nil {
+		if err := writeSSE(res, "room_stats", map[string]interface{}{"type": "room_stats", "room_id": roomID, "stats": stats, "sent_at": time.Now()}); err != nil {
+			return nil
+		}
+	}
+
+	keepAlive := time.NewTicker(viewerStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.closing:
+			_ = writeSSE(res, "reconnect", map[string]interface{}{"type": "reconnect", "room_id": roomID, "reason": "server_shutdown"})
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case data := <-sub.ch:
+			var envelope struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal(data, &envelope)
+			if err := writeSSERaw(res, envelope.Type, data); err != nil {
+				return nil
+			}
+			if envelope.Type == "game_end_summary" {
+				return nil
+			}
+		}
+	}
+}
+
+func (h *ViewerStreamHandler) add(roomID string, sub *viewerSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[roomID] == nil {
+		h.subs[roomID] = make(map[*viewerSub]struct{})
+	}
+	h.subs[roomID][sub] = struct{}{}
+	h.metrics.SetRoomViewers(roomID, len(h.subs[roomID]))
+}
+
+func (h *ViewerStreamHandler) remove(roomID string, sub *viewerSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[roomID], sub)
+	h.metrics.SetRoomViewers(roomID, len(h.subs[roomID]))
+	if len(h.subs[roomID]) == 0 {
+		delete(h.subs, roomID)
+	}
+}
+
+// Drain: インスタンス停止時に全ストリームへ reconnect を送って閉じ、ハンドラの終了を待つ
+// (EventSource は閉じられると自動で再接続し、停止中でないインスタンスへ振り分けられる)
+func (h *ViewerStreamHandler) Drain(ctx context.Context) error {
+	h.closeOnce.Do(func() { close(h.closing) })
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		n := h.StreamCount()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d viewer streams still open: %w", n, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *ViewerStreamHandler) draining() bool {
+	select {
+	case <-h.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribed: Pub/Sub 購読の goroutine が動作中か
+func (h *ViewerStreamHandler) Subscribed() bool { return h.subscribed.Load() }
+
+// StreamCount: このインスタンスで接続中のストリーム数 (全ルーム合計)
+func (h *ViewerStreamHandler) StreamCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+// ViewerCount: このインスタンスでルームを購読中の視聴者数
+func (h *ViewerStreamHandler) ViewerCount(roomID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs[roomID])
+}
+
+// dispatch: ルームの購読者全員へ配信 (詰まっている視聴者の分は破棄し、他を待たせない)
+func (h *ViewerStreamHandler) dispatch(roomID string, data []byte) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	delivered := 0
+	for sub := range h.subs[roomID] {
+		select {
+		case sub.ch <- data:
+			delivered++
+		default:
+			h.metrics.DeliveryDropped(metrics.TargetViewer, "buffer_full")
+			h.logger.Warn("viewer stream buffer full, message dropped", slog.String("room_id", roomID))
+		}
+	}
+	return delivered
+}
+
+// StartPubSubSubscription: ChannelViewerUpdates の購読を開始 (ブロッキング)
+func (h *ViewerStreamHandler) StartPubSubSubscription(ctx context.Context) error {
+	h.subscribed.Store(true)
+	defer h.subscribed.Store(false)
+	handler := func(ctx context.Context, channel string, message []byte) error {
+		var envelope struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := json.Unmarshal(message, &envelope); err != nil || envelope.RoomID == "" {
+			return fmt.Errorf("room_id not found in viewer update")
+		}
+		if n := h.dispatch(envelope.RoomID, message); n > 0 {
+			h.logger.Debug("viewer update delivered", slog.String("room_id", envelope.RoomID), slog.Int("viewers", n))
+		}
+		return nil
+	}
+	h.logger.Info("starting pubsub subscription", slog.String("channel", pubsub.ChannelViewerUpdates))
+	if err := h.pubsub.Subscribe(ctx, pubsub.ChannelViewerUpdates, handler); err != nil && !errors.Is(err, context.Canceled) {
+		h.logger.Error("pubsub subscription failed", slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// writeSSE: 1イベント分を SSE 形式で書き出して flush
+func writeSSE(res *echo.Response, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return writeSSERaw(res, event, data)
+}
+
+func writeSSERaw(res *echo.Response, event string, data []byte) error {
+	if event != "" {
+		if _, err := fmt.Fprintf(res, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(res, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -4,28 +4,84 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/websocket"
 
+	"streamerrio-backend/internal/model"
 	"streamerrio-backend/internal/service"
+	"streamerrio-backend/pkg/metrics"
 	"streamerrio-backend/pkg/pubsub"
+	"streamerrio-backend/pkg/registry"
 
 	"github.com/labstack/echo/v4"
 	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// registryTimeout: 所有レジストリ操作1回あたりのタイムアウト
+const registryTimeout = 2 * time.Second
+
+// インスタンス停止時の接続整理
+const (
+	drainPollInterval = 50 * time.Millisecond // 接続の後始末完了を確認する間隔
+	drainRetryAfter   = "1"                   // 停止中に新規接続を断る際の Retry-After (秒)
+)
+
+// Pub/Sub 購読が止まった際の再購読間隔 (失敗ごとに倍にする)
+const (
+	subscribeRetryMin = time.Second
+	subscribeRetryMax = 30 * time.Second
+)
+
+// maxReplayQueue: 再送中に溜める通常配信の上限 (超過分は捨て、次回再接続時の since で補わせる)
+const maxReplayQueue = 1024
+
+// roomDelivery: ルームごとの配信済み seq (再送と通常配信の重複・順序入れ替わりを防ぐ)
+// 再送中 (replaying) に届いた通常配信は queued に溜め、再送分と合わせて seq 順に送る。
+// mu は送信キューへ積む間だけ保持する (DB 登録や履歴の読み出し中は保持しない)。
+type roomDelivery struct {
+	mu        sync.Mutex
+	lastSeq   int64
+	replaying bool
+	queued    []sequencedMessage
+}
+
+// sequencedMessage: 再送キューへ溜める通常配信 (payload は送信前の形)
+type sequencedMessage struct {
+	seq     int64
+	payload map[string]interface{}
+}
+
 type WebSocketHandler struct {
-	connections    map[string]*websocket.Conn
+	connections    map[string]*unityConn
+	deliveries     map[string]*roomDelivery
 	mu             sync.RWMutex
 	roomService    *service.RoomService
 	sessionService *service.GameSessionService
+	catalogService *service.CatalogService
+	streamers      *service.StreamerService // 配信者認証 (nil なら全接続を匿名として扱う)
+	joinService    *service.JoinService     // 参加 URL / QR / 参加コード (nil なら初期メッセージに含めない)
 	pubsub         pubsub.PubSub
+	registry       registry.Registry // Unity 接続の所有インスタンス (nil なら単一インスタンス扱い)
+	instanceID     string
+	ownershipTTL   time.Duration
+	connOpts       ConnOptions
+	draining       atomic.Bool // Drain 開始後は新規接続を断る
+	subscribed     atomic.Bool // Pub/Sub 購読の goroutine が動作中
+	metrics        *metrics.Metrics
 	logger         *slog.Logger
 	ulidEntropy    io.Reader
 }
@@ -35,8 +91,10 @@ func NewWebSocketHandler(ps pubsub.PubSub, logger *slog.Logger) *WebSocketHandle
 		logger = slog.Default()
 	}
 	return &WebSocketHandler{
-		connections: make(map[string]*websocket.Conn),
+		connections: make(map[string]*unityConn),
+		deliveries:  make(map[string]*roomDelivery),
 		pubsub:      ps,
+		connOpts:    DefaultConnOptions(),
 		logger:      logger,
 		ulidEntropy: ulid.Monotonic(rand.Reader, 0),
 	}
@@ -44,7 +102,48 @@ func NewWebSocketHandler(ps pubsub.PubSub, logger *slog.Logger) *WebSocketHandle
 
 // Unity接続管理
 // /ws-unity に接続されたら、この関数が呼ばれる
+// ?protocol=N でプロトコルバージョンを指定 (省略時 v1、未対応バージョンは 400)
+// 配信者の資格情報は Authorization: Bearer <API キー/接続トークン> か ?token=<接続トークン> で提示する
+// (不正なら 401、他の配信者のルーム ID 指定は 403、所有を確認できなければ 503。いずれもアップグレード前に JSON で返す)。
+// インスタンス停止中は 503 (Retry-After 付き) で断る。
 func (h *WebSocketHandler) HandleUnityConnection(c echo.Context) error {
+	if h.draining.Load() {
+		c.Response().Header().Set("Retry-After", drainRetryAfter)
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"error": "server shutting down"})
+	}
+	version, err := negotiateVersion(c.QueryParam("protocol"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":                err.Error(),
+			"min_protocol_version": minProtocolVersion,
+			"protocol_version":     protocolVersion,
+		})
+	}
+	// 新規接続のルーム ID は認証前に決めて、接続トークンをそのルームに結び付ける
+	requestedID := c.QueryParam("room_id")
+	roomID := requestedID
+	if roomID == "" {
+		roomID = h.newRoomID()
+	}
+	streamerID, err := h.authenticateStreamer(c, roomID)
+	if err != nil {
+		c.Logger().Warnf("unity auth rejected remote=%s err=%v", c.RealIP(), err)
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+	}
+	// 再接続の所有確認はアップグレード前の1回だけ行い、確認できなければ受け付けない (DB 障害時に他人のルームを渡さないため)
+	if requestedID != "" && h.roomService != nil {
+		if _, err := h.roomService.EnsureOwnedRoom(c.Request().Context(), requestedID, streamerID); errors.Is(err, service.ErrRoomForbidden) {
+			c.Logger().Warnf("room ownership rejected id=%s streamer=%q", requestedID, streamerID)
+			return c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+		} else if err != nil {
+			c.Logger().Errorf("room ownership check failed id=%s err=%v", requestedID, err)
+			c.Response().Header().Set("Retry-After", drainRetryAfter)
+			return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"error": "room ownership check unavailable"})
+		}
+	}
+	// ソケットは Handler で受け取る。受信の検知 (activityResponseWriter) から touch できるよう接続状態は先に作る
+	conn := newUnityConn(nil, version, h.connOpts, h.logger)
+	conn.metrics = h.metrics
 	s := websocket.Server{
 		Handshake: func(cfg *websocket.Config, r *http.Request) error {
 			// 全オリジン許可（必要ならここで厳密にチェック）
@@ -52,16 +151,30 @@ func (h *WebSocketHandler) HandleUnityConnection(c echo.Context) error {
 		},
 		Handler: func(ws *websocket.Conn) {
 			defer ws.Close()
+			conn.ws = ws
+			defer conn.close()
 
 			// 接続登録（再接続の場合は同一 room_id を維持）
-			requestedID := c.QueryParam("room_id")
+			// since=N 指定時は seq > N の取りこぼしを初期メッセージの直後に再送する
+			delivery := &roomDelivery{}
+			if raw := c.QueryParam("since"); raw != "" && requestedID != "" {
+				if since, err := strconv.ParseInt(raw, 10, 64); err == nil && since >= 0 {
+					// 再送完了までの通常配信は delivery に溜める
+					delivery.lastSeq, delivery.replaying = since, true
+				} else {
+					c.Logger().Warnf("invalid since=%q ignored", raw)
+				}
+			}
+			replay := delivery.replaying
+
 			var id string
 			if requestedID != "" {
-				id = h.registerWithID(requestedID, ws, c)
+				id = h.registerWithID(requestedID, conn, delivery, c)
 			} else {
-				id = h.registerNew(ws, c)
+				id = h.registerNew(roomID, streamerID, conn, delivery, c)
 			}
-			defer h.unregister(id, ws, c)
+			defer h.unregister(id, conn, c)
+			conn.start()
 
 			// 接続直後に必ずログを出す
 			c.Logger().Infof("Client connected: %s id=%s", c.Request().RemoteAddr, id)
@@ -72,15 +185,19 @@ func (h *WebSocketHandler) HandleUnityConnection(c echo.Context) error {
 				initType = "room_ready"
 			}
 			payload := map[string]interface{}{
-				"type":    initType,
-				"room_id": id,
-				"qr_code": "data:image/png;base64,...",
-				"web_url": "https://example.com",
+				"type":                 initType,
+				"room_id":              id,
+				"protocol_version":     version,
+				"max_protocol_version": protocolVersion,
 			}
+			h.addJoinInfo(id, payload, c)
 			if err := h.SendEventToUnity(id, payload); err != nil {
 				c.Logger().Errorf("initial send failed: %v", err)
 				return
 			}
+			if replay {
+				h.replay(id, delivery, c)
+			}
 
 			for {
 				// Client からのメッセージを読み込む
@@ -90,40 +207,110 @@ func (h *WebSocketHandler) HandleUnityConnection(c echo.Context) error {
 				// エラー処理
 				// メッセージを受信できなかった場合は、接続を切断する
 				if err != nil {
-					if err == io.EOF {
+					var netErr net.Error
+					switch {
+					case conn.evicted() != "":
+						c.Logger().Warnf("Client evicted id=%s reason=%s", id, conn.evicted())
+					case errors.As(err, &netErr) && netErr.Timeout():
+						// 受信期限切れ = pong 応答を含め何も届かない (半開きの接続)。理由を通知して切断
+						conn.notifyEvicted(evictPongTimeout)
+						conn.evict(evictPongTimeout)
+						c.Logger().Warnf("Client evicted id=%s reason=%s", id, evictPongTimeout)
+					case err == io.EOF:
 						c.Logger().Infof("Client disconnected id=%s", id)
-					} else {
+					default:
 						c.Logger().Errorf("receive failed: %v", err)
 					}
 					return
 				}
+				conn.touch()
 
-				var incoming struct {
-					Type string `json:"type"`
-				}
-				if err := json.Unmarshal([]byte(msg), &incoming); err != nil {
-					continue
-				}
-				switch incoming.Type {
-				case "game_end":
-					if h.sessionService == nil {
-						c.Logger().Warn("game_end received but sessionService not set")
-						continue
-					}
-					if _, err := h.sessionService.EndGame(id); err != nil {
-						c.Logger().Errorf("game end handling failed id=%s err=%v", id, err)
-					}
-				default:
-					// その他のメッセージは現状無視
-				}
+				h.handleInbound(id, conn, msg, c)
 			}
 		},
 	}
 
-	s.ServeHTTP(c.Response(), c.Request())
+	s.ServeHTTP(activityResponseWriter{ResponseWriter: c.Response(), onRead: conn.touch}, c.Request())
 	return nil
 }
 
+// addJoinInfo: 初期メッセージに参加 URL / QR / 参加コードを載せる (失敗時は載せずに続行)
+// web_url は join_url の旧名 (既存の Unity クライアント向け)。
+func (h *WebSocketHandler) addJoinInfo(id string, payload map[string]interface{}, c echo.Context) {
+	if h.joinService == nil {
+		return
+	}
+	info, err := h.joinService.Info(c.Request().Context(), id)
+	if err != nil {
+		c.Logger().Warnf("join info unavailable id=%s err=%v", id, err)
+		return
+	}
+	payload["join_url"] = info.JoinURL
+	payload["web_url"] = info.JoinURL
+	payload["qr_code"] = info.QRCode
+	if info.JoinCode != "" {
+		payload["join_code"] = info.JoinCode
+	}
+}
+
+// handleInbound: Unity からの1メッセージを検証・処理
+// 不正なメッセージには error を返し、id 付きの正常なメッセージには ack を返す。
+func (h *WebSocketHandler) handleInbound(id string, conn *unityConn, raw string, c echo.Context) {
+	incoming, perr := parseInbound(raw)
+	if perr != nil {
+		c.Logger().Warnf("invalid message id=%s code=%s err=%s", id, perr.code, perr.message)
+		if err := conn.reply(errorMessage{Envelope: Envelope{Type: msgTypeError}, Ref: incoming.ID, Code: perr.code, Message: perr.message}); err != nil {
+			c.Logger().Errorf("error reply failed: %v", err)
+		}
+		return
+	}
+
+	switch incoming.Type {
+	case msgTypeAck:
+		if !conn.ack(incoming.Ref) {
+			c.Logger().Debugf("ack for unknown message id=%s ref=%s", id, incoming.Ref)
+		}
+		return
+	case msgTypeNack:
+		c.Logger().Warnf("unity nack id=%s ref=%s err=%s", id, incoming.Ref, incoming.Error)
+		conn.nack(incoming.Ref)
+		return
+	case msgTypePong:
+		// 受信自体で死活監視は更新済み
+		return
+	case msgTypePing:
+		if err := conn.reply(map[string]interface{}{"type": msgTypePong, "ts": time.Now().UnixMilli()}); err != nil {
+			c.Logger().Errorf("pong reply failed: %v", err)
+		}
+		return
+	}
+
+	if incoming.ID != "" {
+		if err := conn.reply(ackMessage{Envelope: Envelope{Type: msgTypeAck}, Ref: incoming.ID}); err != nil {
+			c.Logger().Errorf("ack reply failed: %v", err)
+		}
+	}
+
+	switch incoming.Type {
+	case "game_end":
+		if h.sessionService == nil {
+			c.Logger().Warn("game_end received but sessionService not set")
+			return
+		}
+		if _, err := h.sessionService.EndGame(c.Request().Context(), id); err != nil {
+			c.Logger().Errorf("game end handling failed id=%s err=%v", id, err)
+		}
+	case "game_start", "game_pause", "game_resume":
+		h.handleLifecycle(id, incoming.Type, c)
+	case "configure_events":
+		// ルームで使用するボタン定義を宣言（rooms.settings に保存）
+		h.handleConfigureEvents(id, incoming.Events, c)
+	case "configure_threshold":
+		// ルームの閾値算出方式を選択（rooms.settings に保存）
+		h.handleConfigureThreshold(id, incoming.Threshold, c)
+	}
+}
+
 func (h *WebSocketHandler) RelayActionToUnity(c echo.Context) error {
 	// リクエストボディをそのまま JSON として受け取り、Unity へ転送する
 	var payload map[string]interface{}
@@ -146,8 +333,11 @@ func (h *WebSocketHandler) RelayActionToUnity(c echo.Context) error {
 		forward[k] = v
 	}
 
-	// Unity へ送信
+	// Unity へ送信 (直列化できないペイロードは 400、接続が無い / 切断済みなら 404)
 	if err := h.SendEventToUnity(roomID, forward); err != nil {
+		if errors.Is(err, errInvalidPayload) {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		}
 		return c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
 	}
 
@@ -162,49 +352,235 @@ func (h *WebSocketHandler) SetGameSessionService(gs *service.GameSessionService)
 	h.sessionService = gs
 }
 
-// registerNew: 新規接続用に新しい roomID を払い出して登録
-func (h *WebSocketHandler) registerNew(ws *websocket.Conn, c echo.Context) string {
-	id := ulid.MustNew(ulid.Timestamp(time.Now()), h.ulidEntropy).String()
+// SetStreamerService: Unity 接続の配信者認証サービスを注入
+func (h *WebSocketHandler) SetStreamerService(ss *service.StreamerService) { h.streamers = ss }
+
+// SetJoinService: 参加導線 (参加 URL / QR / 参加コード) サービスを注入
+func (h *WebSocketHandler) SetJoinService(js *service.JoinService) { h.joinService = js }
+
+// SetCatalogService: イベントカタログ管理サービスを注入
+func (h *WebSocketHandler) SetCatalogService(cs *service.CatalogService) { h.catalogService = cs }
+
+// SetConnOptions: Unity 接続の死活監視・送信キュー設定を注入
+func (h *WebSocketHandler) SetConnOptions(opts ConnOptions) { h.connOpts = opts }
+
+// SetMetrics: 接続数 / 破棄したメッセージの記録先を注入
+func (h *WebSocketHandler) SetMetrics(m *metrics.Metrics) { h.metrics = m }
+
+// SetRegistry: 複数インスタンス構成向けに所有レジストリとこのインスタンスの識別子を注入
+func (h *WebSocketHandler) SetRegistry(reg registry.Registry, instanceID string, ttl time.Duration) {
+	h.registry = reg
+	h.instanceID = instanceID
+	h.ownershipTTL = ttl
+}
+
+// handleLifecycle: Unity からの開始/一時停止/再開通知でルーム状態を遷移させ、結果を返信
+func (h *WebSocketHandler) handleLifecycle(id, msgType string, c echo.Context) {
+	ctx := c.Request().Context()
+	if h.roomService == nil {
+		c.Logger().Warnf("%s received but roomService not set", msgType)
+		return
+	}
+	var (
+		room *model.Room
+		err  error
+	)
+	switch msgType {
+	case "game_start":
+		room, err = h.roomService.StartGame(ctx, id)
+	case "game_pause":
+		room, err = h.roomService.PauseGame(ctx, id)
+	case "game_resume":
+		room, err = h.roomService.ResumeGame(ctx, id)
+	}
+	if err != nil {
+		c.Logger().Warnf("%s rejected id=%s err=%v", msgType, id, err)
+		payload := map[string]interface{}{
+			"type":    "state_rejected",
+			"room_id": id,
+			"request": msgType,
+			"error":   err.Error(),
+		}
+		if cur, getErr := h.roomService.FindRoom(ctx, id); getErr == nil {
+			payload["status"] = cur.Status
+		}
+		if sendErr := h.SendEventToUnity(id, payload); sendErr != nil {
+			c.Logger().Errorf("state_rejected send failed: %v", sendErr)
+		}
+		return
+	}
+	c.Logger().Infof("room state changed id=%s status=%s", id, room.Status)
+	if err := h.SendEventToUnity(id, roomStatePayload(room)); err != nil {
+		c.Logger().Errorf("room_state send failed: %v", err)
+	}
+}
+
+// roomStatePayload: ルーム状態通知メッセージ
+func roomStatePayload(room *model.Room) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "room_state",
+		"room_id":    room.ID,
+		"status":     model.NormalizeRoomStatus(room.Status),
+		"started_at": room.StartedAt,
+		"paused_at":  room.PausedAt,
+		"resumed_at": room.ResumedAt,
+	}
+}
+
+// handleConfigureEvents: Unity から受け取ったボタン定義を検証・保存し、結果を返信
+func (h *WebSocketHandler) handleConfigureEvents(id string, events []model.EventConfig, c echo.Context) {
+	if h.catalogService == nil {
+		c.Logger().Warn("configure_events received but catalogService not set")
+		return
+	}
+	catalog, err := h.catalogService.SetCatalog(c.Request().Context(), id, events)
+	if err != nil {
+		c.Logger().Warnf("configure_events rejected id=%s err=%v", id, err)
+		if sendErr := h.SendEventToUnity(id, map[string]interface{}{
+			"type":    "events_rejected",
+			"room_id": id,
+			"error":   err.Error(),
+		}); sendErr != nil {
+			c.Logger().Errorf("events_rejected send failed: %v", sendErr)
+		}
+		return
+	}
+	if err := h.SendEventToUnity(id, map[string]interface{}{
+		"type":    "events_configured",
+		"room_id": id,
+		"events":  catalog.Events(),
+	}); err != nil {
+		c.Logger().Errorf("events_configured send failed: %v", err)
+	}
+}
+
+// handleConfigureThreshold: Unity から受け取った閾値算出方式を検証・保存し、結果を返信
+func (h *WebSocketHandler) handleConfigureThreshold(id string, threshold *model.ThresholdSettings, c echo.Context) {
+	if h.catalogService == nil {
+		c.Logger().Warn("configure_threshold received but catalogService not set")
+		return
+	}
+	var settings model.ThresholdSettings
+	if threshold != nil {
+		settings = *threshold
+	}
+	strategy, err := h.catalogService.SetThresholdStrategy(c.Request().Context(), id, settings)
+	if err != nil {
+		c.Logger().Warnf("configure_threshold rejected id=%s err=%v", id, err)
+		if sendErr := h.SendEventToUnity(id, map[string]interface{}{
+			"type":    "threshold_rejected",
+			"room_id": id,
+			"error":   err.Error(),
+		}); sendErr != nil {
+			c.Logger().Errorf("threshold_rejected send failed: %v", sendErr)
+		}
+		return
+	}
+	if err := h.SendEventToUnity(id, map[string]interface{}{
+		"type":     "threshold_configured",
+		"room_id":  id,
+		"strategy": strategy.Name(),
+	}); err != nil {
+		c.Logger().Errorf("threshold_configured send failed: %v", err)
+	}
+}
+
+// authenticateStreamer: ハンドシェイクの資格情報から配信者 ID を得る (資格情報なしの匿名接続は空文字)
+// roomID は接続先のルームで、接続トークンの結び付け先になる。
+func (h *WebSocketHandler) authenticateStreamer(c echo.Context, roomID string) (string, error) {
+	credential := bearerToken(c.Request())
+	if credential == "" {
+		credential = c.QueryParam("token")
+	}
+	if h.streamers == nil {
+		return "", nil
+	}
+	if credential == "" {
+		if h.roomService != nil && h.roomService.StreamerAuthRequired() {
+			return "", errors.New("streamer credentials required")
+		}
+		return "", nil
+	}
+	streamerID, err := h.streamers.AuthenticateConnection(c.Request().Context(), credential, roomID)
+	if err != nil {
+		return "", err
+	}
+	return streamerID, nil
+}
+
+// newRoomID: 新規接続用のルーム ID を払い出す (Monotonic の乱数源は並行利用できないため mu で守る)
+func (h *WebSocketHandler) newRoomID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return ulid.MustNew(ulid.Timestamp(time.Now()), h.ulidEntropy).String()
+}
+
+// registerNew: 新規接続を払い出し済みの id で登録 (streamerID 空なら匿名ルーム)
+func (h *WebSocketHandler) registerNew(id, streamerID string, conn *unityConn, delivery *roomDelivery, c echo.Context) string {
+	if streamerID == "" {
+		streamerID = model.AnonymousStreamerID
+	}
 
 	if h.roomService != nil {
-		if err := h.roomService.CreateIfNotExists(id, "unity"); err != nil {
+		if err := h.roomService.CreateIfNotExists(c.Request().Context(), id, streamerID); err != nil {
 			c.Logger().Errorf("room db create failed id=%s err=%v", id, err)
 		} else {
 			c.Logger().Infof("room db created id=%s", id)
+			h.enterLobby(id, c)
 		}
 	}
 
+	conn.roomID = id
 	h.mu.Lock()
-	h.connections[id] = ws
+	h.connections[id] = conn
+	h.deliveries[id] = delivery
+	h.metrics.SetUnityConnections(len(h.connections))
 	h.mu.Unlock()
+	h.claim(id)
 	return id
 }
 
 // registerWithID: 指定 roomID で接続を登録（再接続時）
-// 既存接続がある場合は置き換える
-func (h *WebSocketHandler) registerWithID(id string, ws *websocket.Conn, c echo.Context) string {
-	// 既存の DB レコードは触らない（既に存在している前提）。無い場合のみ作成。
+// 所有確認 (無ければ作成) はアップグレード前に済ませている前提。既存接続がある場合は置き換える
+func (h *WebSocketHandler) registerWithID(id string, conn *unityConn, delivery *roomDelivery, c echo.Context) string {
 	if h.roomService != nil {
-		if err := h.roomService.CreateIfNotExists(id, "unity"); err != nil {
-			c.Logger().Errorf("room db ensure failed id=%s err=%v", id, err)
-		}
+		h.enterLobby(id, c)
 	}
 
+	conn.roomID = id
 	h.mu.Lock()
-	h.connections[id] = ws
+	h.connections[id] = conn
+	h.deliveries[id] = delivery
+	h.metrics.SetUnityConnections(len(h.connections))
 	h.mu.Unlock()
+	h.claim(id)
 	c.Logger().Infof("room re-registered id=%s", id)
 	return id
 }
 
+// enterLobby: Unity 接続に伴い created → lobby (自動開始設定時は running) へ進める
+func (h *WebSocketHandler) enterLobby(id string, c echo.Context) {
+	if room, err := h.roomService.EnterLobby(c.Request().Context(), id); err != nil {
+		c.Logger().Warnf("room lobby transition failed id=%s err=%v", id, err)
+	} else {
+		c.Logger().Infof("room state id=%s status=%s", id, room.Status)
+	}
+}
+
 // unregister: 接続が同一の場合のみ削除（置換時の誤削除防止）
-func (h *WebSocketHandler) unregister(id string, ws *websocket.Conn, c echo.Context) {
+func (h *WebSocketHandler) unregister(id string, conn *unityConn, c echo.Context) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	cur := h.connections[id]
-	if cur == ws {
+	removed := cur == conn
+	if removed {
 		delete(h.connections, id)
+		delete(h.deliveries, id)
+		h.metrics.SetUnityConnections(len(h.connections))
+	}
+	h.mu.Unlock()
+
+	if removed {
+		h.release(id)
 		c.Logger().Infof("Client unregistered id=%s", id)
 	} else {
 		// すでに別の接続に置き換わっている
@@ -212,37 +588,357 @@ func (h *WebSocketHandler) unregister(id string, ws *websocket.Conn, c echo.Cont
 	}
 }
 
-func (h *WebSocketHandler) SendEventToUnity(roomID string, payload interface{}) error {
+// claim: 所有レジストリへこのインスタンスを登録 (失敗してもブロードキャスト配信で届くため継続)
+func (h *WebSocketHandler) claim(id string) {
+	if h.registry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := h.registry.Claim(ctx, id, h.instanceID, h.ownershipTTL); err != nil {
+		h.logger.Warn("room ownership claim failed", slog.String("room_id", id), slog.String("instance_id", h.instanceID), slog.Any("error", err))
+	}
+}
+
+// release: 所有レジストリから削除 (他インスタンスへ移っていれば何もしない)
+func (h *WebSocketHandler) release(id string) {
+	if h.registry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := h.registry.Release(ctx, id, h.instanceID); err != nil {
+		h.logger.Warn("room ownership release failed", slog.String("room_id", id), slog.String("instance_id", h.instanceID), slog.Any("error", err))
+	}
+}
+
+// localRoomIDs: このインスタンスが保持する接続のルームID一覧
+func (h *WebSocketHandler) localRoomIDs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.connections))
+	for id := range h.connections {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// StartOwnershipHeartbeat: 保持中ルームの所有エントリを TTL/3 間隔で延長 (context キャンセルまでブロック)
+func (h *WebSocketHandler) StartOwnershipHeartbeat(ctx context.Context) error {
+	if h.registry == nil {
+		return nil
+	}
+	interval := h.ownershipTTL / 3
+	h.logger.Info("ownership heartbeat started", slog.String("instance_id", h.instanceID), slog.Duration("interval", interval))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			ids := h.localRoomIDs()
+			if len(ids) == 0 {
+				continue
+			}
+			rctx, cancel := context.WithTimeout(ctx, registryTimeout)
+			if err := h.registry.Refresh(rctx, h.instanceID, ids, h.ownershipTTL); err != nil {
+				h.logger.Warn("ownership heartbeat failed", slog.Int("room_count", len(ids)), slog.Any("error", err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Drain: インスタンス停止時にこのインスタンスの Unity 接続を全て閉じる
+// 新規接続を断り、接続中の Unity へ evicted (reason=server_shutdown, reconnect=true) を送って切断する。
+// Unity は同じ room_id と since で再接続し、別インスタンスで取りこぼし分から受信を再開する。
+// 所有登録は各接続の後始末で解除されるため、それが終わるか ctx が期限切れになるまで待つ。
+func (h *WebSocketHandler) Drain(ctx context.Context) error {
+	h.draining.Store(true)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		// 停止開始と同時に登録途中だった接続も拾うため、毎回取り直す
+		h.mu.RLock()
+		conns := make([]*unityConn, 0, len(h.connections))
+		for _, conn := range h.connections {
+			conns = append(conns, conn)
+		}
+		h.mu.RUnlock()
+		if len(conns) == 0 {
+			return nil
+		}
+
+		var wg sync.WaitGroup
+		for _, conn := range conns {
+			if conn.evicted() != "" {
+				continue
+			}
+			wg.Add(1)
+			go func(conn *unityConn) {
+				defer wg.Done()
+				conn.notifyEvicted(evictShutdown)
+				conn.evict(evictShutdown)
+			}(conn)
+		}
+		wg.Wait()
 
-	// 排他制御
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d unity connections still open: %w", len(conns), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining: 停止処理中 (新規接続を断っている) か
+func (h *WebSocketHandler) Draining() bool { return h.draining.Load() }
+
+// Subscribed: Pub/Sub 購読の goroutine が動作中か
+func (h *WebSocketHandler) Subscribed() bool { return h.subscribed.Load() }
+
+// ConnectionCount: このインスタンスで接続中の Unity 数
+func (h *WebSocketHandler) ConnectionCount() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	return len(h.connections)
+}
 
-	// 接続先にメッセージを送信
-	client := h.connections[roomID]
-	if client == nil {
+// SendEventToUnity: ローカル接続へ送信 (v2 接続では ack まで再送)
+func (h *WebSocketHandler) SendEventToUnity(roomID string, payload interface{}) error {
+	h.mu.RLock()
+	conn := h.connections[roomID]
+	h.mu.RUnlock()
+	if conn == nil {
 		return fmt.Errorf("no websocket client for roomID=%s", roomID)
 	}
-	if err := websocket.JSON.Send(client, payload); err != nil {
-		return fmt.Errorf("send failed: %v", err)
+	return conn.send(payload)
+}
+
+// DeliverToUnity: ローカル接続があれば直接送信し、無ければ所有インスタンス宛てに Pub/Sub で転送
+// (reaper や REST 起点の終了サマリーなど、接続を持たないインスタンスからの送信用)
+func (h *WebSocketHandler) DeliverToUnity(roomID string, payload map[string]interface{}) error {
+	if h.hasLocalConnection(roomID) || h.pubsub == nil {
+		return h.SendEventToUnity(roomID, payload)
+	}
+	forward := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		forward[k] = v
+	}
+	forward["room_id"] = roomID // 購読側で配信先を特定するため必須
+	message, err := json.Marshal(forward)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	channel := registry.ChannelFor(ctx, h.registry, roomID)
+	if err := h.pubsub.Publish(ctx, channel, message); err != nil {
+		return fmt.Errorf("publish failed: %w", err)
+	}
+	h.logger.Debug("unity message forwarded via pubsub", slog.String("room_id", roomID), slog.String("channel", channel))
 	return nil
 }
 
-func (h *WebSocketHandler) ListClients(c echo.Context) error {
+func (h *WebSocketHandler) hasLocalConnection(roomID string) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	ids := make([]string, 0, len(h.connections))
-	for id := range h.connections {
-		ids = append(ids, id)
+	return h.connections[roomID] != nil
+}
+
+// replay: Pub/Sub の履歴から取りこぼし (seq > since) を読み出し、再送中に溜めた通常配信と合わせて seq 順に送る
+// 履歴の読み出しは delivery.mu を保持せずに行う (その間の通常配信は deliverSequenced が溜める)。
+func (h *WebSocketHandler) replay(id string, delivery *roomDelivery, c echo.Context) {
+	delivery.mu.Lock()
+	since := delivery.lastSeq
+	delivery.mu.Unlock()
+
+	var msgs []pubsub.Message
+	if replayer, ok := h.pubsub.(pubsub.Replayer); !ok {
+		c.Logger().Warnf("replay requested but pubsub does not support replay id=%s", id)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		var err error
+		msgs, err = replayer.Replay(ctx, id, since)
+		cancel()
+		if err != nil {
+			// 失敗しても溜めた通常配信は送る (取りこぼしは次回再接続時の since で補う)
+			c.Logger().Errorf("replay failed id=%s since=%d err=%v", id, since, err)
+		}
+	}
+
+	backlog := make([]sequencedMessage, 0, len(msgs))
+	for _, m := range msgs {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(m.Payload, &payload); err != nil {
+			continue
+		}
+		backlog = append(backlog, sequencedMessage{seq: m.Seq, payload: payload})
+	}
+	sent, err := delivery.finishReplay(backlog, func(payload map[string]interface{}) error {
+		return h.SendEventToUnity(id, payload)
+	})
+	if err != nil {
+		c.Logger().Errorf("replay send failed id=%s err=%v", id, err)
+		return
+	}
+	c.Logger().Infof("replayed id=%s since=%d count=%d", id, since, sent)
+}
+
+// deliverSequenced: seq 付きメッセージを配信済み seq より新しい場合のみ送信 (再送中なら溜めて再送完了後に送る)
+func (h *WebSocketHandler) deliverSequenced(roomID string, seq int64, payload map[string]interface{}) (bool, error) {
+	h.mu.RLock()
+	delivery := h.deliveries[roomID]
+	h.mu.RUnlock()
+	if delivery == nil || seq <= 0 {
+		return true, h.SendEventToUnity(roomID, payload)
+	}
+	return delivery.offer(seq, payload, func(payload map[string]interface{}) error {
+		return h.SendEventToUnity(roomID, payload)
+	})
+}
+
+// offer: 通常配信を1件受け付ける (配信済みなら false / 再送中なら溜めて true)
+func (d *roomDelivery) offer(seq int64, payload map[string]interface{}, send func(map[string]interface{}) error) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if seq <= d.lastSeq {
+		return false, nil // 再送済み
+	}
+	if d.replaying {
+		if len(d.queued) >= maxReplayQueue {
+			return false, fmt.Errorf("replay queue full")
+		}
+		d.queued = append(d.queued, sequencedMessage{seq: seq, payload: payload})
+		return true, nil
+	}
+	if err := send(payload); err != nil {
+		return false, err
+	}
+	d.lastSeq = seq
+	return true, nil
+}
+
+// finishReplay: 再送分と再送中に溜めた通常配信を seq 順・重複なしで送り、通常配信へ戻す (送った件数を返す)
+func (d *roomDelivery) finishReplay(backlog []sequencedMessage, send func(map[string]interface{}) error) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pending := append(backlog, d.queued...)
+	d.queued, d.replaying = nil, false
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+	sent := 0
+	for _, m := range pending {
+		if m.seq <= d.lastSeq {
+			continue
+		}
+		if err := send(m.payload); err != nil {
+			return sent, fmt.Errorf("seq=%d: %w", m.seq, err)
+		}
+		d.lastSeq = m.seq
+		sent++
+	}
+	return sent, nil
+}
+
+// HasConnection: 指定ルームの Unity 接続をクラスタ内のいずれかのインスタンスが保持しているか
+func (h *WebSocketHandler) HasConnection(roomID string) bool {
+	if h.hasLocalConnection(roomID) {
+		return true
+	}
+	if h.registry == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	_, ok, err := h.registry.Owner(ctx, roomID)
+	if err != nil {
+		// 判定できない場合は接続中とみなす (誤って回収しないため)
+		h.logger.Warn("room ownership lookup failed", slog.String("room_id", roomID), slog.Any("error", err))
+		return true
+	}
+	return ok
+}
+
+// clientInfo: /clients の接続詳細
+type clientInfo struct {
+	RoomID     string     `json:"room_id"`
+	InstanceID string     `json:"instance_id"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	Local      bool       `json:"local"`
+}
+
+// ListClients: クラスタ全体の Unity 接続一覧 (レジストリ未設定時はこのインスタンス分のみ)
+func (h *WebSocketHandler) ListClients(c echo.Context) error {
+	local := h.localRoomIDs()
+	sort.Strings(local)
+	localSet := make(map[string]bool, len(local))
+	for _, id := range local {
+		localSet[id] = true
+	}
+
+	infos := make([]clientInfo, 0, len(local))
+	if h.registry != nil {
+		owned, err := h.registry.List(c.Request().Context())
+		if err != nil {
+			h.logger.Warn("list room ownership failed", slog.Any("error", err))
+		}
+		for _, o := range owned {
+			claimedAt := o.ClaimedAt
+			infos = append(infos, clientInfo{RoomID: o.RoomID, InstanceID: o.InstanceID, ClaimedAt: &claimedAt, Local: localSet[o.RoomID] && o.InstanceID == h.instanceID})
+			if o.InstanceID == h.instanceID {
+				delete(localSet, o.RoomID)
+			}
+		}
+	}
+	// レジストリ未登録 (未設定 / 登録失敗) のローカル接続も含める
+	for _, id := range local {
+		if localSet[id] {
+			infos = append(infos, clientInfo{RoomID: id, InstanceID: h.instanceID, Local: true})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].RoomID < infos[j].RoomID })
+
+	ids := make([]string, len(infos))
+	for i, info := range infos {
+		ids[i] = info.RoomID
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"clients":     ids,
+		"connections": infos,
+		"instance_id": h.instanceID,
+	})
+}
+
+// subscribeWithRetry: 購読が ctx のキャンセル以外で終了したら、間隔を倍にしながら購読し直す
+// 一定時間 (subscribeRetryMax) 続いた購読の後は間隔を初期値に戻す。
+func (h *WebSocketHandler) subscribeWithRetry(ctx context.Context, channel string, handler pubsub.MessageHandler) error {
+	backoff := subscribeRetryMin
+	for {
+		start := time.Now()
+		err := h.pubsub.Subscribe(ctx, channel, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Since(start) >= subscribeRetryMax {
+			backoff = subscribeRetryMin
+		}
+		h.logger.Error("pubsub subscription stopped, retrying", slog.String("channel", channel), slog.Duration("backoff", backoff), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, subscribeRetryMax)
 	}
-	return c.JSON(http.StatusOK, map[string]interface{}{"clients": ids})
 }
 
 // StartPubSubSubscription: Pub/Sub購読を開始（別goroutineで実行）
 // REST APIからのイベントをUnityに配信する
 func (h *WebSocketHandler) StartPubSubSubscription(ctx context.Context) error {
-	handler := func(channel string, message []byte) error {
+	h.subscribed.Store(true)
+	defer h.subscribed.Store(false)
+	handler := func(ctx context.Context, channel string, message []byte) error {
 		var payload map[string]interface{}
 		if err := json.Unmarshal(message, &payload); err != nil {
 			h.logger.Error("pubsub message unmarshal failed", slog.Any("error", err))
@@ -256,14 +952,27 @@ func (h *WebSocketHandler) StartPubSubSubscription(ctx context.Context) error {
 			return fmt.Errorf("room_id not found in payload")
 		}
 
-		// 自分が接続を持っている場合のみ配信
-		if err := h.SendEventToUnity(roomID, payload); err != nil {
+		// 自分が接続を持っている場合のみ配信 (再送済みの seq は送らない)
+		// ctx は発行側 (押下リクエスト) のトレースを引き継いだ consumer スパンを含む
+		seq, _ := payload[pubsub.SeqField].(float64)
+		_, span := otel.Tracer(tracerName).Start(ctx, "WebSocketHandler.SendEventToUnity", trace.WithAttributes(
+			attribute.String("room_id", roomID),
+			attribute.Int64("seq", int64(seq)),
+		))
+		sent, err := h.deliverSequenced(roomID, int64(seq), payload)
+		span.SetAttributes(attribute.Bool("local_connection", err == nil), attribute.Bool("sent", sent))
+		span.End()
+		if err != nil {
 			// 接続がないのは正常（他のインスタンスが持っている）
 			h.logger.Debug("no local connection for room, skip delivery",
 				slog.String("room_id", roomID),
 				slog.String("event_type", fmt.Sprintf("%v", payload["event_type"])))
 			return nil
 		}
+		if !sent {
+			h.logger.Debug("skip already replayed message", slog.String("room_id", roomID), slog.Int64("seq", int64(seq)))
+			return nil
+		}
 
 		h.logger.Info("event delivered to unity via pubsub",
 			slog.String("room_id", roomID),
@@ -272,8 +981,27 @@ func (h *WebSocketHandler) StartPubSubSubscription(ctx context.Context) error {
 	}
 
 	// 購読開始（ブロッキング）
-	h.logger.Info("starting pubsub subscription", slog.String("channel", pubsub.ChannelGameEvents))
-	if err := h.pubsub.Subscribe(ctx, pubsub.ChannelGameEvents, handler); err != nil {
+	// 全体ブロードキャスト (所有者不明時のフォールバック) + インスタンス宛てチャネルの両方を購読
+	channels := []string{pubsub.ChannelGameEvents}
+	if h.registry != nil && h.instanceID != "" {
+		channels = append(channels, pubsub.InstanceChannel(h.instanceID))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, len(channels))
+	for _, ch := range channels {
+		h.logger.Info("starting pubsub subscription", slog.String("channel", ch))
+		go func(ch string) {
+			errCh <- h.subscribeWithRetry(ctx, ch, handler)
+		}(ch)
+	}
+	// いずれかの購読が終了したら残りも止める
+	err := <-errCh
+	cancel()
+	for i := 1; i < len(channels); i++ {
+		<-errCh
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
 		h.logger.Error("pubsub subscription failed", slog.Any("error", err))
 		return err
 	}
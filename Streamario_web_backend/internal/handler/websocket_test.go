@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/internal/service"
+	"streamerrio-backend/pkg/pubsub"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// newTestDelivery: writeLoop 未起動の接続を room に登録する (送信内容は conn.out から読む)
+func newTestDelivery(t *testing.T, ps pubsub.PubSub, roomID string, delivery *roomDelivery) (*WebSocketHandler, *unityConn) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewWebSocketHandler(ps, logger)
+	conn := newUnityConn(nil, 1, DefaultConnOptions(), logger)
+	conn.roomID = roomID
+	h.connections[roomID] = conn
+	h.deliveries[roomID] = delivery
+	return h, conn
+}
+
+// sentSeqs: 送信キューに積まれたメッセージの seq を順に取り出す
+func sentSeqs(t *testing.T, conn *unityConn) []int64 {
+	t.Helper()
+	var seqs []int64
+	for {
+		select {
+		case frame := <-conn.out:
+			var payload struct {
+				Seq int64 `json:"seq"`
+			}
+			if err := json.Unmarshal(frame.data, &payload); err != nil {
+				t.Fatalf("unmarshal %s: %v", frame.data, err)
+			}
+			seqs = append(seqs, payload.Seq)
+		default:
+			return seqs
+		}
+	}
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWebSocketHandler_ReplayMergesLiveDeliveries(t *testing.T) {
+	ctx := context.Background()
+	ps := pubsub.NewMemoryPubSub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := 0; i < 5; i++ {
+		if err := ps.Publish(ctx, pubsub.ChannelGameEvents, []byte(`{"type":"game_event","room_id":"room-a"}`)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	// since=2 で再接続し、再送の完了前に通常配信 (seq 6 と、履歴と重複する 4) が届く
+	delivery := &roomDelivery{lastSeq: 2, replaying: true}
+	h, conn := newTestDelivery(t, ps, "room-a", delivery)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, seq := range []int64{6, 4} {
+			if _, err := h.deliverSequenced("room-a", seq, map[string]interface{}{"type": "game_event", "seq": seq}); err != nil {
+				t.Errorf("deliverSequenced(%d): %v", seq, err)
+			}
+		}
+	}()
+	select {
+	case <-done: // 再送中でも購読ループを止めない
+	case <-time.After(time.Second):
+		t.Fatal("deliverSequenced blocked during replay")
+	}
+	if got := sentSeqs(t, conn); len(got) != 0 {
+		t.Fatalf("live messages sent before replay: %v", got)
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/ws-unity", nil), httptest.NewRecorder())
+	h.replay("room-a", delivery, c)
+	if got, want := sentSeqs(t, conn), []int64{3, 4, 5, 6}; !equalSeqs(got, want) {
+		t.Fatalf("sent seqs = %v, want %v", got, want)
+	}
+
+	// 再送後は通常配信に戻り、配信済みの seq は送らない
+	if sent, err := h.deliverSequenced("room-a", 5, map[string]interface{}{"type": "game_event", "seq": 5}); sent || err != nil {
+		t.Fatalf("duplicate seq: sent=%v err=%v", sent, err)
+	}
+	if sent, err := h.deliverSequenced("room-a", 7, map[string]interface{}{"type": "game_event", "seq": 7}); !sent || err != nil {
+		t.Fatalf("new seq: sent=%v err=%v", sent, err)
+	}
+	if got := sentSeqs(t, conn); !equalSeqs(got, []int64{7}) {
+		t.Fatalf("sent after replay = %v, want [7]", got)
+	}
+}
+
+func TestRoomDelivery_FinishReplayWithoutHistory(t *testing.T) {
+	// 履歴を取れなくても、溜めた通常配信は seq 順に送って通常配信へ戻る
+	d := &roomDelivery{lastSeq: 10, replaying: true}
+	for _, seq := range []int64{13, 11, 9} {
+		if _, err := d.offer(seq, map[string]interface{}{"seq": seq}, nil); err != nil {
+			t.Fatalf("offer(%d): %v", seq, err)
+		}
+	}
+	var sent []int64
+	send := func(p map[string]interface{}) error {
+		sent = append(sent, p["seq"].(int64))
+		return nil
+	}
+	if n, err := d.finishReplay(nil, send); n != 2 || err != nil {
+		t.Fatalf("finishReplay = %d, %v; want 2", n, err)
+	}
+	if !equalSeqs(sent, []int64{11, 13}) || d.lastSeq != 13 || d.replaying {
+		t.Fatalf("sent=%v lastSeq=%d replaying=%v", sent, d.lastSeq, d.replaying)
+	}
+}
+
+func TestWebSocketHandler_RelayActionToUnity(t *testing.T) {
+	h, conn := newTestDelivery(t, nil, "room-a", &roomDelivery{})
+	relay := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/relay", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		if err := h.RelayActionToUnity(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("RelayActionToUnity: %v", err)
+		}
+		return rec
+	}
+
+	// type の無いペイロードも v1 接続へはそのままのフラットな JSON で届く
+	if rec := relay(`{"room_id":"room-a","action":"spawn"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	select {
+	case frame := <-conn.out:
+		if got := string(frame.data); got != `{"action":"spawn"}` {
+			t.Fatalf("forwarded %s", got)
+		}
+	default:
+		t.Fatal("payload was not forwarded")
+	}
+
+	if rec := relay(`{"room_id":"room-b","action":"spawn"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown room: status = %d", rec.Code)
+	}
+	if rec := relay(`{"action":"spawn"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing room_id: status = %d", rec.Code)
+	}
+}
+
+// ownedRoomRepo: Get だけを実装した RoomRepository (err があればそれを返す)
+type ownedRoomRepo struct {
+	repository.RoomRepository
+	room *model.Room
+	err  error
+}
+
+func (r ownedRoomRepo) Get(context.Context, string) (*model.Room, error) { return r.room, r.err }
+
+func TestWebSocketHandler_ReconnectOwnershipFailsClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		repo ownedRoomRepo
+		want int
+	}{
+		{"other streamer's room", ownedRoomRepo{room: &model.Room{ID: "room-a", StreamerID: "streamer-1", Status: model.RoomStatusRunning}}, http.StatusForbidden},
+		{"ownership lookup failed", ownedRoomRepo{err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewWebSocketHandler(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			h.SetRoomService(service.NewRoomService(tc.repo, &config.Config{}))
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/ws-unity?room_id=room-a&since=3", nil)
+			if err := h.HandleUnityConnection(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("HandleUnityConnection: %v", err)
+			}
+			// アップグレードせずに断り、接続も登録しない
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.want, rec.Body)
+			}
+			if len(h.connections) != 0 {
+				t.Fatalf("connection registered: %v", h.connections)
+			}
+		})
+	}
+}
+
+// roomCount: 登録中の Unity 接続数
+func roomCount(h *WebSocketHandler) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.connections)
+}
+
+func TestWebSocketHandler_V1ReadDeadline(t *testing.T) {
+	h := NewWebSocketHandler(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	h.SetConnOptions(ConnOptions{PingInterval: 20 * time.Millisecond, PongWait: 100 * time.Millisecond, WriteWait: time.Second, SendQueueSize: 16})
+	e := echo.New()
+	e.GET("/ws-unity", h.HandleUnityConnection)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	dial := func() *websocket.Conn {
+		t.Helper()
+		// protocol 省略 = v1
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws-unity", "", srv.URL)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return ws
+	}
+	waitRooms := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for roomCount(h) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("rooms = %d, want %d", roomCount(h), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// 読み続ける (= ping 制御フレームに pong を返す) v1 クライアントは、メッセージを送らなくても PongWait を過ぎて残る
+	alive := dial()
+	defer alive.Close()
+	go func() {
+		var msg string
+		for websocket.Message.Receive(alive, &msg) == nil {
+		}
+	}()
+	waitRooms(1)
+	time.Sleep(300 * time.Millisecond)
+	if roomCount(h) != 1 {
+		t.Fatal("v1 client answering pings was evicted")
+	}
+
+	// 読まない (= pong を返さない半開き相当の) v1 クライアントは受信期限で切断される
+	silent := dial()
+	defer silent.Close()
+	waitRooms(2)
+	waitRooms(1)
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 既定チーム名 (デフォルトカタログおよび Unity 向け team_tops のキーで使用)
+const (
+	TeamSkill = "skill"
+	TeamEnemy = "enemy"
+)
+
+// TeamAll: team_tops で全体の最多押下者に使う予約済みのキー (カタログのチーム名には使えない)
+const TeamAll = "all"
+
+// カタログ定義の上限値 (Unity からの過大な定義を防ぐ)
+const (
+	MaxCatalogEvents     = 32
+	MaxEventLabelLength  = 32
+	MaxEventThreshold    = 100000
+	defaultLevelMultiply = 1.0
+)
+
+// identPattern: 種別 ID / チーム名に許可する文字列 (Redis キーや URL にそのまま載せるため制限)
+var identPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]{0,31}$`)
+
+// EventCatalog: ルームごとのボタン (イベント種別) 定義集
+// 定義順を保持し、種別 ID からの逆引きを提供する。
+type EventCatalog struct {
+	events []EventConfig
+	index  map[EventType]int
+}
+
+// NewEventCatalog: 定義を検証してカタログを構築 (不正な定義はエラー)
+func NewEventCatalog(defs []EventConfig) (*EventCatalog, error) {
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("event catalog must not be empty")
+	}
+	if len(defs) > MaxCatalogEvents {
+		return nil, fmt.Errorf("event catalog has too many events: %d (max %d)", len(defs), MaxCatalogEvents)
+	}
+	c := &EventCatalog{events: make([]EventConfig, 0, len(defs)), index: make(map[EventType]int, len(defs))}
+	for i, def := range defs {
+		normalized, err := normalizeEventConfig(def)
+		if err != nil {
+			return nil, fmt.Errorf("event[%d]: %w", i, err)
+		}
+		if _, dup := c.index[normalized.EventType]; dup {
+			return nil, fmt.Errorf("event[%d]: duplicate id %q", i, normalized.EventType)
+		}
+		c.index[normalized.EventType] = len(c.events)
+		c.events = append(c.events, normalized)
+	}
+	return c, nil
+}
+
+// normalizeEventConfig: 1件分の定義を検証し、省略値を補完する
+func normalizeEventConfig(def EventConfig) (EventConfig, error) {
+	def.EventType = EventType(strings.TrimSpace(string(def.EventType)))
+	if !identPattern.MatchString(string(def.EventType)) {
+		return def, fmt.Errorf("invalid id %q (lowercase letters, digits, '_' or '-', up to 32 chars)", def.EventType)
+	}
+	def.Team = strings.TrimSpace(def.Team)
+	if !identPattern.MatchString(def.Team) {
+		return def, fmt.Errorf("invalid team %q for %s", def.Team, def.EventType)
+	}
+	if def.Team == TeamAll {
+		return def, fmt.Errorf("team %q is reserved for %s", TeamAll, def.EventType)
+	}
+	def.Label = strings.TrimSpace(def.Label)
+	if def.Label == "" {
+		def.Label = string(def.EventType)
+	}
+	if len([]rune(def.Label)) > MaxEventLabelLength {
+		return def, fmt.Errorf("label too long for %s (max %d chars)", def.EventType, MaxEventLabelLength)
+	}
+	if def.MinThreshold < 1 {
+		return def, fmt.Errorf("min_threshold must be >= 1 for %s", def.EventType)
+	}
+	if def.MaxThreshold > MaxEventThreshold {
+		return def, fmt.Errorf("max_threshold must be <= %d for %s", MaxEventThreshold, def.EventType)
+	}
+	if def.BaseThreshold < def.MinThreshold || def.BaseThreshold > def.MaxThreshold {
+		return def, fmt.Errorf("thresholds must satisfy min <= base <= max for %s", def.EventType)
+	}
+	if def.LevelMultiplier == 0 {
+		def.LevelMultiplier = defaultLevelMultiply
+	}
+	if def.LevelMultiplier < 1 {
+		return def, fmt.Errorf("level_multiplier must be >= 1 for %s", def.EventType)
+	}
+	if def.RateLimits != nil {
+		if err := def.RateLimits.Validate(); err != nil {
+			return def, fmt.Errorf("%w for %s", err, def.EventType)
+		}
+	}
+	return def, nil
+}
+
+// Lookup: 種別 ID から定義を取得
+func (c *EventCatalog) Lookup(et EventType) (*EventConfig, bool) {
+	i, ok := c.index[et]
+	if !ok {
+		return nil, false
+	}
+	cfg := c.events[i]
+	return &cfg, true
+}
+
+// Events: 定義順のコピーを返す
+func (c *EventCatalog) Events() []EventConfig {
+	out := make([]EventConfig, len(c.events))
+	copy(out, c.events)
+	return out
+}
+
+// Types: 定義順の種別 ID 一覧
+func (c *EventCatalog) Types() []EventType {
+	out := make([]EventType, len(c.events))
+	for i, ev := range c.events {
+		out[i] = ev.EventType
+	}
+	return out
+}
+
+// Teams: 出現順のチーム名一覧 (重複なし)
+func (c *EventCatalog) Teams() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, ev := range c.events {
+		if !seen[ev.Team] {
+			seen[ev.Team] = true
+			out = append(out, ev.Team)
+		}
+	}
+	return out
+}
+
+// TeamOf: 種別 ID が属するチーム名 (未定義なら空文字)
+func (c *EventCatalog) TeamOf(et EventType) string {
+	if cfg, ok := c.Lookup(et); ok {
+		return cfg.Team
+	}
+	return ""
+}
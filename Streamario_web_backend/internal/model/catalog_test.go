@@ -0,0 +1,90 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func validEvent(id, team string) EventConfig {
+	return EventConfig{EventType: EventType(id), Team: team, BaseThreshold: 5, MinThreshold: 3, MaxThreshold: 50}
+}
+
+func TestNewEventCatalog_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*EventConfig)
+		wantErr string
+	}{
+		{"valid", func(*EventConfig) {}, ""},
+		{"empty id", func(e *EventConfig) { e.EventType = "" }, "invalid id"},
+		{"uppercase id", func(e *EventConfig) { e.EventType = "Skill1" }, "invalid id"},
+		{"id too long", func(e *EventConfig) { e.EventType = EventType(strings.Repeat("a", 33)) }, "invalid id"},
+		{"invalid team", func(e *EventConfig) { e.Team = "red team" }, "invalid team"},
+		{"reserved team", func(e *EventConfig) { e.Team = TeamAll }, "reserved"},
+		{"reserved team with spaces", func(e *EventConfig) { e.Team = " all " }, "reserved"},
+		{"label too long", func(e *EventConfig) { e.Label = strings.Repeat("あ", MaxEventLabelLength+1) }, "label too long"},
+		{"min below 1", func(e *EventConfig) { e.MinThreshold = 0 }, "min_threshold"},
+		{"max above limit", func(e *EventConfig) { e.MaxThreshold = MaxEventThreshold + 1 }, "max_threshold"},
+		{"base below min", func(e *EventConfig) { e.BaseThreshold = 2 }, "min <= base <= max"},
+		{"base above max", func(e *EventConfig) { e.BaseThreshold = 51 }, "min <= base <= max"},
+		{"multiplier below 1", func(e *EventConfig) { e.LevelMultiplier = 0.5 }, "level_multiplier"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			def := validEvent("skill1", TeamSkill)
+			tc.mutate(&def)
+			_, err := NewEventCatalog([]EventConfig{def})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewEventCatalog_NormalizesAndKeepsOrder(t *testing.T) {
+	c, err := NewEventCatalog([]EventConfig{
+		{EventType: " boss ", Team: " enemy ", BaseThreshold: 20, MinThreshold: 10, MaxThreshold: 200},
+		validEvent("heal", TeamSkill),
+		validEvent("spawn", TeamEnemy),
+	})
+	if err != nil {
+		t.Fatalf("NewEventCatalog: %v", err)
+	}
+	boss, ok := c.Lookup("boss")
+	if !ok {
+		t.Fatal("trimmed id not found")
+	}
+	// 省略したラベル / 倍率は補完する
+	if boss.Label != "boss" || boss.Team != TeamEnemy || boss.LevelMultiplier != defaultLevelMultiply {
+		t.Fatalf("normalized = %+v", boss)
+	}
+	if got := c.Types(); len(got) != 3 || got[0] != "boss" || got[1] != "heal" || got[2] != "spawn" {
+		t.Fatalf("Types = %v", got)
+	}
+	if got := c.Teams(); len(got) != 2 || got[0] != TeamEnemy || got[1] != TeamSkill {
+		t.Fatalf("Teams = %v", got)
+	}
+	if c.TeamOf("heal") != TeamSkill || c.TeamOf("missing") != "" {
+		t.Fatalf("TeamOf mismatch")
+	}
+}
+
+func TestNewEventCatalog_RejectsDuplicatesAndSize(t *testing.T) {
+	// 前後の空白を除いた後で重複を判定する
+	_, err := NewEventCatalog([]EventConfig{validEvent("skill1", TeamSkill), validEvent(" skill1", TeamEnemy)})
+	if err == nil || !strings.Contains(err.Error(), `event[1]: duplicate id "skill1"`) {
+		t.Fatalf("err = %v, want duplicate id", err)
+	}
+	if _, err := NewEventCatalog(nil); err == nil {
+		t.Fatal("empty catalog should be rejected")
+	}
+	if _, err := NewEventCatalog(make([]EventConfig, MaxCatalogEvents+1)); err == nil || !strings.Contains(err.Error(), "too many events") {
+		t.Fatalf("err = %v, want too many events", err)
+	}
+}
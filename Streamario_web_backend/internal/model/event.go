@@ -4,6 +4,7 @@ import "time"
 
 type EventType string
 
+// 既定カタログのイベント種別 (ルームがカタログを宣言しない場合に使用)
 const (
 	SKILL1 EventType = "skill1"
 	SKILL2 EventType = "skill2"
@@ -13,10 +14,6 @@ const (
 	ENEMY3 EventType = "enemy3"
 )
 
-func ListEventTypes() []EventType {
-	return []EventType{SKILL1, SKILL2, SKILL3, ENEMY1, ENEMY2, ENEMY3}
-}
-
 type Event struct {
 	ID          int64     `json:"id" db:"id"`
 	RoomID      string    `json:"room_id" db:"room_id"`
@@ -24,23 +21,30 @@ type Event struct {
 	EventType   EventType `json:"event_type" db:"event_type"`
 	TriggeredAt time.Time `json:"triggered_at" db:"triggered_at"`
 	Metadata    string    `json:"metadata" db:"metadata"`
+	PressCount  int       `json:"press_count" db:"press_count"` // この行が表す押下数 (1回の送信分をまとめて1行に記録 / 0 は 1 扱い)
 }
 
+// EventConfig: ボタン1種分の定義 (ルームのイベントカタログ要素)
 type EventConfig struct {
-	EventType       EventType `json:"event_type"`
-	BaseThreshold   int       `json:"base_threshold"`
-	MinThreshold    int       `json:"min_threshold"`
-	MaxThreshold    int       `json:"max_threshold"`
-	LevelMultiplier float64   `json:"level_multiplier"` // 互換性のため残すが未使用
+	EventType       EventType   `json:"id"`
+	Label           string      `json:"label"`
+	Team            string      `json:"team"`
+	BaseThreshold   int         `json:"base_threshold"`
+	MinThreshold    int         `json:"min_threshold"`
+	MaxThreshold    int         `json:"max_threshold"`
+	LevelMultiplier float64     `json:"level_multiplier,omitempty"` // escalation/decay 方式で発動ごとに閾値へ掛ける倍率
+	RateLimits      *RateLimits `json:"rate_limits,omitempty"`      // 押下のレート制限 (省略時はサーバ既定値)
 }
 
 type EventResult struct {
-	EventType       EventType `json:"event_type"`
-	CurrentCount    int       `json:"current_count"`
-	RequiredCount   int       `json:"required_count"`
-	EffectTriggered bool      `json:"effect_triggered"`
-	ViewerCount     int       `json:"viewer_count"`
-	NextThreshold   int       `json:"next_threshold"`
+	EventType       EventType      `json:"event_type"`
+	CurrentCount    int            `json:"current_count"`
+	CurrentLevel    int            `json:"current_level"`
+	RequiredCount   int            `json:"required_count"`
+	EffectTriggered bool           `json:"effect_triggered"`
+	ViewerCount     int            `json:"viewer_count"`
+	NextThreshold   int            `json:"next_threshold"`
+	Moderation      *PressDecision `json:"moderation,omitempty"` // レート制限/不正検知の判定
 }
 
 type RoomEventStat struct {
@@ -51,3 +55,15 @@ type RoomEventStat struct {
 	NextThreshold int       `json:"next_threshold"`
 	ViewerCount   int       `json:"viewer_count"`
 }
+
+// GameEvent: 閾値到達による発動履歴 (game_events テーブル)
+type GameEvent struct {
+	ID           int64     `json:"id" db:"id"`
+	RoomID       string    `json:"room_id" db:"room_id"`
+	EventType    EventType `json:"event_type" db:"event_type"`
+	TriggerCount int       `json:"trigger_count" db:"trigger_count"` // 発動時点の押下カウント
+	Threshold    int       `json:"threshold" db:"threshold"`         // 発動に要した閾値
+	Level        int       `json:"level" db:"level"`                 // 発動時のレベル (Threshold を算出したレベル)
+	ViewerCount  int       `json:"viewer_count" db:"viewer_count"`   // 発動時点のアクティブ視聴者数
+	SentAt       time.Time `json:"sent_at" db:"sent_at"`
+}
@@ -46,12 +46,6 @@ type RoomResultSummary struct {
 	ViewerTotals []ViewerTotal          `json:"viewer_totals"`
 }
 
-type TeamTopSummary struct {
-	TopSkill  *EventTop `json:"top_skill"`
-	TopEnemy  *EventTop `json:"top_enemy"`
-	TopAll    *EventTop `json:"top_all"`
-}
-
 // ViewerSummary: 終了後に返す視聴者別内訳
 type ViewerSummary struct {
 	ViewerID   string            `json:"viewer_id"`
@@ -59,3 +53,12 @@ type ViewerSummary struct {
 	Counts     map[EventType]int `json:"counts"`
 	Total      int               `json:"total"`
 }
+
+// TriggerHistory: 発動履歴 API 用の1ページ分 (新しい順)
+type TriggerHistory struct {
+	Triggers   []GameEvent       `json:"triggers"`
+	Totals     map[EventType]int `json:"totals"` // 種別ごとの累計発動回数 (ページングに依らない)
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+	NextOffset *int              `json:"next_offset"` // 次ページが無ければ null
+}
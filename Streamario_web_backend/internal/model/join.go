@@ -0,0 +1,9 @@
+package model
+
+// JoinInfo: 視聴者をルームへ誘導するための情報 (Unity の room_created / オーバーレイ向け)
+type JoinInfo struct {
+	RoomID   string `json:"room_id"`
+	JoinCode string `json:"join_code,omitempty"` // 配信画面から入力できる短いコード (確保に失敗した場合は空)
+	JoinURL  string `json:"join_url"`            // 視聴者ページの URL
+	QRCode   string `json:"qr_code"`             // JoinURL の QR (PNG の data URI)
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxRateLimitBurst: バケット容量の上限 (カタログ定義の過大な値を防ぐ)
+const MaxRateLimitBurst = 10000
+
+// RateLimit: トークンバケット1つ分の設定
+type RateLimit struct {
+	Rate  float64 `json:"rate"`  // 1秒あたりの補充数 (= 持続的に許可する押下/秒)
+	Burst int64   `json:"burst"` // 連続で許可する最大押下数
+}
+
+// RateLimits: イベント種別ごとの押下レート制限 (省略した単位はサーバ既定値を使う)
+type RateLimits struct {
+	Viewer *RateLimit `json:"viewer,omitempty"` // 視聴者ごと
+	IP     *RateLimit `json:"ip,omitempty"`     // 送信元 IP ごと
+	Room   *RateLimit `json:"room,omitempty"`   // ルーム全体
+}
+
+// Validate: 各バケット設定の範囲チェック
+func (r *RateLimits) Validate() error {
+	for _, b := range []struct {
+		name string
+		l    *RateLimit
+	}{{"viewer", r.Viewer}, {"ip", r.IP}, {"room", r.Room}} {
+		name, l := b.name, b.l
+		if l == nil {
+			continue
+		}
+		if l.Rate <= 0 {
+			return fmt.Errorf("rate_limits.%s.rate must be > 0", name)
+		}
+		if l.Burst < 1 || l.Burst > MaxRateLimitBurst {
+			return fmt.Errorf("rate_limits.%s.burst must be between 1 and %d", name, MaxRateLimitBurst)
+		}
+	}
+	return nil
+}
+
+// 押下判定の結果
+const (
+	PressAllow  = "allow"  // 全量を受理
+	PressReduce = "reduce" // 一部のみ受理 (レート超過分の切り捨て / 重み付け)
+	PressReject = "reject" // 受理しない
+)
+
+// 判定・フラグの理由
+const (
+	ReasonViewerRateLimited = "viewer_rate_limited" // 視聴者ごとのバケット超過
+	ReasonIPRateLimited     = "ip_rate_limited"     // IP ごとのバケット超過
+	ReasonRoomRateLimited   = "room_rate_limited"   // ルーム全体のバケット超過
+	ReasonRegularInterval   = "regular_interval"    // 押下間隔が機械的に一定
+	ReasonSharedIP          = "shared_ip"           // 同一 IP から多数の視聴者 ID
+)
+
+// ViewerFlag: 不正の疑いでフラグ付けされた視聴者
+// Action=reduce の間は押下を Weight 倍に、reject の間は押下を受理しない (ExpiresAt まで / nil ならルーム終了まで有効)。
+type ViewerFlag struct {
+	ViewerID  string     `json:"viewer_id"`
+	Reason    string     `json:"reason"`
+	Action    string     `json:"action"`
+	Weight    float64    `json:"weight"`
+	Detail    string     `json:"detail,omitempty"`
+	FlaggedAt time.Time  `json:"flagged_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Active: at の時点でフラグが有効か
+func (f *ViewerFlag) Active(at time.Time) bool {
+	return f != nil && (f.ExpiresAt == nil || at.Before(*f.ExpiresAt))
+}
+
+// PressDecision: 1種別分の押下に対するレート制限/不正検知の判定
+type PressDecision struct {
+	Action       string      `json:"action"`    // allow / reduce / reject
+	Requested    int64       `json:"requested"` // 送信された押下数
+	Accepted     int64       `json:"accepted"`  // カウントに反映した押下数
+	Reason       string      `json:"reason,omitempty"`
+	RetryAfterMs int64       `json:"retry_after_ms,omitempty"` // レート超過時、全量が受理されるまでの目安
+	Flag         *ViewerFlag `json:"flag,omitempty"`
+}
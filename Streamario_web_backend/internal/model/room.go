@@ -1,13 +1,121 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RoomStatus: ルームのライフサイクル状態
+//
+//	created → lobby → running ⇄ paused
+//	いずれの非終端状態からも ended / expired へ遷移できる (終端状態からの遷移は不可)
+type RoomStatus string
+
+const (
+	RoomStatusCreated RoomStatus = "created" // レコード作成直後 (Unity 未接続)
+	RoomStatusLobby   RoomStatus = "lobby"   // Unity 接続済み・ゲーム開始待ち
+	RoomStatusRunning RoomStatus = "running" // ゲーム進行中 (押下を受け付ける)
+	RoomStatusPaused  RoomStatus = "paused"  // 一時停止中
+	RoomStatusEnded   RoomStatus = "ended"   // 正常終了
+	RoomStatusExpired RoomStatus = "expired" // 期限切れ/放置により終了
+)
+
+// roomTransitions: 許可される状態遷移 (from → to の集合)
+var roomTransitions = map[RoomStatus][]RoomStatus{
+	RoomStatusCreated: {RoomStatusLobby, RoomStatusRunning, RoomStatusEnded, RoomStatusExpired},
+	RoomStatusLobby:   {RoomStatusRunning, RoomStatusEnded, RoomStatusExpired},
+	RoomStatusRunning: {RoomStatusPaused, RoomStatusEnded, RoomStatusExpired},
+	RoomStatusPaused:  {RoomStatusRunning, RoomStatusEnded, RoomStatusExpired},
+}
+
+// NormalizeRoomStatus: 旧ステータス値 (active/inactive) を新しい状態へ読み替える
+func NormalizeRoomStatus(s RoomStatus) RoomStatus {
+	switch s {
+	case "active":
+		return RoomStatusRunning
+	case "inactive":
+		return RoomStatusLobby
+	case "":
+		return RoomStatusCreated
+	}
+	return s
+}
+
+// IsTerminal: 終端状態 (ended / expired) か
+func (s RoomStatus) IsTerminal() bool {
+	return s == RoomStatusEnded || s == RoomStatusExpired
+}
+
+// CanTransition: from から to への遷移が許可されているか
+func (s RoomStatus) CanTransition(to RoomStatus) bool {
+	for _, next := range roomTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionSources: to へ遷移可能な遷移元状態の一覧
+func TransitionSources(to RoomStatus) []RoomStatus {
+	var out []RoomStatus
+	for from, nexts := range roomTransitions {
+		for _, next := range nexts {
+			if next == to {
+				out = append(out, from)
+			}
+		}
+	}
+	return out
+}
 
 type Room struct {
 	ID         string     `json:"id" db:"id"`
 	StreamerID string     `json:"streamer_id" db:"streamer_id"`
 	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
 	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
-	Status     string     `json:"status" db:"status"`
+	Status     RoomStatus `json:"status" db:"status"`
 	Settings   string     `json:"settings" db:"settings"`
+	LobbyAt    *time.Time `json:"lobby_at" db:"lobby_at"`
+	StartedAt  *time.Time `json:"started_at" db:"started_at"`
+	PausedAt   *time.Time `json:"paused_at" db:"paused_at"`
+	ResumedAt  *time.Time `json:"resumed_at" db:"resumed_at"`
 	EndedAt    *time.Time `json:"ended_at" db:"ended_at"`
+	ExpiredAt  *time.Time `json:"expired_at" db:"expired_at"`
+}
+
+// RoomSettings: rooms.settings (JSONB) に保存するルーム単位の設定
+type RoomSettings struct {
+	EventCatalog []EventConfig      `json:"event_catalog,omitempty"` // Unity が宣言したボタン定義 (空なら既定カタログ)
+	Threshold    *ThresholdSettings `json:"threshold,omitempty"`     // 閾値算出方式 (nil なら step)
+}
+
+// ThresholdSettings: ルームが選択する閾値算出方式とそのパラメータ
+type ThresholdSettings struct {
+	Strategy        string  `json:"strategy"`                   // step / linear / log / escalation / decay
+	Factor          float64 `json:"factor,omitempty"`           // linear/log の視聴者数係数 (0 なら既定値)
+	CooldownSeconds int     `json:"cooldown_seconds,omitempty"` // decay でレベルが1下がるまでの秒数 (0 なら既定値)
+}
+
+// ParseRoomSettings: settings 列の JSON を構造体へ変換 (空/NULL は空設定)
+func ParseRoomSettings(raw string) (*RoomSettings, error) {
+	settings := &RoomSettings{}
+	if strings.TrimSpace(raw) == "" || raw == "null" {
+		return settings, nil
+	}
+	if err := json.Unmarshal([]byte(raw), settings); err != nil {
+		return nil, fmt.Errorf("invalid room settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Encode: settings 列へ保存する JSON 文字列に変換
+func (s *RoomSettings) Encode() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
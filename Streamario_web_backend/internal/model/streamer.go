@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// AnonymousStreamerID: 配信者アカウント導入前 (未認証の Unity 接続) に作成されたルームの streamer_id
+const AnonymousStreamerID = "unity"
+
+// Streamer: 配信者アカウント (ルームの所有者)
+type Streamer struct {
+	ID        string     `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// StreamerAPIKey: 配信者の API キー (平文は発行時のみ返し、ハッシュのみ保存)
+type StreamerAPIKey struct {
+	ID         string     `json:"id" db:"id"`
+	StreamerID string     `json:"streamer_id" db:"streamer_id"`
+	Name       string     `json:"name" db:"name"`
+	SecretHash []byte     `json:"-" db:"secret_hash"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/metrics"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -15,46 +17,63 @@ import (
 // EventRepository: イベント永続化用インタフェース
 // 主要イベントクエリのトレースログを出力し、運用時の観測性を高める。
 type EventRepository interface {
-	CreateEvent(event *model.Event) error // 単一イベント挿入
-	CreateEventsBatch(events []*model.Event) error // バッチ挿入（効率的）
-	ListEventViewerCounts(roomID string) ([]model.EventAggregate, error)
-	ListEventTotals(roomID string) ([]model.EventTotal, error)
-	ListViewerTotals(roomID string) ([]model.ViewerTotal, error)
-	ListViewerEventCounts(roomID, viewerID string) ([]model.ViewerEventCount, error)
+	CreateEvent(ctx context.Context, event *model.Event) error // 単一イベント挿入 (PressCount 回分の押下を1行で記録)
+	CreateEventsBatch(ctx context.Context, events []*model.Event) error // バッチ挿入（効率的）
+	// 以下の集計は各行の press_count を合計する (1行 = 1回の送信分の押下)
+	ListEventViewerCounts(ctx context.Context, roomID string) ([]model.EventAggregate, error)
+	ListEventTotals(ctx context.Context, roomID string) ([]model.EventTotal, error)
+	ListViewerTotals(ctx context.Context, roomID string) ([]model.ViewerTotal, error)
+	ListViewerEventCounts(ctx context.Context, roomID, viewerID string) ([]model.ViewerEventCount, error)
+	CreateGameEvent(ctx context.Context, ge *model.GameEvent) error                                          // 発動履歴を記録
+	ListGameEvents(ctx context.Context, roomID string, eventType model.EventType, limit, offset int) ([]model.GameEvent, error) // 発動履歴 (新しい順, eventType 空なら全種別)
+	ListTriggerTotals(ctx context.Context, roomID string) ([]model.EventTotal, error)                        // 種別ごとの発動回数
+	ProbeEventTypes(ctx context.Context, types []model.EventType) (map[model.EventType]error, error)         // 種別を DB が受け付けるか列の型と CHECK 制約から確認 (拒否された種別と理由)
 }
 
+// eventColumns: CreateEventsBatch が1行あたりに渡すパラメータ数
+const eventColumns = 6
+
 type eventRepository struct {
-	db     *sqlx.DB
-	logger *slog.Logger
+	db      *sqlx.DB
+	metrics *metrics.Metrics // クエリ遅延の記録先 (nil なら記録しない)
+	timeout time.Duration    // 1クエリあたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
 }
 
 // NewEventRepository: 実装生成
-func NewEventRepository(db *sqlx.DB, logger *slog.Logger) EventRepository {
+func NewEventRepository(db *sqlx.DB, m *metrics.Metrics, timeout time.Duration, logger *slog.Logger) EventRepository {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &eventRepository{db: db, logger: logger}
+	return &eventRepository{db: db, metrics: m, timeout: timeout, logger: logger}
 }
 
-// CreateEvent: events テーブルへ挿入 (TriggeredAt 未設定なら現在時刻)
-func (r *eventRepository) CreateEvent(event *model.Event) error {
+// CreateEvent: events テーブルへ挿入 (TriggeredAt 未設定なら現在時刻 / PressCount 未設定なら 1)
+func (r *eventRepository) CreateEvent(ctx context.Context, event *model.Event) error {
 	if event.TriggeredAt.IsZero() {
 		event.TriggeredAt = time.Now()
 	}
-	q := `INSERT INTO events (room_id, viewer_id, event_type, triggered_at, metadata) VALUES ($1,$2,$3,$4,$5)`
+	if event.PressCount <= 0 {
+		event.PressCount = 1
+	}
+	q := `INSERT INTO events (room_id, viewer_id, event_type, triggered_at, metadata, press_count) VALUES ($1,$2,$3,$4,$5,$6)`
 	attrs := []any{
 		slog.String("repo", "event"),
 		slog.String("op", "create_event"),
 		slog.String("room_id", event.RoomID),
 		slog.String("event_type", string(event.EventType)),
 		slog.Bool("has_viewer", event.ViewerID != nil),
+		slog.Int("press_count", event.PressCount),
 	}
 	if event.ViewerID != nil {
 		attrs = append(attrs, slog.String("viewer_id", *event.ViewerID))
 	}
 	logger := r.logger.With(attrs...)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, event.RoomID, event.ViewerID, event.EventType, event.TriggeredAt, event.Metadata)
+	defer r.metrics.ObserveDB("event", "create_event", start)
+	res, err := r.db.ExecContext(ctx, q, event.RoomID, event.ViewerID, event.EventType, event.TriggeredAt, event.Metadata, event.PressCount)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -66,36 +85,42 @@ func (r *eventRepository) CreateEvent(event *model.Event) error {
 
 // CreateEventsBatch: 複数イベントを効率的にバッチ挿入
 // PostgreSQLのVALUES句を使用して1回のクエリで複数レコードを挿入
-func (r *eventRepository) CreateEventsBatch(events []*model.Event) error {
+func (r *eventRepository) CreateEventsBatch(ctx context.Context, events []*model.Event) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	// 現在時刻を設定（未設定の場合）
+	// 現在時刻 / 押下数を設定（未設定の場合）
 	now := time.Now()
+	presses := 0
 	for _, event := range events {
 		if event.TriggeredAt.IsZero() {
 			event.TriggeredAt = now
 		}
+		if event.PressCount <= 0 {
+			event.PressCount = 1
+		}
+		presses += event.PressCount
 	}
 
 	// VALUES句を構築
 	values := make([]string, len(events))
-	args := make([]interface{}, 0, len(events)*5)
+	args := make([]interface{}, 0, len(events)*eventColumns)
 
 	for i, event := range events {
-		values[i] = fmt.Sprintf("($%d,$%d,$%d,$%d,$%d)",
-			i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
-		args = append(args, event.RoomID, event.ViewerID, event.EventType, event.TriggeredAt, event.Metadata)
+		values[i] = fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d)",
+			i*eventColumns+1, i*eventColumns+2, i*eventColumns+3, i*eventColumns+4, i*eventColumns+5, i*eventColumns+6)
+		args = append(args, event.RoomID, event.ViewerID, event.EventType, event.TriggeredAt, event.Metadata, event.PressCount)
 	}
 
-	q := fmt.Sprintf(`INSERT INTO events (room_id, viewer_id, event_type, triggered_at, metadata) VALUES %s`,
+	q := fmt.Sprintf(`INSERT INTO events (room_id, viewer_id, event_type, triggered_at, metadata, press_count) VALUES %s`,
 		strings.Join(values, ","))
 
 	attrs := []any{
 		slog.String("repo", "event"),
 		slog.String("op", "create_events_batch"),
 		slog.Int("count", len(events)),
+		slog.Int("presses", presses),
 	}
 	if len(events) > 0 {
 		attrs = append(attrs,
@@ -104,8 +129,11 @@ func (r *eventRepository) CreateEventsBatch(events []*model.Event) error {
 	}
 	logger := r.logger.With(attrs...)
 
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, args...)
+	defer r.metrics.ObserveDB("event", "create_events_batch", start)
+	res, err := r.db.ExecContext(ctx, q, args...)
 	if err != nil {
 		logger.Error("db.exec batch failed", slog.Any("error", err))
 		return err
@@ -115,7 +143,7 @@ func (r *eventRepository) CreateEventsBatch(events []*model.Event) error {
 	return nil
 }
 
-func (r *eventRepository) ListEventViewerCounts(roomID string) ([]model.EventAggregate, error) {
+func (r *eventRepository) ListEventViewerCounts(ctx context.Context, roomID string) ([]model.EventAggregate, error) {
 	rows := []struct {
 		EventType  model.EventType `db:"event_type"`
 		ViewerID   sql.NullString  `db:"viewer_id"`
@@ -125,7 +153,7 @@ func (r *eventRepository) ListEventViewerCounts(roomID string) ([]model.EventAgg
 	q := `SELECT e.event_type,
              e.viewer_id,
              v.name AS viewer_name,
-             COUNT(*) AS count
+             SUM(e.press_count) AS count
       FROM events e
       LEFT JOIN viewers v ON v.id = e.viewer_id
       WHERE e.room_id = $1 AND e.viewer_id IS NOT NULL
@@ -135,8 +163,11 @@ func (r *eventRepository) ListEventViewerCounts(roomID string) ([]model.EventAgg
 		slog.String("op", "list_event_viewer_counts"),
 		slog.String("room_id", roomID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Select(&rows, q, roomID); err != nil {
+	defer r.metrics.ObserveDB("event", "list_event_viewer_counts", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID); err != nil {
 		logger.Error("db.query failed", slog.Any("error", err))
 		return nil, err
 	}
@@ -156,9 +187,9 @@ func (r *eventRepository) ListEventViewerCounts(roomID string) ([]model.EventAgg
 	return aggs, nil
 }
 
-func (r *eventRepository) ListEventTotals(roomID string) ([]model.EventTotal, error) {
+func (r *eventRepository) ListEventTotals(ctx context.Context, roomID string) ([]model.EventTotal, error) {
 	rows := []model.EventTotal{}
-	q := `SELECT event_type, COUNT(*) AS count
+	q := `SELECT event_type, SUM(press_count) AS count
         FROM events
         WHERE room_id = $1
         GROUP BY event_type`
@@ -167,8 +198,11 @@ func (r *eventRepository) ListEventTotals(roomID string) ([]model.EventTotal, er
 		slog.String("op", "list_event_totals"),
 		slog.String("room_id", roomID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Select(&rows, q, roomID); err != nil {
+	defer r.metrics.ObserveDB("event", "list_event_totals", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID); err != nil {
 		logger.Error("db.query failed", slog.Any("error", err))
 		return nil, err
 	}
@@ -176,7 +210,7 @@ func (r *eventRepository) ListEventTotals(roomID string) ([]model.EventTotal, er
 	return rows, nil
 }
 
-func (r *eventRepository) ListViewerTotals(roomID string) ([]model.ViewerTotal, error) {
+func (r *eventRepository) ListViewerTotals(ctx context.Context, roomID string) ([]model.ViewerTotal, error) {
 	rows := []struct {
 		ViewerID   sql.NullString `db:"viewer_id"`
 		ViewerName sql.NullString `db:"viewer_name"`
@@ -184,7 +218,7 @@ func (r *eventRepository) ListViewerTotals(roomID string) ([]model.ViewerTotal,
 	}{}
 	q := `SELECT e.viewer_id,
              v.name AS viewer_name,
-             COUNT(*) AS count
+             SUM(e.press_count) AS count
       FROM events e
       LEFT JOIN viewers v ON v.id = e.viewer_id
       WHERE e.room_id = $1 AND e.viewer_id IS NOT NULL
@@ -195,8 +229,11 @@ func (r *eventRepository) ListViewerTotals(roomID string) ([]model.ViewerTotal,
 		slog.String("op", "list_viewer_totals"),
 		slog.String("room_id", roomID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Select(&rows, q, roomID); err != nil {
+	defer r.metrics.ObserveDB("event", "list_viewer_totals", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID); err != nil {
 		logger.Error("db.query failed", slog.Any("error", err))
 		return nil, err
 	}
@@ -216,9 +253,9 @@ func (r *eventRepository) ListViewerTotals(roomID string) ([]model.ViewerTotal,
 	return totals, nil
 }
 
-func (r *eventRepository) ListViewerEventCounts(roomID, viewerID string) ([]model.ViewerEventCount, error) {
+func (r *eventRepository) ListViewerEventCounts(ctx context.Context, roomID, viewerID string) ([]model.ViewerEventCount, error) {
 	rows := []model.ViewerEventCount{}
-	q := `SELECT event_type, COUNT(*) AS count
+	q := `SELECT event_type, SUM(press_count) AS count
         FROM events
         WHERE room_id = $1 AND viewer_id = $2
         GROUP BY event_type`
@@ -228,8 +265,11 @@ func (r *eventRepository) ListViewerEventCounts(roomID, viewerID string) ([]mode
 		slog.String("room_id", roomID),
 		slog.String("viewer_id", viewerID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Select(&rows, q, roomID, viewerID); err != nil {
+	defer r.metrics.ObserveDB("event", "list_viewer_event_counts", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID, viewerID); err != nil {
 		logger.Error("db.query failed", slog.Any("error", err))
 		return nil, err
 	}
@@ -237,6 +277,162 @@ func (r *eventRepository) ListViewerEventCounts(roomID, viewerID string) ([]mode
 	return rows, nil
 }
 
+// CreateGameEvent: game_events テーブルへ発動履歴を挿入 (SentAt 未設定なら現在時刻)
+func (r *eventRepository) CreateGameEvent(ctx context.Context, ge *model.GameEvent) error {
+	if ge.SentAt.IsZero() {
+		ge.SentAt = time.Now()
+	}
+	q := `INSERT INTO game_events (room_id, event_type, trigger_count, threshold, level, viewer_count, sent_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id`
+	logger := r.logger.With(
+		slog.String("repo", "event"),
+		slog.String("op", "create_game_event"),
+		slog.String("room_id", ge.RoomID),
+		slog.String("event_type", string(ge.EventType)),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("event", "create_game_event", start)
+	if err := r.db.GetContext(ctx, &ge.ID, q, ge.RoomID, ge.EventType, ge.TriggerCount, ge.Threshold, ge.Level, ge.ViewerCount, ge.SentAt); err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return err
+	}
+	logger.Debug("db.exec", slog.Int64("id", ge.ID), slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+func (r *eventRepository) ListGameEvents(ctx context.Context, roomID string, eventType model.EventType, limit, offset int) ([]model.GameEvent, error) {
+	rows := []model.GameEvent{}
+	q := `SELECT id, room_id, event_type, trigger_count, threshold, level, viewer_count, sent_at
+        FROM game_events
+        WHERE room_id = $1 AND ($2 = '' OR event_type = $2)
+        ORDER BY sent_at DESC, id DESC
+        LIMIT $3 OFFSET $4`
+	logger := r.logger.With(
+		slog.String("repo", "event"),
+		slog.String("op", "list_game_events"),
+		slog.String("room_id", roomID),
+		slog.String("event_type", string(eventType)),
+		slog.Int("limit", limit),
+		slog.Int("offset", offset),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("event", "list_game_events", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID, string(eventType), limit, offset); err != nil {
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Int("row_count", len(rows)), slog.Duration("elapsed", time.Since(start)))
+	return rows, nil
+}
+
+func (r *eventRepository) ListTriggerTotals(ctx context.Context, roomID string) ([]model.EventTotal, error) {
+	rows := []model.EventTotal{}
+	q := `SELECT event_type, COUNT(*) AS count
+        FROM game_events
+        WHERE room_id = $1
+        GROUP BY event_type`
+	logger := r.logger.With(
+		slog.String("repo", "event"),
+		slog.String("op", "list_trigger_totals"),
+		slog.String("room_id", roomID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("event", "list_trigger_totals", start)
+	if err := r.db.SelectContext(ctx, &rows, q, roomID); err != nil {
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Int("row_count", len(rows)), slog.Duration("elapsed", time.Since(start)))
+	return rows, nil
+}
+
+// eventTypeTables: 種別列 (event_type) を持つテーブル (ProbeEventTypes の確認対象)
+var eventTypeTables = []string{"events", "game_events"}
+
+// eventTypeCheck: 種別列だけを参照する CHECK 制約
+type eventTypeCheck struct {
+	Name string `db:"conname"`
+	Expr string `db:"expr"`
+}
+
+// ProbeEventTypes: events / game_events の種別列の型と CHECK 制約をカタログから読み、受け付けられない種別を返す
+// 行は書き込まない。各種別を列の型 (ENUM/TEXT) へ変換し、制約の式を SELECT で評価して確認する。
+func (r *eventRepository) ProbeEventTypes(ctx context.Context, types []model.EventType) (map[model.EventType]error, error) {
+	logger := r.logger.With(
+		slog.String("repo", "event"),
+		slog.String("op", "probe_event_types"),
+		slog.Int("type_count", len(types)),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("event", "probe_event_types", start)
+	rejected := map[model.EventType]error{}
+	for _, table := range eventTypeTables {
+		var colType string
+		if err := r.db.GetContext(ctx, &colType, `SELECT format_type(atttypid, atttypmod) FROM pg_attribute WHERE attrelid = to_regclass($1) AND attname = 'event_type' AND NOT attisdropped`, table); err != nil {
+			logger.Error("db.get failed", slog.String("table", table), slog.Any("error", err))
+			return nil, fmt.Errorf("read %s.event_type type: %w", table, err)
+		}
+		var checks []eventTypeCheck
+		if err := r.db.SelectContext(ctx, &checks, `
+			SELECT c.conname, pg_get_expr(c.conbin, c.conrelid) AS expr
+			FROM pg_constraint c
+			JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attname = 'event_type'
+			WHERE c.conrelid = to_regclass($1) AND c.contype = 'c' AND c.conkey = ARRAY[a.attnum]`, table); err != nil {
+			logger.Error("db.select failed", slog.String("table", table), slog.Any("error", err))
+			return nil, fmt.Errorf("read %s.event_type constraints: %w", table, err)
+		}
+		for _, et := range types {
+			if _, ok := rejected[et]; ok {
+				continue
+			}
+			reason, err := r.evalEventType(ctx, colType, checks, et)
+			if err != nil {
+				logger.Error("db.query failed", slog.String("table", table), slog.String("event_type", string(et)), slog.Any("error", err))
+				return nil, err
+			}
+			if reason != nil {
+				rejected[et] = fmt.Errorf("%s: %w", table, reason)
+			}
+		}
+	}
+	logger.Debug("db.probe", slog.Int("rejected", len(rejected)), slog.Duration("elapsed", time.Since(start)))
+	return rejected, nil
+}
+
+// evalEventType: 種別を列の型へ変換し、CHECK 制約を評価する (拒否理由 / 問い合わせ自体の失敗)
+// 型変換できない値 (ENUM に無いラベルなど) はデータ例外として拒否理由にする。CHECK は INSERT と同じく NULL を通す。
+func (r *eventRepository) evalEventType(ctx context.Context, colType string, checks []eventTypeCheck, et model.EventType) (error, error) {
+	value := fmt.Sprintf("CAST($1 AS %s)", colType)
+	var ok bool
+	if err := r.db.GetContext(ctx, &ok, `SELECT `+value+` IS NOT NULL`, string(et)); err != nil {
+		if isRowError(err) {
+			return err, nil
+		}
+		return nil, err
+	}
+	for _, check := range checks {
+		q := fmt.Sprintf(`SELECT (%s) IS NOT FALSE FROM (SELECT %s AS event_type) AS probe`, check.Expr, value)
+		if err := r.db.GetContext(ctx, &ok, q, string(et)); err != nil {
+			if isRowError(err) {
+				return err, nil
+			}
+			return nil, err
+		}
+		if !ok {
+			return fmt.Errorf("violates check constraint %q", check.Name), nil
+		}
+	}
+	return nil, nil
+}
+
 func cloneString(s string) *string {
 	val := s
 	return &val
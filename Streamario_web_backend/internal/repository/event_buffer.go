@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/metrics"
+
+	"github.com/lib/pq"
+)
+
+// ErrEventQueueFull: 書き込み待ちのキューが上限に達し、EnqueueTimeout 以内に空かなかった
+var ErrEventQueueFull = errors.New("event write queue is full")
+
+// maxEventBatchSize: 1回の INSERT にまとめられる上限 (1行あたりのパラメータ数 × 件数が PostgreSQL の上限 65535 を超えない)
+const maxEventBatchSize = 65535 / eventColumns
+
+// eventSettleMargin: SettleRoom が FlushInterval に上乗せして待つ余裕 (他インスタンスの INSERT にかかる時間の分)
+const eventSettleMargin = 500 * time.Millisecond
+
+// RoomEventSettler: 押下イベントの書き込みを遅らせる EventRepository が実装する (ルーム終了時の集計前に書き込みを待つ)
+type RoomEventSettler interface {
+	SettleRoom(ctx context.Context, roomID string, since time.Time) error
+}
+
+// EventBufferConfig: 押下イベントの非同期書き込み (write-behind) の設定
+type EventBufferConfig struct {
+	BatchSize      int           // 1回の INSERT にまとめる最大件数 (溜まったら間隔を待たずに書き出す)
+	FlushInterval  time.Duration // 件数に満たなくても書き出す間隔
+	QueueSize      int           // 書き込み待ちの上限 (超える押下は空きができるまで待たせる)
+	EnqueueTimeout time.Duration // キューの空きを待つ上限 (超えたら ErrEventQueueFull)
+	MaxRetries     int           // 書き込み失敗時の再試行回数 (使い切ったバッチは破棄してメトリクスに残す。特定の行が原因なら分割してその行だけ破棄)
+	RetryBackoff   time.Duration // 最初の再試行までの待ち時間 (以降は毎回2倍)
+}
+
+// BufferedEventRepository: 押下イベント (events) をメモリに溜め、まとめて INSERT する EventRepository
+// CreateEvent / CreateEventsBatch はキューへ積むだけで戻るため、押下処理は DB の遅延を待たない。
+// events を読む集計は対象ルームの溜まっている分を書き出してから実行する。それ以外の操作は元のリポジトリへそのまま委譲する。
+// 書き出しは Run (バックグラウンド) が件数か間隔で行い、停止時は Flush で残りを書き出す。
+type BufferedEventRepository struct {
+	EventRepository
+	cfg     EventBufferConfig
+	metrics *metrics.Metrics // キュー長 / 書き込み遅延の記録先 (nil なら記録しない)
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	pending []*model.Event // 書き込み待ち (先頭から書き出す)
+	space   chan struct{}  // 書き出しで空きができたら close し、キューの空きを待つ呼び出し元を起こす
+	kick    chan struct{}  // BatchSize 分溜まったことを Run へ知らせる
+	flushMu sync.Mutex     // 書き出しを1バッチずつ直列化 (Run / Flush / ルーム単位の書き出し)
+}
+
+// NewBufferedEventRepository: repo への events 書き込みを write-behind にするラッパを生成 (0 以下の設定値は既定値)
+func NewBufferedEventRepository(repo EventRepository, cfg EventBufferConfig, m *metrics.Metrics, logger *slog.Logger) *BufferedEventRepository {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.BatchSize > maxEventBatchSize {
+		cfg.BatchSize = maxEventBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 250 * time.Millisecond
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		cfg.QueueSize = cfg.BatchSize
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		cfg.EnqueueTimeout = time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 100 * time.Millisecond
+	}
+	return &BufferedEventRepository{
+		EventRepository: repo,
+		cfg:             cfg,
+		metrics:         m,
+		logger:          logger,
+		space:           make(chan struct{}),
+		kick:            make(chan struct{}, 1),
+	}
+}
+
+// CreateEvent: 書き込み待ちキューへ積む (TriggeredAt 未設定なら現在時刻)
+func (b *BufferedEventRepository) CreateEvent(ctx context.Context, event *model.Event) error {
+	return b.enqueue(ctx, []*model.Event{event})
+}
+
+// CreateEventsBatch: 書き込み待ちキューへまとめて積む (1回の押下分は分割せず、すべて積むかエラー)
+// キューが満杯なら空きを EnqueueTimeout まで待ち、空かなければ ErrEventQueueFull を返す。
+func (b *BufferedEventRepository) CreateEventsBatch(ctx context.Context, events []*model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return b.enqueue(ctx, events)
+}
+
+// ListEventViewerCounts: 溜まっている分を書き出してから集計
+func (b *BufferedEventRepository) ListEventViewerCounts(ctx context.Context, roomID string) ([]model.EventAggregate, error) {
+	b.flushBeforeRead(ctx, roomID, "list_event_viewer_counts")
+	return b.EventRepository.ListEventViewerCounts(ctx, roomID)
+}
+
+// ListEventTotals: 溜まっている分を書き出してから集計
+func (b *BufferedEventRepository) ListEventTotals(ctx context.Context, roomID string) ([]model.EventTotal, error) {
+	b.flushBeforeRead(ctx, roomID, "list_event_totals")
+	return b.EventRepository.ListEventTotals(ctx, roomID)
+}
+
+// ListViewerTotals: 溜まっている分を書き出してから集計
+func (b *BufferedEventRepository) ListViewerTotals(ctx context.Context, roomID string) ([]model.ViewerTotal, error) {
+	b.flushBeforeRead(ctx, roomID, "list_viewer_totals")
+	return b.EventRepository.ListViewerTotals(ctx, roomID)
+}
+
+// ListViewerEventCounts: 溜まっている分を書き出してから集計
+func (b *BufferedEventRepository) ListViewerEventCounts(ctx context.Context, roomID, viewerID string) ([]model.ViewerEventCount, error) {
+	b.flushBeforeRead(ctx, roomID, "list_viewer_event_counts")
+	return b.EventRepository.ListViewerEventCounts(ctx, roomID, viewerID)
+}
+
+// Run: ctx がキャンセルされるまで、BatchSize 分溜まるか FlushInterval ごとに書き出す (ブロッキング)
+// キャンセル時に書き出し中だったバッチはキューに残るため、停止処理では Run の終了後に Flush を呼ぶ。
+func (b *BufferedEventRepository) Run(ctx context.Context) error {
+	b.logger.Info("event writer started", slog.Int("batch_size", b.cfg.BatchSize), slog.Duration("flush_interval", b.cfg.FlushInterval), slog.Int("queue_size", b.cfg.QueueSize))
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Info("event writer stopped", slog.Int("pending", b.Pending()), slog.Any("reason", ctx.Err()))
+			return ctx.Err()
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		_ = b.Flush(ctx) // 破棄した行は dropFailed がログとメトリクスに残す
+	}
+}
+
+// Flush: 呼び出し時点で溜まっているイベントをすべて書き出す (停止時)
+// 破棄した行があればそのエラーを返す。ctx が終わった場合、書き出せなかった分はキューに残る。
+func (b *BufferedEventRepository) Flush(ctx context.Context) error {
+	// 押下が続いても戻れるよう、呼び出し時点の件数だけ書き出す
+	target := b.Pending()
+	var lastErr error
+	for flushed := 0; flushed < target; {
+		n, err := b.flushOnce(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			lastErr = err
+		}
+		if n == 0 {
+			break
+		}
+		flushed += n
+	}
+	return lastErr
+}
+
+// FlushRoom: roomID の書き込み待ちだけをキューから外して書き出す (集計前)
+// 他ルームの押下は Run に任せて待たない。ctx が終わった場合、書き出せなかった分はキューの先頭へ戻す。
+func (b *BufferedEventRepository) FlushRoom(ctx context.Context, roomID string) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	var room, rest []*model.Event
+	for _, event := range b.pending {
+		if event.RoomID == roomID {
+			room = append(room, event)
+		} else {
+			rest = append(rest, event)
+		}
+	}
+	if len(room) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.pending = rest
+	depth := b.release()
+	b.mu.Unlock()
+	b.metrics.SetEventQueueDepth(depth)
+
+	var lastErr error
+	for i := 0; i < len(room); i += b.cfg.BatchSize {
+		batch := room[i:min(i+b.cfg.BatchSize, len(room))]
+		dropped, err := b.flushBatch(ctx, batch)
+		if err == nil {
+			continue
+		}
+		if dropped == 0 { // ctx が終わって書き込めなかった
+			b.mu.Lock()
+			b.pending = append(room[i:len(room):len(room)], b.pending...)
+			depth = len(b.pending)
+			b.mu.Unlock()
+			b.metrics.SetEventQueueDepth(depth)
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// SettleRoom: since までに受け付けた roomID の押下が、全インスタンスで書き込まれるのを待つ (ルーム終了時の集計前)
+// 他インスタンスのキューは FlushInterval ごとに書き出されるため、since から FlushInterval (+余裕) が過ぎるまで待ち、自インスタンスの分は直接書き出す。
+// 他インスタンスが再試行中の押下までは待たない (各インスタンスの EVENT_FLUSH_INTERVAL は揃えておく)。
+func (b *BufferedEventRepository) SettleRoom(ctx context.Context, roomID string, since time.Time) error {
+	if wait := time.Until(since.Add(b.cfg.FlushInterval + eventSettleMargin)); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return b.FlushRoom(ctx, roomID)
+}
+
+// Pending: 書き込み待ちのイベント数
+func (b *BufferedEventRepository) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// enqueue: events をキュー末尾へ積む (空きが無ければ書き出しを待つ)
+// キューが空なら QueueSize を超える単発の大きな押下も受け入れる (永久に積めなくなるのを防ぐ)。
+func (b *BufferedEventRepository) enqueue(ctx context.Context, events []*model.Event) error {
+	// 書き込みは後になるため、押下時刻はここで確定させる
+	now := time.Now()
+	for _, event := range events {
+		if event.TriggeredAt.IsZero() {
+			event.TriggeredAt = now
+		}
+	}
+	var deadline <-chan time.Time
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 || len(b.pending)+len(events) <= b.cfg.QueueSize {
+			b.pending = append(b.pending, events...)
+			depth := len(b.pending)
+			b.mu.Unlock()
+			b.metrics.SetEventQueueDepth(depth)
+			if depth >= b.cfg.BatchSize {
+				select {
+				case b.kick <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}
+		space := b.space
+		b.mu.Unlock()
+
+		if deadline == nil {
+			timer := time.NewTimer(b.cfg.EnqueueTimeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		select {
+		case <-space:
+		case <-deadline:
+			b.logger.Warn("event write queue full", slog.String("room_id", events[0].RoomID), slog.Int("count", len(events)), slog.Int("queue_size", b.cfg.QueueSize))
+			return ErrEventQueueFull
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// flushOnce: 先頭から最大 BatchSize 件を書き出してキューから外し、書き出した件数を返す
+// 書き込めなかった行は破棄する。ctx が終わって中断した場合はキューに残し、0 とエラーを返す。
+func (b *BufferedEventRepository) flushOnce(ctx context.Context) (int, error) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	n := min(len(b.pending), b.cfg.BatchSize)
+	batch := b.pending[:n:n] // キューの先頭を外すのは flushMu の保持者だけなので、先頭 n 件は書き出し中に変わらない
+	b.mu.Unlock()
+	if n == 0 {
+		return 0, nil
+	}
+
+	dropped, err := b.flushBatch(ctx, batch)
+	if err != nil && dropped == 0 {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	clear(b.pending[:n])
+	b.pending = b.pending[n:]
+	depth := b.release()
+	b.mu.Unlock()
+	b.metrics.SetEventQueueDepth(depth)
+	return n, err
+}
+
+// release: キューの空きを待つ呼び出し元を起こし、現在のキュー長を返す (mu を保持して呼ぶ)
+func (b *BufferedEventRepository) release() int {
+	close(b.space)
+	b.space = make(chan struct{})
+	return len(b.pending)
+}
+
+// flushBatch: batch を書き込み、書き込めなかった行を破棄して破棄件数を返す
+// ctx が終わって書き込めなかった場合は破棄せず、0 と ctx のエラーを返す (呼び出し元がキューに残す)。
+func (b *BufferedEventRepository) flushBatch(ctx context.Context, batch []*model.Event) (int, error) {
+	err := b.write(ctx, batch)
+	if err == nil || ctx.Err() != nil {
+		return 0, err
+	}
+	return b.dropFailed(ctx, batch, err)
+}
+
+// dropFailed: 書き込みに失敗した batch を破棄し、破棄件数を返す
+// 特定の行が原因 (isRowError) なら半分ずつ書き直し、原因の行だけを破棄して残りは書き込む。
+func (b *BufferedEventRepository) dropFailed(ctx context.Context, batch []*model.Event, err error) (int, error) {
+	if len(batch) == 1 || !isRowError(err) || ctx.Err() != nil {
+		b.metrics.EventsDropped(len(batch))
+		b.logger.Error("event batch dropped", slog.Int("count", len(batch)), slog.String("room_id", batch[0].RoomID), slog.String("event_type", string(batch[0].EventType)), slog.Int("retries", b.cfg.MaxRetries), slog.Any("error", err))
+		return len(batch), err
+	}
+	mid := len(batch) / 2
+	dropped := 0
+	var lastErr error
+	for _, half := range [][]*model.Event{batch[:mid], batch[mid:]} {
+		if err := b.write(ctx, half); err != nil {
+			n, err := b.dropFailed(ctx, half, err)
+			dropped += n
+			lastErr = err
+		}
+	}
+	return dropped, lastErr
+}
+
+// isRowError: バッチ内の特定の行が原因の失敗か (データ例外 22xxx / 制約違反 23xxx。再試行しても通らない)
+func isRowError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
+
+// write: バッチを1回の INSERT で書き込み、失敗したら間隔を倍にしながら MaxRetries 回まで再試行
+func (b *BufferedEventRepository) write(ctx context.Context, batch []*model.Event) error {
+	backoff := b.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := b.EventRepository.CreateEventsBatch(ctx, batch)
+		b.metrics.ObserveEventFlush(err, start)
+		if err == nil {
+			b.logger.Debug("event batch flushed", slog.Int("count", len(batch)), slog.Int("attempt", attempt+1), slog.Duration("elapsed", time.Since(start)))
+			return nil
+		}
+		if attempt >= b.cfg.MaxRetries || ctx.Err() != nil || isRowError(err) {
+			return err
+		}
+		b.logger.Warn("event batch flush failed, retrying", slog.Int("count", len(batch)), slog.Int("attempt", attempt+1), slog.Duration("backoff", backoff), slog.Any("error", err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// flushBeforeRead: 集計クエリの前に roomID の溜まっている分を書き出す
+// 失敗しても集計は行う (直近の押下が結果に含まれない可能性をログに残す)。
+func (b *BufferedEventRepository) flushBeforeRead(ctx context.Context, roomID, op string) {
+	if err := b.FlushRoom(ctx, roomID); err != nil {
+		b.logger.Warn("flush before read failed", slog.String("op", op), slog.String("room_id", roomID), slog.Int("pending", b.Pending()), slog.Any("error", err))
+	}
+}
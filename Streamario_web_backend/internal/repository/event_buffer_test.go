@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+
+	"github.com/lib/pq"
+)
+
+// fakeEventRepo: 書き込まれたイベントを記録する EventRepository (fail 回だけ書き込みを失敗させ、EventType "invalid" を含むバッチは制約違反にする)
+type fakeEventRepo struct {
+	EventRepository
+	mu       sync.Mutex
+	written  []*model.Event
+	batches  int
+	attempts int
+	fail     int
+	block    chan struct{} // 非 nil なら close されるまで書き込みを止める
+}
+
+func (f *fakeEventRepo) CreateEventsBatch(ctx context.Context, events []*model.Event) error {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("db unavailable")
+	}
+	f.attempts++
+	for _, e := range events {
+		if e.EventType == "invalid" {
+			return &pq.Error{Code: "23514", Message: "check constraint violated"}
+		}
+	}
+	f.written = append(f.written, events...)
+	f.batches++
+	return nil
+}
+
+func (f *fakeEventRepo) ListEventTotals(_ context.Context, roomID string) ([]model.EventTotal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return []model.EventTotal{{EventType: "skill1", Count: len(f.written)}}, nil
+}
+
+func (f *fakeEventRepo) count() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.written), f.batches
+}
+
+func newTestBuffer(repo EventRepository, cfg EventBufferConfig) *BufferedEventRepository {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewBufferedEventRepository(repo, cfg, nil, logger)
+}
+
+func presses(n int) []*model.Event {
+	return roomPresses("room-a", n)
+}
+
+func roomPresses(roomID string, n int) []*model.Event {
+	events := make([]*model.Event, n)
+	for i := range events {
+		events[i] = &model.Event{RoomID: roomID, EventType: "skill1", Metadata: "{}"}
+	}
+	return events
+}
+
+func TestBufferedEventRepository_FlushBySizeAndOnRead(t *testing.T) {
+	repo := &fakeEventRepo{}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 4, FlushInterval: time.Hour, QueueSize: 100})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go buf.Run(ctx)
+
+	if err := buf.CreateEventsBatch(ctx, presses(3)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if n, _ := repo.count(); n != 0 {
+		t.Fatalf("written before reaching batch size: %d", n)
+	}
+	// BatchSize に達したら間隔を待たずに書き出す
+	if err := buf.CreateEventsBatch(ctx, presses(2)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for n, _ := repo.count(); n < 4; n, _ = repo.count() {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not flushed, written=%d", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 集計は溜まっている分を書き出してから行う
+	totals, err := buf.ListEventTotals(ctx, "room-a")
+	if err != nil || len(totals) != 1 || totals[0].Count != 5 {
+		t.Fatalf("totals = %+v, %v; want count 5", totals, err)
+	}
+	if buf.Pending() != 0 {
+		t.Fatalf("pending = %d, want 0", buf.Pending())
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, e := range repo.written {
+		if e.TriggeredAt.IsZero() {
+			t.Fatal("press time should be fixed at enqueue")
+		}
+	}
+}
+
+func TestBufferedEventRepository_RetryAndDrop(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeEventRepo{fail: 2}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 10, QueueSize: 10, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	_ = buf.CreateEventsBatch(ctx, presses(3))
+	if err := buf.Flush(ctx); err != nil {
+		t.Fatalf("flush should succeed on the last retry: %v", err)
+	}
+	if n, batches := repo.count(); n != 3 || batches != 1 {
+		t.Fatalf("written=%d batches=%d, want 3/1", n, batches)
+	}
+
+	// 再試行を使い切ったバッチは破棄してキューを詰まらせない
+	repo.fail = 3
+	_ = buf.CreateEventsBatch(ctx, presses(2))
+	if err := buf.Flush(ctx); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if buf.Pending() != 0 {
+		t.Fatalf("dropped batch should leave the queue, pending=%d", buf.Pending())
+	}
+	if n, _ := repo.count(); n != 3 {
+		t.Fatalf("written=%d, want 3", n)
+	}
+}
+
+func TestBufferedEventRepository_Backpressure(t *testing.T) {
+	repo := &fakeEventRepo{block: make(chan struct{})}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 2, QueueSize: 2, EnqueueTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+	if err := buf.CreateEventsBatch(ctx, presses(2)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	// 満杯で書き出しも進まなければ期限で諦める
+	if err := buf.CreateEvent(ctx, presses(1)[0]); !errors.Is(err, ErrEventQueueFull) {
+		t.Fatalf("err = %v, want ErrEventQueueFull", err)
+	}
+
+	// 書き出しで空きができれば待っていた押下は受け入れられる
+	buf.cfg.EnqueueTimeout = time.Second
+	done := make(chan error, 1)
+	go func() { done <- buf.CreateEvent(ctx, presses(1)[0]) }()
+	flushed := make(chan error, 1)
+	go func() { flushed <- buf.Flush(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	close(repo.block)
+	if err := <-done; err != nil {
+		t.Fatalf("enqueue after flush: %v", err)
+	}
+	if err := <-flushed; err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	// 停止時の Flush は残りを書き出す (ctx が終わっていれば残したまま返る)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	repo.block = make(chan struct{})
+	if err := buf.Flush(cancelled); !errors.Is(err, context.Canceled) || buf.Pending() != 1 {
+		t.Fatalf("flush with cancelled ctx: err=%v pending=%d", err, buf.Pending())
+	}
+	close(repo.block)
+	if err := buf.Flush(ctx); err != nil || buf.Pending() != 0 {
+		t.Fatalf("final flush: err=%v pending=%d", err, buf.Pending())
+	}
+	if n, _ := repo.count(); n != 3 {
+		t.Fatalf("written=%d, want 3", n)
+	}
+}
+
+func TestBufferedEventRepository_DropsOnlyBadRows(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeEventRepo{}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 8, QueueSize: 8, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	events := presses(8)
+	events[5].EventType = "invalid"
+	_ = buf.CreateEventsBatch(ctx, events)
+
+	// 制約違反は再試行せず、分割して原因の1行だけを破棄する
+	var pqErr *pq.Error
+	if err := buf.Flush(ctx); !errors.As(err, &pqErr) {
+		t.Fatalf("err = %v, want the row error", err)
+	}
+	if n, _ := repo.count(); n != 7 {
+		t.Fatalf("written=%d, want 7", n)
+	}
+	// 8 件 → 4+4 → 2+2 → 1+1 の順に書き直す
+	if repo.attempts != 7 {
+		t.Fatalf("attempts=%d, want 7", repo.attempts)
+	}
+	if buf.Pending() != 0 {
+		t.Fatalf("pending = %d, want 0", buf.Pending())
+	}
+}
+
+func TestBufferedEventRepository_FlushRoomBeforeRead(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeEventRepo{}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 2, QueueSize: 100})
+	_ = buf.CreateEventsBatch(ctx, roomPresses("room-b", 3))
+	_ = buf.CreateEventsBatch(ctx, presses(3))
+	_ = buf.CreateEventsBatch(ctx, roomPresses("room-b", 1))
+
+	// 集計するルームの分だけを書き出し、他ルームはキューに残す
+	totals, err := buf.ListEventTotals(ctx, "room-a")
+	if err != nil || totals[0].Count != 3 {
+		t.Fatalf("totals = %+v, %v; want count 3", totals, err)
+	}
+	if n, batches := repo.count(); n != 3 || batches != 2 {
+		t.Fatalf("written=%d batches=%d, want 3/2", n, batches)
+	}
+	if buf.Pending() != 4 {
+		t.Fatalf("pending = %d, want 4", buf.Pending())
+	}
+
+	// ctx が終わって書き込めなかった分はキューの先頭へ戻す
+	repo.block = make(chan struct{})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := buf.FlushRoom(cancelled, "room-b"); !errors.Is(err, context.Canceled) || buf.Pending() != 4 {
+		t.Fatalf("flush with cancelled ctx: err=%v pending=%d", err, buf.Pending())
+	}
+	close(repo.block)
+	if err := buf.Flush(ctx); err != nil || buf.Pending() != 0 {
+		t.Fatalf("final flush: err=%v pending=%d", err, buf.Pending())
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for i, e := range repo.written[3:] {
+		if e.RoomID != "room-b" {
+			t.Fatalf("written[%d] room = %s, want room-b", i+3, e.RoomID)
+		}
+	}
+}
+
+func TestBufferedEventRepository_SettleRoomWaitsFlushInterval(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeEventRepo{}
+	buf := newTestBuffer(repo, EventBufferConfig{BatchSize: 10, QueueSize: 10, FlushInterval: 50 * time.Millisecond})
+	_ = buf.CreateEventsBatch(ctx, presses(2))
+
+	// 他インスタンスが書き出すまで FlushInterval + 余裕を待ってから、自分の分を書き出す
+	since := time.Now()
+	if err := buf.SettleRoom(ctx, "room-a", since); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if elapsed := time.Since(since); elapsed < 50*time.Millisecond+eventSettleMargin {
+		t.Fatalf("settled after %v, want at least %v", elapsed, 50*time.Millisecond+eventSettleMargin)
+	}
+	if n, _ := repo.count(); n != 2 {
+		t.Fatalf("written=%d, want 2", n)
+	}
+
+	// 終了から十分経っていれば待たない
+	start := time.Now()
+	if err := buf.SettleRoom(ctx, "room-a", start.Add(-time.Minute)); err != nil || time.Since(start) > eventSettleMargin {
+		t.Fatalf("settle long after end: err=%v elapsed=%v", err, time.Since(start))
+	}
+}
@@ -1,52 +1,79 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
 	"time"
 
 	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/metrics"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // RoomRepository: ルーム永続化アクセス用インタフェース
 // 主要メソッドでクエリの所要時間と結果をログ出力する。
 type RoomRepository interface {
-	Create(room *model.Room) error                // 新規作成
-	Get(id string) (*model.Room, error)           // ID取得 (存在しなければ nil)
-	Delete(id string) error                       // ID削除
-	Update(id string, room *model.Room) error     // ID更新
-	MarkEnded(id string, endedAt time.Time) error // 終了状態に遷移
+	Create(ctx context.Context, room *model.Room) error            // 新規作成
+	Get(ctx context.Context, id string) (*model.Room, error)       // ID取得 (存在しなければ nil)
+	Delete(ctx context.Context, id string) error                   // ID削除
+	Update(ctx context.Context, id string, room *model.Room) error // ID更新
+	UpdateSettings(ctx context.Context, id, settings string) error // settings (JSONB) のみ更新
+	// Transition: 現在状態が from のいずれかである場合のみ to へ更新し、対応する時刻列を記録 (更新できたか返す)
+	Transition(ctx context.Context, id string, from []model.RoomStatus, to model.RoomStatus, at time.Time) (bool, error)
+	// ListReapable: 未終了のうち期限切れ (expires_at < now) または最終活動が idleBefore より前のルーム
+	ListReapable(ctx context.Context, now, idleBefore time.Time, limit int) ([]model.Room, error)
+	// ListByStreamer: 配信者のルームを新しい順に取得 (status 指定時はその状態のみ)
+	ListByStreamer(ctx context.Context, streamerID string, status model.RoomStatus, limit, offset int) ([]model.Room, error)
+}
+
+// roomColumns: SELECT 対象列 (model.Room と対応)
+const roomColumns = `id, streamer_id, created_at, expires_at, status, settings, lobby_at, started_at, paused_at, resumed_at, ended_at, expired_at`
+
+// statusTimestampColumns: 遷移先状態ごとに記録する時刻列
+var statusTimestampColumns = map[model.RoomStatus]string{
+	model.RoomStatusLobby:   "lobby_at",
+	model.RoomStatusRunning: "started_at",
+	model.RoomStatusPaused:  "paused_at",
+	model.RoomStatusEnded:   "ended_at",
+	model.RoomStatusExpired: "expired_at",
 }
 
 type roomRepository struct {
-	db     *sqlx.DB
-	logger *slog.Logger
+	db      *sqlx.DB
+	metrics *metrics.Metrics // クエリ遅延の記録先 (nil なら記録しない)
+	timeout time.Duration    // 1クエリあたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
 }
 
 // NewRoomRepository: 実装生成
-func NewRoomRepository(db *sqlx.DB, logger *slog.Logger) RoomRepository {
+func NewRoomRepository(db *sqlx.DB, m *metrics.Metrics, timeout time.Duration, logger *slog.Logger) RoomRepository {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &roomRepository{db: db, logger: logger}
+	return &roomRepository{db: db, metrics: m, timeout: timeout, logger: logger}
 }
 
 // Create: rooms テーブルに挿入 (CreatedAt 未設定時は現在時刻)
-func (r *roomRepository) Create(room *model.Room) error {
+func (r *roomRepository) Create(ctx context.Context, room *model.Room) error {
 	if room.CreatedAt.IsZero() {
 		room.CreatedAt = time.Now()
 	}
-	q := `INSERT INTO rooms (id, streamer_id, created_at, expires_at, status, settings, ended_at)
-          VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	q := `INSERT INTO rooms (id, streamer_id, created_at, expires_at, status, settings, lobby_at, started_at, paused_at, resumed_at, ended_at, expired_at)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
 	logger := r.logger.With(
 		slog.String("repo", "room"),
 		slog.String("op", "create"),
 		slog.String("room_id", room.ID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, room.ID, room.StreamerID, room.CreatedAt, room.ExpiresAt, room.Status, room.Settings, room.EndedAt)
+	defer r.metrics.ObserveDB("room", "create", start)
+	res, err := r.db.ExecContext(ctx, q, room.ID, room.StreamerID, room.CreatedAt, room.ExpiresAt, room.Status, room.Settings, room.LobbyAt, room.StartedAt, room.PausedAt, room.ResumedAt, room.EndedAt, room.ExpiredAt)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -57,16 +84,19 @@ func (r *roomRepository) Create(room *model.Room) error {
 }
 
 // Get: 指定IDのルームを取得 (存在しない場合 nil を返す)
-func (r *roomRepository) Get(id string) (*model.Room, error) {
+func (r *roomRepository) Get(ctx context.Context, id string) (*model.Room, error) {
 	var rm model.Room
-	q := `SELECT id, streamer_id, created_at, expires_at, status, settings, ended_at FROM rooms WHERE id=$1`
+	q := `SELECT ` + roomColumns + ` FROM rooms WHERE id=$1`
 	logger := r.logger.With(
 		slog.String("repo", "room"),
 		slog.String("op", "get"),
 		slog.String("room_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Get(&rm, q, id); err != nil {
+	defer r.metrics.ObserveDB("room", "get", start)
+	if err := r.db.GetContext(ctx, &rm, q, id); err != nil {
 		if err == sql.ErrNoRows {
 			logger.Debug("db.query", slog.Bool("found", false), slog.Duration("elapsed", time.Since(start)))
 			return nil, nil
@@ -79,15 +109,19 @@ func (r *roomRepository) Get(id string) (*model.Room, error) {
 }
 
 // Update: 指定IDのルームを更新
-func (r *roomRepository) Update(id string, room *model.Room) error {
-	q := `UPDATE rooms SET streamer_id=$1, created_at=$2, expires_at=$3, status=$4, settings=$5, ended_at=$6 WHERE id=$7`
+func (r *roomRepository) Update(ctx context.Context, id string, room *model.Room) error {
+	q := `UPDATE rooms SET streamer_id=$1, created_at=$2, expires_at=$3, status=$4, settings=$5,
+          lobby_at=$6, started_at=$7, paused_at=$8, resumed_at=$9, ended_at=$10, expired_at=$11 WHERE id=$12`
 	logger := r.logger.With(
 		slog.String("repo", "room"),
 		slog.String("op", "update"),
 		slog.String("room_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, room.StreamerID, room.CreatedAt, room.ExpiresAt, room.Status, room.Settings, room.EndedAt, id)
+	defer r.metrics.ObserveDB("room", "update", start)
+	res, err := r.db.ExecContext(ctx, q, room.StreamerID, room.CreatedAt, room.ExpiresAt, room.Status, room.Settings, room.LobbyAt, room.StartedAt, room.PausedAt, room.ResumedAt, room.EndedAt, room.ExpiredAt, id)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -98,15 +132,18 @@ func (r *roomRepository) Update(id string, room *model.Room) error {
 }
 
 // Delete: 指定IDのルームを削除
-func (r *roomRepository) Delete(id string) error {
+func (r *roomRepository) Delete(ctx context.Context, id string) error {
 	q := `DELETE FROM rooms WHERE id=$1`
 	logger := r.logger.With(
 		slog.String("repo", "room"),
 		slog.String("op", "delete"),
 		slog.String("room_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, id)
+	defer r.metrics.ObserveDB("room", "delete", start)
+	res, err := r.db.ExecContext(ctx, q, id)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -116,15 +153,56 @@ func (r *roomRepository) Delete(id string) error {
 	return nil
 }
 
-func (r *roomRepository) MarkEnded(id string, endedAt time.Time) error {
-	q := `UPDATE rooms SET status=$1, ended_at=$2 WHERE id=$3`
+// Transition: 現在状態を条件にした UPDATE で状態遷移を原子的に行う
+// paused → running の再開時は started_at を保持し resumed_at を記録する。
+func (r *roomRepository) Transition(ctx context.Context, id string, from []model.RoomStatus, to model.RoomStatus, at time.Time) (bool, error) {
+	column, ok := statusTimestampColumns[to]
+	if !ok {
+		return false, fmt.Errorf("no timestamp column for status %s", to)
+	}
+	froms := make([]string, len(from))
+	for i, f := range from {
+		froms[i] = string(f)
+	}
+	// running への遷移は初回のみ started_at を設定し、再開時は resumed_at を更新する
+	set := column + `=$2`
+	if to == model.RoomStatusRunning {
+		set = `started_at=COALESCE(started_at, $2), resumed_at=CASE WHEN status='paused' THEN $2 ELSE resumed_at END`
+	}
+	q := `UPDATE rooms SET status=$1, ` + set + ` WHERE id=$3 AND status = ANY($4)`
+	logger := r.logger.With(
+		slog.String("repo", "room"),
+		slog.String("op", "transition"),
+		slog.String("room_id", id),
+		slog.String("to", string(to)),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("room", "transition", start)
+	res, err := r.db.ExecContext(ctx, q, to, at, id, pq.Array(froms))
+	if err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return false, err
+	}
+	rows, _ := res.RowsAffected()
+	logger.Debug("db.exec", slog.Int64("rows_affected", rows), slog.Duration("elapsed", time.Since(start)))
+	return rows > 0, nil
+}
+
+// UpdateSettings: settings 列のみを更新 (カタログ登録など部分更新用)
+func (r *roomRepository) UpdateSettings(ctx context.Context, id, settings string) error {
+	q := `UPDATE rooms SET settings=$1::jsonb WHERE id=$2`
 	logger := r.logger.With(
 		slog.String("repo", "room"),
-		slog.String("op", "mark_ended"),
+		slog.String("op", "update_settings"),
 		slog.String("room_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, "ended", endedAt, id)
+	defer r.metrics.ObserveDB("room", "update_settings", start)
+	res, err := r.db.ExecContext(ctx, q, settings, id)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -133,3 +211,58 @@ func (r *roomRepository) MarkEnded(id string, endedAt time.Time) error {
 	logger.Debug("db.exec", slog.Int64("rows_affected", rows), slog.Duration("elapsed", time.Since(start)))
 	return nil
 }
+
+// ListReapable: 期限切れ/放置ルームを取得
+// 最終活動 = 作成・各状態遷移時刻・最後の押下 (events.triggered_at) の最大値。
+func (r *roomRepository) ListReapable(ctx context.Context, now, idleBefore time.Time, limit int) ([]model.Room, error) {
+	rooms := []model.Room{}
+	q := `SELECT ` + roomColumns + `
+        FROM rooms r
+        WHERE r.status NOT IN ('ended', 'expired')
+          AND (
+            (r.expires_at IS NOT NULL AND r.expires_at < $1)
+            OR GREATEST(r.created_at, r.lobby_at, r.started_at, r.paused_at, r.resumed_at,
+                        (SELECT MAX(e.triggered_at) FROM events e WHERE e.room_id = r.id)) < $2
+          )
+        ORDER BY r.created_at
+        LIMIT $3`
+	logger := r.logger.With(
+		slog.String("repo", "room"),
+		slog.String("op", "list_reapable"),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("room", "list_reapable", start)
+	if err := r.db.SelectContext(ctx, &rooms, q, now, idleBefore, limit); err != nil {
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Int("row_count", len(rooms)), slog.Duration("elapsed", time.Since(start)))
+	return rooms, nil
+}
+
+// ListByStreamer: 配信者のルーム一覧 (作成の新しい順)
+func (r *roomRepository) ListByStreamer(ctx context.Context, streamerID string, status model.RoomStatus, limit, offset int) ([]model.Room, error) {
+	rooms := []model.Room{}
+	q := `SELECT ` + roomColumns + `
+        FROM rooms
+        WHERE streamer_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY created_at DESC, id DESC
+        LIMIT $3 OFFSET $4`
+	logger := r.logger.With(
+		slog.String("repo", "room"),
+		slog.String("op", "list_by_streamer"),
+		slog.String("streamer_id", streamerID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("room", "list_by_streamer", start)
+	if err := r.db.SelectContext(ctx, &rooms, q, streamerID, string(status), limit, offset); err != nil {
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Int("row_count", len(rooms)), slog.Duration("elapsed", time.Since(start)))
+	return rooms, nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StreamerRepository: 配信者アカウントと API キーの永続化
+type StreamerRepository interface {
+	Create(ctx context.Context, streamer *model.Streamer) error                             // 新規作成
+	Get(ctx context.Context, id string) (*model.Streamer, error)                            // ID取得 (存在しなければ nil)
+	CreateAPIKey(ctx context.Context, key *model.StreamerAPIKey) error                      // API キー追加
+	GetAPIKey(ctx context.Context, id string) (*model.StreamerAPIKey, error)                // キー ID で取得 (存在しなければ nil)
+	ListAPIKeys(ctx context.Context, streamerID string) ([]model.StreamerAPIKey, error)     // 配信者のキー一覧 (新しい順, 失効済みを含む)
+	RevokeAPIKey(ctx context.Context, streamerID, keyID string, at time.Time) (bool, error) // 配信者自身の有効なキーのみ失効 (失効できたか返す)
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error                         // 最終使用時刻を記録
+}
+
+type streamerRepository struct {
+	db      *sqlx.DB
+	metrics *metrics.Metrics // クエリ遅延の記録先 (nil なら記録しない)
+	timeout time.Duration    // 1クエリあたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
+}
+
+// NewStreamerRepository: 実装生成
+func NewStreamerRepository(db *sqlx.DB, m *metrics.Metrics, timeout time.Duration, logger *slog.Logger) StreamerRepository {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &streamerRepository{db: db, metrics: m, timeout: timeout, logger: logger}
+}
+
+// Create: streamers テーブルに挿入 (CreatedAt 未設定時は現在時刻)
+func (r *streamerRepository) Create(ctx context.Context, streamer *model.Streamer) error {
+	if streamer.CreatedAt.IsZero() {
+		streamer.CreatedAt = time.Now()
+	}
+	q := `INSERT INTO streamers (id, name, created_at, updated_at) VALUES ($1, $2, $3, $4)`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "create"),
+		slog.String("streamer_id", streamer.ID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "create", start)
+	res, err := r.db.ExecContext(ctx, q, streamer.ID, streamer.Name, streamer.CreatedAt, streamer.UpdatedAt)
+	if err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	logger.Debug("db.exec", slog.Int64("rows_affected", rows), slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Get: 指定IDの配信者を取得 (存在しない場合 nil を返す)
+func (r *streamerRepository) Get(ctx context.Context, id string) (*model.Streamer, error) {
+	var s model.Streamer
+	q := `SELECT id, name, created_at, updated_at FROM streamers WHERE id = $1`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "get"),
+		slog.String("streamer_id", id),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "get", start)
+	if err := r.db.GetContext(ctx, &s, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			logger.Debug("db.query", slog.Bool("found", false), slog.Duration("elapsed", time.Since(start)))
+			return nil, nil
+		}
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Bool("found", true), slog.Duration("elapsed", time.Since(start)))
+	return &s, nil
+}
+
+// CreateAPIKey: streamer_api_keys テーブルに挿入
+func (r *streamerRepository) CreateAPIKey(ctx context.Context, key *model.StreamerAPIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	q := `INSERT INTO streamer_api_keys (id, streamer_id, name, secret_hash, created_at) VALUES ($1, $2, $3, $4, $5)`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "create_api_key"),
+		slog.String("streamer_id", key.StreamerID),
+		slog.String("key_id", key.ID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "create_api_key", start)
+	res, err := r.db.ExecContext(ctx, q, key.ID, key.StreamerID, key.Name, key.SecretHash, key.CreatedAt)
+	if err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	logger.Debug("db.exec", slog.Int64("rows_affected", rows), slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// GetAPIKey: キー ID で取得 (存在しない場合 nil を返す)
+func (r *streamerRepository) GetAPIKey(ctx context.Context, id string) (*model.StreamerAPIKey, error) {
+	var key model.StreamerAPIKey
+	q := `SELECT id, streamer_id, name, secret_hash, created_at, last_used_at, revoked_at FROM streamer_api_keys WHERE id = $1`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "get_api_key"),
+		slog.String("key_id", id),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "get_api_key", start)
+	if err := r.db.GetContext(ctx, &key, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			logger.Debug("db.query", slog.Bool("found", false), slog.Duration("elapsed", time.Since(start)))
+			return nil, nil
+		}
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Bool("found", true), slog.Duration("elapsed", time.Since(start)))
+	return &key, nil
+}
+
+// ListAPIKeys: 配信者のキー一覧 (新しい順)
+func (r *streamerRepository) ListAPIKeys(ctx context.Context, streamerID string) ([]model.StreamerAPIKey, error) {
+	keys := []model.StreamerAPIKey{}
+	q := `SELECT id, streamer_id, name, secret_hash, created_at, last_used_at, revoked_at
+        FROM streamer_api_keys WHERE streamer_id = $1 ORDER BY created_at DESC`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "list_api_keys"),
+		slog.String("streamer_id", streamerID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "list_api_keys", start)
+	if err := r.db.SelectContext(ctx, &keys, q, streamerID); err != nil {
+		logger.Error("db.query failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("db.query", slog.Int("row_count", len(keys)), slog.Duration("elapsed", time.Since(start)))
+	return keys, nil
+}
+
+// RevokeAPIKey: 配信者自身の未失効キーのみ revoked_at を設定
+func (r *streamerRepository) RevokeAPIKey(ctx context.Context, streamerID, keyID string, at time.Time) (bool, error) {
+	q := `UPDATE streamer_api_keys SET revoked_at = $1 WHERE id = $2 AND streamer_id = $3 AND revoked_at IS NULL`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "revoke_api_key"),
+		slog.String("streamer_id", streamerID),
+		slog.String("key_id", keyID),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "revoke_api_key", start)
+	res, err := r.db.ExecContext(ctx, q, at, keyID, streamerID)
+	if err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return false, err
+	}
+	rows, _ := res.RowsAffected()
+	logger.Debug("db.exec", slog.Int64("rows_affected", rows), slog.Duration("elapsed", time.Since(start)))
+	return rows > 0, nil
+}
+
+// TouchAPIKey: last_used_at を更新
+func (r *streamerRepository) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	q := `UPDATE streamer_api_keys SET last_used_at = $1 WHERE id = $2`
+	logger := r.logger.With(
+		slog.String("repo", "streamer"),
+		slog.String("op", "touch_api_key"),
+		slog.String("key_id", id),
+	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer r.metrics.ObserveDB("streamer", "touch_api_key", start)
+	if _, err := r.db.ExecContext(ctx, q, at, id); err != nil {
+		logger.Error("db.exec failed", slog.Any("error", err))
+		return err
+	}
+	logger.Debug("db.exec", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// withTimeout: 1クエリ分の期限を ctx に設定 (timeout <= 0 なら ctx のまま)
+// 呼び出し元 (リクエスト) の期限の方が早ければそちらで打ち切られる。
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -1,34 +1,38 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"log/slog"
 	"time"
 
 	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/metrics"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type ViewerRepository interface {
-	Create(viewer *model.Viewer) error
-	Exists(id string) (bool, error)
-	Get(id string) (*model.Viewer, error)
+	Create(ctx context.Context, viewer *model.Viewer) error
+	Exists(ctx context.Context, id string) (bool, error)
+	Get(ctx context.Context, id string) (*model.Viewer, error)
 }
 
 type viewerRepository struct {
-	db     *sqlx.DB
-	logger *slog.Logger
+	db      *sqlx.DB
+	metrics *metrics.Metrics // クエリ遅延の記録先 (nil なら記録しない)
+	timeout time.Duration    // 1クエリあたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
 }
 
-func NewViewerRepository(db *sqlx.DB, logger *slog.Logger) ViewerRepository {
+func NewViewerRepository(db *sqlx.DB, m *metrics.Metrics, timeout time.Duration, logger *slog.Logger) ViewerRepository {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &viewerRepository{db: db, logger: logger}
+	return &viewerRepository{db: db, metrics: m, timeout: timeout, logger: logger}
 }
 
-func (r *viewerRepository) Create(viewer *model.Viewer) error {
+func (r *viewerRepository) Create(ctx context.Context, viewer *model.Viewer) error {
 	if viewer.CreatedAt.IsZero() {
 		viewer.CreatedAt = time.Now()
 	}
@@ -39,8 +43,11 @@ func (r *viewerRepository) Create(viewer *model.Viewer) error {
 		slog.String("op", "create"),
 		slog.String("viewer_id", viewer.ID),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	res, err := r.db.Exec(q, viewer.ID, viewer.Name, viewer.CreatedAt, viewer.UpdatedAt)
+	defer r.metrics.ObserveDB("viewer", "create", start)
+	res, err := r.db.ExecContext(ctx, q, viewer.ID, viewer.Name, viewer.CreatedAt, viewer.UpdatedAt)
 	if err != nil {
 		logger.Error("db.exec failed", slog.Any("error", err))
 		return err
@@ -50,7 +57,7 @@ func (r *viewerRepository) Create(viewer *model.Viewer) error {
 	return nil
 }
 
-func (r *viewerRepository) Exists(id string) (bool, error) {
+func (r *viewerRepository) Exists(ctx context.Context, id string) (bool, error) {
 	var exists bool
 	q := `SELECT EXISTS(SELECT 1 FROM viewers WHERE id = $1)`
 	logger := r.logger.With(
@@ -58,8 +65,11 @@ func (r *viewerRepository) Exists(id string) (bool, error) {
 		slog.String("op", "exists"),
 		slog.String("viewer_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Get(&exists, q, id); err != nil {
+	defer r.metrics.ObserveDB("viewer", "exists", start)
+	if err := r.db.GetContext(ctx, &exists, q, id); err != nil {
 		logger.Error("db.query failed", slog.Any("error", err))
 		return false, err
 	}
@@ -67,7 +77,7 @@ func (r *viewerRepository) Exists(id string) (bool, error) {
 	return exists, nil
 }
 
-func (r *viewerRepository) Get(id string) (*model.Viewer, error) {
+func (r *viewerRepository) Get(ctx context.Context, id string) (*model.Viewer, error) {
 	var viewer model.Viewer
 	q := `SELECT id, name, created_at, updated_at FROM viewers WHERE id = $1`
 	logger := r.logger.With(
@@ -75,8 +85,11 @@ func (r *viewerRepository) Get(id string) (*model.Viewer, error) {
 		slog.String("op", "get"),
 		slog.String("viewer_id", id),
 	)
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 	start := time.Now()
-	if err := r.db.Get(&viewer, q, id); err != nil {
+	defer r.metrics.ObserveDB("viewer", "get", start)
+	if err := r.db.GetContext(ctx, &viewer, q, id); err != nil {
 		if err == sql.ErrNoRows {
 			logger.Debug("db.query", slog.Bool("found", false), slog.Duration("elapsed", time.Since(start)))
 			return nil, nil
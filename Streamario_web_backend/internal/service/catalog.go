@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+)
+
+// catalogCacheTTL: カタログキャッシュの有効期間
+// 別インスタンスでカタログが更新された場合もこの時間で追従する。
+const catalogCacheTTL = 30 * time.Second
+
+// ErrUnknownEventType: ルームのカタログに存在しないイベント種別
+var ErrUnknownEventType = errors.New("unknown event type")
+
+type catalogEntry struct {
+	catalog  *model.EventCatalog
+	strategy ThresholdStrategy
+	loadedAt time.Time
+}
+
+// CatalogService: ルームごとのイベントカタログ (ボタン定義) と閾値算出方式を管理
+// 定義は rooms.settings に永続化し、プロセス内で短期キャッシュする。
+type CatalogService struct {
+	repo     repository.RoomRepository
+	defaults *model.EventCatalog
+	mu       sync.RWMutex
+	cache    map[string]catalogEntry
+	logger   *slog.Logger
+}
+
+// NewCatalogService: 依存注入してサービス生成
+func NewCatalogService(repo repository.RoomRepository, logger *slog.Logger) *CatalogService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &CatalogService{repo: repo, defaults: DefaultEventCatalog(), cache: make(map[string]catalogEntry), logger: logger}
+}
+
+// GetCatalog: ルームのカタログを取得 (未宣言・未登録ルームは既定カタログ)
+func (s *CatalogService) GetCatalog(ctx context.Context, roomID string) (*model.EventCatalog, error) {
+	entry, err := s.load(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.catalog, nil
+}
+
+// GetStrategy: ルームの閾値算出方式を取得 (未設定なら step)
+func (s *CatalogService) GetStrategy(ctx context.Context, roomID string) (ThresholdStrategy, error) {
+	entry, err := s.load(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.strategy, nil
+}
+
+// load: キャッシュ優先で settings からカタログ/閾値方式を組み立てる
+// 保存内容が壊れている場合は既定値にフォールバックする。
+func (s *CatalogService) load(ctx context.Context, roomID string) (catalogEntry, error) {
+	s.mu.RLock()
+	entry, ok := s.cache[roomID]
+	s.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < catalogCacheTTL {
+		return entry, nil
+	}
+
+	room, err := s.repo.Get(ctx, roomID)
+	if err != nil {
+		return catalogEntry{}, fmt.Errorf("load room failed: %w", err)
+	}
+	entry = catalogEntry{catalog: s.defaults, strategy: stepStrategy{}}
+	if room != nil {
+		settings, err := model.ParseRoomSettings(room.Settings)
+		if err != nil {
+			s.logger.Warn("room settings unreadable, falling back to defaults", slog.String("room_id", roomID), slog.Any("error", err))
+			settings = &model.RoomSettings{}
+		}
+		if len(settings.EventCatalog) > 0 {
+			c, err := model.NewEventCatalog(settings.EventCatalog)
+			if err != nil {
+				s.logger.Warn("stored event catalog invalid, falling back to default catalog", slog.String("room_id", roomID), slog.Any("error", err))
+			} else {
+				entry.catalog = c
+			}
+		}
+		if st, err := NewThresholdStrategy(settings.Threshold); err != nil {
+			s.logger.Warn("stored threshold strategy invalid, falling back to step", slog.String("room_id", roomID), slog.Any("error", err))
+		} else {
+			entry.strategy = st
+		}
+	}
+	entry.loadedAt = time.Now()
+	s.mu.Lock()
+	s.pruneLocked(entry.loadedAt)
+	s.cache[roomID] = entry
+	s.mu.Unlock()
+	return entry, nil
+}
+
+// pruneLocked: 有効期間を過ぎたエントリを破棄 (終了後に結果参照だけされたルームを残さない)
+// 呼び出し側で s.mu の書き込みロックを取得しておくこと。
+func (s *CatalogService) pruneLocked(now time.Time) {
+	for id, e := range s.cache {
+		if now.Sub(e.loadedAt) >= catalogCacheTTL {
+			delete(s.cache, id)
+		}
+	}
+}
+
+// SetCatalog: Unity が宣言したボタン定義を検証し rooms.settings へ保存
+func (s *CatalogService) SetCatalog(ctx context.Context, roomID string, defs []model.EventConfig) (*model.EventCatalog, error) {
+	catalog, err := model.NewEventCatalog(defs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateSettings(ctx, roomID, func(settings *model.RoomSettings) {
+		settings.EventCatalog = catalog.Events()
+	}); err != nil {
+		return nil, err
+	}
+	s.logger.Info("event catalog configured", slog.String("room_id", roomID), slog.Int("event_count", len(defs)))
+	return catalog, nil
+}
+
+// SetThresholdStrategy: 閾値算出方式を検証し rooms.settings へ保存
+func (s *CatalogService) SetThresholdStrategy(ctx context.Context, roomID string, threshold model.ThresholdSettings) (ThresholdStrategy, error) {
+	strategy, err := NewThresholdStrategy(&threshold)
+	if err != nil {
+		return nil, err
+	}
+	threshold.Strategy = strategy.Name()
+	if err := s.updateSettings(ctx, roomID, func(settings *model.RoomSettings) {
+		settings.Threshold = &threshold
+	}); err != nil {
+		return nil, err
+	}
+	s.logger.Info("threshold strategy configured", slog.String("room_id", roomID), slog.String("strategy", strategy.Name()))
+	return strategy, nil
+}
+
+// updateSettings: settings を読み出して mutate を適用し保存、キャッシュを破棄する
+func (s *CatalogService) updateSettings(ctx context.Context, roomID string, mutate func(*model.RoomSettings)) error {
+	room, err := s.repo.Get(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("load room failed: %w", err)
+	}
+	if room == nil {
+		return errors.New("room not found")
+	}
+	settings, err := model.ParseRoomSettings(room.Settings)
+	if err != nil {
+		// 壊れた settings は作り直す
+		settings = &model.RoomSettings{}
+	}
+	mutate(settings)
+	raw, err := settings.Encode()
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdateSettings(ctx, roomID, raw); err != nil {
+		return fmt.Errorf("save room settings failed: %w", err)
+	}
+	s.Invalidate(roomID)
+	return nil
+}
+
+// Resolve: ルームのカタログから種別定義を引く (存在しなければ ErrUnknownEventType)
+func (s *CatalogService) Resolve(ctx context.Context, roomID string, eventType model.EventType) (*model.EventConfig, error) {
+	catalog, err := s.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, ok := catalog.Lookup(eventType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+	}
+	return cfg, nil
+}
+
+// Invalidate: キャッシュを破棄 (ルーム終了時など)
+func (s *CatalogService) Invalidate(roomID string) {
+	s.mu.Lock()
+	delete(s.cache, roomID)
+	s.mu.Unlock()
+}
+
+// DefaultEventCatalog: カタログ未宣言ルーム向けの既定ボタン定義 (従来の6種)
+func DefaultEventCatalog() *model.EventCatalog {
+	catalog, err := model.NewEventCatalog([]model.EventConfig{
+		{EventType: model.SKILL1, Label: "Skill 1", Team: model.TeamSkill, BaseThreshold: 5, MinThreshold: 3, MaxThreshold: 50, LevelMultiplier: 1.3},
+		{EventType: model.SKILL2, Label: "Skill 2", Team: model.TeamSkill, BaseThreshold: 6, MinThreshold: 4, MaxThreshold: 60, LevelMultiplier: 1.3},
+		{EventType: model.SKILL3, Label: "Skill 3", Team: model.TeamSkill, BaseThreshold: 12, MinThreshold: 8, MaxThreshold: 100, LevelMultiplier: 1.4},
+		{EventType: model.ENEMY1, Label: "Enemy 1", Team: model.TeamEnemy, BaseThreshold: 6, MinThreshold: 4, MaxThreshold: 45, LevelMultiplier: 1.3},
+		{EventType: model.ENEMY2, Label: "Enemy 2", Team: model.TeamEnemy, BaseThreshold: 7, MinThreshold: 5, MaxThreshold: 55, LevelMultiplier: 1.4},
+		{EventType: model.ENEMY3, Label: "Enemy 3", Team: model.TeamEnemy, BaseThreshold: 10, MinThreshold: 6, MaxThreshold: 80, LevelMultiplier: 1.5},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("default event catalog invalid: %v", err))
+	}
+	return catalog
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+)
+
+func TestCatalogService_FallsBackToDefaults(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "declared", Status: model.RoomStatusRunning})
+	repo.put(model.Room{ID: "broken-json", Status: model.RoomStatusRunning, Settings: `{"event_catalog":`})
+	// 保存後に予約済みになったチーム名など、今は通らない定義
+	repo.put(model.Room{ID: "invalid-catalog", Status: model.RoomStatusRunning, Settings: `{"event_catalog":[{"id":"boss","team":"all","base_threshold":5,"min_threshold":1,"max_threshold":10}],"threshold":{"strategy":"unknown"}}`})
+	s := NewCatalogService(repo, nil)
+
+	heal := model.EventConfig{EventType: "heal", Team: model.TeamSkill, BaseThreshold: 5, MinThreshold: 1, MaxThreshold: 10}
+	if _, err := s.SetCatalog(ctx, "declared", []model.EventConfig{heal}); err != nil {
+		t.Fatalf("SetCatalog: %v", err)
+	}
+	if _, err := s.SetThresholdStrategy(ctx, "declared", model.ThresholdSettings{Strategy: StrategyEscalation}); err != nil {
+		t.Fatalf("SetThresholdStrategy: %v", err)
+	}
+
+	defaults := DefaultEventCatalog().Types()
+	tests := []struct {
+		roomID   string
+		types    int
+		strategy string
+	}{
+		{"declared", 1, StrategyEscalation},
+		{"unregistered", len(defaults), StrategyStep},
+		{"broken-json", len(defaults), StrategyStep},
+		{"invalid-catalog", len(defaults), StrategyStep},
+	}
+	for _, tc := range tests {
+		t.Run(tc.roomID, func(t *testing.T) {
+			catalog, err := s.GetCatalog(ctx, tc.roomID)
+			if err != nil {
+				t.Fatalf("GetCatalog: %v", err)
+			}
+			if got := len(catalog.Types()); got != tc.types {
+				t.Fatalf("types = %v, want %d", catalog.Types(), tc.types)
+			}
+			strategy, err := s.GetStrategy(ctx, tc.roomID)
+			if err != nil || strategy.Name() != tc.strategy {
+				t.Fatalf("strategy = %v, %v; want %s", strategy, err, tc.strategy)
+			}
+		})
+	}
+
+	// 宣言したカタログに無い種別は解決できない (既定カタログの種別も含む)
+	if _, err := s.Resolve(ctx, "declared", model.SKILL1); err == nil {
+		t.Fatal("skill1 should not resolve in a declared catalog")
+	}
+	if _, err := s.Resolve(ctx, "unregistered", model.SKILL1); err != nil {
+		t.Fatalf("default catalog should resolve skill1: %v", err)
+	}
+
+	// 不正な宣言は保存せず、既存のカタログを残す
+	dup := []model.EventConfig{heal, heal}
+	if _, err := s.SetCatalog(ctx, "declared", dup); err == nil {
+		t.Fatal("duplicate ids should be rejected")
+	}
+	if catalog, _ := s.GetCatalog(ctx, "declared"); len(catalog.Types()) != 1 {
+		t.Fatalf("catalog changed after rejected declaration: %v", catalog.Types())
+	}
+}
+
+func TestCatalogService_PrunesExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "ended", Status: model.RoomStatusEnded})
+	repo.put(model.Room{ID: "running", Status: model.RoomStatusRunning})
+	s := NewCatalogService(repo, nil)
+
+	if _, err := s.GetCatalog(ctx, "ended"); err != nil {
+		t.Fatalf("GetCatalog: %v", err)
+	}
+	// 結果参照だけされて有効期間を過ぎたエントリ
+	s.mu.Lock()
+	e := s.cache["ended"]
+	e.loadedAt = time.Now().Add(-catalogCacheTTL)
+	s.cache["ended"] = e
+	s.mu.Unlock()
+
+	if _, err := s.GetCatalog(ctx, "running"); err != nil {
+		t.Fatalf("GetCatalog: %v", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.cache["ended"]; ok {
+		t.Fatal("expired entry not pruned")
+	}
+	if _, ok := s.cache["running"]; !ok {
+		t.Fatal("fresh entry missing")
+	}
+}
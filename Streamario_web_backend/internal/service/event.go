@@ -3,14 +3,20 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math"
+	"time"
 
 	"streamerrio-backend/internal/model"
 	"streamerrio-backend/internal/repository"
 	"streamerrio-backend/pkg/counter"
+	"streamerrio-backend/pkg/metrics"
 	"streamerrio-backend/pkg/pubsub"
+	"streamerrio-backend/pkg/registry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // WebSocket 送信用インタフェース (Unity へゲームイベント通知するための最小限)
@@ -19,72 +25,134 @@ type WebSocketSender interface {
 	SendEventToUnity(roomID string, payload map[string]interface{}) error
 }
 
+// maxTriggerAttempts: 発動履歴の競合 (counter.ErrTriggerStateChanged) で加算をやり直す上限
+// 競合は同じ種別の発動1回につき高々1回ずつしか起きないため、超えるのは発動が連続する異常時のみ。
+const maxTriggerAttempts = 8
+
+// ErrEventBacklogged: 押下イベントの書き込み待ちが溢れている (DB の書き込みが追いつくまで受け付けられない)
+var ErrEventBacklogged = repository.ErrEventQueueFull
+
 type EventService struct {
 	counter   counter.Counter
 	eventRepo repository.EventRepository
-	pubsub    pubsub.PubSub // Pub/Sub経由でWebSocketサーバーに配信
-	configs   map[model.EventType]*model.EventConfig
+	pubsub    pubsub.PubSub     // Pub/Sub経由でWebSocketサーバーに配信
+	catalogs  *CatalogService   // ルームごとのボタン定義
+	registry  registry.Registry // Unity 接続の所有インスタンス (nil なら全体ブロードキャスト)
+	feed      *ViewerFeed       // 視聴者向けライブ更新 (nil なら発行しない)
+	metrics   *metrics.Metrics  // 押下数 / 発動数の記録先 (nil なら記録しない)
 	logger    *slog.Logger
 }
 
-// NewEventService: 依存（カウンタ / リポジトリ / PubSub）を束ねてサービス生成
-func NewEventService(counter counter.Counter, eventRepo repository.EventRepository, ps pubsub.PubSub, logger *slog.Logger) *EventService {
+// NewEventService: 依存（カウンタ / リポジトリ / PubSub / カタログ）を束ねてサービス生成
+func NewEventService(counter counter.Counter, eventRepo repository.EventRepository, ps pubsub.PubSub, catalogs *CatalogService, logger *slog.Logger) *EventService {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &EventService{counter: counter, eventRepo: eventRepo, pubsub: ps, configs: getDefaultEventConfigs(), logger: logger}
+	return &EventService{counter: counter, eventRepo: eventRepo, pubsub: ps, catalogs: catalogs, logger: logger}
 }
 
-// ProcessEvent: 1イベント処理の本流 (DB保存→視聴者アクティビティ更新→カウント加算→閾値判定→発動通知/リセット)
-func (s *EventService) ProcessEvent(roomID string, eventType model.EventType, EventButtonPushCount int64, viewerID *string) (*model.EventResult, error) {
-	// eventType が有効かチェック
-	if _, ok := s.configs[eventType]; !ok {
-		return nil, fmt.Errorf("invalid event type: %s", eventType)
-	}
-
-	// 1. Record events (バッチ挿入で効率化)
-	events := make([]*model.Event, EventButtonPushCount)
-	for i := int64(0); i < EventButtonPushCount; i++ {
-		events[i] = &model.Event{
-			RoomID:    roomID,
-			EventType: eventType,
-			ViewerID:  viewerID,
-			Metadata:  "{}",
-		}
+// SetRegistry: 所有インスタンス解決用レジストリを注入 (発動通知を所有インスタンス宛てに発行する)
+func (s *EventService) SetRegistry(reg registry.Registry) { s.registry = reg }
+
+// SetViewerFeed: 視聴者向けライブ更新の発行先を注入
+func (s *EventService) SetViewerFeed(feed *ViewerFeed) { s.feed = feed }
+
+// SetMetrics: 押下数 / 発動数の記録先を注入
+func (s *EventService) SetMetrics(m *metrics.Metrics) { s.metrics = m }
+
+// ProcessEvent: 1イベント処理の本流 (DB保存→視聴者アクティビティ更新→閾値算出→原子的な加算/発動判定→発動通知)
+// ctx はリクエストの context。各段階をそのトレースの子スパンとして記録し、発動通知にもトレースを引き継ぐ。
+func (s *EventService) ProcessEvent(ctx context.Context, roomID string, eventType model.EventType, EventButtonPushCount int64, viewerID *string) (res *model.EventResult, err error) {
+	ctx, span := tracer.Start(ctx, "EventService.ProcessEvent", trace.WithAttributes(
+		attribute.String("room_id", roomID),
+		attribute.String("event_type", string(eventType)),
+		attribute.Int64("push_count", EventButtonPushCount),
+	))
+	defer func() { endSpan(span, err) }()
+
+	// eventType がルームのカタログに存在するかチェック
+	cfg, err := s.catalogs.Resolve(ctx, roomID, eventType)
+	if err != nil {
+		return nil, err
 	}
-	if err := s.eventRepo.CreateEventsBatch(events); err != nil {
-		return nil, fmt.Errorf("record events failed: %w", err)
+
+	// 1. Record events (1回の送信分の押下を press_count 付きの1行で記録 / write-behind 構成ではキューへ積むだけで、カウントは DB を待たずに進める)
+	if EventButtonPushCount > 0 {
+		event := &model.Event{
+			RoomID:     roomID,
+			EventType:  eventType,
+			ViewerID:   viewerID,
+			Metadata:   "{}",
+			PressCount: int(EventButtonPushCount),
+		}
+		_, recordSpan := tracer.Start(ctx, "EventRepository.CreateEventsBatch", trace.WithAttributes(attribute.Int64("presses", EventButtonPushCount)))
+		err = s.eventRepo.CreateEventsBatch(ctx, []*model.Event{event})
+		endSpan(recordSpan, err)
+		if err != nil {
+			return nil, fmt.Errorf("record events failed: %w", err)
+		}
 	}
 
 	// 2. Update viewer activity (backend-agnostic)
 	if viewerID != nil {
-		_ = s.counter.UpdateViewerActivity(roomID, *viewerID)
+		_ = s.counter.UpdateViewerActivity(ctx, roomID, *viewerID)
 	}
 
-	// 3. Increment counter
-	current, err := s.counter.Increment(roomID, string(eventType), EventButtonPushCount)
+	// 3. Active viewer count
+	viewers := s.getActiveViewerCount(ctx, roomID)
+
+	// 4. Threshold strategy (閾値はルームの算出方式と発動履歴から決定)
+	strategy, err := s.catalogs.GetStrategy(ctx, roomID)
 	if err != nil {
-		return nil, fmt.Errorf("increment failed: %w", err)
+		return nil, err
 	}
 
-	// 4. Active viewer count
-	viewers := s.getActiveViewerCount(roomID)
+	// 5. Increment & trigger (加算・閾値判定・超過分設定・発動履歴記録を原子的に実行)
+	// 同時リクエストでも発動の取りこぼし/二重発動が起きないよう、判定は Counter 側に委ねる。
+	// 閾値とレベルは読み出した発動履歴から算出するため、加算までに別リクエストが発動させていたら読み直して算出し直す。
+	var (
+		tr        counter.TriggerResult
+		level     int
+		threshold int
+	)
+	for attempt := 1; ; attempt++ {
+		state, err := s.counter.GetTriggerState(ctx, roomID, string(eventType))
+		if err != nil {
+			return nil, fmt.Errorf("get trigger state failed: %w", err)
+		}
+		level = strategy.Level(state, time.Now())
+		threshold = strategy.Threshold(cfg, viewers, level)
 
-	// 5. Threshold
-	cfg := s.configs[eventType]
-	threshold := s.calculateDynamicThreshold(cfg, viewers)
+		_, counterSpan := tracer.Start(ctx, "Counter.IncrementAndTrigger", trace.WithAttributes(attribute.Int("threshold", threshold), attribute.Int("attempt", attempt)))
+		tr, err = s.counter.IncrementAndTrigger(ctx, roomID, string(eventType), EventButtonPushCount, int64(threshold), int64(nextLevel(level)), state.Count)
+		if err == nil {
+			counterSpan.SetAttributes(attribute.Bool("triggered", tr.Triggered))
+		}
+		endSpan(counterSpan, err)
+		if errors.Is(err, counter.ErrTriggerStateChanged) && attempt < maxTriggerAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("increment failed: %w", err)
+		}
+		break
+	}
+	s.metrics.Presses(string(eventType), EventButtonPushCount)
 
-	res := &model.EventResult{EventType: eventType, CurrentCount: int(current), RequiredCount: threshold, ViewerCount: viewers, EffectTriggered: false, NextThreshold: threshold}
+	res = &model.EventResult{EventType: eventType, CurrentCount: int(tr.Count), CurrentLevel: level, RequiredCount: threshold, ViewerCount: viewers, EffectTriggered: false, NextThreshold: threshold}
 
-	if int(current) >= threshold {
-		s.logger.Info("event triggered", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.Int("count", int(current)), slog.Int("threshold", threshold), slog.Int("active_viewers", viewers))
+	if tr.Triggered {
+		// 発動は確定済みのため、以降の通知・履歴記録はクライアントが切断しても完了させる (キャンセルは引き継がず、トレースのみ引き継ぐ)
+		ctx := context.WithoutCancel(ctx)
+		s.metrics.TriggerFired(string(eventType))
+		s.logger.Info("event triggered", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.Int("count", int(tr.Count)), slog.Int("threshold", threshold), slog.Int("active_viewers", viewers), slog.Int64("trigger_seq", tr.Trigger.Count))
 
-		// Pub/Sub経由で全WebSocketサーバーにブロードキャスト
+		// Pub/Sub経由で Unity 接続を持つ WebSocketサーバーへ配信 (所有者不明なら全体ブロードキャスト)
 		payload := map[string]interface{}{
 			"type":          "game_event",
 			"room_id":       roomID, // WebSocketサーバー側で配信先を特定するため必須
 			"event_type":    string(eventType),
-			"trigger_count": int(current),
+			"trigger_count": int(tr.Count),
 			"viewer_count":  viewers,
 		}
 
@@ -92,59 +160,50 @@ func (s *EventService) ProcessEvent(roomID string, eventType model.EventType, Ev
 		if err != nil {
 			s.logger.Error("json marshal failed", slog.String("room_id", roomID), slog.Any("error", err))
 		} else {
-			ctx := context.Background()
-			if err := s.pubsub.Publish(ctx, pubsub.ChannelGameEvents, message); err != nil {
-				s.logger.Error("pubsub publish failed", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.Any("error", err))
+			channel := registry.ChannelFor(ctx, s.registry, roomID)
+			if err := s.pubsub.Publish(ctx, channel, message); err != nil {
+				s.logger.Error("pubsub publish failed", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.String("channel", channel), slog.Any("error", err))
 			} else {
-				s.logger.Info("event published to pubsub", slog.String("room_id", roomID), slog.String("event_type", string(eventType)))
+				s.logger.Info("event published to pubsub", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.String("channel", channel))
 			}
 		}
-
-		// 閾値超過分をカウントに設定（超過分を捨てない）
-		excess := current - int64(threshold)
-		if err := s.counter.SetExcess(roomID, string(eventType), excess); err != nil {
-			s.logger.Error("set excess failed", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.Int64("excess", excess), slog.Any("error", err))
+		if s.feed != nil {
+			s.feed.Trigger(ctx, roomID, payload)
 		}
+
 		res.EffectTriggered = true
-		res.NextThreshold = s.calculateDynamicThreshold(cfg, s.getActiveViewerCount(roomID))
-		res.CurrentCount = int(excess)
+		// 履歴には発動に要した閾値と、その閾値を決めたレベル (発動時のレベル) を組で残す
+		s.recordTrigger(ctx, &model.GameEvent{RoomID: roomID, EventType: eventType, TriggerCount: int(tr.Count), Threshold: threshold, Level: level, ViewerCount: viewers})
+		res.CurrentLevel = strategy.Level(tr.Trigger, time.Now())
+		res.NextThreshold = strategy.Threshold(cfg, s.getActiveViewerCount(ctx, roomID), res.CurrentLevel)
+		res.CurrentCount = int(tr.Remaining)
+	}
+	if s.feed != nil {
+		s.feed.StatsChanged(roomID)
 	}
 	return res, nil
 }
 
-// calculateDynamicThreshold: 視聴者数に応じた動的閾値を算出し上下限でクランプ
-func (s *EventService) calculateDynamicThreshold(cfg *model.EventConfig, viewerCount int) int {
-	mult := s.getViewerMultiplier(viewerCount)
-	raw := float64(cfg.BaseThreshold) * mult
-	val := int(math.Ceil(raw))
-	if val < cfg.MinThreshold {
-		val = cfg.MinThreshold
-	}
-	if val > cfg.MaxThreshold {
-		val = cfg.MaxThreshold
+// recordTrigger: 発動履歴を game_events に記録 (失敗しても押下処理は継続しログのみ)
+func (s *EventService) recordTrigger(ctx context.Context, ge *model.GameEvent) {
+	if err := s.eventRepo.CreateGameEvent(ctx, ge); err != nil {
+		s.logger.Error("record game event failed", slog.String("room_id", ge.RoomID), slog.String("event_type", string(ge.EventType)), slog.Any("error", err))
 	}
-	return val
 }
 
-// getViewerMultiplier: 視聴者数帯ごとの倍率テーブル
-func (s *EventService) getViewerMultiplier(v int) float64 {
-	switch {
-	case v <= 5:
-		return 1.0
-	case v <= 10:
-		return 1.2
-	case v <= 20:
-		return 1.5
-	case v <= 50:
-		return 2.0
-	default:
-		return 3.0
+// currentLevel: 発動履歴から現在レベルを算出 (取得失敗時は 1)
+func (s *EventService) currentLevel(ctx context.Context, strategy ThresholdStrategy, roomID string, eventType model.EventType) int {
+	state, err := s.counter.GetTriggerState(ctx, roomID, string(eventType))
+	if err != nil {
+		s.logger.Warn("get trigger state failed", slog.String("room_id", roomID), slog.String("event_type", string(eventType)), slog.Any("error", err))
+		return 1
 	}
+	return strategy.Level(state, time.Now())
 }
 
 // getActiveViewerCount: アクティブ視聴者数取得 (0 やエラー時は 1 にフォールバック)
-func (s *EventService) getActiveViewerCount(roomID string) int {
-	c, err := s.counter.GetActiveViewerCount(roomID)
+func (s *EventService) getActiveViewerCount(ctx context.Context, roomID string) int {
+	c, err := s.counter.GetActiveViewerCount(ctx, roomID)
 	if err != nil || c < 1 {
 		return 1
 	}
@@ -154,41 +213,86 @@ func (s *EventService) getActiveViewerCount(roomID string) int {
 	return int(c)
 }
 
-// Stats (simplified, no level)
 // RoomEventStat: 統計表示用の簡易集計構造体
 type RoomEventStat struct {
 	EventType     model.EventType `json:"event_type"`
+	Label         string          `json:"label"`
+	Team          string          `json:"team"`
 	CurrentCount  int             `json:"current_count"`
-	CurrentLevel  int             `json:"current_level"` // always 1
+	CurrentLevel  int             `json:"current_level"` // 発動回数 + 1 (decay 方式では時間経過で低下)
 	RequiredCount int             `json:"required_count"`
 	NextThreshold int             `json:"next_threshold"`
 	ViewerCount   int             `json:"viewer_count"`
 }
 
-// GetRoomStats: 全イベント種別について現在カウントと閾値をまとめて返却
-func (s *EventService) GetRoomStats(roomID string) ([]RoomEventStat, error) {
-	viewers := s.getActiveViewerCount(roomID)
-	stats := make([]RoomEventStat, 0, len(s.configs))
-	for et, cfg := range s.configs {
-		cur, err := s.counter.Get(roomID, string(et))
+// GetRoomStats: ルームのカタログに含まれる全イベント種別について現在カウントと閾値を定義順で返却
+func (s *EventService) GetRoomStats(ctx context.Context, roomID string) ([]RoomEventStat, error) {
+	catalog, err := s.catalogs.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := s.catalogs.GetStrategy(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	viewers := s.getActiveViewerCount(ctx, roomID)
+	events := catalog.Events()
+	stats := make([]RoomEventStat, 0, len(events))
+	for i := range events {
+		cfg := &events[i]
+		cur, err := s.counter.Get(ctx, roomID, string(cfg.EventType))
 		if err != nil {
 			return nil, fmt.Errorf("get counter failed: %w", err)
 		}
-		th := s.calculateDynamicThreshold(cfg, viewers)
-		stats = append(stats, RoomEventStat{EventType: et, CurrentCount: int(cur), CurrentLevel: 1, RequiredCount: th, NextThreshold: th, ViewerCount: viewers})
+		level := s.currentLevel(ctx, strategy, roomID, cfg.EventType)
+		th := strategy.Threshold(cfg, viewers, level)
+		stats = append(stats, RoomEventStat{EventType: cfg.EventType, Label: cfg.Label, Team: cfg.Team, CurrentCount: int(cur), CurrentLevel: level, RequiredCount: th, NextThreshold: th, ViewerCount: viewers})
 	}
 	return stats, nil
 }
 
-// Default configs (unchanged thresholds foundation)
-// getDefaultEventConfigs: 初期閾値設定マップ生成
-func getDefaultEventConfigs() map[model.EventType]*model.EventConfig {
-	return map[model.EventType]*model.EventConfig{
-		model.SKILL1: {EventType: model.SKILL1, BaseThreshold: 5, MinThreshold: 3, MaxThreshold: 50, LevelMultiplier: 1.3},
-		model.SKILL2: {EventType: model.SKILL2, BaseThreshold: 6, MinThreshold: 4, MaxThreshold: 60, LevelMultiplier: 1.3},
-		model.SKILL3: {EventType: model.SKILL3, BaseThreshold: 12, MinThreshold: 8, MaxThreshold: 100, LevelMultiplier: 1.4},
-		model.ENEMY1: {EventType: model.ENEMY1, BaseThreshold: 6, MinThreshold: 4, MaxThreshold: 45, LevelMultiplier: 1.3},
-		model.ENEMY2: {EventType: model.ENEMY2, BaseThreshold: 7, MinThreshold: 5, MaxThreshold: 55, LevelMultiplier: 1.4},
-		model.ENEMY3: {EventType: model.ENEMY3, BaseThreshold: 10, MinThreshold: 6, MaxThreshold: 80, LevelMultiplier: 1.5},
+// 発動履歴ページングの上限
+const (
+	defaultTriggerPageSize = 50
+	maxTriggerPageSize     = 200
+)
+
+// ListTriggers: ルームの発動履歴を新しい順にページ取得し、種別ごとの累計発動回数を添える
+func (s *EventService) ListTriggers(ctx context.Context, roomID string, eventType model.EventType, limit, offset int) (*model.TriggerHistory, error) {
+	if limit <= 0 {
+		limit = defaultTriggerPageSize
+	}
+	if limit > maxTriggerPageSize {
+		limit = maxTriggerPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	// 次ページ有無の判定用に1件多く取得
+	rows, err := s.eventRepo.ListGameEvents(ctx, roomID, eventType, limit+1, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list game events failed: %w", err)
+	}
+	var next *int
+	if len(rows) > limit {
+		rows = rows[:limit]
+		n := offset + limit
+		next = &n
+	}
+	totals, err := s.eventRepo.ListTriggerTotals(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("list trigger totals failed: %w", err)
+	}
+	catalog, err := s.catalogs.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	totalMap := make(map[model.EventType]int, len(totals))
+	for _, et := range catalog.Types() {
+		totalMap[et] = 0
+	}
+	for _, t := range totals {
+		totalMap[t.EventType] = t.Count
 	}
+	return &model.TriggerHistory{Triggers: rows, Totals: totalMap, Limit: limit, Offset: offset, NextOffset: next}, nil
 }
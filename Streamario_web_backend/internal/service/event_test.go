@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/pkg/counter"
+	"streamerrio-backend/pkg/pubsub"
+)
+
+// triggerEventRepo: 押下は捨て、発動履歴だけをメモリに記録する EventRepository
+type triggerEventRepo struct {
+	repository.EventRepository
+	mu       sync.Mutex
+	triggers []model.GameEvent
+}
+
+func (r *triggerEventRepo) CreateEventsBatch(context.Context, []*model.Event) error { return nil }
+func (r *triggerEventRepo) CreateGameEvent(_ context.Context, ge *model.GameEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ge.ID = int64(len(r.triggers) + 1)
+	r.triggers = append(r.triggers, *ge)
+	return nil
+}
+
+// ListGameEvents: 新しい順 (記録の逆順) にページ取得
+func (r *triggerEventRepo) ListGameEvents(_ context.Context, roomID string, eventType model.EventType, limit, offset int) ([]model.GameEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []model.GameEvent
+	for i := len(r.triggers) - 1; i >= 0; i-- {
+		ge := r.triggers[i]
+		if ge.RoomID == roomID && (eventType == "" || ge.EventType == eventType) {
+			out = append(out, ge)
+		}
+	}
+	if offset >= len(out) {
+		return nil, nil
+	}
+	return out[offset:min(offset+limit, len(out))], nil
+}
+func (r *triggerEventRepo) ListTriggerTotals(_ context.Context, roomID string) ([]model.EventTotal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := map[model.EventType]int{}
+	for _, ge := range r.triggers {
+		if ge.RoomID == roomID {
+			counts[ge.EventType]++
+		}
+	}
+	var out []model.EventTotal
+	for et, n := range counts {
+		out = append(out, model.EventTotal{EventType: et, Count: n})
+	}
+	return out, nil
+}
+
+// slowStateCounter: 発動履歴の読み出し後に少し待ち、読み出しから加算までの間に他の押下が割り込みやすくする
+type slowStateCounter struct {
+	counter.Counter
+}
+
+func (c slowStateCounter) GetTriggerState(ctx context.Context, roomID, eventType string) (counter.TriggerState, error) {
+	state, err := c.Counter.GetTriggerState(ctx, roomID, eventType)
+	time.Sleep(time.Millisecond)
+	return state, err
+}
+
+// newTestEventService: strategy を設定したルーム "room" と、そのルームで使う1種別 "boss" を用意する
+func newTestEventService(t *testing.T, strategy string, boss model.EventConfig) (*EventService, *triggerEventRepo, counter.Counter) {
+	t.Helper()
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rooms := newFakeRoomRepo()
+	rooms.put(model.Room{ID: "room", Status: model.RoomStatusRunning})
+	catalogs := NewCatalogService(rooms, logger)
+	if _, err := catalogs.SetCatalog(ctx, "room", []model.EventConfig{boss}); err != nil {
+		t.Fatalf("SetCatalog: %v", err)
+	}
+	if _, err := catalogs.SetThresholdStrategy(ctx, "room", model.ThresholdSettings{Strategy: strategy}); err != nil {
+		t.Fatalf("SetThresholdStrategy: %v", err)
+	}
+	repo := &triggerEventRepo{}
+	c := slowStateCounter{counter.NewMemoryCounter()}
+	return NewEventService(c, repo, pubsub.NewMemoryPubSub(logger), catalogs, logger), repo, c
+}
+
+func TestEventService_ConcurrentPressesEscalate(t *testing.T) {
+	boss := model.EventConfig{EventType: "boss", Team: model.TeamEnemy, BaseThreshold: 2, MinThreshold: 1, MaxThreshold: 1000, LevelMultiplier: 2}
+	s, repo, c := newTestEventService(t, StrategyEscalation, boss)
+
+	// レベル 1..6 の閾値をちょうど満たす押下数を同時に送る
+	const triggers = 6
+	total := 0
+	for level := 1; level <= triggers; level++ {
+		total += escalationStrategy{}.Threshold(&boss, 1, level)
+	}
+	var wg sync.WaitGroup
+	presses := make(chan struct{}, total)
+	for i := 0; i < total; i++ {
+		presses <- struct{}{}
+	}
+	close(presses)
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range presses {
+				if _, err := s.ProcessEvent(context.Background(), "room", "boss", 1, nil); err != nil {
+					t.Errorf("ProcessEvent: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 各レベルで1回ずつ、そのレベルの閾値で発動する (古いレベルの閾値での早すぎる発動やレベルの重複が無い)
+	if len(repo.triggers) != triggers {
+		t.Fatalf("triggers = %d, want %d", len(repo.triggers), triggers)
+	}
+	thresholds := make([]int, 0, triggers)
+	for _, ge := range repo.triggers {
+		thresholds = append(thresholds, ge.Threshold)
+	}
+	sort.Ints(thresholds)
+	for i, th := range thresholds {
+		if want := (escalationStrategy{}).Threshold(&boss, 1, i+1); th != want {
+			t.Fatalf("trigger thresholds = %v, want level %d at %d", thresholds, i+1, want)
+		}
+	}
+	if n, _ := c.Get(context.Background(), "room", "boss"); n != 0 {
+		t.Fatalf("remaining count = %d, want 0", n)
+	}
+	if state, _ := c.GetTriggerState(context.Background(), "room", "boss"); state.Count != triggers || state.Level != triggers+1 {
+		t.Fatalf("trigger state = %+v, want %d triggers at level %d", state, triggers, triggers+1)
+	}
+}
+
+func TestEventService_RecordsTriggerLevelWithThreshold(t *testing.T) {
+	ctx := context.Background()
+	boss := model.EventConfig{EventType: "boss", Team: model.TeamEnemy, BaseThreshold: 2, MinThreshold: 1, MaxThreshold: 1000, LevelMultiplier: 3}
+	s, repo, _ := newTestEventService(t, StrategyEscalation, boss)
+
+	// レベル 1, 2, 3 で1回ずつ発動させる
+	for level := 1; level <= 3; level++ {
+		th := (escalationStrategy{}).Threshold(&boss, 1, level)
+		res, err := s.ProcessEvent(ctx, "room", "boss", int64(th), nil)
+		if err != nil {
+			t.Fatalf("ProcessEvent: %v", err)
+		}
+		if !res.EffectTriggered || res.RequiredCount != th || res.CurrentLevel != level+1 {
+			t.Fatalf("level %d: result = %+v", level, res)
+		}
+	}
+
+	// 各履歴は発動に要した閾値と、その閾値を決めたレベルの組
+	for i, ge := range repo.triggers {
+		level := i + 1
+		if ge.Level != level || ge.Threshold != (escalationStrategy{}).Threshold(&boss, 1, level) || ge.TriggerCount != ge.Threshold {
+			t.Fatalf("trigger %d = %+v, want level %d", i, ge, level)
+		}
+	}
+
+	// 新しい順にページングし、累計はカタログの全種別を含む
+	page, err := s.ListTriggers(ctx, "room", "", 2, 0)
+	if err != nil {
+		t.Fatalf("ListTriggers: %v", err)
+	}
+	if len(page.Triggers) != 2 || page.Triggers[0].Level != 3 || page.Triggers[1].Level != 2 || page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Fatalf("first page = %+v", page)
+	}
+	if page.Totals["boss"] != 3 || len(page.Totals) != 1 {
+		t.Fatalf("totals = %v", page.Totals)
+	}
+	page, err = s.ListTriggers(ctx, "room", "boss", 2, 2)
+	if err != nil || len(page.Triggers) != 1 || page.Triggers[0].Level != 1 || page.NextOffset != nil {
+		t.Fatalf("last page = %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"streamerrio-backend/internal/model"
+)
+
+// eventTypeFormatSamples: カタログで宣言できる種別 ID の形式 (model の identPattern) を代表するサンプル
+// ルームごとのカタログで任意の種別が使われるため、既定カタログの種別に加えて形式の境界も確認する。
+var eventTypeFormatSamples = []model.EventType{
+	"0",                                      // 最短 / 数字始まり
+	"custom_event-1",                         // _ と - を含む
+	model.EventType(strings.Repeat("z", 32)), // 最長
+}
+
+// EventTypeMismatchError: EventService が扱う種別のうち DB が受け付けないもの
+type EventTypeMismatchError struct {
+	Rejected map[model.EventType]error
+}
+
+func (e *EventTypeMismatchError) Error() string {
+	types := make([]string, 0, len(e.Rejected))
+	for et := range e.Rejected {
+		types = append(types, string(et))
+	}
+	sort.Strings(types)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d event type(s) rejected by the database (apply pending migrations with `server migrate up`):", len(types))
+	for _, et := range types {
+		fmt.Fprintf(&b, "\n  %q: %v", et, e.Rejected[model.EventType(et)])
+	}
+	return b.String()
+}
+
+// KnownEventTypes: このサーバが記録しうる種別 (既定カタログ + カタログ宣言の形式サンプル)
+func (s *EventService) KnownEventTypes() []model.EventType {
+	return append(DefaultEventCatalog().Types(), eventTypeFormatSamples...)
+}
+
+// VerifyEventTypes: 起動時に、扱う種別がすべて DB に記録できるか確認する
+// 受け付けられない種別があれば *EventTypeMismatchError を返す (スキーマが古いまま起動して押下の記録に失敗し続けるのを防ぐ)。
+func (s *EventService) VerifyEventTypes(ctx context.Context) error {
+	rejected, err := s.eventRepo.ProbeEventTypes(ctx, s.KnownEventTypes())
+	if err != nil {
+		return fmt.Errorf("probe event types: %w", err)
+	}
+	if len(rejected) > 0 {
+		return &EventTypeMismatchError{Rejected: rejected}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+)
+
+// probeEventRepo: ProbeEventTypes のみ実装した EventRepository (他のメソッドは呼ばれない想定)
+type probeEventRepo struct {
+	repository.EventRepository
+	accept func(model.EventType) bool
+	probed []model.EventType
+}
+
+func (r *probeEventRepo) ProbeEventTypes(_ context.Context, types []model.EventType) (map[model.EventType]error, error) {
+	r.probed = types
+	rejected := map[model.EventType]error{}
+	for _, et := range types {
+		if !r.accept(et) {
+			rejected[et] = errors.New(`invalid input value for enum event_type_enum: "` + string(et) + `"`)
+		}
+	}
+	return rejected, nil
+}
+
+func TestEventService_VerifyEventTypes(t *testing.T) {
+	// 旧 ENUM (button1..6 + 002 で追加した6種) 相当: カタログ宣言の種別を受け付けない
+	legacy := map[model.EventType]bool{model.SKILL1: true, model.SKILL2: true, model.SKILL3: true, model.ENEMY1: true, model.ENEMY2: true, model.ENEMY3: true}
+	repo := &probeEventRepo{accept: func(et model.EventType) bool { return legacy[et] }}
+	s := &EventService{eventRepo: repo}
+
+	err := s.VerifyEventTypes(context.Background())
+	var mismatch *EventTypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("want EventTypeMismatchError, got %v", err)
+	}
+	if len(mismatch.Rejected) != len(eventTypeFormatSamples) {
+		t.Fatalf("rejected = %v", mismatch.Rejected)
+	}
+	if msg := err.Error(); !strings.Contains(msg, `"custom_event-1"`) || strings.Contains(msg, `"skill1"`) {
+		t.Fatalf("unexpected report: %s", msg)
+	}
+	if len(repo.probed) != len(DefaultEventCatalog().Types())+len(eventTypeFormatSamples) {
+		t.Fatalf("probed %v", repo.probed)
+	}
+
+	repo.accept = func(model.EventType) bool { return true }
+	if err := s.VerifyEventTypes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
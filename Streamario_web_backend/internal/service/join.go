@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/joincode"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR 画像の一辺のピクセル数
+const (
+	DefaultQRSize  = 512 // GET /qr.png の既定
+	MinQRSize      = 64
+	MaxQRSize      = 1024
+	embeddedQRSize = 256 // room_created に埋め込む data URI (メッセージを肥大させないよう小さめ)
+)
+
+// joinRoomParam: 視聴者ページがルーム ID を受け取るクエリパラメータ名 (フロントエンドの既存仕様)
+const joinRoomParam = "streamer_id"
+
+// defaultJoinCodeTTL: 期限なし (ROOM_TTL=0) のルームの参加コード有効期間
+const defaultJoinCodeTTL = 24 * time.Hour
+
+// ErrJoinCodeNotFound: 参加コードが不明/失効済み、または対応するルームが既に無い
+var ErrJoinCodeNotFound = errors.New("join code not found")
+
+// JoinService: 視聴者の参加導線 (参加 URL / QR / 短い参加コード) を組み立てる
+type JoinService struct {
+	rooms   *RoomService
+	codes   joincode.Store
+	baseURL string
+	logger  *slog.Logger
+}
+
+// NewJoinService: baseURL は視聴者ページのベース URL (末尾の / は不要)
+func NewJoinService(rooms *RoomService, codes joincode.Store, baseURL string, logger *slog.Logger) *JoinService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &JoinService{rooms: rooms, codes: codes, baseURL: strings.TrimRight(baseURL, "/"), logger: logger}
+}
+
+// JoinURL: ルームの視聴者ページ URL
+func (s *JoinService) JoinURL(roomID string) string {
+	return s.baseURL + "/?" + joinRoomParam + "=" + url.QueryEscape(roomID)
+}
+
+// Info: ルームの参加情報を組み立てる
+// 参加コードはルームの期限と同時に失効させる (期限なしのルームは24時間)。確保に失敗してもコード無しで返す。
+func (s *JoinService) Info(ctx context.Context, roomID string) (*model.JoinInfo, error) {
+	room, err := s.rooms.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	joinURL := s.JoinURL(room.ID)
+	png, err := qrcode.Encode(joinURL, qrcode.Medium, embeddedQRSize)
+	if err != nil {
+		return nil, fmt.Errorf("render qr: %w", err)
+	}
+	info := &model.JoinInfo{
+		RoomID:  room.ID,
+		JoinURL: joinURL,
+		QRCode:  "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}
+	ttl := defaultJoinCodeTTL
+	if room.ExpiresAt != nil {
+		ttl = time.Until(*room.ExpiresAt)
+	}
+	if code, err := s.codes.Reserve(ctx, room.ID, ttl); err != nil {
+		s.logger.Warn("join code reserve failed", slog.String("room_id", room.ID), slog.Any("error", err))
+	} else {
+		info.JoinCode = code
+	}
+	return info, nil
+}
+
+// QRPNG: ルームの参加 URL の QR を PNG で返す (size はピクセル数 / 範囲外は丸める)
+func (s *JoinService) QRPNG(ctx context.Context, roomID string, size int) ([]byte, error) {
+	room, err := s.rooms.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	size = min(max(size, MinQRSize), MaxQRSize)
+	return qrcode.Encode(s.JoinURL(room.ID), qrcode.Medium, size)
+}
+
+// Resolve: 参加コードからルームを引く (終了済みルームも結果表示のため返す)
+func (s *JoinService) Resolve(ctx context.Context, code string) (*model.Room, error) {
+	code = joincode.Normalize(code)
+	if !joincode.Valid(code) {
+		return nil, ErrJoinCodeNotFound
+	}
+	roomID, ok, err := s.codes.Resolve(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrJoinCodeNotFound
+	}
+	room, err := s.rooms.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, ErrJoinCodeNotFound
+	}
+	return room, nil
+}
+
+// Release: 回収したルームの参加コードを解放 (失敗してもコードは期限で消えるため警告のみ)
+func (s *JoinService) Release(ctx context.Context, roomID string) {
+	if err := s.codes.Release(ctx, roomID); err != nil {
+		s.logger.Warn("join code release failed", slog.String("room_id", roomID), slog.Any("error", err))
+	}
+}
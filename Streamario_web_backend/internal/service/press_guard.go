@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/counter"
+)
+
+// PressGuardConfig: レート制限の既定値と不正検知のしきい値
+type PressGuardConfig struct {
+	Viewer model.RateLimit // 視聴者ごとの既定バケット (カタログの rate_limits で種別ごとに上書き可)
+	IP     model.RateLimit // IP ごとの既定バケット
+	Room   model.RateLimit // ルーム全体の既定バケット
+
+	IntervalSamples int     // 押下間隔の判定に使う直近の間隔数
+	IntervalMaxCV   float64 // 間隔の変動係数 (標準偏差/平均) がこれ未満なら機械的とみなす (0 で無効)
+
+	IPViewerLimit  int           // 1 IP から窓内に押下した視聴者 ID がこれを超えたらフラグ (0 で無効)
+	IPViewerWindow time.Duration // 同一 IP の視聴者を数える窓
+
+	ReducedWeight float64       // Action=reduce のフラグが付いた視聴者の押下に掛ける重み
+	FlagTTL       time.Duration // フラグの有効期間 (0 ならルーム終了まで)
+}
+
+// PressRequest: 押下リクエスト1件分の送信元情報
+type PressRequest struct {
+	RoomID   string
+	ViewerID string // 空なら視聴者単位の制限/検知は行わない
+	IP       string // 空なら IP 単位の制限/検知は行わない
+	Presses  int64  // リクエスト内の押下数の合計 (2 以上は端末側でまとめた送信とみなし、押下間隔の判定に使わない)
+	At       time.Time
+}
+
+// PressGuard: 押下のレート制限と不正パターン検知
+// 視聴者 / IP / ルームのトークンバケットで押下数を絞り、機械的な押下や同一 IP の多重 ID を検知した視聴者にフラグを付ける。
+// フラグ付きの視聴者は重みを下げて数える (reduce) か、押下を受理しない (reject)。
+type PressGuard struct {
+	limiter counter.RateLimiter
+	cfg     PressGuardConfig
+	random  func() float64 // 重み付けの確率的丸め用 (テストで差し替え)
+	logger  *slog.Logger
+}
+
+// NewPressGuard: レート制限ストアと設定からガードを生成
+func NewPressGuard(limiter counter.RateLimiter, cfg PressGuardConfig, logger *slog.Logger) *PressGuard {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &PressGuard{limiter: limiter, cfg: cfg, random: rand.Float64, logger: logger}
+}
+
+// Inspect: リクエスト単位で押下パターンを記録・検知し、視聴者の現在のフラグ (無ければ nil) を返す
+// 新たに検知した場合は既存より重い判定のときだけフラグを更新する (reduce → reject への格上げのみ)。
+// 押下間隔はリクエストの到着時刻で測るため、複数の押下をまとめた送信 (Presses > 1) は記録しない
+// (一定周期でまとめて送る端末を機械的な押下と誤判定しないように)。
+func (g *PressGuard) Inspect(ctx context.Context, req PressRequest) (*model.ViewerFlag, error) {
+	if req.ViewerID == "" {
+		return nil, nil
+	}
+	current, err := g.flag(ctx, req.RoomID, req.ViewerID, req.At)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Action == model.PressReject {
+		return current, nil
+	}
+
+	var detected *model.ViewerFlag
+	if g.cfg.IntervalMaxCV > 0 && g.cfg.IntervalSamples > 1 && req.Presses <= 1 {
+		times, err := g.limiter.RecordPress(ctx, req.RoomID, req.ViewerID, req.At, g.cfg.IntervalSamples+1)
+		if err != nil {
+			return nil, fmt.Errorf("record press failed: %w", err)
+		}
+		if cv, ok := intervalCV(times, g.cfg.IntervalSamples); ok && cv < g.cfg.IntervalMaxCV {
+			detected = &model.ViewerFlag{
+				Reason: model.ReasonRegularInterval,
+				Action: model.PressReject,
+				Detail: fmt.Sprintf("inter-press interval cv=%.3f over %d presses", cv, len(times)),
+			}
+		}
+	}
+	if req.IP != "" && g.cfg.IPViewerLimit > 0 {
+		n, err := g.limiter.TrackIPViewer(ctx, req.RoomID, req.IP, req.ViewerID, g.cfg.IPViewerWindow, req.At)
+		if err != nil {
+			return nil, fmt.Errorf("track ip viewer failed: %w", err)
+		}
+		if n > int64(g.cfg.IPViewerLimit) && detected == nil {
+			detected = &model.ViewerFlag{
+				Reason: model.ReasonSharedIP,
+				Action: model.PressReduce,
+				Weight: g.cfg.ReducedWeight,
+				Detail: fmt.Sprintf("%d viewer ids from one ip within %s", n, g.cfg.IPViewerWindow),
+			}
+		}
+	}
+	if detected == nil || (current != nil && current.Action == detected.Action) {
+		return current, nil
+	}
+
+	detected.ViewerID = req.ViewerID
+	detected.FlaggedAt = req.At
+	if g.cfg.FlagTTL > 0 {
+		expiresAt := req.At.Add(g.cfg.FlagTTL)
+		detected.ExpiresAt = &expiresAt
+	}
+	data, err := json.Marshal(detected)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.limiter.SetFlag(ctx, req.RoomID, req.ViewerID, data); err != nil {
+		return nil, fmt.Errorf("save viewer flag failed: %w", err)
+	}
+	g.logger.Warn("viewer flagged",
+		slog.String("room_id", req.RoomID),
+		slog.String("viewer_id", req.ViewerID),
+		slog.String("reason", detected.Reason),
+		slog.String("action", detected.Action),
+		slog.String("detail", detected.Detail),
+	)
+	return detected, nil
+}
+
+// Admit: 1種別分の押下をフラグとレート制限に照らして判定し、カウントへ反映する押下数を決める
+// 視聴者 / IP / ルームのバケットから同じ数を1回で取り出す (いずれかが足りなければ全バケットでその数に揃える)。
+func (g *PressGuard) Admit(ctx context.Context, req PressRequest, cfg *model.EventConfig, pushCount int64, flag *model.ViewerFlag) (*model.PressDecision, error) {
+	d := &model.PressDecision{Requested: pushCount, Flag: flag}
+	if flag != nil && flag.Action == model.PressReject {
+		d.Action, d.Reason = model.PressReject, flag.Reason
+		return d, nil
+	}
+
+	viewerLimit, ipLimit, roomLimit := g.limitsFor(cfg)
+	var buckets []counter.Bucket
+	var reasons []string
+	add := func(name string, limit model.RateLimit, reason string) {
+		buckets = append(buckets, counter.Bucket{Name: name, Limit: counter.BucketLimit{Rate: limit.Rate, Burst: limit.Burst}})
+		reasons = append(reasons, reason)
+	}
+	if req.ViewerID != "" {
+		add("viewer:"+req.ViewerID+":"+string(cfg.EventType), viewerLimit, model.ReasonViewerRateLimited)
+	}
+	if req.IP != "" {
+		add("ip:"+req.IP+":"+string(cfg.EventType), ipLimit, model.ReasonIPRateLimited)
+	}
+	add("room:"+string(cfg.EventType), roomLimit, model.ReasonRoomRateLimited)
+
+	res, err := g.limiter.Take(ctx, req.RoomID, buckets, pushCount, req.At)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit failed: %w", err)
+	}
+	granted := res.Granted
+	if res.Limited >= 0 {
+		d.Reason = reasons[res.Limited]
+		d.RetryAfterMs = res.RetryAfter.Milliseconds()
+	}
+
+	if flag != nil && flag.Action == model.PressReduce {
+		granted = g.weighted(granted, flag.Weight)
+		if d.Reason == "" {
+			d.Reason = flag.Reason
+		}
+	}
+
+	d.Accepted = granted
+	switch {
+	case granted >= pushCount:
+		d.Action = model.PressAllow
+	case granted > 0:
+		d.Action = model.PressReduce
+	default:
+		d.Action = model.PressReject
+	}
+	return d, nil
+}
+
+// Flags: ルームで現在フラグ付けされている視聴者一覧 (フラグ付けの早い順 / 期限切れは除く)
+func (g *PressGuard) Flags(ctx context.Context, roomID string) ([]model.ViewerFlag, error) {
+	raw, err := g.limiter.ListFlags(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]model.ViewerFlag, 0, len(raw))
+	now := time.Now()
+	for viewerID, data := range raw {
+		var f model.ViewerFlag
+		if err := json.Unmarshal(data, &f); err != nil {
+			g.logger.Warn("invalid viewer flag", slog.String("room_id", roomID), slog.String("viewer_id", viewerID), slog.Any("error", err))
+			continue
+		}
+		if !f.Active(now) {
+			continue
+		}
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].FlaggedAt.Before(flags[j].FlaggedAt) })
+	return flags, nil
+}
+
+// flag: 保存済みの視聴者フラグ (無い / at の時点で期限切れなら nil)
+func (g *PressGuard) flag(ctx context.Context, roomID, viewerID string, at time.Time) (*model.ViewerFlag, error) {
+	data, err := g.limiter.GetFlag(ctx, roomID, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("load viewer flag failed: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var f model.ViewerFlag
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode viewer flag failed: %w", err)
+	}
+	if !f.Active(at) {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// limitsFor: 種別定義の rate_limits を既定値に重ねる
+func (g *PressGuard) limitsFor(cfg *model.EventConfig) (viewer, ip, room model.RateLimit) {
+	viewer, ip, room = g.cfg.Viewer, g.cfg.IP, g.cfg.Room
+	if cfg == nil || cfg.RateLimits == nil {
+		return
+	}
+	if cfg.RateLimits.Viewer != nil {
+		viewer = *cfg.RateLimits.Viewer
+	}
+	if cfg.RateLimits.IP != nil {
+		ip = *cfg.RateLimits.IP
+	}
+	if cfg.RateLimits.Room != nil {
+		room = *cfg.RateLimits.Room
+	}
+	return
+}
+
+// weighted: n に重みを掛ける (端数は確率的に丸め、期待値を n*weight に保つ)
+func (g *PressGuard) weighted(n int64, weight float64) int64 {
+	if n <= 0 || weight <= 0 {
+		return 0
+	}
+	if weight >= 1 {
+		return n
+	}
+	v := float64(n) * weight
+	whole := math.Floor(v)
+	if g.random() < v-whole {
+		whole++
+	}
+	return int64(whole)
+}
+
+// intervalCV: 直近の押下時刻 (新しい順) から間隔の変動係数を求める (samples 個の間隔が揃わなければ ok=false)
+func intervalCV(times []time.Time, samples int) (cv float64, ok bool) {
+	if len(times) < samples+1 {
+		return 0, false
+	}
+	intervals := make([]float64, samples)
+	var sum float64
+	for i := 0; i < samples; i++ {
+		intervals[i] = float64(times[i].Sub(times[i+1]).Milliseconds())
+		sum += intervals[i]
+	}
+	mean := sum / float64(samples)
+	if mean <= 0 {
+		return 0, false
+	}
+	var variance float64
+	for _, v := range intervals {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(samples)
+	return math.Sqrt(variance) / mean, true
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/counter"
+)
+
+func newTestPressGuard(cfg PressGuardConfig) *PressGuard {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	g := NewPressGuard(counter.NewMemoryRateLimiter(), cfg, logger)
+	g.random = func() float64 { return 0.99 } // 端数は切り捨て側に固定
+	return g
+}
+
+func testGuardConfig() PressGuardConfig {
+	return PressGuardConfig{
+		Viewer:          model.RateLimit{Rate: 10, Burst: 20},
+		IP:              model.RateLimit{Rate: 100, Burst: 200},
+		Room:            model.RateLimit{Rate: 1000, Burst: 2000},
+		IntervalSamples: 6,
+		IntervalMaxCV:   0.05,
+		IPViewerLimit:   3,
+		IPViewerWindow:  time.Minute,
+		ReducedWeight:   0.5,
+	}
+}
+
+func TestPressGuard_RateLimitPerEventType(t *testing.T) {
+	g := newTestPressGuard(testGuardConfig())
+	now := time.Unix(1_700_000_000, 0)
+	req := PressRequest{RoomID: "room", ViewerID: "v1", IP: "203.0.113.1", At: now}
+	strict := &model.EventConfig{EventType: "enemy3", RateLimits: &model.RateLimits{Viewer: &model.RateLimit{Rate: 1, Burst: 5}}}
+	loose := &model.EventConfig{EventType: "skill1"}
+
+	d, err := g.Admit(context.Background(), req, strict, 8, nil)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+	if d.Action != model.PressReduce || d.Accepted != 5 || d.Reason != model.ReasonViewerRateLimited || d.RetryAfterMs != 3000 {
+		t.Fatalf("strict event decision: %+v", d)
+	}
+	d, _ = g.Admit(context.Background(), req, strict, 1, nil)
+	if d.Action != model.PressReject || d.Accepted != 0 {
+		t.Fatalf("exhausted bucket decision: %+v", d)
+	}
+	// 種別ごとにバケットが分かれ、既定値が適用される
+	d, _ = g.Admit(context.Background(), req, loose, 8, nil)
+	if d.Action != model.PressAllow || d.Accepted != 8 || d.Reason != "" {
+		t.Fatalf("default event decision: %+v", d)
+	}
+}
+
+func TestPressGuard_FlagsRegularIntervals(t *testing.T) {
+	g := newTestPressGuard(testGuardConfig())
+	start := time.Unix(1_700_000_000, 0)
+
+	// 人間らしい不規則な間隔ではフラグが付かない
+	human := []int{0, 180, 420, 530, 900, 1010, 1400, 1520, 1990}
+	for _, ms := range human {
+		flag, err := g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: "human", At: start.Add(time.Duration(ms) * time.Millisecond)})
+		if err != nil || flag != nil {
+			t.Fatalf("human flagged at %dms: %+v, %v", ms, flag, err)
+		}
+	}
+
+	// 250ms ちょうどの間隔は機械的とみなして reject
+	var flag *model.ViewerFlag
+	for i := 0; i < 7; i++ {
+		var err error
+		flag, err = g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: "bot", At: start.Add(time.Duration(i) * 250 * time.Millisecond)})
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+	}
+	if flag == nil || flag.Reason != model.ReasonRegularInterval || flag.Action != model.PressReject {
+		t.Fatalf("bot not flagged: %+v", flag)
+	}
+	d, _ := g.Admit(context.Background(), PressRequest{RoomID: "room", ViewerID: "bot"}, &model.EventConfig{EventType: "skill1"}, 3, flag)
+	if d.Action != model.PressReject || d.Accepted != 0 || d.Flag == nil {
+		t.Fatalf("flagged viewer decision: %+v", d)
+	}
+
+	flags, err := g.Flags(context.Background(), "room")
+	if err != nil || len(flags) != 1 || flags[0].ViewerID != "bot" {
+		t.Fatalf("Flags = %+v, %v", flags, err)
+	}
+}
+
+func TestPressGuard_SharedIPReducesWeight(t *testing.T) {
+	g := newTestPressGuard(testGuardConfig())
+	now := time.Unix(1_700_000_000, 0)
+	var flag *model.ViewerFlag
+	for _, id := range []string{"a", "b", "c", "d"} {
+		var err error
+		flag, err = g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: id, IP: "198.51.100.7", At: now})
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		if id != "d" && flag != nil {
+			t.Fatalf("viewer %s flagged under the limit: %+v", id, flag)
+		}
+	}
+	if flag == nil || flag.Reason != model.ReasonSharedIP || flag.Action != model.PressReduce || flag.Weight != 0.5 {
+		t.Fatalf("shared ip not flagged: %+v", flag)
+	}
+	d, _ := g.Admit(context.Background(), PressRequest{RoomID: "room", ViewerID: "d", IP: "198.51.100.7", At: now}, &model.EventConfig{EventType: "skill1"}, 5, flag)
+	if d.Action != model.PressReduce || d.Accepted != 2 || d.Reason != model.ReasonSharedIP {
+		t.Fatalf("reduced weight decision: %+v", d)
+	}
+}
+
+func TestPressGuard_BatchedRequestsAndFlagExpiry(t *testing.T) {
+	cfg := testGuardConfig()
+	cfg.FlagTTL = time.Minute
+	g := newTestPressGuard(cfg)
+	start := time.Unix(1_700_000_000, 0)
+
+	// 一定周期でまとめて送る端末 (1リクエストに複数の押下) は押下間隔の判定に使わない
+	for i := 0; i < 20; i++ {
+		flag, err := g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: "batched", Presses: 3, At: start.Add(time.Duration(i) * 250 * time.Millisecond)})
+		if err != nil || flag != nil {
+			t.Fatalf("batched client flagged at request %d: %+v, %v", i, flag, err)
+		}
+	}
+
+	// フラグは FlagTTL で失効する
+	var flag *model.ViewerFlag
+	for i := 0; i < 7; i++ {
+		flag, _ = g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: "bot", Presses: 1, At: start.Add(time.Duration(i) * 250 * time.Millisecond)})
+	}
+	if flag == nil || flag.ExpiresAt == nil || !flag.ExpiresAt.Equal(flag.FlaggedAt.Add(time.Minute)) {
+		t.Fatalf("bot flag = %+v, want expiry after a minute", flag)
+	}
+	later := flag.FlaggedAt.Add(time.Minute)
+	if got, err := g.flag(context.Background(), "room", "bot", later); err != nil || got != nil {
+		t.Fatalf("flag after ttl = %+v, %v; want nil", got, err)
+	}
+	// 失効後は人間らしい間隔の押下で再びフラグが付かない
+	for _, ms := range []int{0, 180, 420, 530, 900, 1010, 1400, 1520} {
+		flag, err := g.Inspect(context.Background(), PressRequest{RoomID: "room", ViewerID: "bot", Presses: 1, At: later.Add(time.Duration(ms) * time.Millisecond)})
+		if err != nil || flag != nil {
+			t.Fatalf("expired flag still applied at %dms: %+v, %v", ms, flag, err)
+		}
+	}
+}
+
+func TestPressGuard_RoomLimitKeepsViewerTokens(t *testing.T) {
+	cfg := testGuardConfig()
+	cfg.Room = model.RateLimit{Rate: 1, Burst: 2}
+	g := newTestPressGuard(cfg)
+	now := time.Unix(1_700_000_000, 0)
+	req := PressRequest{RoomID: "room", ViewerID: "v1", IP: "203.0.113.1", At: now}
+	event := &model.EventConfig{EventType: "skill1"}
+
+	d, err := g.Admit(context.Background(), req, event, 5, nil)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+	if d.Accepted != 2 || d.Reason != model.ReasonRoomRateLimited || d.RetryAfterMs != 3000 {
+		t.Fatalf("room limited decision: %+v", d)
+	}
+	// ルームのバケットで断られた分は視聴者のバケットからも減らない (20 - 2 = 18 残る)
+	viewer := counter.Bucket{Name: "viewer:v1:skill1", Limit: counter.BucketLimit{Rate: 10, Burst: 20}}
+	res, err := g.limiter.Take(context.Background(), "room", []counter.Bucket{viewer}, 20, now)
+	if err != nil || res.Granted != 18 {
+		t.Fatalf("viewer bucket take = %+v, %v; want 18 granted", res, err)
+	}
+}
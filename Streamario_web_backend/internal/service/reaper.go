@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/model"
+)
+
+// reaperBatchSize: 1回の走査で回収するルーム数の上限
+const reaperBatchSize = 100
+
+// ConnectionChecker: Unity 接続の有無を問い合わせる (接続中のルームは期限切れ・放置とも回収しない)
+type ConnectionChecker interface {
+	HasConnection(roomID string) bool
+}
+
+// RoomReaper: 期限切れ/放置ルームを定期的に回収するバックグラウンド処理
+// 回収時は GameSessionService で集計・終端状態への遷移・Redis データ削除まで行う。
+type RoomReaper struct {
+	roomService    *RoomService
+	sessionService *GameSessionService
+	connections    ConnectionChecker
+	interval       time.Duration
+	idleTimeout    time.Duration
+	logger         *slog.Logger
+}
+
+// NewRoomReaper: 設定 (回収間隔/放置判定時間) を元に生成
+func NewRoomReaper(roomService *RoomService, sessionService *GameSessionService, connections ConnectionChecker, cfg *config.Config, logger *slog.Logger) *RoomReaper {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &RoomReaper{
+		roomService:    roomService,
+		sessionService: sessionService,
+		connections:    connections,
+		interval:       cfg.RoomReaperInterval,
+		idleTimeout:    cfg.RoomIdleTimeout,
+		logger:         logger,
+	}
+}
+
+// Run: context がキャンセルされるまで interval ごとに回収を実行 (ブロッキング)
+func (r *RoomReaper) Run(ctx context.Context) error {
+	r.logger.Info("room reaper started", slog.Duration("interval", r.interval), slog.Duration("idle_timeout", r.idleTimeout))
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("room reaper stopped", slog.Any("reason", ctx.Err()))
+			return ctx.Err()
+		case <-ticker.C:
+			r.ReapOnce(ctx, time.Now())
+		}
+	}
+}
+
+// ReapOnce: 1回分の回収処理。回収したルーム数を返す。
+func (r *RoomReaper) ReapOnce(ctx context.Context, now time.Time) int {
+	rooms, err := r.roomService.ListReapable(ctx, now, r.idleTimeout, reaperBatchSize)
+	if err != nil {
+		r.logger.Error("list reapable rooms failed", slog.Any("error", err))
+		return 0
+	}
+	reaped := 0
+	for _, room := range rooms {
+		// Unity が接続中のルームはゲーム中のため回収しない (期限切れでも切断後の走査で回収する)
+		if r.connections != nil && r.connections.HasConnection(room.ID) {
+			continue
+		}
+		status, reason := model.RoomStatusEnded, "idle"
+		if room.ExpiresAt != nil && now.After(*room.ExpiresAt) {
+			status, reason = model.RoomStatusExpired, "expired"
+		}
+		logger := r.logger.With(slog.String("room_id", room.ID), slog.String("status", string(status)), slog.String("reason", reason))
+		if _, err := r.sessionService.ReapRoom(ctx, room.ID, status, reason); err != nil {
+			logger.Warn("reap room failed", slog.Any("error", err))
+			continue
+		}
+		logger.Info("room reaped")
+		reaped++
+	}
+	return reaped
+}
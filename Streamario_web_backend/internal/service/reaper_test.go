@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/pkg/counter"
+)
+
+// emptyEventRepo: 押下の記録が無い EventRepository (集計は空を返す)
+type emptyEventRepo struct {
+	repository.EventRepository
+}
+
+func (emptyEventRepo) ListEventViewerCounts(context.Context, string) ([]model.EventAggregate, error) {
+	return nil, nil
+}
+func (emptyEventRepo) ListEventTotals(context.Context, string) ([]model.EventTotal, error) {
+	return nil, nil
+}
+func (emptyEventRepo) ListViewerTotals(context.Context, string) ([]model.ViewerTotal, error) {
+	return nil, nil
+}
+
+// fakeConnections: Unity 接続中のルーム集合
+type fakeConnections map[string]bool
+
+func (f fakeConnections) HasConnection(roomID string) bool { return f[roomID] }
+
+func newTestSession(repo *fakeRoomRepo) (*RoomService, *GameSessionService) {
+	rooms, _, sessions := newTestSessionWithCatalogs(repo)
+	return rooms, sessions
+}
+
+func newTestSessionWithCatalogs(repo *fakeRoomRepo) (*RoomService, *CatalogService, *GameSessionService) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rooms := NewRoomService(repo, &config.Config{})
+	catalogs := NewCatalogService(repo, logger)
+	return rooms, catalogs, NewGameSessionService(rooms, catalogs, emptyEventRepo{}, nil, counter.NewMemoryCounter(), nil, logger)
+}
+
+func TestRoomReaper_ReapOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	longAgo := now.Add(-2 * time.Hour)
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "expired", Status: model.RoomStatusRunning, CreatedAt: longAgo, ExpiresAt: &past})
+	repo.put(model.Room{ID: "expired-connected", Status: model.RoomStatusRunning, CreatedAt: longAgo, ExpiresAt: &past})
+	repo.put(model.Room{ID: "idle", Status: model.RoomStatusLobby, CreatedAt: longAgo})
+	repo.put(model.Room{ID: "idle-connected", Status: model.RoomStatusRunning, CreatedAt: longAgo})
+	repo.put(model.Room{ID: "fresh", Status: model.RoomStatusRunning, CreatedAt: now})
+	repo.put(model.Room{ID: "ended", Status: model.RoomStatusEnded, CreatedAt: longAgo, ExpiresAt: &past})
+	rooms, sessions := newTestSession(repo)
+	conns := fakeConnections{"expired-connected": true, "idle-connected": true}
+	reaper := NewRoomReaper(rooms, sessions, conns, &config.Config{RoomReaperInterval: time.Minute, RoomIdleTimeout: 30 * time.Minute}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if n := reaper.ReapOnce(ctx, now); n != 2 {
+		t.Fatalf("reaped %d rooms, want 2", n)
+	}
+	for id, want := range map[string]model.RoomStatus{
+		"expired":           model.RoomStatusExpired,
+		"idle":              model.RoomStatusEnded,
+		"expired-connected": model.RoomStatusRunning, // ゲーム中は期限切れでも回収しない
+		"idle-connected":    model.RoomStatusRunning,
+		"fresh":             model.RoomStatusRunning,
+		"ended":             model.RoomStatusEnded,
+	} {
+		room, _ := repo.Get(ctx, id)
+		if room.Status != want {
+			t.Errorf("%s status = %s, want %s", id, room.Status, want)
+		}
+	}
+
+	// 切断後の走査で回収される
+	delete(conns, "expired-connected")
+	if n := reaper.ReapOnce(ctx, now); n != 1 {
+		t.Fatalf("reaped %d rooms after disconnect, want 1", n)
+	}
+}
+
+func TestGameSession_ResultsAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "overdue", Status: model.RoomStatusRunning, ExpiresAt: &past})
+	repo.put(model.Room{ID: "reaped", Status: model.RoomStatusExpired, ExpiresAt: &past, ExpiredAt: &past})
+	_, sessions := newTestSession(repo)
+
+	// TTL を過ぎた game_end も終了できる
+	summary, err := sessions.EndGame(ctx, "overdue")
+	if err != nil || summary.RoomID != "overdue" {
+		t.Fatalf("EndGame after TTL = %+v, %v", summary, err)
+	}
+	if room, _ := repo.Get(ctx, "overdue"); room.Status != model.RoomStatusEnded {
+		t.Fatalf("status = %s, want ended", room.Status)
+	}
+	// 回収済み (expired) ルームの game_end / 結果取得は保存済みの結果を返す
+	for _, id := range []string{"overdue", "reaped"} {
+		if _, err := sessions.GetRoomResult(ctx, id); err != nil {
+			t.Fatalf("GetRoomResult(%s): %v", id, err)
+		}
+	}
+	if _, err := sessions.EndGame(ctx, "reaped"); err != nil {
+		t.Fatalf("EndGame on reaped room: %v", err)
+	}
+	if room, _ := repo.Get(ctx, "reaped"); room.Status != model.RoomStatusExpired {
+		t.Fatalf("reaped room status changed to %s", room.Status)
+	}
+}
+
+func TestGameSession_EndGameEvictsCatalog(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "running", Status: model.RoomStatusRunning})
+	_, catalogs, sessions := newTestSessionWithCatalogs(repo)
+
+	if _, err := catalogs.GetCatalog(ctx, "running"); err != nil {
+		t.Fatalf("GetCatalog: %v", err)
+	}
+	if _, err := sessions.EndGame(ctx, "running"); err != nil {
+		t.Fatalf("EndGame: %v", err)
+	}
+	catalogs.mu.RLock()
+	_, cached := catalogs.cache["running"]
+	catalogs.mu.RUnlock()
+	if cached {
+		t.Fatal("catalog cache entry kept after EndGame")
+	}
+}
@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"time"
 
 	"streamerrio-backend/internal/config"
@@ -12,7 +14,16 @@ import (
 	"github.com/oklog/ulid/v2"
 )
 
-// RoomService: ルームのライフサイクル管理 (取得/生成/存在保証)
+// ErrInvalidTransition: 現在の状態から要求された状態へ遷移できない
+var ErrInvalidTransition = errors.New("invalid room state transition")
+
+// ErrRoomExpired: ルームの期限 (ROOM_TTL) が過ぎている、または期限切れとして回収済み
+var ErrRoomExpired = errors.New("room expired")
+
+// ErrRoomForbidden: ルームが別の配信者 (または匿名) の所有で、要求元には操作権が無い
+var ErrRoomForbidden = errors.New("room owned by another streamer")
+
+// RoomService: ルームのライフサイクル管理 (取得/生成/存在保証/状態遷移)
 type RoomService struct {
 	repo repository.RoomRepository
 	cfg  *config.Config
@@ -24,53 +35,78 @@ func NewRoomService(repo repository.RoomRepository, cfg *config.Config) *RoomSer
 }
 
 // CreateRoom: ルームを永続化 (ID必須, CreatedAt補完)
-func (s *RoomService) CreateRoom(room *model.Room) error {
+func (s *RoomService) CreateRoom(ctx context.Context, room *model.Room) error {
 	if room.ID == "" {
 		return errors.New("room id required")
 	}
 	if room.CreatedAt.IsZero() {
 		room.CreatedAt = time.Now()
 	}
-	return s.repo.Create(room)
+	return s.repo.Create(ctx, room)
+}
+
+// GetRoom: 存在しない/期限切れならエラーを返す取得処理 (参加・押下など、これから操作するルームの確認用)
+func (s *RoomService) GetRoom(ctx context.Context, id string) (*model.Room, error) {
+	room, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if room.Status == model.RoomStatusExpired || (room.ExpiresAt != nil && time.Now().After(*room.ExpiresAt)) {
+		return nil, ErrRoomExpired
+	}
+	return room, nil
+}
+
+// FindRoom: 期限を問わずルームを取得 (結果の参照や終了処理など、期限切れ・終了後も扱うルーム用)
+func (s *RoomService) FindRoom(ctx context.Context, id string) (*model.Room, error) {
+	return s.lookup(ctx, id)
 }
 
-// GetRoom: 存在しない/期限切れならエラーを返す取得処理
-func (s *RoomService) GetRoom(id string) (*model.Room, error) {
-	room, err := s.repo.Get(id)
+// lookup: 期限を問わずルームを取得し状態値を正規化 (存在しなければエラー)
+func (s *RoomService) lookup(ctx context.Context, id string) (*model.Room, error) {
+	room, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if room == nil {
 		return nil, errors.New("room not found")
 	}
-	if room.ExpiresAt != nil && time.Now().After(*room.ExpiresAt) {
-		return nil, errors.New("room expired")
-	}
+	room.Status = model.NormalizeRoomStatus(room.Status)
 	return room, nil
 }
 
+// expiresAt: 設定 TTL から期限時刻を算出 (TTL 0 は無期限)
+func (s *RoomService) expiresAt(createdAt time.Time) *time.Time {
+	if s.cfg == nil || s.cfg.RoomTTL <= 0 {
+		return nil
+	}
+	t := createdAt.Add(s.cfg.RoomTTL)
+	return &t
+}
+
 // GenerateRoom: ULIDを用いて新規ルームを生成し保存
-func (s *RoomService) GenerateRoom(streamerID string) (*model.Room, error) {
+func (s *RoomService) GenerateRoom(ctx context.Context, streamerID string) (*model.Room, error) {
 	entropy := ulid.Monotonic(rand.Reader, 0)
-	id := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+	now := time.Now()
+	id := ulid.MustNew(ulid.Timestamp(now), entropy).String()
 	room := &model.Room{
 		ID:         id,
 		StreamerID: streamerID,
-		CreatedAt:  time.Now(),
-		Status:     "active",
+		CreatedAt:  now,
+		ExpiresAt:  s.expiresAt(now),
+		Status:     model.RoomStatusCreated,
 		Settings:   "{}",
 		EndedAt:    nil,
 	}
-	// TTL 機能は現状未実装 (Config 拡張で追加予定)
-	if err := s.repo.Create(room); err != nil {
+	if err := s.repo.Create(ctx, room); err != nil {
 		return nil, err
 	}
 	return room, nil
 }
 
 // CreateIfNotExists: (WebSocket発行IDをDBへ確定させる用途) 存在しなければ指定 streamerID で作成
-func (s *RoomService) CreateIfNotExists(id, streamerID string) error {
-	existing, err := s.repo.Get(id)
+func (s *RoomService) CreateIfNotExists(ctx context.Context, id, streamerID string) error {
+	existing, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -78,20 +114,184 @@ func (s *RoomService) CreateIfNotExists(id, streamerID string) error {
 		return nil
 	}
 	now := time.Now()
-	return s.repo.Create(&model.Room{ID: id, StreamerID: streamerID, CreatedAt: now, Status: "active", Settings: "{}", EndedAt: nil})
+	return s.repo.Create(ctx, &model.Room{ID: id, StreamerID: streamerID, CreatedAt: now, ExpiresAt: s.expiresAt(now), Status: model.RoomStatusCreated, Settings: "{}", EndedAt: nil})
+}
+
+// EnsureOwnedRoom: Unity が指定 ID で接続する際の所有確認 (存在しなければ streamerID の所有で作成)
+// streamerID が空なら匿名接続。匿名ルームは STREAMER_AUTH_REQUIRED が無効な間のみ匿名で再接続でき、
+// 配信者が匿名ルームを後から引き取ることはできない (ID を知るだけで乗っ取れてしまうため)。
+func (s *RoomService) EnsureOwnedRoom(ctx context.Context, id, streamerID string) (*model.Room, error) {
+	owner := streamerID
+	if owner == "" {
+		owner = model.AnonymousStreamerID
+	}
+	if err := s.CreateIfNotExists(ctx, id, owner); err != nil {
+		return nil, err
+	}
+	room, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if room.StreamerID != owner {
+		return nil, ErrRoomForbidden
+	}
+	if streamerID == "" && s.StreamerAuthRequired() {
+		return nil, ErrRoomForbidden
+	}
+	return room, nil
 }
 
-// MarkEnded: ルームを終了状態へ更新
-func (s *RoomService) MarkEnded(id string, endedAt time.Time) error {
-	return s.repo.MarkEnded(id, endedAt)
+// StreamerAuthRequired: 資格情報の無い Unity 接続を拒否する設定か
+func (s *RoomService) StreamerAuthRequired() bool {
+	return s.cfg != nil && s.cfg.StreamerAuthRequired
+}
+
+// CheckOwner: 配信者がルームを所有しているか確認 (存在しなければ not found エラー)
+func (s *RoomService) CheckOwner(ctx context.Context, id, streamerID string) (*model.Room, error) {
+	room, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if streamerID == "" || room.StreamerID != streamerID {
+		return nil, ErrRoomForbidden
+	}
+	return room, nil
+}
+
+// ListByStreamer: 配信者のルーム履歴 (新しい順 / status 空なら全状態)
+func (s *RoomService) ListByStreamer(ctx context.Context, streamerID string, status model.RoomStatus, limit, offset int) ([]model.Room, error) {
+	rooms, err := s.repo.ListByStreamer(ctx, streamerID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rooms {
+		rooms[i].Status = model.NormalizeRoomStatus(rooms[i].Status)
+	}
+	return rooms, nil
+}
+
+// EnterLobby: Unity 接続時に created → lobby へ遷移 (既に lobby 以降なら何もしない)
+// 設定で自動開始が有効な場合はそのまま running まで進める。
+func (s *RoomService) EnterLobby(ctx context.Context, id string) (*model.Room, error) {
+	room, err := s.GetRoom(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if room.Status == model.RoomStatusCreated {
+		if room, err = s.transition(ctx, room, model.RoomStatusLobby); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg != nil && s.cfg.RoomAutoStart && room.Status == model.RoomStatusLobby {
+		return s.transition(ctx, room, model.RoomStatusRunning)
+	}
+	return room, nil
+}
+
+// StartGame: created/lobby → running (Unity の game_start)
+func (s *RoomService) StartGame(ctx context.Context, id string) (*model.Room, error) {
+	return s.transitionFrom(ctx, id, model.RoomStatusRunning, model.RoomStatusCreated, model.RoomStatusLobby)
+}
+
+// PauseGame: running → paused (Unity の game_pause)
+func (s *RoomService) PauseGame(ctx context.Context, id string) (*model.Room, error) {
+	return s.transitionFrom(ctx, id, model.RoomStatusPaused, model.RoomStatusRunning)
+}
+
+// ResumeGame: paused → running (Unity の game_resume)
+func (s *RoomService) ResumeGame(ctx context.Context, id string) (*model.Room, error) {
+	return s.transitionFrom(ctx, id, model.RoomStatusRunning, model.RoomStatusPaused)
+}
+
+// MarkEnded: ルームを終了状態へ更新 (期限切れ後の終了も許可)
+func (s *RoomService) MarkEnded(ctx context.Context, id string, endedAt time.Time) error {
+	return s.close(ctx, id, model.RoomStatusEnded, endedAt)
+}
+
+// MarkExpired: ルームを期限切れ状態へ更新
+func (s *RoomService) MarkExpired(ctx context.Context, id string, expiredAt time.Time) error {
+	return s.close(ctx, id, model.RoomStatusExpired, expiredAt)
+}
+
+func (s *RoomService) close(ctx context.Context, id string, to model.RoomStatus, at time.Time) error {
+	room, err := s.lookup(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.transitionAt(ctx, room, to, at)
+	return err
+}
+
+// ListReapable: 期限切れ (ExpiresAt 超過) または放置 (最終活動から idleTimeout 経過) の未終了ルーム
+func (s *RoomService) ListReapable(ctx context.Context, now time.Time, idleTimeout time.Duration, limit int) ([]model.Room, error) {
+	idleBefore := time.Time{} // idleTimeout 0 は放置判定しない
+	if idleTimeout > 0 {
+		idleBefore = now.Add(-idleTimeout)
+	}
+	rooms, err := s.repo.ListReapable(ctx, now, idleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rooms {
+		rooms[i].Status = model.NormalizeRoomStatus(rooms[i].Status)
+	}
+	return rooms, nil
+}
+
+// transitionFrom: 現在状態が allowed のいずれかである場合のみ to へ遷移 (既に to なら冪等に成功)
+func (s *RoomService) transitionFrom(ctx context.Context, id string, to model.RoomStatus, allowed ...model.RoomStatus) (*model.Room, error) {
+	room, err := s.GetRoom(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if room.Status == to {
+		return room, nil
+	}
+	for _, a := range allowed {
+		if room.Status == a {
+			return s.transition(ctx, room, to)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, room.Status, to)
+}
+
+func (s *RoomService) transition(ctx context.Context, room *model.Room, to model.RoomStatus) (*model.Room, error) {
+	return s.transitionAt(ctx, room, to, time.Now())
+}
+
+// transitionAt: 遷移表で検証したうえで、現在状態を条件にした更新で競合を検出する
+func (s *RoomService) transitionAt(ctx context.Context, room *model.Room, to model.RoomStatus, at time.Time) (*model.Room, error) {
+	if !room.Status.CanTransition(to) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, room.Status, to)
+	}
+	ok, err := s.repo.Transition(ctx, room.ID, []model.RoomStatus{room.Status, rawStatus(room.Status)}, to, at)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 読み出し後に別リクエストが状態を変えた
+		return nil, fmt.Errorf("%w: room %s changed concurrently", ErrInvalidTransition, room.ID)
+	}
+	return s.repo.Get(ctx, room.ID)
+}
+
+// rawStatus: 旧ステータス値で保存されている行にも条件が一致するよう、読み替え前の値を返す
+func rawStatus(s model.RoomStatus) model.RoomStatus {
+	switch s {
+	case model.RoomStatusRunning:
+		return "active"
+	case model.RoomStatusLobby:
+		return "inactive"
+	}
+	return s
 }
 
 // UpdateRoom: ルームを更新
-func (s *RoomService) UpdateRoom(id string, room *model.Room) error {
-	return s.repo.Update(id, room)
+func (s *RoomService) UpdateRoom(ctx context.Context, id string, room *model.Room) error {
+	return s.repo.Update(ctx, id, room)
 }
 
 // DeleteRoom: ルームを削除
-func (s *RoomService) DeleteRoom(id string) error {
-	return s.repo.Delete(id)
+func (s *RoomService) DeleteRoom(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
 }
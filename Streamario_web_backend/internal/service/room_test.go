@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/config"
+	"streamerrio-backend/internal/model"
+)
+
+// fakeRoomRepo: RoomRepository のメモリ実装 (テスト用 / Transition は DB と同じく現在状態を条件に更新)
+type fakeRoomRepo struct {
+	mu    sync.Mutex
+	rooms map[string]*model.Room
+}
+
+func newFakeRoomRepo() *fakeRoomRepo {
+	return &fakeRoomRepo{rooms: map[string]*model.Room{}}
+}
+
+func (r *fakeRoomRepo) Create(_ context.Context, room *model.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *room
+	r.rooms[room.ID] = &cp
+	return nil
+}
+func (r *fakeRoomRepo) Get(_ context.Context, id string) (*model.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room, ok := r.rooms[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *room
+	return &cp, nil
+}
+func (r *fakeRoomRepo) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.rooms, id)
+	return nil
+}
+func (r *fakeRoomRepo) Update(_ context.Context, id string, room *model.Room) error {
+	return r.Create(context.Background(), room)
+}
+func (r *fakeRoomRepo) UpdateSettings(_ context.Context, id, settings string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if room, ok := r.rooms[id]; ok {
+		room.Settings = settings
+	}
+	return nil
+}
+func (r *fakeRoomRepo) Transition(_ context.Context, id string, from []model.RoomStatus, to model.RoomStatus, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room, ok := r.rooms[id]
+	if !ok {
+		return false, nil
+	}
+	for _, f := range from {
+		if room.Status == f {
+			room.Status = to
+			switch to {
+			case model.RoomStatusEnded:
+				room.EndedAt = &at
+			case model.RoomStatusExpired:
+				room.ExpiredAt = &at
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (r *fakeRoomRepo) ListReapable(_ context.Context, now, idleBefore time.Time, limit int) ([]model.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []model.Room
+	for _, room := range r.rooms {
+		if model.NormalizeRoomStatus(room.Status).IsTerminal() {
+			continue
+		}
+		expired := room.ExpiresAt != nil && room.ExpiresAt.Before(now)
+		idle := !idleBefore.IsZero() && room.CreatedAt.Before(idleBefore)
+		if expired || idle {
+			out = append(out, *room)
+		}
+	}
+	return out, nil
+}
+func (r *fakeRoomRepo) ListByStreamer(_ context.Context, streamerID string, status model.RoomStatus, limit, offset int) ([]model.Room, error) {
+	return nil, nil
+}
+
+func (r *fakeRoomRepo) put(room model.Room) {
+	_ = r.Create(context.Background(), &room)
+}
+
+func TestRoomService_Expiry(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "live", Status: model.RoomStatusRunning})
+	repo.put(model.Room{ID: "overdue", Status: model.RoomStatusRunning, ExpiresAt: &past})
+	repo.put(model.Room{ID: "reaped", Status: model.RoomStatusExpired, ExpiresAt: &past})
+	rooms := NewRoomService(repo, &config.Config{})
+
+	if _, err := rooms.GetRoom(ctx, "live"); err != nil {
+		t.Fatalf("live room: %v", err)
+	}
+	// 参加・押下用の GetRoom は期限切れを拒否し、結果・終了処理用の FindRoom は返す
+	for _, id := range []string{"overdue", "reaped"} {
+		if _, err := rooms.GetRoom(ctx, id); !errors.Is(err, ErrRoomExpired) {
+			t.Fatalf("GetRoom(%s) err = %v, want ErrRoomExpired", id, err)
+		}
+		if room, err := rooms.FindRoom(ctx, id); err != nil || room.ID != id {
+			t.Fatalf("FindRoom(%s) = %+v, %v", id, room, err)
+		}
+	}
+	if _, err := rooms.FindRoom(ctx, "missing"); err == nil {
+		t.Fatal("missing room should be an error")
+	}
+	// 期限を過ぎても終了はできる
+	if err := rooms.MarkEnded(ctx, "overdue", time.Now()); err != nil {
+		t.Fatalf("end overdue room: %v", err)
+	}
+}
+
+func TestRoomService_Transitions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	type op func(*RoomService, string) error
+	enterLobby := func(s *RoomService, id string) error { _, err := s.EnterLobby(ctx, id); return err }
+	start := func(s *RoomService, id string) error { _, err := s.StartGame(ctx, id); return err }
+	pause := func(s *RoomService, id string) error { _, err := s.PauseGame(ctx, id); return err }
+	resume := func(s *RoomService, id string) error { _, err := s.ResumeGame(ctx, id); return err }
+	end := func(s *RoomService, id string) error { return s.MarkEnded(ctx, id, now) }
+	expire := func(s *RoomService, id string) error { return s.MarkExpired(ctx, id, now) }
+
+	tests := []struct {
+		name      string
+		from      model.RoomStatus
+		autoStart bool
+		op        op
+		want      model.RoomStatus // 失敗時は from のまま
+		wantErr   bool
+	}{
+		{"created enter lobby", model.RoomStatusCreated, false, enterLobby, model.RoomStatusLobby, false},
+		{"created enter lobby auto start", model.RoomStatusCreated, true, enterLobby, model.RoomStatusRunning, false},
+		{"running enter lobby is noop", model.RoomStatusRunning, true, enterLobby, model.RoomStatusRunning, false},
+		{"created start", model.RoomStatusCreated, false, start, model.RoomStatusRunning, false},
+		{"lobby start", model.RoomStatusLobby, false, start, model.RoomStatusRunning, false},
+		{"running start is idempotent", model.RoomStatusRunning, false, start, model.RoomStatusRunning, false},
+		{"paused start", model.RoomStatusPaused, false, start, model.RoomStatusPaused, true},
+		{"running pause", model.RoomStatusRunning, false, pause, model.RoomStatusPaused, false},
+		{"legacy active pause", "active", false, pause, model.RoomStatusPaused, false},
+		{"lobby pause", model.RoomStatusLobby, false, pause, model.RoomStatusLobby, true},
+		{"created pause", model.RoomStatusCreated, false, pause, model.RoomStatusCreated, true},
+		{"paused resume", model.RoomStatusPaused, false, resume, model.RoomStatusRunning, false},
+		{"lobby resume", model.RoomStatusLobby, false, resume, model.RoomStatusLobby, true},
+		{"created end", model.RoomStatusCreated, false, end, model.RoomStatusEnded, false},
+		{"lobby end", model.RoomStatusLobby, false, end, model.RoomStatusEnded, false},
+		{"running end", model.RoomStatusRunning, false, end, model.RoomStatusEnded, false},
+		{"paused end", model.RoomStatusPaused, false, end, model.RoomStatusEnded, false},
+		{"running expire", model.RoomStatusRunning, false, expire, model.RoomStatusExpired, false},
+		{"paused expire", model.RoomStatusPaused, false, expire, model.RoomStatusExpired, false},
+		{"expired end", model.RoomStatusExpired, false, end, model.RoomStatusExpired, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newFakeRoomRepo()
+			repo.put(model.Room{ID: "room", Status: tc.from})
+			s := NewRoomService(repo, &config.Config{RoomAutoStart: tc.autoStart})
+			err := tc.op(s, "room")
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("err = %v, want ErrInvalidTransition", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			room, _ := repo.Get(ctx, "room")
+			if got := model.NormalizeRoomStatus(room.Status); got != tc.want {
+				t.Fatalf("status = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRoomService_EndedRejectsTransitions(t *testing.T) {
+	ctx := context.Background()
+	ops := map[string]func(*RoomService) error{
+		"start":  func(s *RoomService) error { _, err := s.StartGame(ctx, "room"); return err },
+		"pause":  func(s *RoomService) error { _, err := s.PauseGame(ctx, "room"); return err },
+		"resume": func(s *RoomService) error { _, err := s.ResumeGame(ctx, "room"); return err },
+		"end":    func(s *RoomService) error { return s.MarkEnded(ctx, "room", time.Now()) },
+		"expire": func(s *RoomService) error { return s.MarkExpired(ctx, "room", time.Now()) },
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			endedAt := time.Now().Add(-time.Minute)
+			repo := newFakeRoomRepo()
+			repo.put(model.Room{ID: "room", Status: model.RoomStatusEnded, EndedAt: &endedAt})
+			s := NewRoomService(repo, &config.Config{RoomAutoStart: true})
+			if err := op(s); !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("err = %v, want ErrInvalidTransition", err)
+			}
+			room, _ := repo.Get(ctx, "room")
+			if room.Status != model.RoomStatusEnded || !room.EndedAt.Equal(endedAt) {
+				t.Fatalf("ended room changed: status=%s ended_at=%v", room.Status, room.EndedAt)
+			}
+		})
+	}
+	// Unity の再接続 (EnterLobby) でも終了したルームは動かない
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "room", Status: model.RoomStatusEnded})
+	if room, err := NewRoomService(repo, &config.Config{RoomAutoStart: true}).EnterLobby(ctx, "room"); err != nil || room.Status != model.RoomStatusEnded {
+		t.Fatalf("EnterLobby on ended room = %+v, %v", room, err)
+	}
+	for from := range map[model.RoomStatus]bool{model.RoomStatusEnded: true, model.RoomStatusExpired: true} {
+		for _, to := range []model.RoomStatus{model.RoomStatusCreated, model.RoomStatusLobby, model.RoomStatusRunning, model.RoomStatusPaused, model.RoomStatusEnded, model.RoomStatusExpired} {
+			if from.CanTransition(to) {
+				t.Fatalf("%s -> %s should not be allowed", from, to)
+			}
+		}
+	}
+}
+
+func TestRoomService_ConcurrentTransitions(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRoomRepo()
+	repo.put(model.Room{ID: "room", Status: model.RoomStatusRunning})
+	s := NewRoomService(repo, &config.Config{})
+
+	// 終了処理と期限切れ回収が競合しても、遷移に成功するのは1件だけ
+	const workers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs <- s.MarkEnded(ctx, "room", time.Now())
+			} else {
+				errs <- s.MarkExpired(ctx, "room", time.Now())
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrInvalidTransition):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d transitions succeeded, want 1", succeeded)
+	}
+	room, _ := repo.Get(ctx, "room")
+	if !room.Status.IsTerminal() || (room.EndedAt == nil) == (room.ExpiredAt == nil) {
+		t.Fatalf("final room = %+v", room)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -14,82 +15,144 @@ import (
 // GameSessionService: ゲーム開始〜終了の境界を跨ぐ処理を担当
 type GameSessionService struct {
 	roomService *RoomService
+	catalogs    *CatalogService
 	eventRepo   repository.EventRepository
 	viewerRepo  repository.ViewerRepository
 	counter     counter.Counter
 	wsSender    WebSocketSender
+	feed        *ViewerFeed  // 視聴者向けライブ更新 (nil なら発行しない)
+	join        *JoinService // 回収時の参加コード解放 (nil なら解放しない)
 	logger      *slog.Logger
 }
 
-func NewGameSessionService(roomService *RoomService, eventRepo repository.EventRepository, viewerRepo repository.ViewerRepository, counter counter.Counter, sender WebSocketSender, logger *slog.Logger) *GameSessionService {
+func NewGameSessionService(roomService *RoomService, catalogs *CatalogService, eventRepo repository.EventRepository, viewerRepo repository.ViewerRepository, counter counter.Counter, sender WebSocketSender, logger *slog.Logger) *GameSessionService {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &GameSessionService{roomService: roomService, eventRepo: eventRepo, viewerRepo: viewerRepo, counter: counter, wsSender: sender, logger: logger}
+	return &GameSessionService{roomService: roomService, catalogs: catalogs, eventRepo: eventRepo, viewerRepo: viewerRepo, counter: counter, wsSender: sender, logger: logger}
 }
 
+// SetViewerFeed: 視聴者向けライブ更新の発行先を注入
+func (s *GameSessionService) SetViewerFeed(feed *ViewerFeed) { s.feed = feed }
+
+// SetJoinService: 回収したルームの参加コードを解放するため注入
+func (s *GameSessionService) SetJoinService(js *JoinService) { s.join = js }
+
 // EndGame: Unity からの終了通知時に呼ぶ。集計→ルーム終了→Unity へ結果送信までを担う。
-func (s *GameSessionService) EndGame(roomID string) (*model.RoomResultSummary, error) {
-	room, err := s.roomService.GetRoom(roomID)
+// 期限 (ROOM_TTL) を過ぎたルームも終了でき、回収済み (ended/expired) なら保存済みの結果を返す。
+func (s *GameSessionService) EndGame(ctx context.Context, roomID string) (*model.RoomResultSummary, error) {
+	room, err := s.roomService.FindRoom(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
 	if room == nil {
 		return nil, errors.New("room not found")
 	}
-	if room.Status == "ended" {
-		return s.GetRoomResult(roomID)
+	if room.Status.IsTerminal() {
+		return s.GetRoomResult(ctx, roomID)
 	}
+	return s.closeRoom(ctx, roomID, model.RoomStatusEnded, "game_end")
+}
 
-	summary, err := s.buildRoomSummary(roomID)
+// ReapRoom: 期限切れ/放置ルームを回収する (reaper から呼ぶ)。
+// 集計→終端状態へ遷移→Unity へ結果送信の後、Redis 上のルームデータを全削除する。
+func (s *GameSessionService) ReapRoom(ctx context.Context, roomID string, status model.RoomStatus, reason string) (*model.RoomResultSummary, error) {
+	if !status.IsTerminal() {
+		return nil, fmt.Errorf("reap requires terminal status, got %s", status)
+	}
+	summary, err := s.closeRoom(ctx, roomID, status, reason)
 	if err != nil {
 		return nil, err
 	}
+	if n, err := s.counter.PurgeRoom(ctx, roomID); err != nil {
+		s.logger.Warn("purge room data failed", slog.String("room_id", roomID), slog.Any("error", err))
+	} else {
+		s.logger.Debug("room data purged", slog.String("room_id", roomID), slog.Int64("deleted", n))
+	}
+	if s.join != nil {
+		s.join.Release(ctx, roomID)
+	}
+	return summary, nil
+}
+
+// closeRoom: 集計→終端状態 (ended/expired) へ遷移→カウンタリセット→Unity へ終了サマリー送信→カタログキャッシュ破棄
+func (s *GameSessionService) closeRoom(ctx context.Context, roomID string, status model.RoomStatus, reason string) (*model.RoomResultSummary, error) {
+	catalog, err := s.catalogs.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	// 先に終了させて以降の押下を止めてから集計する
 	endedAt := time.Now()
-	if err := s.roomService.MarkEnded(roomID, endedAt); err != nil {
+	if status == model.RoomStatusExpired {
+		err = s.roomService.MarkExpired(ctx, roomID, endedAt)
+	} else {
+		err = s.roomService.MarkEnded(ctx, roomID, endedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 書き込みを遅らせるリポジトリなら、終了までに受け付けた押下 (他インスタンス分を含む) の書き込みを待つ
+	if settler, ok := s.eventRepo.(repository.RoomEventSettler); ok {
+		if err := settler.SettleRoom(ctx, roomID, endedAt); err != nil {
+			s.logger.Warn("settle room events failed", slog.String("room_id", roomID), slog.Any("error", err))
+		}
+	}
+	summary, err := s.buildRoomSummary(ctx, roomID, catalog)
+	if err != nil {
 		return nil, err
 	}
 	summary.RoomID = roomID
 	summary.EndedAt = endedAt
 
 	// Redis カウンタは終了時にリセットしておく（失敗しても致命的ではないためログのみ）
-	for _, et := range model.ListEventTypes() {
-		if err := s.counter.Reset(roomID, string(et)); err != nil {
+	for _, et := range catalog.Types() {
+		if err := s.counter.Reset(ctx, roomID, string(et)); err != nil {
 			s.logger.Warn("reset counter failed", slog.String("room_id", roomID), slog.String("event_type", string(et)), slog.Any("error", err))
 		}
 	}
 
-	// Unity へ終了サマリーを送信
+	// Unity / 視聴者へ終了サマリーを送信
+	teamTops := map[string]interface{}{
+		model.TeamAll: s.eventTopToPayload(summary.TopOverall),
+	}
+	for team, top := range s.buildTeamTops(summary, catalog) {
+		teamTops[team] = s.eventTopToPayload(top)
+	}
+	payload := map[string]interface{}{
+		"type":          "game_end_summary",
+		"reason":        reason,
+		"top_by_button": summary.TopByEvent,
+		"top_overall":   summary.TopOverall,
+		"team_tops":     teamTops,
+	}
 	if s.wsSender != nil {
-		teamTops := s.buildTeamTop(summary)
-		payload := map[string]interface{}{
-			"type":          "game_end_summary",
-			"top_by_button": summary.TopByEvent,
-			"top_overall":   summary.TopOverall,
-			"team_tops": map[string]interface{}{
-				"skill": s.eventTopToPayload(teamTops.TopSkill),
-				"enemy": s.eventTopToPayload(teamTops.TopEnemy),
-				"all":   s.eventTopToPayload(teamTops.TopAll),
-			},
-		}
 		if err := s.wsSender.SendEventToUnity(roomID, payload); err != nil {
 			s.logger.Warn("failed to send end summary to unity", slog.String("room_id", roomID), slog.Any("error", err))
 		}
 	}
+	if s.feed != nil {
+		s.feed.GameEnded(ctx, roomID, payload)
+	}
+	// 終了後はカタログを変更できないため、キャッシュは破棄して結果参照時に読み直す
+	s.catalogs.Invalidate(roomID)
 
 	return summary, nil
 }
 
-// GetRoomResult: 終了済みルームの集計結果を取得
-func (s *GameSessionService) GetRoomResult(roomID string) (*model.RoomResultSummary, error) {
-	room, err := s.roomService.GetRoom(roomID)
+// GetRoomResult: 終了済みルームの集計結果を取得 (期限切れ後も参照できる)
+func (s *GameSessionService) GetRoomResult(ctx context.Context, roomID string) (*model.RoomResultSummary, error) {
+	room, err := s.roomService.FindRoom(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
 	if room == nil {
 		return nil, errors.New("room not found")
 	}
-	summary, err := s.buildRoomSummary(roomID)
+	catalog, err := s.catalogs.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.buildRoomSummary(ctx, roomID, catalog)
 	if err != nil {
 		return nil, err
 	}
@@ -103,11 +166,11 @@ func (s *GameSessionService) GetRoomResult(roomID string) (*model.RoomResultSumm
 }
 
 // GetViewerSummary: 終了後に視聴者へ返す個別内訳
-func (s *GameSessionService) GetViewerSummary(roomID, viewerID string) (*model.ViewerSummary, error) {
+func (s *GameSessionService) GetViewerSummary(ctx context.Context, roomID, viewerID string) (*model.ViewerSummary, error) {
 	if viewerID == "" {
 		return nil, fmt.Errorf("viewer_id required")
 	}
-	rows, err := s.eventRepo.ListViewerEventCounts(roomID, viewerID)
+	rows, err := s.eventRepo.ListViewerEventCounts(ctx, roomID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -117,14 +180,18 @@ func (s *GameSessionService) GetViewerSummary(roomID, viewerID string) (*model.V
 		counts[row.EventType] = row.Count
 		total += row.Count
 	}
-	for _, et := range model.ListEventTypes() {
+	catalog, err := s.catalogs.GetCatalog(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, et := range catalog.Types() {
 		if _, ok := counts[et]; !ok {
 			counts[et] = 0
 		}
 	}
 	var namePtr *string
 	if s.viewerRepo != nil {
-		if viewer, err := s.viewerRepo.Get(viewerID); err == nil && viewer != nil && viewer.Name != nil {
+		if viewer, err := s.viewerRepo.Get(ctx, viewerID); err == nil && viewer != nil && viewer.Name != nil {
 			namePtr = cloneStringPointer(viewer.Name)
 		}
 	}
@@ -132,22 +199,24 @@ func (s *GameSessionService) GetViewerSummary(roomID, viewerID string) (*model.V
 }
 
 // buildRoomSummary: DB の events をもとに終了サマリーを構築（EndedAt は呼び出し側で設定）
-func (s *GameSessionService) buildRoomSummary(roomID string) (*model.RoomResultSummary, error) {
-	aggs, err := s.eventRepo.ListEventViewerCounts(roomID)
+// カタログに含まれる種別は押下が無くても 0 で埋める。
+func (s *GameSessionService) buildRoomSummary(ctx context.Context, roomID string, catalog *model.EventCatalog) (*model.RoomResultSummary, error) {
+	aggs, err := s.eventRepo.ListEventViewerCounts(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
-	eventTotals, err := s.eventRepo.ListEventTotals(roomID)
+	eventTotals, err := s.eventRepo.ListEventTotals(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
-	viewerTotals, err := s.eventRepo.ListViewerTotals(roomID)
+	viewerTotals, err := s.eventRepo.ListViewerTotals(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
 
-	topByEvent := make(map[model.EventType]model.EventTop, len(model.ListEventTypes()))
-	for _, et := range model.ListEventTypes() {
+	eventTypes := catalog.Types()
+	topByEvent := make(map[model.EventType]model.EventTop, len(eventTypes))
+	for _, et := range eventTypes {
 		topByEvent[et] = model.EventTop{ViewerID: "", ViewerName: nil, Count: 0}
 	}
 
@@ -166,8 +235,8 @@ func (s *GameSessionService) buildRoomSummary(roomID string) (*model.RoomResultS
 		}
 	}
 
-	totalMap := make(map[model.EventType]int, len(model.ListEventTypes()))
-	for _, et := range model.ListEventTypes() {
+	totalMap := make(map[model.EventType]int, len(eventTypes))
+	for _, et := range eventTypes {
 		totalMap[et] = 0
 	}
 	for _, total := range eventTotals {
@@ -191,30 +260,24 @@ func cloneStringPointer(src *string) *string {
 	return &val
 }
 
-func (s *GameSessionService) buildTeamTop(summary *model.RoomResultSummary) model.TeamTopSummary {
-	fetch := func(filter func(model.EventType) bool) *model.EventTop {
-		var best *model.EventTop
-		for et, top := range summary.TopByEvent {
-			if !filter(et) || top.ViewerID == "" {
-				continue
-			}
-			if best == nil || top.Count > best.Count || (top.Count == best.Count && top.ViewerID < best.ViewerID) {
-				tmp := top
-				best = &tmp
-			}
-		}
-		return best
+// buildTeamTops: カタログのチームごとに最多押下者を求める (押下者がいないチームは nil)
+func (s *GameSessionService) buildTeamTops(summary *model.RoomResultSummary, catalog *model.EventCatalog) map[string]*model.EventTop {
+	tops := make(map[string]*model.EventTop)
+	for _, team := range catalog.Teams() {
+		tops[team] = nil
 	}
-
-	return model.TeamTopSummary{
-		TopSkill: fetch(func(et model.EventType) bool {
-			return et == model.SKILL1 || et == model.SKILL2 || et == model.SKILL3
-		}),
-		TopEnemy: fetch(func(et model.EventType) bool {
-			return et == model.ENEMY1 || et == model.ENEMY2 || et == model.ENEMY3
-		}),
-		TopAll: summary.TopOverall,
+	for et, top := range summary.TopByEvent {
+		team := catalog.TeamOf(et)
+		if team == "" || top.ViewerID == "" {
+			continue
+		}
+		best := tops[team]
+		if best == nil || top.Count > best.Count || (top.Count == best.Count && top.ViewerID < best.ViewerID) {
+			tmp := top
+			tops[team] = &tmp
+		}
 	}
+	return tops
 }
 
 func (s *GameSessionService) eventTopToPayload(top *model.EventTop) map[string]interface{} {
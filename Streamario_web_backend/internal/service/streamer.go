@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/internal/repository"
+	"streamerrio-backend/pkg/conntoken"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// 資格情報の接頭辞 (種類の判別と、ログ/設定への誤混入の発見用)
+const (
+	apiKeyPrefix    = "sk_" // API キー: sk_<キーID>_<secret>
+	connTokenPrefix = "ct_" // 接続トークン: ct_<random>
+)
+
+// 配信者アカウントの制約
+const (
+	maxStreamerNameLength = 64
+	maxAPIKeyNameLength   = 64
+)
+
+// ErrInvalidCredentials: API キー/接続トークンが不正・失効・期限切れ
+var ErrInvalidCredentials = errors.New("invalid streamer credentials")
+
+// StreamerService: 配信者アカウントと資格情報 (API キー / Unity 接続トークン) の管理
+type StreamerService struct {
+	repo     repository.StreamerRepository
+	tokens   conntoken.Store
+	tokenTTL time.Duration
+	logger   *slog.Logger
+}
+
+// NewStreamerService: tokenTTL は接続トークンの有効期間 (発行から Unity が接続するまで)
+func NewStreamerService(repo repository.StreamerRepository, tokens conntoken.Store, tokenTTL time.Duration, logger *slog.Logger) *StreamerService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &StreamerService{repo: repo, tokens: tokens, tokenTTL: tokenTTL, logger: logger}
+}
+
+// Register: 配信者アカウントを作成し、最初の API キーを発行 (平文のキーはこの戻り値でのみ得られる)
+func (s *StreamerService) Register(ctx context.Context, name string) (*model.Streamer, *model.StreamerAPIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil, "", fmt.Errorf("name required")
+	}
+	if len([]rune(name)) > maxStreamerNameLength {
+		return nil, nil, "", fmt.Errorf("name too long (max %d chars)", maxStreamerNameLength)
+	}
+	streamer := &model.Streamer{ID: ulid.Make().String(), Name: name, CreatedAt: time.Now()}
+	if err := s.repo.Create(ctx, streamer); err != nil {
+		return nil, nil, "", err
+	}
+	key, secret, err := s.IssueAPIKey(ctx, streamer.ID, "default")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return streamer, key, secret, nil
+}
+
+// GetStreamer: 配信者取得 (存在しなければ nil)
+func (s *StreamerService) GetStreamer(ctx context.Context, id string) (*model.Streamer, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// IssueAPIKey: API キーを追加発行 (平文は戻り値でのみ返し、ハッシュのみ保存)
+func (s *StreamerService) IssueAPIKey(ctx context.Context, streamerID, name string) (*model.StreamerAPIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) > maxAPIKeyNameLength {
+		return nil, "", fmt.Errorf("key name too long (max %d chars)", maxAPIKeyNameLength)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := &model.StreamerAPIKey{ID: ulid.Make().String(), StreamerID: streamerID, Name: name, SecretHash: hashSecret(secret), CreatedAt: time.Now()}
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, apiKeyPrefix + key.ID + "_" + secret, nil
+}
+
+// ListAPIKeys: 配信者のキー一覧 (失効済みを含む)
+func (s *StreamerService) ListAPIKeys(ctx context.Context, streamerID string) ([]model.StreamerAPIKey, error) {
+	return s.repo.ListAPIKeys(ctx, streamerID)
+}
+
+// RevokeAPIKey: 配信者自身のキーを失効 (該当なし/失効済みなら false)
+func (s *StreamerService) RevokeAPIKey(ctx context.Context, streamerID, keyID string) (bool, error) {
+	return s.repo.RevokeAPIKey(ctx, streamerID, keyID, time.Now())
+}
+
+// AuthenticateAPIKey: API キー (sk_...) を検証して配信者を返す
+func (s *StreamerService) AuthenticateAPIKey(ctx context.Context, raw string) (*model.Streamer, error) {
+	keyID, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+	if !strings.HasPrefix(raw, apiKeyPrefix) || !ok || keyID == "" || secret == "" {
+		return nil, ErrInvalidCredentials
+	}
+	key, err := s.repo.GetAPIKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil || subtle.ConstantTimeCompare(key.SecretHash, hashSecret(secret)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	streamer, err := s.repo.Get(ctx, key.StreamerID)
+	if err != nil {
+		return nil, err
+	}
+	if streamer == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.repo.TouchAPIKey(ctx, key.ID, time.Now()); err != nil {
+		s.logger.Warn("touch api key failed", slog.String("key_id", key.ID), slog.Any("error", err))
+	}
+	return streamer, nil
+}
+
+// IssueConnectionToken: Unity のハンドシェイクで提示する短命トークンを発行
+// Unity ビルドに API キーを埋め込まずに済むよう、配信者のダッシュボード等から接続直前に取得する想定。
+// トークンは最初に接続したルームに結び付き、期限内は同じルームへの再接続にも使える。
+func (s *StreamerService) IssueConnectionToken(ctx context.Context, streamerID string) (string, time.Time, error) {
+	random, err := randomHex(24)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	token := connTokenPrefix + random
+	expiresAt := time.Now().Add(s.tokenTTL)
+	if err := s.tokens.Put(ctx, token, streamerID, s.tokenTTL); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// AuthenticateConnection: Unity 接続時の資格情報 (API キー or 接続トークン) から配信者 ID を得る
+// roomID は接続先のルーム (新規接続なら払い出す予定の ID)。接続トークンは結び付いたルーム以外には使えない。
+func (s *StreamerService) AuthenticateConnection(ctx context.Context, credential, roomID string) (string, error) {
+	switch {
+	case strings.HasPrefix(credential, apiKeyPrefix):
+		streamer, err := s.AuthenticateAPIKey(ctx, credential)
+		if err != nil {
+			return "", err
+		}
+		return streamer.ID, nil
+	case strings.HasPrefix(credential, connTokenPrefix):
+		streamerID, ok, err := s.tokens.Use(ctx, credential, roomID)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrInvalidCredentials
+		}
+		return streamerID, nil
+	}
+	return "", ErrInvalidCredentials
+}
+
+// hashSecret: 保存用の SHA-256 ハッシュ (secret は十分な乱数のため salt/ストレッチ不要)
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/conntoken"
+)
+
+// fakeStreamerRepo: StreamerRepository のメモリ実装 (テスト用)
+type fakeStreamerRepo struct {
+	streamers map[string]*model.Streamer
+	keys      map[string]*model.StreamerAPIKey
+}
+
+func newFakeStreamerRepo() *fakeStreamerRepo {
+	return &fakeStreamerRepo{streamers: map[string]*model.Streamer{}, keys: map[string]*model.StreamerAPIKey{}}
+}
+
+func (r *fakeStreamerRepo) Create(_ context.Context, s *model.Streamer) error {
+	r.streamers[s.ID] = s
+	return nil
+}
+func (r *fakeStreamerRepo) Get(_ context.Context, id string) (*model.Streamer, error) {
+	return r.streamers[id], nil
+}
+func (r *fakeStreamerRepo) CreateAPIKey(_ context.Context, k *model.StreamerAPIKey) error {
+	r.keys[k.ID] = k
+	return nil
+}
+func (r *fakeStreamerRepo) GetAPIKey(_ context.Context, id string) (*model.StreamerAPIKey, error) {
+	return r.keys[id], nil
+}
+func (r *fakeStreamerRepo) ListAPIKeys(_ context.Context, streamerID string) ([]model.StreamerAPIKey, error) {
+	var out []model.StreamerAPIKey
+	for _, k := range r.keys {
+		if k.StreamerID == streamerID {
+			out = append(out, *k)
+		}
+	}
+	return out, nil
+}
+func (r *fakeStreamerRepo) RevokeAPIKey(_ context.Context, streamerID, keyID string, at time.Time) (bool, error) {
+	k := r.keys[keyID]
+	if k == nil || k.StreamerID != streamerID || k.RevokedAt != nil {
+		return false, nil
+	}
+	k.RevokedAt = &at
+	return true, nil
+}
+func (r *fakeStreamerRepo) TouchAPIKey(_ context.Context, id string, at time.Time) error {
+	if k := r.keys[id]; k != nil {
+		k.LastUsedAt = &at
+	}
+	return nil
+}
+
+func newTestStreamerService() (*StreamerService, *fakeStreamerRepo) {
+	repo := newFakeStreamerRepo()
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewStreamerService(repo, conntoken.NewMemoryStore(), time.Minute, logger), repo
+}
+
+func TestStreamerService_APIKeyLifecycle(t *testing.T) {
+	s, repo := newTestStreamerService()
+	streamer, key, secret, err := s.Register(context.Background(), "  alice ")
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if streamer.Name != "alice" || !strings.HasPrefix(secret, "sk_"+key.ID+"_") {
+		t.Fatalf("unexpected registration: %+v %q", streamer, secret)
+	}
+	if strings.Contains(string(repo.keys[key.ID].SecretHash), strings.TrimPrefix(secret, "sk_"+key.ID+"_")) {
+		t.Fatalf("secret stored in plain text")
+	}
+
+	got, err := s.AuthenticateAPIKey(context.Background(), secret)
+	if err != nil || got.ID != streamer.ID {
+		t.Fatalf("authenticate failed: %v %+v", err, got)
+	}
+	if repo.keys[key.ID].LastUsedAt == nil {
+		t.Fatalf("last_used_at not updated")
+	}
+	for _, bad := range []string{"", "sk_", "sk_" + key.ID, "sk_" + key.ID + "_00", "ct_" + key.ID, secret + "x"} {
+		if _, err := s.AuthenticateAPIKey(context.Background(), bad); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%q: want ErrInvalidCredentials, got %v", bad, err)
+		}
+	}
+
+	if ok, _ := s.RevokeAPIKey(context.Background(), "someone-else", key.ID); ok {
+		t.Fatalf("revoked another streamer's key")
+	}
+	if ok, _ := s.RevokeAPIKey(context.Background(), streamer.ID, key.ID); !ok {
+		t.Fatalf("revoke failed")
+	}
+	if _, err := s.AuthenticateAPIKey(context.Background(), secret); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("revoked key accepted: %v", err)
+	}
+}
+
+func TestStreamerService_ConnectionTokenBoundToRoom(t *testing.T) {
+	s, _ := newTestStreamerService()
+	streamer, _, secret, err := s.Register(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	token, expiresAt, err := s.IssueConnectionToken(context.Background(), streamer.ID)
+	if err != nil || !strings.HasPrefix(token, "ct_") || !expiresAt.After(time.Now()) {
+		t.Fatalf("issue failed: %v %q %v", err, token, expiresAt)
+	}
+	if id, err := s.AuthenticateConnection(context.Background(), token, "room-a"); err != nil || id != streamer.ID {
+		t.Fatalf("connection auth failed: %v %q", err, id)
+	}
+	// 期限内なら同じルームへの再接続 (since=N での再開) に使える
+	if id, err := s.AuthenticateConnection(context.Background(), token, "room-a"); err != nil || id != streamer.ID {
+		t.Fatalf("reconnect with token failed: %v %q", err, id)
+	}
+	if _, err := s.AuthenticateConnection(context.Background(), token, "room-b"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("token used for another room: %v", err)
+	}
+	// API キーでも接続できる
+	if id, err := s.AuthenticateConnection(context.Background(), secret, "room-b"); err != nil || id != streamer.ID {
+		t.Fatalf("api key connection failed: %v %q", err, id)
+	}
+	if _, err := s.AuthenticateConnection(context.Background(), "garbage", "room-a"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("garbage accepted: %v", err)
+	}
+}
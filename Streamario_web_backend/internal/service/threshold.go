@@ -0,0 +1,213 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/counter"
+)
+
+// 閾値算出方式の識別子 (rooms.settings.threshold.strategy に保存される値)
+const (
+	StrategyStep       = "step"
+	StrategyLinear     = "linear"
+	StrategyLog        = "log"
+	StrategyEscalation = "escalation"
+	StrategyDecay      = "decay"
+)
+
+// 各方式の既定パラメータ
+const (
+	defaultLinearFactor    = 0.04             // 50人で約3倍
+	defaultLogFactor       = 0.5              // 50人で約3倍
+	defaultDecayCooldown   = 60 * time.Second // 1レベル下がるまでの時間
+	maxThresholdStrategyLv = 1000             // レベル計算の安全上限
+)
+
+// ThresholdStrategy: イベント発動に必要な押下数 (閾値) の算出方式
+// Level で発動履歴から現在レベルを求め、Threshold でレベルと視聴者数から閾値を決める。
+// 発動時は nextLevel(現在レベル) を発動履歴に記録し、次回の Level の基準にする。
+type ThresholdStrategy interface {
+	Name() string
+	Level(state counter.TriggerState, now time.Time) int
+	Threshold(cfg *model.EventConfig, viewerCount, level int) int
+}
+
+// NewThresholdStrategy: ルーム設定から方式を生成 (nil / 空は step)
+func NewThresholdStrategy(settings *model.ThresholdSettings) (ThresholdStrategy, error) {
+	if settings == nil {
+		return stepStrategy{}, nil
+	}
+	if settings.Factor < 0 {
+		return nil, fmt.Errorf("threshold factor must be >= 0")
+	}
+	if settings.CooldownSeconds < 0 {
+		return nil, fmt.Errorf("threshold cooldown_seconds must be >= 0")
+	}
+	switch strings.ToLower(strings.TrimSpace(settings.Strategy)) {
+	case "", StrategyStep:
+		return stepStrategy{}, nil
+	case StrategyLinear:
+		return linearStrategy{factor: orDefault(settings.Factor, defaultLinearFactor)}, nil
+	case StrategyLog, "logarithmic":
+		return logStrategy{factor: orDefault(settings.Factor, defaultLogFactor)}, nil
+	case StrategyEscalation:
+		return escalationStrategy{}, nil
+	case StrategyDecay:
+		cooldown := defaultDecayCooldown
+		if settings.CooldownSeconds > 0 {
+			cooldown = time.Duration(settings.CooldownSeconds) * time.Second
+		}
+		return decayStrategy{cooldown: cooldown}, nil
+	default:
+		return nil, fmt.Errorf("unknown threshold strategy: %s", settings.Strategy)
+	}
+}
+
+// stepStrategy: 視聴者数帯ごとの倍率テーブル (従来方式)。レベルは閾値に影響しない。
+type stepStrategy struct{}
+
+func (stepStrategy) Name() string { return StrategyStep }
+
+func (stepStrategy) Level(state counter.TriggerState, _ time.Time) int {
+	return recordedLevel(state)
+}
+
+func (stepStrategy) Threshold(cfg *model.EventConfig, viewerCount, _ int) int {
+	return clampThreshold(cfg, float64(cfg.BaseThreshold)*stepMultiplier(viewerCount))
+}
+
+// linearStrategy: 倍率 = 1 + factor × (視聴者数 - 1)
+type linearStrategy struct{ factor float64 }
+
+func (linearStrategy) Name() string { return StrategyLinear }
+
+func (linearStrategy) Level(state counter.TriggerState, _ time.Time) int {
+	return recordedLevel(state)
+}
+
+func (s linearStrategy) Threshold(cfg *model.EventConfig, viewerCount, _ int) int {
+	mult := 1 + s.factor*float64(max(viewerCount-1, 0))
+	return clampThreshold(cfg, float64(cfg.BaseThreshold)*mult)
+}
+
+// logStrategy: 倍率 = 1 + factor × ln(視聴者数)。大人数ほど伸びが緩やか。
+type logStrategy struct{ factor float64 }
+
+func (logStrategy) Name() string { return StrategyLog }
+
+func (logStrategy) Level(state counter.TriggerState, _ time.Time) int {
+	return recordedLevel(state)
+}
+
+func (s logStrategy) Threshold(cfg *model.EventConfig, viewerCount, _ int) int {
+	mult := 1 + s.factor*math.Log(float64(max(viewerCount, 1)))
+	return clampThreshold(cfg, float64(cfg.BaseThreshold)*mult)
+}
+
+// escalationStrategy: 発動のたびに LevelMultiplier 倍ずつ閾値を引き上げる (視聴者倍率は step と同じ)
+type escalationStrategy struct{}
+
+func (escalationStrategy) Name() string { return StrategyEscalation }
+
+func (escalationStrategy) Level(state counter.TriggerState, _ time.Time) int {
+	return recordedLevel(state)
+}
+
+func (escalationStrategy) Threshold(cfg *model.EventConfig, viewerCount, level int) int {
+	return escalatedThreshold(cfg, viewerCount, level)
+}
+
+// decayStrategy: escalation と同様に引き上げるが、最終発動から cooldown 経過ごとにレベルが1下がる
+// 発動時は下がったレベルから1つ上げたレベルを記録するため、低下分は次の発動後も引き継がれる。
+type decayStrategy struct{ cooldown time.Duration }
+
+func (decayStrategy) Name() string { return StrategyDecay }
+
+func (s decayStrategy) Level(state counter.TriggerState, now time.Time) int {
+	level := recordedLevel(state)
+	if state.LastTriggeredAt.IsZero() || s.cooldown <= 0 {
+		return level
+	}
+	elapsed := now.Sub(state.LastTriggeredAt)
+	if elapsed <= 0 {
+		return level
+	}
+	decayed := int(elapsed / s.cooldown)
+	return max(level-decayed, 1)
+}
+
+func (decayStrategy) Threshold(cfg *model.EventConfig, viewerCount, level int) int {
+	return escalatedThreshold(cfg, viewerCount, level)
+}
+
+// escalatedThreshold: step 倍率 × LevelMultiplier^(level-1)
+func escalatedThreshold(cfg *model.EventConfig, viewerCount, level int) int {
+	mult := stepMultiplier(viewerCount)
+	if level > 1 && cfg.LevelMultiplier > 1 {
+		mult *= math.Pow(cfg.LevelMultiplier, float64(level-1))
+	}
+	return clampThreshold(cfg, float64(cfg.BaseThreshold)*mult)
+}
+
+// recordedLevel: 最終発動時に記録したレベル (未記録なら発動回数から算出)
+func recordedLevel(state counter.TriggerState) int {
+	if state.Level > 0 {
+		return int(min(state.Level, maxThresholdStrategyLv))
+	}
+	return levelFromCount(state.Count)
+}
+
+// nextLevel: level で発動した後のレベル (発動履歴に記録する値)
+func nextLevel(level int) int {
+	return min(max(level, 1)+1, maxThresholdStrategyLv)
+}
+
+// levelFromCount: 発動回数からレベルを算出 (未発動 = 1)
+func levelFromCount(count int64) int {
+	if count < 0 {
+		return 1
+	}
+	if count >= maxThresholdStrategyLv {
+		return maxThresholdStrategyLv
+	}
+	return int(count) + 1
+}
+
+// stepMultiplier: 視聴者数帯ごとの倍率テーブル
+func stepMultiplier(v int) float64 {
+	switch {
+	case v <= 5:
+		return 1.0
+	case v <= 10:
+		return 1.2
+	case v <= 20:
+		return 1.5
+	case v <= 50:
+		return 2.0
+	default:
+		return 3.0
+	}
+}
+
+// clampThreshold: 切り上げた閾値を上下限でクランプ
+func clampThreshold(cfg *model.EventConfig, raw float64) int {
+	if math.IsInf(raw, 0) || math.IsNaN(raw) || raw > float64(cfg.MaxThreshold) {
+		return cfg.MaxThreshold
+	}
+	val := int(math.Ceil(raw))
+	if val < cfg.MinThreshold {
+		val = cfg.MinThreshold
+	}
+	return val
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamerrio-backend/internal/model"
+	"streamerrio-backend/pkg/counter"
+)
+
+func TestThresholdStrategy_Level(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cooldown := time.Minute
+	tests := []struct {
+		name     string
+		strategy ThresholdStrategy
+		state    counter.TriggerState
+		now      time.Time
+		want     int
+	}{
+		{"step unfired", stepStrategy{}, counter.TriggerState{}, t0, 1},
+		{"step ignores elapsed time", stepStrategy{}, counter.TriggerState{Count: 2, LastTriggeredAt: t0, Level: 3}, t0.Add(time.Hour), 3},
+		{"escalation from count", escalationStrategy{}, counter.TriggerState{Count: 2, LastTriggeredAt: t0}, t0.Add(time.Hour), 3},
+		{"escalation from recorded level", escalationStrategy{}, counter.TriggerState{Count: 2, LastTriggeredAt: t0, Level: 3}, t0, 3},
+		{"decay unfired", decayStrategy{cooldown: cooldown}, counter.TriggerState{}, t0, 1},
+		{"decay just fired", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 3, LastTriggeredAt: t0, Level: 4}, t0, 4},
+		{"decay before cooldown", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 3, LastTriggeredAt: t0, Level: 4}, t0.Add(cooldown - time.Millisecond), 4},
+		{"decay at cooldown boundary", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 3, LastTriggeredAt: t0, Level: 4}, t0.Add(cooldown), 3},
+		{"decay two cooldowns", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 3, LastTriggeredAt: t0, Level: 4}, t0.Add(2 * cooldown), 2},
+		{"decay floors at 1", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 3, LastTriggeredAt: t0, Level: 4}, t0.Add(time.Hour), 1},
+		// 低下後に発動した記録 (発動回数 5 でも記録したレベル 2 が基準)
+		{"decay uses recorded level", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 5, LastTriggeredAt: t0, Level: 2}, t0.Add(cooldown / 2), 2},
+		{"decay clock skew", decayStrategy{cooldown: cooldown}, counter.TriggerState{Count: 1, LastTriggeredAt: t0, Level: 2}, t0.Add(-time.Minute), 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.strategy.Level(tc.state, tc.now); got != tc.want {
+				t.Fatalf("Level = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestThresholdStrategy_Threshold(t *testing.T) {
+	cfg := &model.EventConfig{BaseThreshold: 10, MinThreshold: 5, MaxThreshold: 100, LevelMultiplier: 2}
+	tests := []struct {
+		name     string
+		strategy ThresholdStrategy
+		viewers  int
+		level    int
+		want     int
+	}{
+		{"step ignores level", stepStrategy{}, 3, 5, 10},
+		{"step viewer band", stepStrategy{}, 15, 1, 15},
+		{"escalation level 1", escalationStrategy{}, 3, 1, 10},
+		{"escalation level 3", escalationStrategy{}, 3, 3, 40},
+		{"escalation clamped", escalationStrategy{}, 3, 10, 100},
+		{"decay matches escalation", decayStrategy{cooldown: time.Minute}, 15, 2, 30},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.strategy.Threshold(cfg, tc.viewers, tc.level); got != tc.want {
+				t.Fatalf("Threshold = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecayStrategy_KeepsDecayAcrossTriggers(t *testing.T) {
+	ctx := context.Background()
+	c := counter.NewMemoryCounter()
+	s := decayStrategy{cooldown: time.Minute}
+	fire := func(now time.Time) int {
+		t.Helper()
+		state, err := c.GetTriggerState(ctx, "room", "skill1")
+		if err != nil {
+			t.Fatalf("GetTriggerState: %v", err)
+		}
+		level := s.Level(state, now)
+		if _, err := c.IncrementAndTrigger(ctx, "room", "skill1", 1, 1, int64(nextLevel(level)), state.Count); err != nil {
+			t.Fatalf("IncrementAndTrigger: %v", err)
+		}
+		return level
+	}
+
+	// 3回続けて発動してレベル 4 まで上げる
+	for want := 1; want <= 3; want++ {
+		if got := fire(time.Now()); got != want {
+			t.Fatalf("trigger %d fired at level %d", want, got)
+		}
+	}
+	// 2 cooldown 空けるとレベル 2 で発動し、次は 3 から (発動回数 4 からの 5 に戻らない)
+	state, _ := c.GetTriggerState(ctx, "room", "skill1")
+	later := state.LastTriggeredAt.Add(2 * time.Minute)
+	if got := fire(later); got != 2 {
+		t.Fatalf("decayed trigger fired at level %d, want 2", got)
+	}
+	state, _ = c.GetTriggerState(ctx, "room", "skill1")
+	if got := s.Level(state, state.LastTriggeredAt); state.Count != 4 || got != 3 {
+		t.Fatalf("after decayed trigger: count=%d level=%d, want 4/3", state.Count, got)
+	}
+}
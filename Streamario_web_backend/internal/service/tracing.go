@@ -0,0 +1,19 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer: サービス層のスパン (押下処理の各段階) を記録するトレーサー
+var tracer = otel.Tracer("streamerrio-backend/internal/service")
+
+// endSpan: err があればスパンに記録してから終了する
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
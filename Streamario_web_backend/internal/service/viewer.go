@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -20,22 +21,22 @@ func NewViewerService(repo repository.ViewerRepository) *ViewerService {
 }
 
 // EnsureViewerID: 既存IDを確認し、存在しなければ新規発行して返す
-func (s *ViewerService) EnsureViewerID(id string) (string, error) {
+func (s *ViewerService) EnsureViewerID(ctx context.Context, id string) (string, error) {
 	if id != "" {
-		exists, err := s.repo.Exists(id)
+		exists, err := s.repo.Exists(ctx, id)
 		if err == nil && exists {
 			return id, nil
 		}
 	}
 	newID := ulid.Make().String()
 	now := time.Now()
-	if err := s.repo.Create(&model.Viewer{ID: newID, CreatedAt: now, UpdatedAt: &now}); err != nil {
+	if err := s.repo.Create(ctx, &model.Viewer{ID: newID, CreatedAt: now, UpdatedAt: &now}); err != nil {
 		return "", err
 	}
 	return newID, nil
 }
 
-func (s *ViewerService) SetViewerName(id, name string) (*model.Viewer, error) {
+func (s *ViewerService) SetViewerName(ctx context.Context, id, name string) (*model.Viewer, error) {
 	if id == "" {
 		return nil, fmt.Errorf("viewer_id required")
 	}
@@ -51,12 +52,12 @@ func (s *ViewerService) SetViewerName(id, name string) (*model.Viewer, error) {
 	}
 	now := time.Now()
 	viewer := &model.Viewer{ID: id, Name: normalized, CreatedAt: now, UpdatedAt: &now}
-	if err := s.repo.Create(viewer); err != nil {
+	if err := s.repo.Create(ctx, viewer); err != nil {
 		return nil, err
 	}
-	return s.repo.Get(id)
+	return s.repo.Get(ctx, id)
 }
 
-func (s *ViewerService) GetViewer(id string) (*model.Viewer, error) {
-	return s.repo.Get(id)
+func (s *ViewerService) GetViewer(ctx context.Context, id string) (*model.Viewer, error) {
+	return s.repo.Get(ctx, id)
 }
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"streamerrio-backend/pkg/pubsub"
+)
+
+// ViewerFeed: 視聴者向けライブ更新 (統計スナップショット / 発動通知 / 終了サマリー) を Pub/Sub へ発行
+// 統計は押下のたびに発行せず、ルームごとに interval 以上の間隔へ間引く (最後の状態は必ず発行する)。
+type ViewerFeed struct {
+	pubsub   pubsub.PubSub
+	stats    func(ctx context.Context, roomID string) ([]RoomEventStat, error)
+	interval time.Duration
+	mu       sync.Mutex
+	lastSent map[string]time.Time   // roomID -> 最終発行時刻
+	timers   map[string]*time.Timer // roomID -> 発行予約
+	logger   *slog.Logger
+}
+
+// NewViewerFeed: stats は統計スナップショットの取得関数 (通常は EventService.GetRoomStats)
+func NewViewerFeed(ps pubsub.PubSub, stats func(ctx context.Context, roomID string) ([]RoomEventStat, error), interval time.Duration, logger *slog.Logger) *ViewerFeed {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ViewerFeed{
+		pubsub:   ps,
+		stats:    stats,
+		interval: interval,
+		lastSent: make(map[string]time.Time),
+		timers:   make(map[string]*time.Timer),
+		logger:   logger,
+	}
+}
+
+// StatsChanged: 押下などで統計が変化したことを通知 (発行は間引かれる)
+func (f *ViewerFeed) StatsChanged(roomID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, scheduled := f.timers[roomID]; scheduled {
+		return
+	}
+	wait := f.interval - time.Since(f.lastSent[roomID])
+	if wait < 0 {
+		wait = 0
+	}
+	// 予約分は押下リクエストの完了後に発行するため、リクエストの ctx は引き継がない
+	f.timers[roomID] = time.AfterFunc(wait, func() { f.flushStats(context.Background(), roomID) })
+}
+
+// flushStats: 予約を解除し、最新スナップショットを発行
+func (f *ViewerFeed) flushStats(ctx context.Context, roomID string) {
+	f.mu.Lock()
+	delete(f.timers, roomID)
+	f.lastSent[roomID] = time.Now()
+	f.mu.Unlock()
+
+	stats, err := f.stats(ctx, roomID)
+	if err != nil {
+		f.logger.Warn("viewer stats snapshot failed", slog.String("room_id", roomID), slog.Any("error", err))
+		return
+	}
+	f.publish(ctx, roomID, map[string]interface{}{
+		"type":    "room_stats",
+		"room_id": roomID,
+		"stats":   stats,
+		"sent_at": time.Now(),
+	})
+}
+
+// Flush: 間引きで予約中の統計スナップショットを待たずに発行 (停止時に最後の状態を取りこぼさないため)
+func (f *ViewerFeed) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	var rooms []string
+	for roomID, t := range f.timers {
+		// Stop が false = 発火済み (flushStats が実行中)
+		if t.Stop() {
+			rooms = append(rooms, roomID)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, roomID := range rooms {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f.flushStats(ctx, roomID)
+	}
+	if len(rooms) > 0 {
+		f.logger.Info("viewer stats flushed", slog.Int("rooms", len(rooms)))
+	}
+	return nil
+}
+
+// Trigger: 発動通知をそのまま視聴者へ転送
+func (f *ViewerFeed) Trigger(ctx context.Context, roomID string, payload map[string]interface{}) {
+	f.publish(ctx, roomID, payload)
+}
+
+// GameEnded: 終了サマリーを発行し、ルームの間引き状態を破棄
+func (f *ViewerFeed) GameEnded(ctx context.Context, roomID string, payload map[string]interface{}) {
+	f.mu.Lock()
+	if t, ok := f.timers[roomID]; ok {
+		t.Stop()
+		delete(f.timers, roomID)
+	}
+	delete(f.lastSent, roomID)
+	f.mu.Unlock()
+	f.publish(ctx, roomID, payload)
+}
+
+func (f *ViewerFeed) publish(ctx context.Context, roomID string, payload map[string]interface{}) {
+	msg := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		msg[k] = v
+	}
+	msg["room_id"] = roomID
+	data, err := json.Marshal(msg)
+	if err != nil {
+		f.logger.Error("json marshal failed", slog.String("room_id", roomID), slog.Any("error", err))
+		return
+	}
+	if err := f.pubsub.Publish(ctx, pubsub.ChannelViewerUpdates, data); err != nil {
+		f.logger.Warn("viewer update publish failed", slog.String("room_id", roomID), slog.Any("type", payload["type"]), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"streamerrio-backend/pkg/pubsub"
+)
+
+func TestViewerFeed_ThrottlesStats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	ps := pubsub.NewMemoryPubSub(logger)
+	defer ps.Close()
+
+	var snapshots atomic.Int32
+	stats := func(_ context.Context, roomID string) ([]RoomEventStat, error) {
+		n := snapshots.Add(1)
+		return []RoomEventStat{{EventType: "skill1", CurrentCount: int(n)}}, nil
+	}
+	feed := NewViewerFeed(ps, stats, 100*time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var types []string
+	var lastCount int
+	go func() {
+		_ = ps.Subscribe(ctx, pubsub.ChannelViewerUpdates, func(_ context.Context, ch string, msg []byte) error {
+			var m struct {
+				Type   string          `json:"type"`
+				RoomID string          `json:"room_id"`
+				Stats  []RoomEventStat `json:"stats"`
+			}
+			if err := json.Unmarshal(msg, &m); err != nil || m.RoomID != "room-a" {
+				t.Errorf("unexpected message: %s", msg)
+			}
+			mu.Lock()
+			types = append(types, m.Type)
+			if len(m.Stats) > 0 {
+				lastCount = m.Stats[0].CurrentCount
+			}
+			mu.Unlock()
+			return nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 短時間の連続押下は先頭 + 末尾の2回に間引かれる
+	for i := 0; i < 50; i++ {
+		feed.StatsChanged("room-a")
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if n := snapshots.Load(); n < 1 || n > 3 {
+		t.Fatalf("expected throttled snapshots, got %d", n)
+	}
+
+	feed.Trigger(context.Background(), "room-a", map[string]interface{}{"type": "game_event", "event_type": "skill1"})
+	feed.GameEnded(context.Background(), "room-a", map[string]interface{}{"type": "game_end_summary"})
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(types) < 3 || types[len(types)-2] != "game_event" || types[len(types)-1] != "game_end_summary" {
+		t.Fatalf("unexpected message order: %v", types)
+	}
+	if lastCount != int(snapshots.Load()) {
+		t.Fatalf("last published snapshot should be the latest: got %d of %d", lastCount, snapshots.Load())
+	}
+}
+
+func TestViewerFeed_FlushPublishesPending(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	ps := pubsub.NewMemoryPubSub(logger)
+	defer ps.Close()
+
+	var snapshots atomic.Int32
+	stats := func(_ context.Context, roomID string) ([]RoomEventStat, error) {
+		snapshots.Add(1)
+		return nil, nil
+	}
+	feed := NewViewerFeed(ps, stats, time.Hour, logger)
+
+	// 初回は即時発行、2回目は interval 後に予約される
+	feed.StatsChanged("room-a")
+	time.Sleep(50 * time.Millisecond)
+	feed.StatsChanged("room-a")
+	if n := snapshots.Load(); n != 1 {
+		t.Fatalf("expected 1 snapshot before flush, got %d", n)
+	}
+
+	if err := feed.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if n := snapshots.Load(); n != 2 {
+		t.Fatalf("expected pending snapshot to be published on flush, got %d", n)
+	}
+	// 予約は解除済み (次の変化は再び間引きの対象)
+	if err := feed.Flush(context.Background()); err != nil || snapshots.Load() != 2 {
+		t.Fatalf("second flush should be a no-op: err=%v snapshots=%d", err, snapshots.Load())
+	}
+}
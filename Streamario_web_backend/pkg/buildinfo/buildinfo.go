@@ -0,0 +1,76 @@
+// Package buildinfo: 実行中バイナリのバージョン情報 (ヘルスチェック / ログ用)
+package buildinfo
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// version: リンク時に上書きするバージョン (-ldflags "-X streamerrio-backend/pkg/buildinfo.version=...")
+// Docker ビルドのように VCS 情報が埋め込まれない環境向け。空ならビルド情報から決める。
+var version string
+
+// Info: バイナリのビルド情報
+type Info struct {
+	Version   string `json:"version"`            // リリース識別子 (ldflags > モジュールバージョン > VCS リビジョン > "devel")
+	Revision  string `json:"revision,omitempty"` // VCS のコミット
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // 未コミットの変更を含むビルド
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	once   sync.Once
+	cached Info
+)
+
+// Get: ビルド情報 (初回のみ読み取り)
+func Get() Info {
+	once.Do(func() { cached = read(version) })
+	return cached
+}
+
+func read(override string) Info {
+	info := Info{Version: override}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "devel"
+		}
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	if info.Version != "" {
+		return info
+	}
+	switch {
+	case bi.Main.Version != "" && bi.Main.Version != "(devel)":
+		info.Version = bi.Main.Version
+	case info.Revision != "":
+		info.Version = shortRevision(info.Revision)
+		if info.Modified {
+			info.Version += "-dirty"
+		}
+	default:
+		info.Version = "devel"
+	}
+	return info
+}
+
+// shortRevision: デプロイのイメージタグと同じ 7 桁に揃える
+func shortRevision(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
@@ -0,0 +1,55 @@
+package conntoken
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStore_ReuseForSameRoom(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	stores := map[string]Store{"memory": NewMemoryStore(), "redis": NewRedisStore(rdb, logger)}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Put(ctx, "tok", "streamer-1", time.Minute); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			// 初回の接続でルームに結び付き、同じルームへの再接続には期限内なら何度でも使える
+			for i := 0; i < 2; i++ {
+				id, ok, err := s.Use(ctx, "tok", "room-a")
+				if err != nil || !ok || id != "streamer-1" {
+					t.Fatalf("Use #%d = %q, %v, %v", i+1, id, ok, err)
+				}
+			}
+			if _, ok, _ := s.Use(ctx, "tok", "room-b"); ok {
+				t.Fatalf("token accepted for another room")
+			}
+			if _, ok, _ := s.Use(ctx, "unknown", "room-a"); ok {
+				t.Fatalf("unknown token accepted")
+			}
+		})
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &memoryStore{entries: make(map[string]memoryEntry), now: func() time.Time { return now }}
+	_ = s.Put(context.Background(), "tok", "streamer-1", time.Minute)
+	if _, ok, _ := s.Use(context.Background(), "tok", "room-a"); !ok {
+		t.Fatalf("fresh token rejected")
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := s.Use(context.Background(), "tok", "room-a"); ok {
+		t.Fatalf("expired token accepted")
+	}
+}
@@ -0,0 +1,18 @@
+package conntoken
+
+import (
+	"context"
+	"time"
+)
+
+// Store: Unity 接続用の短命トークンを保持する共有ストア
+// トークンは最初に接続したルームに結び付き、期限内は同じルームへの再接続 (since=N での再開など) にだけ使える。
+// 発行したインスタンスとは別のインスタンスで使われうるため、複数インスタンス構成では Redis 実装を使う。
+type Store interface {
+	// Put: トークンと配信者 ID の対応を ttl 付きで保存
+	Put(ctx context.Context, token, streamerID string, ttl time.Duration) error
+
+	// Use: roomID への接続にトークンを使い、配信者 ID を返す
+	// 初回はトークンを roomID に結び付ける。別ルームに結び付いている/期限切れ/不明なら ok=false。
+	Use(ctx context.Context, token, roomID string) (streamerID string, ok bool, err error)
+}
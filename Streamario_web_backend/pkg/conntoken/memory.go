@@ -0,0 +1,61 @@
+package conntoken
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	streamerID string
+	roomID     string // 結び付いたルーム (未使用なら空)
+	expiresAt  time.Time
+}
+
+// memoryStore: テスト/単一インスタンス用のインメモリ実装
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry // token -> entry
+	now     func() time.Time
+}
+
+// NewMemoryStore: インメモリ実装を生成
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Put: 保存のついでに期限切れのトークンを掃除
+func (m *memoryStore) Put(ctx context.Context, token, streamerID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for t, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, t)
+		}
+	}
+	m.entries[token] = memoryEntry{streamerID: streamerID, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Use: 期限内なら初回の roomID に結び付け、以後は同じルームにだけ使わせる
+func (m *memoryStore) Use(ctx context.Context, token, roomID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[token]
+	if !ok {
+		return "", false, nil
+	}
+	if !m.now().Before(e.expiresAt) {
+		delete(m.entries, token)
+		return "", false, nil
+	}
+	if e.roomID == "" {
+		e.roomID = roomID
+		m.entries[token] = e
+	}
+	if e.roomID != roomID {
+		return "", false, nil
+	}
+	return e.streamerID, true, nil
+}
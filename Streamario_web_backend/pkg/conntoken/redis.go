@@ -0,0 +1,86 @@
+package conntoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const tokenKeyPrefix = "ws:conntoken:"
+
+// useScript: 未使用ならルームを結び付け、結び付いたルームと一致する場合だけ配信者 ID を返す
+var useScript = redis.NewScript(`
+local streamer = redis.call("HGET", KEYS[1], "streamer")
+if not streamer then
+  return false
+end
+local room = redis.call("HGET", KEYS[1], "room")
+if not room then
+  redis.call("HSET", KEYS[1], "room", ARGV[1])
+  room = ARGV[1]
+end
+if room ~= ARGV[1] then
+  return false
+end
+return streamer
+`)
+
+// redisStore: Redis を利用した本番向け実装
+// ws:conntoken:<token> のハッシュに配信者 ID (streamer) と結び付いたルーム (room) を TTL 付きで保存する。
+type redisStore struct {
+	rdb    *redis.Client
+	logger *slog.Logger
+}
+
+// NewRedisStore: Redis 実装を生成
+func NewRedisStore(rdb *redis.Client, logger *slog.Logger) Store {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &redisStore{rdb: rdb, logger: logger}
+}
+
+// Put: HSET と PEXPIRE を MULTI でまとめて保存
+func (r *redisStore) Put(ctx context.Context, token, streamerID string, ttl time.Duration) error {
+	logger := r.logger.With(
+		slog.String("op", "put"),
+		slog.String("streamer_id", streamerID),
+	)
+	start := time.Now()
+	key := tokenKeyPrefix + token
+	_, err := r.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, key, "streamer", streamerID)
+		p.PExpire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		logger.Error("redis.hset failed", slog.Any("error", err))
+		return fmt.Errorf("save connection token failed: %w", err)
+	}
+	logger.Debug("redis.hset", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Use: useScript で結び付けと照合を原子的に行う (TTL は発行時のまま延長しない)
+func (r *redisStore) Use(ctx context.Context, token, roomID string) (string, bool, error) {
+	logger := r.logger.With(
+		slog.String("op", "use"),
+		slog.String("room_id", roomID),
+	)
+	start := time.Now()
+	streamerID, err := useScript.Run(ctx, r.rdb, []string{tokenKeyPrefix + token}, roomID).Text()
+	if errors.Is(err, redis.Nil) {
+		logger.Debug("redis.use_token", slog.Bool("hit", false), slog.Duration("elapsed", time.Since(start)))
+		return "", false, nil
+	}
+	if err != nil {
+		logger.Error("redis.use_token failed", slog.Any("error", err))
+		return "", false, fmt.Errorf("use connection token failed: %w", err)
+	}
+	logger.Debug("redis.use_token", slog.Bool("hit", true), slog.String("streamer_id", streamerID), slog.Duration("elapsed", time.Since(start)))
+	return streamerID, true, nil
+}
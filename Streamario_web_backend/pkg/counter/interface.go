@@ -1,12 +1,41 @@
 package counter
 
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// ErrTriggerStateChanged: IncrementAndTrigger の呼び出し前に読んだ発動回数と現在の発動回数が一致しない
+// (閾値/レベルの算出後に別リクエストが発動させた)。カウントは加算していないため、発動履歴を読み直して再試行する。
+var ErrTriggerStateChanged = errors.New("trigger state changed")
+
 // Counter: イベント回数 & 視聴者アクティビティを抽象化するインタフェース
 // すべてのメソッドは並行安全であること (goroutine から同時呼び出し想定)
+// ctx のキャンセル/期限で処理を打ち切る (リクエスト切断時に Redis への操作を残さない)
 type Counter interface {
-    Increment(roomID, eventType string, value int64) (int64, error)        // カウントをvalueだけ増やして現在のカウントを返す
-    Get(roomID, eventType string) (int64, error)              // 現在カウント取得
-    Reset(roomID, eventType string) error                     // カウントリセット(閾値到達後など)
-    SetExcess(roomID, eventType string, excess int64) error   // 閾値超過分をカウントに設定（超過分を捨てない）
-    UpdateViewerActivity(roomID, viewerID string) error       // 視聴者アクティビティ更新(最終時刻記録)
-    GetActiveViewerCount(roomID string) (int64, error)        // 一定期間内のアクティブ視聴者数
+    Increment(ctx context.Context, roomID, eventType string, value int64) (int64, error)        // カウントをvalueだけ増やして現在のカウントを返す
+    Get(ctx context.Context, roomID, eventType string) (int64, error)              // 現在カウント取得
+    Reset(ctx context.Context, roomID, eventType string) error                     // カウント・発動履歴リセット(ゲーム終了時など)
+    SetExcess(ctx context.Context, roomID, eventType string, excess int64) error   // 閾値超過分をカウントに設定（超過分を捨てない）
+    IncrementAndTrigger(ctx context.Context, roomID, eventType string, delta, threshold, nextLevel, expectedTriggers int64) (TriggerResult, error) // 発動回数が expectedTriggers のままなら加算・閾値判定・超過分設定・発動履歴 (発動後のレベル nextLevel) 記録を原子的に実行 (変わっていれば ErrTriggerStateChanged)
+    GetTriggerState(ctx context.Context, roomID, eventType string) (TriggerState, error) // 発動回数と最終発動時刻を取得
+    UpdateViewerActivity(ctx context.Context, roomID, viewerID string) error       // 視聴者アクティビティ更新(最終時刻記録)
+    GetActiveViewerCount(ctx context.Context, roomID string) (int64, error)        // 一定期間内のアクティブ視聴者数
+    PurgeRoom(ctx context.Context, roomID string) (int64, error)                   // ルームに紐づく全データを削除 (削除件数を返す)
+}
+
+// TriggerState: イベント種別ごとの発動履歴 (レベル算出に使用)
+type TriggerState struct {
+    Count           int64     // これまでの発動回数
+    LastTriggeredAt time.Time // 最終発動時刻 (未発動ならゼロ値)
+    Level           int64     // 最終発動時に記録した発動後のレベル (decay 方式の低下を反映済み。0 なら未記録)
+}
+
+// TriggerResult: IncrementAndTrigger の結果
+type TriggerResult struct {
+    Count     int64        // 加算直後のカウント (発動判定に使った値)
+    Triggered bool         // 閾値に到達して発動したか
+    Remaining int64        // 処理後に残ったカウント (発動時は超過分)
+    Trigger   TriggerState // 処理後の発動履歴
 }
@@ -1,6 +1,7 @@
 package counter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -8,22 +9,24 @@ import (
 // memoryCounter: プロトタイプ/テスト用のインメモリ実装 (再起動で消える)
 type memoryCounter struct {
 	mu      sync.RWMutex
-	counts  map[string]map[string]int64 // roomID -> eventType -> count
-	viewers map[string]map[string]int64 // roomID -> viewerID -> lastUnix(秒)
-	window  time.Duration               // アクティブ判定窓
+	counts  map[string]map[string]int64        // roomID -> eventType -> count
+	levels  map[string]map[string]TriggerState // roomID -> eventType -> 発動履歴
+	viewers map[string]map[string]int64        // roomID -> viewerID -> lastUnix(秒)
+	window  time.Duration                      // アクティブ判定窓
 }
 
 // NewMemoryCounter: インメモリ実装生成 (5分窓)
 func NewMemoryCounter() Counter {
 	return &memoryCounter{
 		counts:  make(map[string]map[string]int64),
+		levels:  make(map[string]map[string]TriggerState),
 		viewers: make(map[string]map[string]int64),
 		window:  5 * time.Minute,
 	}
 }
 
 // Increment: カウントをvalueだけ加算して現在値返却
-func (m *memoryCounter) Increment(roomID, eventType string, value int64) (int64, error) {
+func (m *memoryCounter) Increment(ctx context.Context, roomID, eventType string, value int64) (int64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if _, ok := m.counts[roomID]; !ok {
@@ -34,7 +37,7 @@ func (m *memoryCounter) Increment(roomID, eventType string, value int64) (int64,
 }
 
 // Get: 現在カウント取得
-func (m *memoryCounter) Get(roomID, eventType string) (int64, error) {
+func (m *memoryCounter) Get(ctx context.Context, roomID, eventType string) (int64, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if evMap, ok := m.counts[roomID]; ok {
@@ -43,18 +46,21 @@ func (m *memoryCounter) Get(roomID, eventType string) (int64, error) {
 	return 0, nil
 }
 
-// Reset: 指定イベント種別カウントを0クリア
-func (m *memoryCounter) Reset(roomID, eventType string) error {
+// Reset: 指定イベント種別カウントを0クリアし発動履歴も消去
+func (m *memoryCounter) Reset(ctx context.Context, roomID, eventType string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if evMap, ok := m.counts[roomID]; ok {
 		evMap[eventType] = 0
 	}
+	if lvMap, ok := m.levels[roomID]; ok {
+		delete(lvMap, eventType)
+	}
 	return nil
 }
 
 // SetExcess: 閾値超過分をカウントに設定（超過分を捨てない）
-func (m *memoryCounter) SetExcess(roomID, eventType string, excess int64) error {
+func (m *memoryCounter) SetExcess(ctx context.Context, roomID, eventType string, excess int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if _, ok := m.counts[roomID]; !ok {
@@ -64,8 +70,45 @@ func (m *memoryCounter) SetExcess(roomID, eventType string, excess int64) error
 	return nil
 }
 
+// IncrementAndTrigger: 発動回数の照合→加算→閾値判定→超過分設定→発動履歴記録をミューテックス内で一括実行
+func (m *memoryCounter) IncrementAndTrigger(ctx context.Context, roomID, eventType string, delta, threshold, nextLevel, expectedTriggers int64) (TriggerResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.counts[roomID]; !ok {
+		m.counts[roomID] = make(map[string]int64)
+	}
+	if _, ok := m.levels[roomID]; !ok {
+		m.levels[roomID] = make(map[string]TriggerState)
+	}
+	if m.levels[roomID][eventType].Count != expectedTriggers {
+		return TriggerResult{}, ErrTriggerStateChanged
+	}
+	cur := m.counts[roomID][eventType] + delta
+	res := TriggerResult{Count: cur, Remaining: cur, Trigger: m.levels[roomID][eventType]}
+	if threshold > 0 && cur >= threshold {
+		res.Triggered = true
+		res.Remaining = cur - threshold
+		res.Trigger.Count++
+		res.Trigger.LastTriggeredAt = time.Now()
+		res.Trigger.Level = nextLevel
+		m.levels[roomID][eventType] = res.Trigger
+	}
+	m.counts[roomID][eventType] = res.Remaining
+	return res, nil
+}
+
+// GetTriggerState: 発動履歴取得 (未発動ならゼロ値)
+func (m *memoryCounter) GetTriggerState(ctx context.Context, roomID, eventType string) (TriggerState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if lvMap, ok := m.levels[roomID]; ok {
+		return lvMap[eventType], nil
+	}
+	return TriggerState{}, nil
+}
+
 // UpdateViewerActivity: 視聴者最終アクセス時刻を更新
-func (m *memoryCounter) UpdateViewerActivity(roomID, viewerID string) error {
+func (m *memoryCounter) UpdateViewerActivity(ctx context.Context, roomID, viewerID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if _, ok := m.viewers[roomID]; !ok {
@@ -76,7 +119,7 @@ func (m *memoryCounter) UpdateViewerActivity(roomID, viewerID string) error {
 }
 
 // GetActiveViewerCount: 窓内(5分) の視聴者数を数え古いものは削除
-func (m *memoryCounter) GetActiveViewerCount(roomID string) (int64, error) {
+func (m *memoryCounter) GetActiveViewerCount(ctx context.Context, roomID string) (int64, error) {
 	cutoff := time.Now().Add(-m.window).Unix()
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -94,3 +137,19 @@ func (m *memoryCounter) GetActiveViewerCount(roomID string) (int64, error) {
 	}
 	return c, nil
 }
+
+// PurgeRoom: ルームのカウント・発動履歴・視聴者記録をすべて削除
+func (m *memoryCounter) PurgeRoom(ctx context.Context, roomID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	n += int64(len(m.counts[roomID]))
+	n += int64(len(m.levels[roomID]))
+	if _, ok := m.viewers[roomID]; ok {
+		n++
+	}
+	delete(m.counts, roomID)
+	delete(m.levels, roomID)
+	delete(m.viewers, roomID)
+	return n, nil
+}
@@ -0,0 +1,130 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// incrementOnce: 発動履歴を読んで IncrementAndTrigger を呼び、発動回数が変わっていたら読み直して再試行する
+func incrementOnce(c Counter, roomID, eventType string, threshold int64) (TriggerResult, error) {
+	for {
+		state, err := c.GetTriggerState(context.Background(), roomID, eventType)
+		if err != nil {
+			return TriggerResult{}, err
+		}
+		res, err := c.IncrementAndTrigger(context.Background(), roomID, eventType, 1, threshold, state.Level+1, state.Count)
+		if !errors.Is(err, ErrTriggerStateChanged) {
+			return res, err
+		}
+	}
+}
+
+// hammer: 複数 goroutine から1ルーム・1種別へ delta=1 の加算を同時実行し、発動回数を数える
+func hammer(t *testing.T, c Counter, roomID, eventType string, workers, perWorker int, threshold int64) int64 {
+	t.Helper()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		triggered int64
+		errs      []error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				res, err := incrementOnce(c, roomID, eventType, threshold)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else if res.Triggered {
+					triggered++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		t.Fatalf("IncrementAndTrigger failed %d times: %v", len(errs), errs[0])
+	}
+	return triggered
+}
+
+// assertNoLostOrDoubledTriggers: 押下総数 = 発動回数×閾値 + 残りカウント が成立し、履歴とも一致すること
+func assertNoLostOrDoubledTriggers(t *testing.T, c Counter, roomID, eventType string, total int, threshold, triggered int64) {
+	t.Helper()
+	wantTriggers := int64(total) / threshold
+	wantRemaining := int64(total) % threshold
+	if triggered != wantTriggers {
+		t.Errorf("triggers: expected %d, got %d", wantTriggers, triggered)
+	}
+	remaining, err := c.Get(context.Background(), roomID, eventType)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if remaining != wantRemaining {
+		t.Errorf("remaining count: expected %d, got %d", wantRemaining, remaining)
+	}
+	state, err := c.GetTriggerState(context.Background(), roomID, eventType)
+	if err != nil {
+		t.Fatalf("GetTriggerState failed: %v", err)
+	}
+	if state.Count != wantTriggers {
+		t.Errorf("trigger state count: expected %d, got %d", wantTriggers, state.Count)
+	}
+}
+
+func TestMemoryCounter_IncrementAndTrigger(t *testing.T) {
+	c := NewMemoryCounter()
+
+	res, err := c.IncrementAndTrigger(context.Background(), "room", "skill1", 3, 5, 2, 0)
+	if err != nil {
+		t.Fatalf("IncrementAndTrigger failed: %v", err)
+	}
+	if res.Triggered || res.Count != 3 || res.Remaining != 3 {
+		t.Fatalf("unexpected result before threshold: %+v", res)
+	}
+
+	// 閾値を超えた分は次回に持ち越す
+	res, err = c.IncrementAndTrigger(context.Background(), "room", "skill1", 4, 5, 2, 0)
+	if err != nil {
+		t.Fatalf("IncrementAndTrigger failed: %v", err)
+	}
+	if !res.Triggered || res.Count != 7 || res.Remaining != 2 || res.Trigger.Count != 1 {
+		t.Fatalf("unexpected result at threshold: %+v", res)
+	}
+	if res.Trigger.LastTriggeredAt.IsZero() {
+		t.Error("expected LastTriggeredAt to be set")
+	}
+
+	// 発動前の履歴を前提にした加算は適用しない
+	if _, err := c.IncrementAndTrigger(context.Background(), "room", "skill1", 1, 5, 2, 0); !errors.Is(err, ErrTriggerStateChanged) {
+		t.Fatalf("stale trigger count: err = %v, want ErrTriggerStateChanged", err)
+	}
+	if n, _ := c.Get(context.Background(), "room", "skill1"); n != 2 {
+		t.Fatalf("stale increment applied: count = %d, want 2", n)
+	}
+
+	// Reset で発動履歴も消える
+	if err := c.Reset(context.Background(), "room", "skill1"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	state, _ := c.GetTriggerState(context.Background(), "room", "skill1")
+	if state.Count != 0 {
+		t.Errorf("expected trigger state cleared after reset, got %+v", state)
+	}
+}
+
+func TestMemoryCounter_IncrementAndTriggerConcurrent(t *testing.T) {
+	c := NewMemoryCounter()
+	const (
+		workers   = 32
+		perWorker = 250
+		threshold = 7
+	)
+	triggered := hammer(t, c, "room", "enemy1", workers, perWorker, threshold)
+	assertNoLostOrDoubledTriggers(t, c, "room", "enemy1", workers*perWorker, threshold, triggered)
+}
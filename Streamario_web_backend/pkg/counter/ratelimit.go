@@ -0,0 +1,99 @@
+package counter
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimiter: 押下のレート制限と不正検知に使う状態を抽象化するインタフェース
+// キーはすべてルーム単位 (room:<id>:...) に閉じ、PurgeRoom でまとめて削除される前提。
+// すべてのメソッドは並行安全であること。ctx のキャンセル/期限で処理を打ち切る
+type RateLimiter interface {
+	// Take: 複数のトークンバケットから同じ数 (最大 cost 個) を原子的に取り出す
+	// 許可数は最も残りの少ないバケットで決まり、一部のバケットだけが減ることはない。
+	// now はメモリ実装の時刻 (Redis 実装はサーバの TIME を使い、インスタンス間の時計のずれに左右されない)
+	Take(ctx context.Context, roomID string, buckets []Bucket, cost int64, now time.Time) (TakeResult, error)
+	// RecordPress: 視聴者の押下時刻を記録し、直近 keep 件を新しい順に返す
+	RecordPress(ctx context.Context, roomID, viewerID string, at time.Time, keep int) ([]time.Time, error)
+	// TrackIPViewer: IP から押下した視聴者を記録し、window 内の異なる視聴者数を返す
+	TrackIPViewer(ctx context.Context, roomID, ip, viewerID string, window time.Duration, now time.Time) (int64, error)
+	// SetFlag / GetFlag / ListFlags: 視聴者ごとの不正フラグ (JSON) の保存・取得 (未設定なら nil)
+	SetFlag(ctx context.Context, roomID, viewerID string, flag []byte) error
+	GetFlag(ctx context.Context, roomID, viewerID string) ([]byte, error)
+	ListFlags(ctx context.Context, roomID string) (map[string][]byte, error)
+}
+
+// BucketLimit: トークンバケット1つ分の設定
+type BucketLimit struct {
+	Rate  float64 // 1秒あたりの補充トークン数
+	Burst int64   // バケット容量 (連続で許可できる最大数)
+}
+
+// Bucket: Take の対象となるバケット (名前はルーム内で一意)
+type Bucket struct {
+	Name  string
+	Limit BucketLimit
+}
+
+// TakeResult: Take の結果
+type TakeResult struct {
+	Granted    int64         // 許可された数 (0..cost)
+	Limited    int           // 許可数を絞ったバケットの添字 (全量許可なら -1)
+	Remaining  float64       // 取り出し後の残りトークン (Limited のバケット / 全量許可なら最も少ないバケット)
+	RetryAfter time.Duration // 要求分が全て揃うまでの目安 (全量許可なら 0)
+}
+
+// refill: 経過時間分を補充した残量 (容量で頭打ち)
+func (l BucketLimit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * l.Rate
+	}
+	if limit := float64(l.Burst); tokens > limit {
+		tokens = limit
+	}
+	return tokens
+}
+
+// ttl: 空のバケットが満タンに戻るまでの時間 (これ以降は状態を保持する必要が無い)
+func (l BucketLimit) ttl() time.Duration {
+	if l.Rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration(float64(l.Burst)/l.Rate*float64(time.Second)) + time.Second
+}
+
+// takeAll: 補充済みの各残量から同じ数を取り出した結果と新しい残量
+func takeAll(buckets []Bucket, tokens []float64, cost int64) (TakeResult, []float64) {
+	res := TakeResult{Granted: cost, Limited: -1}
+	for i, t := range tokens {
+		if avail := max(int64(t), 0); avail < res.Granted {
+			res.Granted, res.Limited = avail, i
+		}
+	}
+	after := make([]float64, len(tokens))
+	for i, t := range tokens {
+		after[i] = t - float64(res.Granted)
+	}
+	res.Remaining, res.RetryAfter = summarize(buckets, after, res.Limited, cost, res.Granted)
+	return res, after
+}
+
+// summarize: 取り出し後の残量から TakeResult の Remaining / RetryAfter を求める
+func summarize(buckets []Bucket, after []float64, limited int, cost, granted int64) (float64, time.Duration) {
+	if limited < 0 {
+		remaining := 0.0
+		for i, t := range after {
+			if i == 0 || t < remaining {
+				remaining = t
+			}
+		}
+		return remaining, 0
+	}
+	remaining := after[limited]
+	rate := buckets[limited].Limit.Rate
+	if rate <= 0 {
+		return remaining, 0
+	}
+	missing := float64(cost-granted) - remaining
+	return remaining, time.Duration(missing / rate * float64(time.Second))
+}
@@ -0,0 +1,137 @@
+package counter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryBucket: トークンバケットの状態
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	expires time.Time
+}
+
+// memoryIPViewers: IP ごとの視聴者と最終押下時刻
+type memoryIPViewers map[string]time.Time
+
+// memoryRateLimiter: プロトタイプ/テスト用のインメモリ実装 (再起動で消える)
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket     // roomID|bucket -> 状態
+	presses map[string][]time.Time       // roomID|viewerID -> 直近の押下時刻 (新しい順)
+	ips     map[string]memoryIPViewers   // roomID|ip -> 視聴者
+	flags   map[string]map[string][]byte // roomID -> viewerID -> フラグ
+	sweeps  int                          // 期限切れバケット掃除までの呼び出し回数
+}
+
+// NewMemoryRateLimiter: インメモリ実装生成
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{
+		buckets: make(map[string]*memoryBucket),
+		presses: make(map[string][]time.Time),
+		ips:     make(map[string]memoryIPViewers),
+		flags:   make(map[string]map[string][]byte),
+	}
+}
+
+// Take: 全バケットを補充してから同じ数を取り出す
+func (m *memoryRateLimiter) Take(ctx context.Context, roomID string, buckets []Bucket, cost int64, now time.Time) (TakeResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	states := make([]*memoryBucket, len(buckets))
+	tokens := make([]float64, len(buckets))
+	for i, bucket := range buckets {
+		key := roomID + "|" + bucket.Name
+		b, ok := m.buckets[key]
+		if !ok || now.After(b.expires) {
+			b = &memoryBucket{tokens: float64(bucket.Limit.Burst), updated: now}
+			m.buckets[key] = b
+		}
+		states[i] = b
+		tokens[i] = bucket.Limit.refill(b.tokens, now.Sub(b.updated))
+	}
+	res, after := takeAll(buckets, tokens, cost)
+	for i, b := range states {
+		b.tokens, b.updated, b.expires = after[i], now, now.Add(buckets[i].Limit.ttl())
+	}
+	return res, nil
+}
+
+// sweep: 一定回数ごとに期限切れのバケットを削除 (呼び出し側でロック済み)
+func (m *memoryRateLimiter) sweep(now time.Time) {
+	m.sweeps++
+	if m.sweeps < 1024 {
+		return
+	}
+	m.sweeps = 0
+	for k, b := range m.buckets {
+		if now.After(b.expires) {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+// RecordPress: 押下時刻を先頭に積み keep 件に切り詰める
+func (m *memoryRateLimiter) RecordPress(ctx context.Context, roomID, viewerID string, at time.Time, keep int) ([]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := roomID + "|" + viewerID
+	times := append([]time.Time{at}, m.presses[key]...)
+	if len(times) > keep {
+		times = times[:keep]
+	}
+	m.presses[key] = times
+	return append([]time.Time(nil), times...), nil
+}
+
+// TrackIPViewer: 窓外の視聴者を除いてから数える
+func (m *memoryRateLimiter) TrackIPViewer(ctx context.Context, roomID, ip, viewerID string, window time.Duration, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := roomID + "|" + ip
+	viewers, ok := m.ips[key]
+	if !ok {
+		viewers = make(memoryIPViewers)
+		m.ips[key] = viewers
+	}
+	viewers[viewerID] = now
+	cutoff := now.Add(-window)
+	for id, ts := range viewers {
+		if ts.Before(cutoff) {
+			delete(viewers, id)
+		}
+	}
+	return int64(len(viewers)), nil
+}
+
+// SetFlag: 視聴者フラグを保存 (上書き)
+func (m *memoryRateLimiter) SetFlag(ctx context.Context, roomID, viewerID string, flag []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.flags[roomID]; !ok {
+		m.flags[roomID] = make(map[string][]byte)
+	}
+	m.flags[roomID][viewerID] = append([]byte(nil), flag...)
+	return nil
+}
+
+// GetFlag: 視聴者フラグ取得 (未設定なら nil)
+func (m *memoryRateLimiter) GetFlag(ctx context.Context, roomID, viewerID string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flags[roomID][viewerID], nil
+}
+
+// ListFlags: ルーム内の全フラグ取得
+func (m *memoryRateLimiter) ListFlags(ctx context.Context, roomID string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string][]byte, len(m.flags[roomID]))
+	for id, f := range m.flags[roomID] {
+		out[id] = f
+	}
+	return out, nil
+}
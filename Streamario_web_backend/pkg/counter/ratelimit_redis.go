@@ -0,0 +1,265 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pressHistoryTTL: 押下時刻リストを保持する時間 (最終押下から)
+const pressHistoryTTL = 10 * time.Minute
+
+// redisRateLimiter: Redis を利用した本番向けレート制限実装
+// 複数インスタンスで同じバケットを共有するため、補充と取り出しは Lua で原子的に行う。
+type redisRateLimiter struct {
+	rdb     *redis.Client
+	timeout time.Duration // 1操作あたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
+}
+
+// NewRedisRateLimiter: 実装生成 (timeout は各メソッドの Redis 操作に掛ける期限)
+func NewRedisRateLimiter(rdb *redis.Client, timeout time.Duration, logger *slog.Logger) RateLimiter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &redisRateLimiter{rdb: rdb, timeout: timeout, logger: logger}
+}
+
+func (rl *redisRateLimiter) keyBucket(roomID, bucket string) string {
+	return fmt.Sprintf("room:%s:rl:%s", roomID, bucket)
+}
+func (rl *redisRateLimiter) keyPresses(roomID, viewerID string) string {
+	return fmt.Sprintf("room:%s:presses:%s", roomID, viewerID)
+}
+func (rl *redisRateLimiter) keyIPViewers(roomID, ip string) string {
+	return fmt.Sprintf("room:%s:ip:%s", roomID, ip)
+}
+func (rl *redisRateLimiter) keyFlags(roomID string) string {
+	return fmt.Sprintf("room:%s:flags", roomID)
+}
+
+// takeScript: 複数のトークンバケットの補充と取り出しを原子的に実行 (全バケットから同じ数を取り出す)
+// KEYS[i]=バケットキー, ARGV[1]=要求数, バケット i ごとに ARGV[3i-1]=補充レート(個/秒), ARGV[3i]=容量, ARGV[3i+1]=TTL(ms)
+// 時刻は Redis の TIME を使う (インスタンスごとの時計のずれで補充量が狂わないように)。
+// 戻り値: {許可数, 許可数を絞ったバケット (1始まり / 全量許可なら 0), {各バケットの残りトークン(文字列)}}
+// ※ Lua の数値は整数へ丸められるため残量は文字列で返す
+var takeScript = redis.NewScript(`
+local cost = tonumber(ARGV[1])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local tokens = {}
+local granted = cost
+local limited = 0
+for i = 1, #KEYS do
+  local rate = tonumber(ARGV[i * 3 - 1])
+  local burst = tonumber(ARGV[i * 3])
+  local st = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+  local tk = tonumber(st[1])
+  local ts = tonumber(st[2])
+  if tk == nil or ts == nil then
+    tk = burst
+    ts = now
+  end
+  if now > ts then
+    tk = tk + (now - ts) / 1000 * rate
+  end
+  if tk > burst then
+    tk = burst
+  end
+  tokens[i] = tk
+  local avail = math.max(math.floor(tk), 0)
+  if avail < granted then
+    granted = avail
+    limited = i
+  end
+end
+local remaining = {}
+for i = 1, #KEYS do
+  local tk = tokens[i] - granted
+  redis.call('HSET', KEYS[i], 'tokens', tostring(tk), 'ts', now)
+  redis.call('PEXPIRE', KEYS[i], ARGV[i * 3 + 1])
+  remaining[i] = tostring(tk)
+end
+return {granted, limited, remaining}
+`)
+
+// Take: Lua スクリプトで全バケットから同じ数を取り出す
+func (rl *redisRateLimiter) Take(ctx context.Context, roomID string, buckets []Bucket, cost int64, now time.Time) (TakeResult, error) {
+	if len(buckets) == 0 {
+		return TakeResult{Granted: cost, Limited: -1}, nil
+	}
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	keys := make([]string, len(buckets))
+	args := make([]interface{}, 0, 1+3*len(buckets))
+	args = append(args, cost)
+	for i, b := range buckets {
+		keys[i] = rl.keyBucket(roomID, b.Name)
+		args = append(args, strconv.FormatFloat(b.Limit.Rate, 'f', -1, 64), b.Limit.Burst, b.Limit.ttl().Milliseconds())
+	}
+	logger := rl.logger.With(
+		slog.String("op", "take"),
+		slog.String("room_id", roomID),
+		slog.Any("keys", keys),
+		slog.Int64("cost", cost),
+	)
+	start := time.Now()
+	vals, err := takeScript.Run(ctx, rl.rdb, keys, args...).Slice()
+	if err != nil {
+		logger.Error("redis.evalsha failed", slog.Any("error", err))
+		return TakeResult{}, err
+	}
+	var raw []interface{}
+	if len(vals) == 3 {
+		raw, _ = vals[2].([]interface{})
+	}
+	if len(raw) != len(buckets) {
+		logger.Error("redis.evalsha unexpected reply", slog.Int("len", len(vals)))
+		return TakeResult{}, fmt.Errorf("unexpected script reply: %v", vals)
+	}
+	granted, _ := vals[0].(int64)
+	limited, _ := vals[1].(int64)
+	after := make([]float64, len(raw))
+	for i, v := range raw {
+		after[i], _ = strconv.ParseFloat(fmt.Sprint(v), 64)
+	}
+	// 許可数は Lua 側で確定済み。Remaining / RetryAfter の算出のみ共通ロジックを使う
+	res := TakeResult{Granted: granted, Limited: int(limited) - 1}
+	res.Remaining, res.RetryAfter = summarize(buckets, after, res.Limited, cost, granted)
+	logger.Debug("redis.evalsha", slog.Int64("granted", granted), slog.Int("limited", res.Limited), slog.Float64("remaining", res.Remaining), slog.Duration("elapsed", time.Since(start)))
+	return res, nil
+}
+
+// RecordPress: LIST の先頭へ押下時刻 (ms) を積み、keep 件に切り詰めて返す
+func (rl *redisRateLimiter) RecordPress(ctx context.Context, roomID, viewerID string, at time.Time, keep int) ([]time.Time, error) {
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	key := rl.keyPresses(roomID, viewerID)
+	logger := rl.logger.With(
+		slog.String("op", "record_press"),
+		slog.String("room_id", roomID),
+		slog.String("viewer_id", viewerID),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	var rng *redis.StringSliceCmd
+	_, err := rl.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, key, at.UnixMilli())
+		p.LTrim(ctx, key, 0, int64(keep-1))
+		p.PExpire(ctx, key, pressHistoryTTL)
+		rng = p.LRange(ctx, key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		logger.Error("redis.lpush failed", slog.Any("error", err))
+		return nil, err
+	}
+	out := make([]time.Time, 0, len(rng.Val()))
+	for _, s := range rng.Val() {
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			out = append(out, time.UnixMilli(ms))
+		}
+	}
+	logger.Debug("redis.lpush", slog.Int("len", len(out)), slog.Duration("elapsed", time.Since(start)))
+	return out, nil
+}
+
+// TrackIPViewer: ZSET に視聴者を時刻スコアで追加し、窓外を除いた要素数を返す
+func (rl *redisRateLimiter) TrackIPViewer(ctx context.Context, roomID, ip, viewerID string, window time.Duration, now time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	key := rl.keyIPViewers(roomID, ip)
+	logger := rl.logger.With(
+		slog.String("op", "track_ip_viewer"),
+		slog.String("room_id", roomID),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	var card *redis.IntCmd
+	_, err := rl.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: viewerID})
+		p.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", now.Add(-window).UnixMilli()))
+		card = p.ZCard(ctx, key)
+		p.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		logger.Error("redis.zadd failed", slog.Any("error", err))
+		return 0, err
+	}
+	logger.Debug("redis.zcard", slog.Int64("count", card.Val()), slog.Duration("elapsed", time.Since(start)))
+	return card.Val(), nil
+}
+
+// SetFlag: HASH room:<id>:flags へ視聴者フラグを保存
+func (rl *redisRateLimiter) SetFlag(ctx context.Context, roomID, viewerID string, flag []byte) error {
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	key := rl.keyFlags(roomID)
+	logger := rl.logger.With(
+		slog.String("op", "set_flag"),
+		slog.String("room_id", roomID),
+		slog.String("viewer_id", viewerID),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	if err := rl.rdb.HSet(ctx, key, viewerID, flag).Err(); err != nil {
+		logger.Error("redis.hset failed", slog.Any("error", err))
+		return err
+	}
+	logger.Debug("redis.hset", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// GetFlag: 視聴者フラグ取得 (未設定なら nil)
+func (rl *redisRateLimiter) GetFlag(ctx context.Context, roomID, viewerID string) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	key := rl.keyFlags(roomID)
+	logger := rl.logger.With(
+		slog.String("op", "get_flag"),
+		slog.String("room_id", roomID),
+		slog.String("viewer_id", viewerID),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	v, err := rl.rdb.HGet(ctx, key, viewerID).Bytes()
+	if err == redis.Nil {
+		logger.Debug("redis.hget", slog.Bool("hit", false), slog.Duration("elapsed", time.Since(start)))
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("redis.hget failed", slog.Any("error", err))
+		return nil, err
+	}
+	logger.Debug("redis.hget", slog.Bool("hit", true), slog.Duration("elapsed", time.Since(start)))
+	return v, nil
+}
+
+// ListFlags: ルーム内の全フラグ取得
+func (rl *redisRateLimiter) ListFlags(ctx context.Context, roomID string) (map[string][]byte, error) {
+	ctx, cancel := withTimeout(ctx, rl.timeout)
+	defer cancel()
+	key := rl.keyFlags(roomID)
+	logger := rl.logger.With(
+		slog.String("op", "list_flags"),
+		slog.String("room_id", roomID),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	vals, err := rl.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		logger.Error("redis.hgetall failed", slog.Any("error", err))
+		return nil, err
+	}
+	out := make(map[string][]byte, len(vals))
+	for id, v := range vals {
+		out[id] = []byte(v)
+	}
+	logger.Debug("redis.hgetall", slog.Int("count", len(out)), slog.Duration("elapsed", time.Since(start)))
+	return out, nil
+}
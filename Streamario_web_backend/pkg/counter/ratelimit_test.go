@@ -0,0 +1,140 @@
+package counter
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testLimiter: 実装と時計 (Redis 実装はサーバの TIME を使うため miniredis の時刻を合わせる)
+type testLimiter struct {
+	RateLimiter
+	setNow func(time.Time)
+}
+
+func rateLimiters(t *testing.T) map[string]testLimiter {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	return map[string]testLimiter{
+		"memory": {NewMemoryRateLimiter(), func(time.Time) {}},
+		"redis":  {NewRedisRateLimiter(rdb, time.Second, logger), mr.SetTime},
+	}
+}
+
+func TestRateLimiter_TakeRefillsAndGrantsPartially(t *testing.T) {
+	for name, rl := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			limit := BucketLimit{Rate: 2, Burst: 5}
+			now := time.UnixMilli(1_700_000_000_000)
+			take := func(bucket string, cost int64, at time.Time) TakeResult {
+				t.Helper()
+				rl.setNow(at)
+				res, err := rl.Take(context.Background(), "room", []Bucket{{Name: bucket, Limit: limit}}, cost, at)
+				if err != nil {
+					t.Fatalf("Take failed: %v", err)
+				}
+				return res
+			}
+
+			if res := take("viewer:v1", 4, now); res.Granted != 4 || res.RetryAfter != 0 || res.Limited != -1 {
+				t.Fatalf("first take: %+v", res)
+			}
+			// 残り1トークンに対して3要求 → 1だけ許可
+			if res := take("viewer:v1", 3, now); res.Granted != 1 || res.RetryAfter != time.Second || res.Limited != 0 {
+				t.Fatalf("partial take: %+v", res)
+			}
+			// 1.5秒で3トークン補充
+			if res := take("viewer:v1", 3, now.Add(1500*time.Millisecond)); res.Granted != 3 {
+				t.Fatalf("take after refill: %+v", res)
+			}
+			// 別バケットは独立
+			if res := take("viewer:v2", 5, now.Add(1500*time.Millisecond)); res.Granted != 5 {
+				t.Fatalf("independent bucket: %+v", res)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_TakeIsAllOrNothingAcrossBuckets(t *testing.T) {
+	for name, rl := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.UnixMilli(1_700_000_000_000)
+			rl.setNow(now)
+			viewer := Bucket{Name: "viewer:v1", Limit: BucketLimit{Rate: 1, Burst: 10}}
+			room := Bucket{Name: "room", Limit: BucketLimit{Rate: 1, Burst: 2}}
+
+			// ルームのバケットが2しか無ければ、視聴者のバケットからも2だけ取り出す
+			res, err := rl.Take(context.Background(), "room", []Bucket{viewer, room}, 5, now)
+			if err != nil {
+				t.Fatalf("Take failed: %v", err)
+			}
+			if res.Granted != 2 || res.Limited != 1 || res.RetryAfter != 3*time.Second {
+				t.Fatalf("limited take: %+v", res)
+			}
+			// ルームが空でも視聴者のトークンは失われない
+			if res, _ := rl.Take(context.Background(), "room", []Bucket{viewer, room}, 1, now); res.Granted != 0 || res.Limited != 1 {
+				t.Fatalf("empty room bucket: %+v", res)
+			}
+			if res, _ := rl.Take(context.Background(), "room", []Bucket{viewer}, 8, now); res.Granted != 8 {
+				t.Fatalf("viewer bucket should keep 8 tokens: %+v", res)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_PressHistoryAndIPViewers(t *testing.T) {
+	for name, rl := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.UnixMilli(1_700_000_000_000)
+			var times []time.Time
+			for i := 0; i < 5; i++ {
+				var err error
+				times, err = rl.RecordPress(context.Background(), "room", "v1", now.Add(time.Duration(i)*time.Second), 3)
+				if err != nil {
+					t.Fatalf("RecordPress failed: %v", err)
+				}
+			}
+			if len(times) != 3 || !times[0].Equal(now.Add(4*time.Second)) || !times[2].Equal(now.Add(2*time.Second)) {
+				t.Fatalf("unexpected press history: %v", times)
+			}
+
+			rl.TrackIPViewer(context.Background(), "room", "10.0.0.1", "a", time.Minute, now)
+			rl.TrackIPViewer(context.Background(), "room", "10.0.0.1", "b", time.Minute, now.Add(30*time.Second))
+			n, err := rl.TrackIPViewer(context.Background(), "room", "10.0.0.1", "c", time.Minute, now.Add(90*time.Second))
+			if err != nil {
+				t.Fatalf("TrackIPViewer failed: %v", err)
+			}
+			if n != 2 { // "a" は窓外
+				t.Fatalf("distinct viewers = %d, want 2", n)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Flags(t *testing.T) {
+	for name, rl := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			if f, err := rl.GetFlag(context.Background(), "room", "v1"); err != nil || f != nil {
+				t.Fatalf("GetFlag on empty = %q, %v", f, err)
+			}
+			if err := rl.SetFlag(context.Background(), "room", "v1", []byte(`{"reason":"x"}`)); err != nil {
+				t.Fatalf("SetFlag failed: %v", err)
+			}
+			if f, _ := rl.GetFlag(context.Background(), "room", "v1"); string(f) != `{"reason":"x"}` {
+				t.Fatalf("GetFlag = %q", f)
+			}
+			all, err := rl.ListFlags(context.Background(), "room")
+			if err != nil || len(all) != 1 || string(all["v1"]) != `{"reason":"x"}` {
+				t.Fatalf("ListFlags = %v, %v", all, err)
+			}
+		})
+	}
+}
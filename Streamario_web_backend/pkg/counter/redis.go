@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -12,28 +14,35 @@ import (
 // redisCounter: Redis を利用した本番向けカウンタ実装
 // 各コマンドの遅延を計測しログへ記録する。
 type redisCounter struct {
-	rdb    *redis.Client
-	window time.Duration // アクティブ視聴判定窓 (デフォルト5分)
-	logger *slog.Logger
+	rdb     *redis.Client
+	window  time.Duration // アクティブ視聴判定窓 (デフォルト5分)
+	timeout time.Duration // 1操作あたりの期限 (0 なら呼び出し元の ctx のみ)
+	logger  *slog.Logger
 }
 
 // NewRedisCounter: 実装生成 (5分窓)
-func NewRedisCounter(rdb *redis.Client, logger *slog.Logger) Counter {
+// timeout は各メソッドの Redis 操作に掛ける期限 (呼び出し元の ctx の期限が先に来ればそちらが優先)。
+func NewRedisCounter(rdb *redis.Client, timeout time.Duration, logger *slog.Logger) Counter {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &redisCounter{rdb: rdb, window: 5 * time.Minute, logger: logger}
+	return &redisCounter{rdb: rdb, window: 5 * time.Minute, timeout: timeout, logger: logger}
 }
 
 func (rc *redisCounter) keyCount(roomID, eventType string) string {
 	return fmt.Sprintf("room:%s:cnt:%s", roomID, eventType)
 }
+func (rc *redisCounter) keyLevel(roomID, eventType string) string {
+	return fmt.Sprintf("room:%s:lvl:%s", roomID, eventType)
+}
 func (rc *redisCounter) keyViewers(roomID string) string {
 	return fmt.Sprintf("room:%s:viewers", roomID)
 }
 
 // Increment: Redis　IncrByでvalueだけ加算し現在値返却
-func (rc *redisCounter) Increment(roomID, eventType string, value int64) (int64, error) {
+func (rc *redisCounter) Increment(ctx context.Context, roomID, eventType string, value int64) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyCount(roomID, eventType)
 	logger := rc.logger.With(
 		slog.String("op", "increment"),
@@ -42,7 +51,7 @@ func (rc *redisCounter) Increment(roomID, eventType string, value int64) (int64,
 		slog.String("key", key),
 	)
 	start := time.Now()
-	val, err := rc.rdb.IncrBy(context.Background(), key, value).Result()
+	val, err := rc.rdb.IncrBy(ctx, key, value).Result()
 	if err != nil {
 		logger.Error("redis.incr failed", slog.Any("error", err))
 		return 0, err
@@ -52,7 +61,9 @@ func (rc *redisCounter) Increment(roomID, eventType string, value int64) (int64,
 }
 
 // Get: 現在カウント取得 (キー無ければ0)
-func (rc *redisCounter) Get(roomID, eventType string) (int64, error) {
+func (rc *redisCounter) Get(ctx context.Context, roomID, eventType string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyCount(roomID, eventType)
 	logger := rc.logger.With(
 		slog.String("op", "get"),
@@ -61,7 +72,7 @@ func (rc *redisCounter) Get(roomID, eventType string) (int64, error) {
 		slog.String("key", key),
 	)
 	start := time.Now()
-	v, err := rc.rdb.Get(context.Background(), key).Int64()
+	v, err := rc.rdb.Get(ctx, key).Int64()
 	if err == redis.Nil {
 		logger.Debug("redis.get", slog.Bool("hit", false), slog.Duration("elapsed", time.Since(start)))
 		return 0, nil
@@ -74,9 +85,12 @@ func (rc *redisCounter) Get(roomID, eventType string) (int64, error) {
 	return v, nil
 }
 
-// Reset: カウントキー削除
-func (rc *redisCounter) Reset(roomID, eventType string) error {
+// Reset: カウントキー・発動履歴キー削除
+func (rc *redisCounter) Reset(ctx context.Context, roomID, eventType string) error {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyCount(roomID, eventType)
+	levelKey := rc.keyLevel(roomID, eventType)
 	logger := rc.logger.With(
 		slog.String("op", "reset"),
 		slog.String("room_id", roomID),
@@ -84,7 +98,7 @@ func (rc *redisCounter) Reset(roomID, eventType string) error {
 		slog.String("key", key),
 	)
 	start := time.Now()
-	if err := rc.rdb.Del(context.Background(), key).Err(); err != nil {
+	if err := rc.rdb.Del(ctx, key, levelKey).Err(); err != nil {
 		logger.Warn("redis.del failed", slog.Any("error", err))
 		return err
 	}
@@ -93,7 +107,9 @@ func (rc *redisCounter) Reset(roomID, eventType string) error {
 }
 
 // SetExcess: 閾値超過分をカウントに設定（超過分を捨てない）
-func (rc *redisCounter) SetExcess(roomID, eventType string, excess int64) error {
+func (rc *redisCounter) SetExcess(ctx context.Context, roomID, eventType string, excess int64) error {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyCount(roomID, eventType)
 	logger := rc.logger.With(
 		slog.String("op", "set_excess"),
@@ -103,7 +119,7 @@ func (rc *redisCounter) SetExcess(roomID, eventType string, excess int64) error
 		slog.Int64("excess", excess),
 	)
 	start := time.Now()
-	if err := rc.rdb.Set(context.Background(), key, excess, 0).Err(); err != nil {
+	if err := rc.rdb.Set(ctx, key, excess, 0).Err(); err != nil {
 		logger.Error("redis.set failed", slog.Any("error", err))
 		return err
 	}
@@ -111,8 +127,100 @@ func (rc *redisCounter) SetExcess(roomID, eventType string, excess int64) error
 	return nil
 }
 
+// incrementAndTriggerScript: 発動回数の照合・加算・閾値判定・超過分設定・発動履歴更新を1回の往復で原子的に実行
+// KEYS[1]=カウントキー, KEYS[2]=発動履歴キー, ARGV[1]=加算値, ARGV[2]=閾値, ARGV[3]=発動時刻(ms), ARGV[4]=発動後のレベル, ARGV[5]=想定する発動回数
+// 戻り値: {加算直後のカウント, 発動(1/0), 残りカウント, 発動回数, 最終発動時刻(ms), 発動後のレベル}
+// 発動回数が ARGV[5] と異なる場合は加算せず、発動欄を -1 にして返す。
+var incrementAndTriggerScript = redis.NewScript(`
+local st = redis.call('HMGET', KEYS[2], 'count', 'last', 'level')
+local n = tonumber(st[1]) or 0
+if n ~= tonumber(ARGV[5]) then
+  return {0, -1, 0, n, 0, 0}
+end
+local cur = redis.call('INCRBY', KEYS[1], ARGV[1])
+local threshold = tonumber(ARGV[2])
+if threshold > 0 and cur >= threshold then
+  local rem = cur - threshold
+  redis.call('SET', KEYS[1], rem)
+  n = redis.call('HINCRBY', KEYS[2], 'count', 1)
+  redis.call('HSET', KEYS[2], 'last', ARGV[3], 'level', ARGV[4])
+  return {cur, 1, rem, n, tonumber(ARGV[3]), tonumber(ARGV[4])}
+end
+return {cur, 0, cur, n, tonumber(st[2]) or 0, tonumber(st[3]) or 0}
+`)
+
+// IncrementAndTrigger: Lua スクリプトで発動回数の照合と加算・発動判定を原子的に実行
+func (rc *redisCounter) IncrementAndTrigger(ctx context.Context, roomID, eventType string, delta, threshold, nextLevel, expectedTriggers int64) (TriggerResult, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
+	key := rc.keyCount(roomID, eventType)
+	levelKey := rc.keyLevel(roomID, eventType)
+	logger := rc.logger.With(
+		slog.String("op", "increment_and_trigger"),
+		slog.String("room_id", roomID),
+		slog.String("event_type", eventType),
+		slog.String("key", key),
+		slog.Int64("threshold", threshold),
+	)
+	start := time.Now()
+	vals, err := incrementAndTriggerScript.Run(ctx, rc.rdb, []string{key, levelKey}, delta, threshold, start.UnixMilli(), nextLevel, expectedTriggers).Int64Slice()
+	if err != nil {
+		logger.Error("redis.evalsha failed", slog.Any("error", err))
+		return TriggerResult{}, err
+	}
+	if len(vals) != 6 {
+		logger.Error("redis.evalsha unexpected reply", slog.Int("len", len(vals)))
+		return TriggerResult{}, fmt.Errorf("unexpected script reply length: %d", len(vals))
+	}
+	if vals[1] < 0 {
+		logger.Debug("redis.evalsha", slog.Bool("trigger_state_changed", true), slog.Int64("expected_triggers", expectedTriggers), slog.Int64("triggers", vals[3]), slog.Duration("elapsed", time.Since(start)))
+		return TriggerResult{}, ErrTriggerStateChanged
+	}
+	res := TriggerResult{Count: vals[0], Triggered: vals[1] == 1, Remaining: vals[2], Trigger: TriggerState{Count: vals[3], Level: vals[5]}}
+	if vals[4] > 0 {
+		res.Trigger.LastTriggeredAt = time.UnixMilli(vals[4])
+	}
+	logger.Debug("redis.evalsha", slog.Int64("value", res.Count), slog.Bool("triggered", res.Triggered), slog.Duration("elapsed", time.Since(start)))
+	return res, nil
+}
+
+// GetTriggerState: HASH から発動履歴を取得 (キー無ければゼロ値)
+func (rc *redisCounter) GetTriggerState(ctx context.Context, roomID, eventType string) (TriggerState, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
+	key := rc.keyLevel(roomID, eventType)
+	logger := rc.logger.With(
+		slog.String("op", "get_trigger_state"),
+		slog.String("room_id", roomID),
+		slog.String("event_type", eventType),
+		slog.String("key", key),
+	)
+	start := time.Now()
+	vals, err := rc.rdb.HMGet(ctx, key, "count", "last", "level").Result()
+	if err != nil {
+		logger.Error("redis.hmget failed", slog.Any("error", err))
+		return TriggerState{}, err
+	}
+	var st TriggerState
+	if s, ok := vals[0].(string); ok {
+		st.Count, _ = strconv.ParseInt(s, 10, 64)
+	}
+	if s, ok := vals[1].(string); ok {
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			st.LastTriggeredAt = time.UnixMilli(ms)
+		}
+	}
+	if s, ok := vals[2].(string); ok {
+		st.Level, _ = strconv.ParseInt(s, 10, 64)
+	}
+	logger.Debug("redis.hmget", slog.Int64("count", st.Count), slog.Duration("elapsed", time.Since(start)))
+	return st, nil
+}
+
 // UpdateViewerActivity: ZSET に時刻をスコアとして追加し古い視聴者をクリーン
-func (rc *redisCounter) UpdateViewerActivity(roomID, viewerID string) error {
+func (rc *redisCounter) UpdateViewerActivity(ctx context.Context, roomID, viewerID string) error {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyViewers(roomID)
 	logger := rc.logger.With(
 		slog.String("op", "update_viewer_activity"),
@@ -120,8 +228,6 @@ func (rc *redisCounter) UpdateViewerActivity(roomID, viewerID string) error {
 		slog.String("viewer_id", viewerID),
 		slog.String("key", key),
 	)
-	ctx := context.Background()
-
 	start := time.Now()
 	if err := rc.rdb.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: viewerID}).Err(); err != nil {
 		logger.Error("redis.zadd failed", slog.Any("error", err))
@@ -140,7 +246,9 @@ func (rc *redisCounter) UpdateViewerActivity(roomID, viewerID string) error {
 }
 
 // GetActiveViewerCount: ZSET から窓内の要素数をカウント
-func (rc *redisCounter) GetActiveViewerCount(roomID string) (int64, error) {
+func (rc *redisCounter) GetActiveViewerCount(ctx context.Context, roomID string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
 	key := rc.keyViewers(roomID)
 	logger := rc.logger.With(
 		slog.String("op", "get_active_viewer_count"),
@@ -148,7 +256,6 @@ func (rc *redisCounter) GetActiveViewerCount(roomID string) (int64, error) {
 		slog.String("key", key),
 	)
 	cutoff := time.Now().Add(-rc.window).Unix()
-	ctx := context.Background()
 	start := time.Now()
 	count, err := rc.rdb.ZCount(ctx, key, fmt.Sprintf("%f", float64(cutoff)), "+inf").Result()
 	if err != nil {
@@ -158,3 +265,54 @@ func (rc *redisCounter) GetActiveViewerCount(roomID string) (int64, error) {
 	logger.Debug("redis.zcount", slog.Int64("count", count), slog.Duration("elapsed", time.Since(start)), slog.Int64("cutoff", cutoff))
 	return count, nil
 }
+
+// PurgeRoom: SCAN で room:<id>:* に一致するキーを列挙し UNLINK で削除
+func (rc *redisCounter) PurgeRoom(ctx context.Context, roomID string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rc.timeout)
+	defer cancel()
+	pattern := fmt.Sprintf("room:%s:*", escapeGlob(roomID))
+	logger := rc.logger.With(
+		slog.String("op", "purge_room"),
+		slog.String("room_id", roomID),
+		slog.String("pattern", pattern),
+	)
+	start := time.Now()
+	var (
+		cursor  uint64
+		deleted int64
+	)
+	for {
+		keys, next, err := rc.rdb.Scan(ctx, cursor, pattern, 100).Result()
+		if err != nil {
+			logger.Error("redis.scan failed", slog.Any("error", err))
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			n, err := rc.rdb.Unlink(ctx, keys...).Result()
+			if err != nil {
+				logger.Error("redis.unlink failed", slog.Any("error", err))
+				return deleted, err
+			}
+			deleted += n
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	logger.Debug("redis.unlink", slog.Int64("deleted", deleted), slog.Duration("elapsed", time.Since(start)))
+	return deleted, nil
+}
+
+// withTimeout: 1操作分の期限を ctx に設定 (timeout <= 0 なら ctx のまま)
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// escapeGlob: SCAN MATCH のグロブ特殊文字をエスケープ
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
@@ -0,0 +1,81 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisCounter(t *testing.T) Counter {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), PoolSize: 64})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewRedisCounter(rdb, time.Second, logger)
+}
+
+func TestRedisCounter_IncrementAndTrigger(t *testing.T) {
+	c := newTestRedisCounter(t)
+
+	res, err := c.IncrementAndTrigger(context.Background(), "room", "skill1", 4, 5, 2, 0)
+	if err != nil {
+		t.Fatalf("IncrementAndTrigger failed: %v", err)
+	}
+	if res.Triggered || res.Remaining != 4 || res.Trigger.Count != 0 {
+		t.Fatalf("unexpected result before threshold: %+v", res)
+	}
+
+	res, err = c.IncrementAndTrigger(context.Background(), "room", "skill1", 3, 5, 2, 0)
+	if err != nil {
+		t.Fatalf("IncrementAndTrigger failed: %v", err)
+	}
+	if !res.Triggered || res.Count != 7 || res.Remaining != 2 || res.Trigger.Count != 1 {
+		t.Fatalf("unexpected result at threshold: %+v", res)
+	}
+
+	state, err := c.GetTriggerState(context.Background(), "room", "skill1")
+	if err != nil {
+		t.Fatalf("GetTriggerState failed: %v", err)
+	}
+	if state.Count != 1 || state.Level != 2 || !state.LastTriggeredAt.Equal(res.Trigger.LastTriggeredAt) {
+		t.Errorf("trigger state mismatch: got %+v, want %+v", state, res.Trigger)
+	}
+
+	// 発動前の履歴を前提にした加算は適用しない
+	if _, err := c.IncrementAndTrigger(context.Background(), "room", "skill1", 1, 5, 2, 0); !errors.Is(err, ErrTriggerStateChanged) {
+		t.Fatalf("stale trigger count: err = %v, want ErrTriggerStateChanged", err)
+	}
+	if n, _ := c.Get(context.Background(), "room", "skill1"); n != 2 {
+		t.Fatalf("stale increment applied: count = %d, want 2", n)
+	}
+}
+
+func TestRedisCounter_IncrementAndTriggerConcurrent(t *testing.T) {
+	c := newTestRedisCounter(t)
+	const (
+		workers   = 32
+		perWorker = 100
+		threshold = 9
+	)
+	triggered := hammer(t, c, "room", "enemy3", workers, perWorker, threshold)
+	assertNoLostOrDoubledTriggers(t, c, "room", "enemy3", workers*perWorker, threshold, triggered)
+}
+
+func TestRedisCounter_CancelledContext(t *testing.T) {
+	c := newTestRedisCounter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.IncrementAndTrigger(ctx, "room", "skill1", 1, 5, 2, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("IncrementAndTrigger with cancelled ctx: err = %v, want context.Canceled", err)
+	}
+	if n, err := c.Get(context.Background(), "room", "skill1"); err != nil || n != 0 {
+		t.Fatalf("cancelled increment should not be applied: n=%d err=%v", n, err)
+	}
+}
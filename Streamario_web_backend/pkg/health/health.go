@@ -0,0 +1,136 @@
+// Package health: 依存先の確認を並行に実行し、構造化したレポートにまとめる
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"streamerrio-backend/pkg/buildinfo"
+)
+
+// レポート / 確認結果の状態
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc: 確認1件分。付加情報 (接続数など) と失敗理由を返す
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// Result: 確認1件分の結果
+type Result struct {
+	Status    string                 `json:"status"`
+	ElapsedMS float64                `json:"elapsed_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report: 全確認の結果 (1件でも失敗なら status=fail)
+type Report struct {
+	Status        string            `json:"status"`
+	Service       string            `json:"service"`
+	Version       string            `json:"version"`
+	Build         buildinfo.Info    `json:"build"`
+	UptimeSeconds int64             `json:"uptime_s"`
+	Checks        map[string]Result `json:"checks"`
+}
+
+// OK: 全確認が成功したか
+func (r Report) OK() bool { return r.Status == StatusOK }
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker: 確認の集合。各確認は timeout で打ち切る
+type Checker struct {
+	service string
+	timeout time.Duration
+	started time.Time
+	mu      sync.RWMutex
+	checks  []namedCheck
+}
+
+// NewChecker: service はレポートに載せるサービス名
+func NewChecker(service string, timeout time.Duration) *Checker {
+	return &Checker{service: service, timeout: timeout, started: time.Now()}
+}
+
+// Add: 確認を追加
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, fn: fn})
+}
+
+// Run: 全確認を並行に実行してレポートを返す
+// ctx を無視して戻らない確認も timeout で失敗扱いにする (その goroutine は戻るまで残る)。
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	build := buildinfo.Get()
+	report := Report{
+		Status:        StatusOK,
+		Service:       c.service,
+		Version:       build.Version,
+		Build:         build,
+		UptimeSeconds: int64(time.Since(c.started).Seconds()),
+		Checks:        make(map[string]Result, len(checks)),
+	}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			results[i] = c.runOne(ctx, check.fn)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for i, check := range checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) runOne(ctx context.Context, fn CheckFunc) Result {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := fn(ctx)
+		done <- outcome{details: details, err: err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+	res := Result{
+		Status:    StatusOK,
+		ElapsedMS: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   out.details,
+	}
+	if out.err != nil {
+		res.Status = StatusFail
+		res.Error = out.err.Error()
+	}
+	return res
+}
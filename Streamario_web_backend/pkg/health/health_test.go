@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerReport(t *testing.T) {
+	c := NewChecker("streamerrio", 50*time.Millisecond)
+	c.Add("ok", func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"connections": 3}, nil
+	})
+	report := c.Run(context.Background())
+	if !report.OK() || report.Service != "streamerrio" || report.Version == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if got := report.Checks["ok"].Details["connections"]; got != 3 {
+		t.Fatalf("details not propagated: %v", got)
+	}
+
+	c.Add("down", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	report = c.Run(context.Background())
+	if report.OK() || report.Checks["down"].Status != StatusFail || report.Checks["down"].Error != "connection refused" {
+		t.Fatalf("failed check should fail the report: %+v", report)
+	}
+	if report.Checks["ok"].Status != StatusOK {
+		t.Fatalf("other checks should still pass: %+v", report.Checks["ok"])
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	c := NewChecker("streamerrio", 50*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	// ctx を無視して戻らない確認
+	c.Add("hung", func(ctx context.Context) (map[string]interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	start := time.Now()
+	report := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("run should be bounded by the timeout, took %s", elapsed)
+	}
+	if report.OK() || report.Checks["hung"].Status != StatusFail {
+		t.Fatalf("hung check should fail: %+v", report.Checks["hung"])
+	}
+}
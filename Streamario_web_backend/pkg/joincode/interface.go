@@ -0,0 +1,66 @@
+package joincode
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Alphabet: 参加コードに使う文字 (配信画面から読み写しやすいよう 0/O, 1/I/L を除く)
+const Alphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// Length: 参加コードの文字数 (31^6 ≒ 8.9億通り)
+const Length = 6
+
+// maxAttempts: 衝突時に別のコードで再試行する回数
+const maxAttempts = 8
+
+// ErrExhausted: 再試行しても空きコードを確保できなかった
+var ErrExhausted = errors.New("join code space exhausted")
+
+// Store: 短い参加コード ⇔ ルーム ID の対応を保持する共有ストア
+// コードはルームの期限 (ttl) と同時に失効し、失効後は別のルームに再利用されうる。
+type Store interface {
+	// Reserve: ルームの参加コードを確保 (既に確保済みならそのコードを返す)
+	Reserve(ctx context.Context, roomID string, ttl time.Duration) (string, error)
+
+	// Resolve: 参加コードからルーム ID を引く (不明/失効済みなら ok=false)
+	Resolve(ctx context.Context, code string) (roomID string, ok bool, err error)
+
+	// Release: ルームの参加コードを期限前に解放 (回収済みルーム向け / 未確保なら何もしない)
+	Release(ctx context.Context, roomID string) error
+}
+
+// Generate: ランダムな参加コードを生成
+func Generate() (string, error) {
+	b := make([]byte, Length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// 256 は 31 で割り切れないため僅かに偏るが、推測困難性は要件外 (衝突確認で十分)
+	for i := range b {
+		b[i] = Alphabet[int(b[i])%len(Alphabet)]
+	}
+	return string(b), nil
+}
+
+// Normalize: 入力揺れ (小文字/空白/ハイフン) を吸収して正規形に変換
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Valid: 正規形の参加コードとして妥当か (ストアを引く前の門前払い用)
+func Valid(code string) bool {
+	if len(code) != Length {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(Alphabet, code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package joincode
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// sequence: 決められた順にコードを返す生成関数 (衝突の再現用)
+func sequence(codes ...string) func() (string, error) {
+	return func() (string, error) {
+		c := codes[0]
+		if len(codes) > 1 {
+			codes = codes[1:]
+		}
+		return c, nil
+	}
+}
+
+func TestStore_ReserveAndResolve(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	mem := NewMemoryStore().(*memoryStore)
+	mem.generate = sequence("ABC234", "ABC234", "XYZ789")
+	red := NewRedisStore(rdb, logger).(*redisStore)
+	red.generate = sequence("ABC234", "ABC234", "XYZ789")
+
+	for name, s := range map[string]Store{"memory": mem, "redis": red} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			code, err := s.Reserve(ctx, "room-1", time.Hour)
+			if err != nil || code != "ABC234" {
+				t.Fatalf("Reserve = %q, %v", code, err)
+			}
+			if again, _ := s.Reserve(ctx, "room-1", time.Hour); again != code {
+				t.Fatalf("Reserve not idempotent: %q != %q", again, code)
+			}
+			// 2件目は1回目の候補が衝突し、次の候補で確保される
+			other, err := s.Reserve(ctx, "room-2", time.Hour)
+			if err != nil || other != "XYZ789" {
+				t.Fatalf("collision not retried: %q, %v", other, err)
+			}
+			if id, ok, err := s.Resolve(ctx, " abc-234 "); err != nil || !ok || id != "room-1" {
+				t.Fatalf("Resolve = %q, %v, %v", id, ok, err)
+			}
+			if _, ok, _ := s.Resolve(ctx, "ZZZZZZ"); ok {
+				t.Fatalf("unknown code resolved")
+			}
+			if err := s.Release(ctx, "room-2"); err != nil {
+				t.Fatalf("Release failed: %v", err)
+			}
+			if _, ok, _ := s.Resolve(ctx, "XYZ789"); ok {
+				t.Fatalf("released code still resolves")
+			}
+			if err := s.Release(ctx, "room-unknown"); err != nil {
+				t.Fatalf("Release of unknown room failed: %v", err)
+			}
+		})
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if _, ok, _ := red.Resolve(context.Background(), "ABC234"); ok {
+		t.Fatalf("code did not expire with the room")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := Generate()
+		if err != nil || len(code) != Length {
+			t.Fatalf("Generate = %q, %v", code, err)
+		}
+		if !Valid(code) {
+			t.Fatalf("generated invalid code %q", code)
+		}
+	}
+	for _, bad := range []string{"", "ABC23", "ABC2345", "ABC0O1", "abc234"} {
+		if Valid(bad) {
+			t.Fatalf("Valid(%q) = true", bad)
+		}
+	}
+	if got := Normalize(" k7q-m3x "); got != "K7QM3X" || !Valid(got) {
+		t.Fatalf("Normalize = %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package joincode
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	roomID    string
+	expiresAt time.Time
+}
+
+// memoryStore: テスト/単一インスタンス用のインメモリ実装
+type memoryStore struct {
+	mu       sync.Mutex
+	codes    map[string]memoryEntry // code -> entry
+	rooms    map[string]string      // roomID -> code
+	now      func() time.Time
+	generate func() (string, error)
+}
+
+// NewMemoryStore: インメモリ実装を生成
+func NewMemoryStore() Store {
+	return &memoryStore{codes: make(map[string]memoryEntry), rooms: make(map[string]string), now: time.Now, generate: Generate}
+}
+
+// Reserve: 保存のついでに期限切れのコードを掃除
+func (m *memoryStore) Reserve(ctx context.Context, roomID string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for code, e := range m.codes {
+		if !now.Before(e.expiresAt) {
+			delete(m.codes, code)
+			delete(m.rooms, e.roomID)
+		}
+	}
+	if code, ok := m.rooms[roomID]; ok {
+		return code, nil
+	}
+	for i := 0; i < maxAttempts; i++ {
+		code, err := m.generate()
+		if err != nil {
+			return "", err
+		}
+		if _, taken := m.codes[code]; taken {
+			continue
+		}
+		m.codes[code] = memoryEntry{roomID: roomID, expiresAt: now.Add(ttl)}
+		m.rooms[roomID] = code
+		return code, nil
+	}
+	return "", ErrExhausted
+}
+
+// Resolve: 期限切れは不明扱い
+func (m *memoryStore) Resolve(ctx context.Context, code string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.codes[Normalize(code)]
+	if !ok || !m.now().Before(e.expiresAt) {
+		return "", false, nil
+	}
+	return e.roomID, true, nil
+}
+
+// Release: 両方向の対応を削除
+func (m *memoryStore) Release(ctx context.Context, roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if code, ok := m.rooms[roomID]; ok {
+		delete(m.codes, code)
+		delete(m.rooms, roomID)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package joincode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	codeKeyPrefix = "join:code:" // join:code:<code> -> roomID
+	roomKeyPrefix = "join:room:" // join:room:<roomID> -> code
+)
+
+// releaseScript: ルーム側のキーを消し、コード側のキーがまだ同じルームを指している場合のみ消す
+// (期限切れ後に別ルームへ再利用されたコードを誤って消さないため)
+var releaseScript = redis.NewScript(`
+local code = redis.call("GET", KEYS[1])
+if not code then
+  return 0
+end
+redis.call("DEL", KEYS[1])
+local key = ARGV[2] .. code
+if redis.call("GET", key) == ARGV[1] then
+  redis.call("DEL", key)
+end
+return 1
+`)
+
+// redisStore: Redis を利用した本番向け実装
+// コード側のキーを SET NX で確保して衝突を検出し、両方向のキーにルームの残り期限を TTL として付ける。
+type redisStore struct {
+	rdb      *redis.Client
+	logger   *slog.Logger
+	generate func() (string, error)
+}
+
+// NewRedisStore: Redis 実装を生成
+func NewRedisStore(rdb *redis.Client, logger *slog.Logger) Store {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &redisStore{rdb: rdb, logger: logger, generate: Generate}
+}
+
+// Reserve: 既存コードを優先し、無ければ衝突しないコードを確保
+// 同じルームを複数インスタンスが同時に確保した場合は、ルーム側のキーを先に取った方のコードに揃える。
+func (r *redisStore) Reserve(ctx context.Context, roomID string, ttl time.Duration) (string, error) {
+	logger := r.logger.With(
+		slog.String("op", "reserve"),
+		slog.String("room_id", roomID),
+	)
+	start := time.Now()
+	roomKey := roomKeyPrefix + roomID
+	if code, err := r.rdb.Get(ctx, roomKey).Result(); err == nil {
+		logger.Debug("redis.get", slog.Bool("hit", true), slog.String("code", code), slog.Duration("elapsed", time.Since(start)))
+		return code, nil
+	} else if !errors.Is(err, redis.Nil) {
+		logger.Error("redis.get failed", slog.Any("error", err))
+		return "", fmt.Errorf("lookup join code failed: %w", err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		code, err := r.generate()
+		if err != nil {
+			return "", err
+		}
+		ok, err := r.rdb.SetNX(ctx, codeKeyPrefix+code, roomID, ttl).Result()
+		if err != nil {
+			logger.Error("redis.setnx failed", slog.Any("error", err))
+			return "", fmt.Errorf("reserve join code failed: %w", err)
+		}
+		if !ok {
+			logger.Debug("join code collision", slog.String("code", code), slog.Int("attempt", attempt))
+			continue
+		}
+		won, err := r.rdb.SetNX(ctx, roomKey, code, ttl).Result()
+		if err != nil {
+			logger.Error("redis.setnx failed", slog.Any("error", err))
+			return "", fmt.Errorf("reserve join code failed: %w", err)
+		}
+		if !won {
+			// 他インスタンスが先に確保した: 自分のコードを返却して相手のコードを使う
+			r.rdb.Del(ctx, codeKeyPrefix+code)
+			existing, err := r.rdb.Get(ctx, roomKey).Result()
+			if err != nil {
+				logger.Error("redis.get failed", slog.Any("error", err))
+				return "", fmt.Errorf("lookup join code failed: %w", err)
+			}
+			return existing, nil
+		}
+		logger.Debug("redis.setnx", slog.String("code", code), slog.Int("attempt", attempt), slog.Duration("elapsed", time.Since(start)))
+		return code, nil
+	}
+	logger.Warn("join code attempts exhausted", slog.Int("attempts", maxAttempts))
+	return "", ErrExhausted
+}
+
+// Resolve: コード側のキーを引く
+func (r *redisStore) Resolve(ctx context.Context, code string) (string, bool, error) {
+	logger := r.logger.With(slog.String("op", "resolve"))
+	start := time.Now()
+	roomID, err := r.rdb.Get(ctx, codeKeyPrefix+Normalize(code)).Result()
+	if errors.Is(err, redis.Nil) {
+		logger.Debug("redis.get", slog.Bool("hit", false), slog.Duration("elapsed", time.Since(start)))
+		return "", false, nil
+	}
+	if err != nil {
+		logger.Error("redis.get failed", slog.Any("error", err))
+		return "", false, fmt.Errorf("resolve join code failed: %w", err)
+	}
+	logger.Debug("redis.get", slog.Bool("hit", true), slog.String("room_id", roomID), slog.Duration("elapsed", time.Since(start)))
+	return roomID, true, nil
+}
+
+// Release: releaseScript で両方向のキーを削除
+func (r *redisStore) Release(ctx context.Context, roomID string) error {
+	logger := r.logger.With(
+		slog.String("op", "release"),
+		slog.String("room_id", roomID),
+	)
+	start := time.Now()
+	n, err := releaseScript.Run(ctx, r.rdb, []string{roomKeyPrefix + roomID}, roomID, codeKeyPrefix).Int()
+	if err != nil {
+		logger.Error("redis.eval failed", slog.Any("error", err))
+		return fmt.Errorf("release join code failed: %w", err)
+	}
+	logger.Debug("redis.eval", slog.Bool("released", n == 1), slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package metrics: Prometheus 形式のアプリケーションメトリクス
+// レジストリはインスタンスごとに持ち (グローバルの DefaultRegisterer は使わない)、テストは New() したものに対して値を検証できる。
+// 各記録メソッドは nil の *Metrics に対しては何もしないため、未設定のコンポーネントでもそのまま呼べる。
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace: 全メトリクス名の接頭辞
+const namespace = "streamerrio"
+
+// 配信の破棄先 (DeliveryDropped の target)
+const (
+	TargetUnity  = "unity"
+	TargetViewer = "viewer"
+)
+
+// latencyBuckets: DB / Redis / Pub/Sub 共通の遅延バケット (0.5ms〜5s)
+var latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Metrics: メトリクス一式とそれを登録したレジストリ
+type Metrics struct {
+	registry *prometheus.Registry
+
+	dbQueryDuration       *prometheus.HistogramVec // repo, op
+	redisCommandDuration  *prometheus.HistogramVec // command
+	pubsubPublishDuration *prometheus.HistogramVec // channel
+	pubsubHandleDuration  *prometheus.HistogramVec // channel
+	pressesTotal          *prometheus.CounterVec   // event_type
+	triggersTotal         *prometheus.CounterVec   // event_type
+	deliveriesDropped     *prometheus.CounterVec   // target, reason
+	unityConnections      prometheus.Gauge
+	roomViewers           *prometheus.GaugeVec // room_id
+	eventQueueDepth       prometheus.Gauge
+	eventFlushDuration    *prometheus.HistogramVec // result
+	eventsDropped         prometheus.Counter
+}
+
+// New: 新しいレジストリにメトリクス一式 (Go ランタイム / プロセスの標準メトリクスを含む) を登録して生成
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "db_query_duration_seconds",
+			Help:    "Latency of database queries by repository and operation.",
+			Buckets: latencyBuckets,
+		}, []string{"repo", "op"}),
+		redisCommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "redis_command_duration_seconds",
+			Help:    "Latency of Redis commands (pipelines are reported as \"pipeline\").",
+			Buckets: latencyBuckets,
+		}, []string{"command"}),
+		pubsubPublishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "pubsub_publish_duration_seconds",
+			Help:    "Latency of pub/sub publishes by channel.",
+			Buckets: latencyBuckets,
+		}, []string{"channel"}),
+		pubsubHandleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "pubsub_handle_duration_seconds",
+			Help:    "Time spent handling a received pub/sub message by channel.",
+			Buckets: latencyBuckets,
+		}, []string{"channel"}),
+		pressesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "presses_total",
+			Help: "Button presses counted toward thresholds by event type.",
+		}, []string{"event_type"}),
+		triggersTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "triggers_total",
+			Help: "Effects fired after reaching a threshold by event type.",
+		}, []string{"event_type"}),
+		deliveriesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "deliveries_dropped_total",
+			Help: "Messages dropped before reaching Unity or a viewer stream.",
+		}, []string{"target", "reason"}),
+		unityConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "unity_connections",
+			Help: "Unity WebSocket connections held by this instance.",
+		}),
+		roomViewers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "room_viewers",
+			Help: "Viewer live streams connected to this instance by room.",
+		}, []string{"room_id"}),
+		eventQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "event_write_queue_depth",
+			Help: "Press events buffered in memory waiting to be written to the database.",
+		}),
+		eventFlushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "event_flush_duration_seconds",
+			Help:    "Latency of writing one buffered batch of press events, by result (ok / error).",
+			Buckets: latencyBuckets,
+		}, []string{"result"}),
+		eventsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "events_dropped_total",
+			Help: "Buffered press events discarded after exhausting write retries.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.dbQueryDuration,
+		m.redisCommandDuration,
+		m.pubsubPublishDuration,
+		m.pubsubHandleDuration,
+		m.pressesTotal,
+		m.triggersTotal,
+		m.deliveriesDropped,
+		m.unityConnections,
+		m.roomViewers,
+		m.eventQueueDepth,
+		m.eventFlushDuration,
+		m.eventsDropped,
+	)
+	return m
+}
+
+// Registry: メトリクスを登録したレジストリ (テストでの検証 / 追加の登録用)
+func (m *Metrics) Registry() *prometheus.Registry { return m.registry }
+
+// Handler: /metrics 用の HTTP ハンドラ (Prometheus テキスト形式)
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveDB: クエリ1回分の遅延 (start からの経過) を記録。defer で呼び、エラー終了も含めて計測する
+func (m *Metrics) ObserveDB(repo, op string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.dbQueryDuration.WithLabelValues(repo, op).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRedis: Redis コマンド1回分の遅延を記録
+func (m *Metrics) ObserveRedis(command string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.redisCommandDuration.WithLabelValues(command).Observe(elapsed.Seconds())
+}
+
+// ObservePublish: Pub/Sub 発行1回分の遅延を記録
+func (m *Metrics) ObservePublish(channel string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.pubsubPublishDuration.WithLabelValues(channel).Observe(elapsed.Seconds())
+}
+
+// ObserveHandle: 受信メッセージ1件の処理時間を記録
+func (m *Metrics) ObserveHandle(channel string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.pubsubHandleDuration.WithLabelValues(channel).Observe(elapsed.Seconds())
+}
+
+// Presses: 閾値へ加算した押下数を記録
+func (m *Metrics) Presses(eventType string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.pressesTotal.WithLabelValues(eventType).Add(float64(n))
+}
+
+// TriggerFired: 発動1回を記録
+func (m *Metrics) TriggerFired(eventType string) {
+	if m == nil {
+		return
+	}
+	m.triggersTotal.WithLabelValues(eventType).Inc()
+}
+
+// DeliveryDropped: 届けられずに破棄したメッセージを記録 (target は TargetUnity / TargetViewer)
+func (m *Metrics) DeliveryDropped(target, reason string) {
+	if m == nil {
+		return
+	}
+	m.deliveriesDropped.WithLabelValues(target, reason).Inc()
+}
+
+// SetUnityConnections: このインスタンスの Unity 接続数
+func (m *Metrics) SetUnityConnections(n int) {
+	if m == nil {
+		return
+	}
+	m.unityConnections.Set(float64(n))
+}
+
+// SetRoomViewers: ルームの視聴者ストリーム数 (0 ならラベルごと削除し、終わったルームを残さない)
+func (m *Metrics) SetRoomViewers(roomID string, n int) {
+	if m == nil {
+		return
+	}
+	if n <= 0 {
+		m.roomViewers.DeleteLabelValues(roomID)
+		return
+	}
+	m.roomViewers.WithLabelValues(roomID).Set(float64(n))
+}
+
+// SetEventQueueDepth: 書き込み待ちの押下イベント数
+func (m *Metrics) SetEventQueueDepth(n int) {
+	if m == nil {
+		return
+	}
+	m.eventQueueDepth.Set(float64(n))
+}
+
+// ObserveEventFlush: 押下イベント1バッチの書き込み遅延 (start からの経過) を記録。再試行は1回ずつ記録する
+func (m *Metrics) ObserveEventFlush(err error, start time.Time) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.eventFlushDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// EventsDropped: 再試行を使い切って破棄した押下イベント数を記録
+func (m *Metrics) EventsDropped(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.eventsDropped.Add(float64(n))
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var m *Metrics
+	m.ObserveDB("event", "create_event", time.Now())
+	m.Presses("skill1", 3)
+	m.TriggerFired("skill1")
+	m.DeliveryDropped(TargetUnity, "send_queue_full")
+	m.SetUnityConnections(1)
+	m.SetRoomViewers("room-a", 2)
+	m.SetEventQueueDepth(3)
+	m.ObserveEventFlush(nil, time.Now())
+	m.EventsDropped(2)
+}
+
+func TestMetricsRecord(t *testing.T) {
+	m := New()
+	m.Presses("skill1", 3)
+	m.Presses("skill1", 2)
+	m.TriggerFired("skill1")
+	m.DeliveryDropped(TargetViewer, "buffer_full")
+	m.SetUnityConnections(4)
+	m.SetRoomViewers("room-a", 2)
+	m.SetRoomViewers("room-b", 1)
+	m.SetRoomViewers("room-b", 0)
+	m.ObserveDB("event", "create_events_batch", time.Now().Add(-10*time.Millisecond))
+
+	if got := testutil.ToFloat64(m.pressesTotal.WithLabelValues("skill1")); got != 5 {
+		t.Fatalf("presses_total = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(m.triggersTotal.WithLabelValues("skill1")); got != 1 {
+		t.Fatalf("triggers_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.deliveriesDropped.WithLabelValues(TargetViewer, "buffer_full")); got != 1 {
+		t.Fatalf("deliveries_dropped_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.unityConnections); got != 4 {
+		t.Fatalf("unity_connections = %v, want 4", got)
+	}
+	// 視聴者が0になったルームはラベルごと消える
+	if got := testutil.CollectAndCount(m.roomViewers); got != 1 {
+		t.Fatalf("room_viewers series = %d, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.dbQueryDuration); got != 1 {
+		t.Fatalf("db_query_duration series = %d, want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`streamerrio_presses_total{event_type="skill1"} 5`,
+		`streamerrio_room_viewers{room_id="room-a"} 2`,
+		`streamerrio_db_query_duration_seconds_count{op="create_events_batch",repo="event"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
+
+func TestRedisHook(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	m := New()
+	rdb.AddHook(m.RedisHook())
+
+	ctx := context.Background()
+	if err := rdb.IncrBy(ctx, "k", 2).Err(); err != nil {
+		t.Fatalf("incrby: %v", err)
+	}
+	pipe := rdb.Pipeline()
+	pipe.Get(ctx, "k")
+	pipe.Del(ctx, "k")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+
+	if n := testutil.CollectAndCount(m.redisCommandDuration); n < 2 {
+		t.Fatalf("expected incrby and pipeline series, got %d", n)
+	}
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`streamerrio_redis_command_duration_seconds_count{command="incrby"} 1`,
+		// 接続初期化 (HELLO など) もパイプラインで送られるため件数は問わない
+		`streamerrio_redis_command_duration_seconds_count{command="pipeline"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
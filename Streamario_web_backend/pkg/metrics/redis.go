@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisHook: go-redis のフックで全コマンドの遅延を記録 (カウンタ / レート制限 / Pub/Sub / レジストリ共通)
+type redisHook struct{ m *Metrics }
+
+// RedisHook: rdb.AddHook に渡すフック
+func (m *Metrics) RedisHook() redis.Hook { return redisHook{m: m} }
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.m.ObserveRedis(strings.ToLower(cmd.Name()), time.Since(start))
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.m.ObserveRedis("pipeline", time.Since(start))
+		return err
+	}
+}
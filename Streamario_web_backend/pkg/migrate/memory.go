@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryDriver: テスト用の stand-in (SQL は実行せず、適用履歴とロックのみ再現する)
+type memoryDriver struct {
+	lock       chan struct{}
+	mu         sync.Mutex
+	applied    map[int64]Applied
+	hasHistory bool
+	hasSchema  bool // 履歴テーブル以外のスキーマがある (Unversioned 判定用)
+	now        func() time.Time
+	fail       map[int64]error // バージョンごとに Apply/Revert を失敗させる
+}
+
+// NewMemoryDriver: 空の DB を模した stand-in を生成
+func NewMemoryDriver() Driver {
+	return &memoryDriver{lock: make(chan struct{}, 1), applied: map[int64]Applied{}, now: time.Now, fail: map[int64]error{}}
+}
+
+func (d *memoryDriver) Lock(ctx context.Context) error {
+	select {
+	case d.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *memoryDriver) Unlock(ctx context.Context) error {
+	select {
+	case <-d.lock:
+		return nil
+	default:
+		return errors.New("migration lock not held")
+	}
+}
+
+func (d *memoryDriver) EnsureTable(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hasHistory = true
+	return nil
+}
+
+func (d *memoryDriver) Unversioned(ctx context.Context) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.hasHistory && d.hasSchema, nil
+}
+
+func (d *memoryDriver) Applied(ctx context.Context) ([]Applied, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Applied, 0, len(d.applied))
+	for _, a := range d.applied {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func (d *memoryDriver) Apply(ctx context.Context, m Migration, runSQL bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail[m.Version]; err != nil && runSQL {
+		return err
+	}
+	d.applied[m.Version] = Applied{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: d.now()}
+	d.hasSchema = true
+	return nil
+}
+
+func (d *memoryDriver) Revert(ctx context.Context, m Migration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail[m.Version]; err != nil {
+		return err
+	}
+	delete(d.applied, m.Version)
+	return nil
+}
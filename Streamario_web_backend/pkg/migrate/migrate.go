@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noTxDirective: この行を含むファイルはトランザクション外で1文ずつ実行する
+// (ENUM への値追加と、その値の使用を同じファイルで行う場合など)
+const noTxDirective = "-- migrate:no-transaction"
+
+// ファイル名: <version>_<name>.sql (up) / <version>_<name>.down.sql (down, 任意)
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_\-]+?)(\.down)?\.sql$`)
+
+var (
+	// ErrChecksumMismatch: 適用済みマイグレーションのファイル内容が変更されている
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	// ErrIrreversible: down ファイルの無いマイグレーションを戻そうとした
+	ErrIrreversible = errors.New("migration is irreversible")
+	// ErrUnversioned: schema_migrations が無いのに既存テーブルがある (手動適用された DB / baseline が必要)
+	ErrUnversioned = errors.New("database has tables but no migration history")
+)
+
+// Migration: 1バージョン分のスキーマ変更
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string // 空なら戻せない
+	UpNoTx   bool
+	DownNoTx bool
+	Checksum string // Up の SHA-256 (適用後の改変検出用)
+}
+
+// Reversible: down が定義されているか
+func (m Migration) Reversible() bool { return strings.TrimSpace(m.Down) != "" }
+
+// Applied: schema_migrations に記録された適用履歴
+type Applied struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Status: マイグレーションごとの適用状況
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool // 適用後にファイルが変更された
+	Missing   bool // 適用済みだがファイルが無い (新しいバイナリで適用された等)
+}
+
+// Load: fsys 直下の *.sql を読み込みバージョン順に返す
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q (want <version>_<name>[.down].sql)", e.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("duplicate migration version %d (%s, %s)", version, m.Name, match[2])
+		}
+		sql := string(body)
+		if match[3] == ".down" {
+			m.Down, m.DownNoTx = sql, hasNoTxDirective(sql)
+			continue
+		}
+		if m.Up != "" {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+		sum := sha256.Sum256(body)
+		m.Up, m.UpNoTx, m.Checksum = sql, hasNoTxDirective(sql), hex.EncodeToString(sum[:])
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has a down file but no up file", m.Version)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func hasNoTxDirective(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.TrimSpace(line) == noTxDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitStatements: SQL を文単位に分割 (文字列/引用符付き識別子/$tag$ ブロック/コメント内の ; は区切りとみなさない)
+func SplitStatements(sql string) []string {
+	var (
+		out   []string
+		start int
+	)
+	flush := func(end int) {
+		if stmt := strings.TrimSpace(sql[start:end]); stmt != "" && !onlyComments(stmt) {
+			out = append(out, stmt)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if j := strings.Index(sql[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(sql)
+			}
+		case c == '\'' || c == '"':
+			for i++; i < len(sql); i++ {
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c { // '' / "" はエスケープ
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '$':
+			if tag := dollarTag(sql[i:]); tag != "" {
+				if j := strings.Index(sql[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		case c == ';':
+			flush(i)
+		}
+	}
+	if start < len(sql) {
+		flush(len(sql))
+	}
+	return out
+}
+
+// dollarTag: s 先頭の $tag$ / $$ を返す (ドル引用でなければ空)
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		if c == '$' {
+			return s[:j+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func onlyComments(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"001_init.sql":        {Data: []byte("CREATE TABLE rooms (id TEXT);")},
+		"002_seed.sql":        {Data: []byte("-- migrate:no-transaction\nINSERT INTO rooms VALUES ('a');")},
+		"003_index.sql":       {Data: []byte("CREATE INDEX idx ON rooms (id);")},
+		"003_index.down.sql":  {Data: []byte("DROP INDEX idx;")},
+		"004_column.sql":      {Data: []byte("ALTER TABLE rooms ADD COLUMN x INT;")},
+		"004_column.down.sql": {Data: []byte("ALTER TABLE rooms DROP COLUMN x;")},
+		"README.md":           {Data: []byte("ignored")},
+	}
+}
+
+func versions(ms []Migration) []int64 {
+	out := []int64{}
+	for _, m := range ms {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(testFS())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := versions(ms); !reflect.DeepEqual(got, []int64{1, 2, 3, 4}) {
+		t.Fatalf("versions = %v", got)
+	}
+	if !ms[1].UpNoTx || ms[0].UpNoTx {
+		t.Fatalf("no-transaction directive not detected")
+	}
+	if ms[0].Reversible() || !ms[2].Reversible() || ms[0].Checksum == "" {
+		t.Fatalf("unexpected migration: %+v", ms[0])
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":    {"init.sql": {Data: []byte("x")}},
+		"duplicate":   {"001_a.sql": {Data: []byte("x")}, "1_b.sql": {Data: []byte("y")}},
+		"orphan down": {"001_a.down.sql": {Data: []byte("x")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMigrator_UpDownBaseline(t *testing.T) {
+	ctx := context.Background()
+	ms, _ := Load(testFS())
+	d := NewMemoryDriver().(*memoryDriver)
+	m := New(d, ms, testLogger())
+
+	done, err := m.Up(ctx, 2)
+	if err != nil || !reflect.DeepEqual(versions(done), []int64{1, 2}) {
+		t.Fatalf("Up(2) = %v, %v", versions(done), err)
+	}
+	done, err = m.Up(ctx, 0)
+	if err != nil || !reflect.DeepEqual(versions(done), []int64{3, 4}) {
+		t.Fatalf("Up(0) = %v, %v", versions(done), err)
+	}
+	if done, _ := m.Up(ctx, 0); len(done) != 0 {
+		t.Fatalf("Up not idempotent: %v", versions(done))
+	}
+
+	// 3,4 は戻せるが 2 は down が無い
+	done, err = m.Down(ctx, 3)
+	if !errors.Is(err, ErrIrreversible) || !reflect.DeepEqual(versions(done), []int64{4, 3}) {
+		t.Fatalf("Down(3) = %v, %v", versions(done), err)
+	}
+	st, _ := m.Status(ctx)
+	if !st[1].Applied || st[2].Applied || st[3].Applied {
+		t.Fatalf("unexpected status after down: %+v", st)
+	}
+
+	// 適用済みファイルの改変は検出して止める
+	modified := append([]Migration(nil), ms...)
+	modified[0].Checksum = "changed"
+	if _, err := New(d, modified, testLogger()).Up(ctx, 0); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("want ErrChecksumMismatch, got %v", err)
+	}
+	if st, _ := New(d, modified, testLogger()).Status(ctx); !st[0].Modified {
+		t.Fatalf("modification not reported: %+v", st[0])
+	}
+
+	// 手動適用済みの DB は up を拒否し、baseline 後は残りだけ適用する
+	legacy := NewMemoryDriver().(*memoryDriver)
+	legacy.hasSchema = true
+	lm := New(legacy, ms, testLogger())
+	if _, err := lm.Up(ctx, 0); !errors.Is(err, ErrUnversioned) {
+		t.Fatalf("want ErrUnversioned, got %v", err)
+	}
+	if done, err := lm.Baseline(ctx, 3); err != nil || !reflect.DeepEqual(versions(done), []int64{1, 2, 3}) {
+		t.Fatalf("Baseline = %v, %v", versions(done), err)
+	}
+	if done, err := lm.Up(ctx, 0); err != nil || !reflect.DeepEqual(versions(done), []int64{4}) {
+		t.Fatalf("Up after baseline = %v, %v", versions(done), err)
+	}
+}
+
+func TestMigrator_FailureStopsAndReleasesLock(t *testing.T) {
+	ctx := context.Background()
+	ms, _ := Load(testFS())
+	d := NewMemoryDriver().(*memoryDriver)
+	d.fail[3] = errors.New("boom")
+	m := New(d, ms, testLogger())
+
+	done, err := m.Up(ctx, 0)
+	if err == nil || !reflect.DeepEqual(versions(done), []int64{1, 2}) {
+		t.Fatalf("Up = %v, %v", versions(done), err)
+	}
+	delete(d.fail, 3)
+	// ロックが解放されていれば再実行で続きから適用される
+	if done, err := m.Up(ctx, 0); err != nil || !reflect.DeepEqual(versions(done), []int64{3, 4}) {
+		t.Fatalf("retry = %v, %v", versions(done), err)
+	}
+}
+
+func TestMigrator_ConcurrentUpAppliesOnce(t *testing.T) {
+	ms, _ := Load(testFS())
+	d := NewMemoryDriver()
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := New(d, ms, testLogger()).Up(context.Background(), 0)
+			if err != nil {
+				t.Errorf("Up failed: %v", err)
+			}
+			mu.Lock()
+			total += len(done)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if total != len(ms) {
+		t.Fatalf("applied %d migrations in total, want %d", total, len(ms))
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- header; comment
+DO $$
+BEGIN
+    ALTER TYPE t ADD VALUE 'a;b';
+END
+$$;
+INSERT INTO rooms VALUES ('it''s; fine', "semi;colon");
+/* block; comment */ SELECT $tag$ ; $tag$;
+-- trailing comment only
+`
+	got := SplitStatements(sql)
+	if len(got) != 3 {
+		t.Fatalf("got %d statements: %q", len(got), got)
+	}
+	if got[1] != `INSERT INTO rooms VALUES ('it''s; fine', "semi;colon")` {
+		t.Fatalf("unexpected statement: %q", got[1])
+	}
+}
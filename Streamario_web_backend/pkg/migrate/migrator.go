@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Driver: マイグレーションの適用先 (Postgres 実装と、テスト用の stand-in を差し替えられるようにする)
+// Lock〜Unlock の間の呼び出しは同一セッションで行われる。
+type Driver interface {
+	// Lock: 複数インスタンスの同時実行を防ぐ排他ロックを取得 (取得できるまで待つ)
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+	// EnsureTable: 履歴テーブルを作成 (既にあれば何もしない)
+	EnsureTable(ctx context.Context) error
+	// Unversioned: 履歴テーブルが無いのに既存のスキーマがあるか
+	Unversioned(ctx context.Context) (bool, error)
+	// Applied: 適用履歴 (履歴テーブルが無ければ空)
+	Applied(ctx context.Context) ([]Applied, error)
+	// Apply: up を実行して履歴に記録 (runSQL=false なら記録のみ / baseline 用)
+	Apply(ctx context.Context, m Migration, runSQL bool) error
+	// Revert: down を実行して履歴から削除
+	Revert(ctx context.Context, m Migration) error
+}
+
+// Migrator: 埋め込みマイグレーションの状態確認/適用/巻き戻し
+type Migrator struct {
+	driver     Driver
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+// New: migrations はバージョン昇順 (Load の戻り値)
+func New(driver Driver, migrations []Migration, logger *slog.Logger) *Migrator {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Migrator{driver: driver, migrations: migrations, logger: logger}
+}
+
+// Latest: 最新のバージョン (マイグレーションが無ければ 0)
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status: 各マイグレーションの適用状況 (ロックを取らない読み取りのみ)
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]Applied, len(applied))
+	for _, a := range applied {
+		byVersion[a.Version] = a
+	}
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := byVersion[mig.Version]; ok {
+			at := a.AppliedAt
+			st.Applied, st.AppliedAt, st.Modified = true, &at, a.Checksum != mig.Checksum
+			delete(byVersion, mig.Version)
+		}
+		out = append(out, st)
+	}
+	for _, a := range applied {
+		if _, ok := byVersion[a.Version]; ok {
+			at := a.AppliedAt
+			out = append(out, Status{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: &at, Missing: true})
+		}
+	}
+	return out, nil
+}
+
+// Up: target 以下の未適用マイグレーションを順に適用 (target<=0 なら最新まで)。適用したものを返す
+// 適用済みファイルの改変を検出した場合は何も適用しない。
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.prepare(ctx, true)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || (target > 0 && mig.Version > target) {
+				continue
+			}
+			start := time.Now()
+			if err := m.driver.Apply(ctx, mig, true); err != nil {
+				return fmt.Errorf("apply %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Info("migration applied", slog.Int64("version", mig.Version), slog.String("name", mig.Name), slog.Duration("elapsed", time.Since(start)))
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down: 直近に適用したものから steps 件を巻き戻す。巻き戻したものを返す
+// down の無いマイグレーションに当たった時点で ErrIrreversible を返す (それより前の巻き戻しは確定済み)。
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.prepare(ctx, false)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if !mig.Reversible() {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, mig.Version, mig.Name)
+			}
+			start := time.Now()
+			if err := m.driver.Revert(ctx, mig); err != nil {
+				return fmt.Errorf("revert %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Info("migration reverted", slog.Int64("version", mig.Version), slog.String("name", mig.Name), slog.Duration("elapsed", time.Since(start)))
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline: 手動で適用済みの DB 向けに、version 以下を SQL を実行せず適用済みとして記録
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.prepare(ctx, false)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.driver.Apply(ctx, mig, false); err != nil {
+				return fmt.Errorf("baseline %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Info("migration baselined", slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked: 排他ロックを取って fn を実行
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	if err := m.driver.Lock(ctx); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if err := m.driver.Unlock(context.WithoutCancel(ctx)); err != nil {
+			m.logger.Warn("release migration lock failed", slog.Any("error", err))
+		}
+	}()
+	return fn()
+}
+
+// prepare: 履歴テーブルを用意し、適用済みの改変を検証して適用済みバージョンを返す
+// rejectUnversioned=true なら、履歴が空で既存スキーマがある DB を ErrUnversioned で拒否する (up の二重適用防止)。
+func (m *Migrator) prepare(ctx context.Context, rejectUnversioned bool) (map[int64]Applied, error) {
+	if rejectUnversioned {
+		unversioned, err := m.driver.Unversioned(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if unversioned {
+			return nil, ErrUnversioned
+		}
+	}
+	if err := m.driver.EnsureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]Applied, len(applied))
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for _, a := range applied {
+		byVersion[a.Version] = a
+		mig, ok := known[a.Version]
+		if !ok {
+			// ローリングデプロイ中に古いバイナリが起動した等。未知のバージョンは触らない
+			m.logger.Warn("applied migration not found in binary", slog.Int64("version", a.Version), slog.String("name", a.Name))
+			continue
+		}
+		if mig.Checksum != a.Checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, a.Version, a.Name)
+		}
+	}
+	return byVersion, nil
+}
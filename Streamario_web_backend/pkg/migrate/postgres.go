@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// advisoryLockKey: pg_advisory_lock のキー (アプリ内で他用途と衝突しない固定値)
+const advisoryLockKey int64 = 0x53545245414d4552 // "STREAMER"
+
+// probeTable: 履歴テーブルが無い場合に既存スキーマの有無を判定するテーブル (001 で作成)
+const probeTable = "rooms"
+
+// postgresDriver: PostgreSQL 実装
+// セッション単位の advisory lock を使うため、Lock で確保した1本の接続で全操作を行う。
+type postgresDriver struct {
+	db    *sql.DB
+	table string
+	conn  *sql.Conn
+}
+
+// NewPostgresDriver: table は履歴テーブル名 (通常 "schema_migrations")
+func NewPostgresDriver(db *sql.DB, table string) Driver {
+	return &postgresDriver{db: db, table: table}
+}
+
+func (p *postgresDriver) Lock(ctx context.Context) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn = conn
+	return nil
+}
+
+func (p *postgresDriver) Unlock(ctx context.Context) error {
+	if p.conn == nil {
+		return nil
+	}
+	_, err := p.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+	if err != nil {
+		// 解除に失敗した接続はプールへ戻さず破棄する (セッション終了でロックも解放される)
+		_ = p.conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	closeErr := p.conn.Close()
+	p.conn = nil
+	return errors.Join(err, closeErr)
+}
+
+// querier: ロック中は確保済みの接続、Status 等のロック外では接続プール
+func (p *postgresDriver) querier() interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+} {
+	if p.conn != nil {
+		return p.conn
+	}
+	return p.db
+}
+
+func (p *postgresDriver) EnsureTable(ctx context.Context) error {
+	_, err := p.querier().ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, p.table))
+	return err
+}
+
+func (p *postgresDriver) tableExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := p.querier().QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	return exists, err
+}
+
+func (p *postgresDriver) Unversioned(ctx context.Context) (bool, error) {
+	hasHistory, err := p.tableExists(ctx, p.table)
+	if err != nil || hasHistory {
+		return false, err
+	}
+	return p.tableExists(ctx, probeTable)
+}
+
+func (p *postgresDriver) Applied(ctx context.Context) ([]Applied, error) {
+	exists, err := p.tableExists(ctx, p.table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := p.querier().QueryContext(ctx, fmt.Sprintf(`SELECT version, name, checksum, applied_at FROM %s ORDER BY version`, p.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Applied
+	for rows.Next() {
+		var a Applied
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresDriver) Apply(ctx context.Context, m Migration, runSQL bool) error {
+	record := func(ex execer) error {
+		_, err := ex.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)`, p.table), m.Version, m.Name, m.Checksum)
+		return err
+	}
+	if !runSQL {
+		return record(p.querier())
+	}
+	return p.run(ctx, m.Up, m.UpNoTx, record)
+}
+
+func (p *postgresDriver) Revert(ctx context.Context, m Migration) error {
+	return p.run(ctx, m.Down, m.DownNoTx, func(ex execer) error {
+		_, err := ex.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, p.table), m.Version)
+		return err
+	})
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// run: 本文と履歴更新を1トランザクションで実行 (noTx なら1文ずつ実行し、最後に履歴を更新)
+func (p *postgresDriver) run(ctx context.Context, body string, noTx bool, after func(execer) error) error {
+	if p.conn == nil {
+		return errors.New("migration lock not held")
+	}
+	if noTx {
+		for _, stmt := range SplitStatements(body) {
+			if _, err := p.conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return after(p.conn)
+	}
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if err := after(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,5 +1,7 @@
 package pubsub
 
+import "strings"
+
 // チャネル名定数
 // Pub/Sub で使用するチャネル（トピック）名を定義
 // タイポ防止と一元管理のため、チャネル名は必ずこの定数を使用すること
@@ -28,4 +30,31 @@ const (
 	//     "ended_at": "2025-10-05T12:00:00Z"
 	//   }
 	ChannelGameEnd = "game_end_notifications"
+
+	// ChannelViewerUpdates: 視聴者向けライブ更新チャネル
+	// 各インスタンスが購読し、そのインスタンスに接続中の視聴者 (SSE) へ room_id ごとに配信する。
+	// Unity 宛てではないため seq の採番・Replay の対象外。
+	//
+	// Payload 例:
+	//   {
+	//     "type": "room_stats",          // room_stats / game_event / game_end_summary
+	//     "room_id": "01HXXX...",
+	//     "stats": [ { "event_type": "skill1", "current_count": 3, ... } ]
+	//   }
+	ChannelViewerUpdates = "viewer_updates"
 )
+
+// instanceChannelPrefix: インスタンス宛てチャネルの接頭辞
+const instanceChannelPrefix = ChannelGameEvents + ":"
+
+// InstanceChannel: 指定インスタンス宛てのゲームイベントチャネル名
+// Unity 接続の所有インスタンスが判明している場合、全体ブロードキャストの代わりにこちらへ発行する。
+// Payload は ChannelGameEvents と同一。
+func InstanceChannel(instanceID string) string {
+	return instanceChannelPrefix + instanceID
+}
+
+// sequenced: seq 採番・Replay の対象チャネルか (Unity 宛てのゲームイベントチャネルのみ)
+func sequenced(channel string) bool {
+	return channel == ChannelGameEvents || strings.HasPrefix(channel, instanceChannelPrefix)
+}
@@ -0,0 +1,47 @@
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"streamerrio-backend/pkg/metrics"
+)
+
+// instrumented: Publish の遅延と受信メッセージの処理時間をメトリクスへ記録するラッパ
+type instrumented struct {
+	PubSub
+	metrics *metrics.Metrics
+}
+
+// instrumentedReplayer: 元の実装が Replayer なら再送もそのまま委譲する
+type instrumentedReplayer struct {
+	*instrumented
+	Replayer
+}
+
+// Instrument: ps をメトリクス記録付きで包む (Replayer 実装であればそれも引き継ぐ)
+func Instrument(ps PubSub, m *metrics.Metrics) PubSub {
+	base := &instrumented{PubSub: ps, metrics: m}
+	if r, ok := ps.(Replayer); ok {
+		return &instrumentedReplayer{instrumented: base, Replayer: r}
+	}
+	return base
+}
+
+// Publish: 発行の遅延を記録 (失敗も含む)
+func (p *instrumented) Publish(ctx context.Context, channel string, message []byte) error {
+	start := time.Now()
+	err := p.PubSub.Publish(ctx, channel, message)
+	p.metrics.ObservePublish(channel, time.Since(start))
+	return err
+}
+
+// Subscribe: ハンドラ1回ごとの処理時間を記録
+func (p *instrumented) Subscribe(ctx context.Context, channel string, handler MessageHandler) error {
+	return p.PubSub.Subscribe(ctx, channel, func(ctx context.Context, ch string, message []byte) error {
+		start := time.Now()
+		err := handler(ctx, ch, message)
+		p.metrics.ObserveHandle(ch, time.Since(start))
+		return err
+	})
+}
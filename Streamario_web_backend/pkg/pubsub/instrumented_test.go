@@ -0,0 +1,55 @@
+package pubsub
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"streamerrio-backend/pkg/metrics"
+)
+
+func TestInstrumentKeepsReplayerAndRecords(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	m := metrics.New()
+	ps := Instrument(NewMemoryPubSub(logger), m)
+	defer ps.Close()
+	if _, ok := ps.(Replayer); !ok {
+		t.Fatal("instrumented memory pubsub should still implement Replayer")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := make(chan struct{}, 1)
+	go func() {
+		_ = ps.Subscribe(ctx, ChannelGameEvents, func(_ context.Context, ch string, msg []byte) error {
+			handled <- struct{}{}
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"room_id":"room-a","type":"game_event"}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`streamerrio_pubsub_publish_duration_seconds_count{channel="` + ChannelGameEvents + `"} 1`,
+		`streamerrio_pubsub_handle_duration_seconds_count{channel="` + ChannelGameEvents + `"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
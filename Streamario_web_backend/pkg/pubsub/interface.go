@@ -17,5 +17,20 @@ type PubSub interface {
 }
 
 // MessageHandler: メッセージ受信時のコールバック関数
+// ctx は購読の context (発行側のトレースを引き継いでいればそのスパンを含む)。
 // エラーを返した場合はログに記録されるが、購読は継続する
-type MessageHandler func(channel string, message []byte) error
+type MessageHandler func(ctx context.Context, channel string, message []byte) error
+
+// Replayer: ルーム単位の連番 (seq) 付き配信履歴を保持し、再接続時の取りこぼし再送に対応する実装
+// room_id を含む JSON オブジェクトを発行すると、購読側へ届くメッセージに "seq" が付与される。
+type Replayer interface {
+	// Replay: roomID 宛てに発行されたメッセージのうち seq > since のものを発行順に返す
+	// 保持期間/件数を超えた古いメッセージは返らない。
+	Replay(ctx context.Context, roomID string, since int64) ([]Message, error)
+}
+
+// Message: 連番付きメッセージ (Payload は "seq" 付与済み)
+type Message struct {
+	Seq     int64
+	Payload []byte
+}
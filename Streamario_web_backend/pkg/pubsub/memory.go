@@ -4,14 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 )
 
+// memoryReplayLimit: ルームごとに保持する再送用メッセージ数
+const memoryReplayLimit = 1000
+
 // memoryPubSub: テスト/開発用のインメモリ実装
 // 同一プロセス内でのみ動作し、複数サーバー間では機能しない
+// room_id 付きメッセージには Redis Streams 実装と同じくルーム単位の seq を付与し、Replay で再送できる。
 type memoryPubSub struct {
 	mu          sync.RWMutex
 	subscribers map[string][]chan []byte // channel -> subscriber channels
+	seqs        map[string]int64         // roomID -> 最終 seq
+	history     map[string][]Message     // roomID -> 再送用履歴 (古い順)
 	logger      *slog.Logger
 	closed      bool
 }
@@ -23,14 +30,16 @@ func NewMemoryPubSub(logger *slog.Logger) PubSub {
 	}
 	return &memoryPubSub{
 		subscribers: make(map[string][]chan []byte),
+		seqs:        make(map[string]int64),
+		history:     make(map[string][]Message),
 		logger:      logger,
 	}
 }
 
 // Publish: メモリ内の購読者全員にメッセージを配信
 func (m *memoryPubSub) Publish(ctx context.Context, channel string, message []byte) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	if m.closed {
 		return fmt.Errorf("pubsub is closed")
@@ -42,6 +51,18 @@ func (m *memoryPubSub) Publish(ctx context.Context, channel string, message []by
 		slog.Int("message_size", len(message)),
 	)
 
+	// Unity 宛てのルームメッセージは購読者の有無に関わらず seq を付与して履歴へ残す
+	if roomID := roomIDOf(message); roomID != "" && sequenced(channel) {
+		m.seqs[roomID]++
+		seq := m.seqs[roomID]
+		message = withSeq(message, seq)
+		hist := append(m.history[roomID], Message{Seq: seq, Payload: message})
+		if len(hist) > memoryReplayLimit {
+			hist = hist[len(hist)-memoryReplayLimit:]
+		}
+		m.history[roomID] = hist
+	}
+
 	subs, exists := m.subscribers[channel]
 	if !exists || len(subs) == 0 {
 		logger.Debug("no subscribers", slog.Int("subscriber_count", 0))
@@ -128,7 +149,7 @@ func (m *memoryPubSub) Subscribe(ctx context.Context, channel string, handler Me
 			}
 
 			// ハンドラを呼び出し
-			if err := handler(channel, msg); err != nil {
+			if err := handler(ctx, channel, msg); err != nil {
 				logger.Error("message handler error",
 					slog.Int("payload_size", len(msg)),
 					slog.Any("error", err),
@@ -139,6 +160,21 @@ func (m *memoryPubSub) Subscribe(ctx context.Context, channel string, handler Me
 	}
 }
 
+// Replay: 履歴から seq > since のメッセージを返す
+func (m *memoryPubSub) Replay(ctx context.Context, roomID string, since int64) ([]Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, fmt.Errorf("pubsub is closed")
+	}
+	hist := m.history[roomID]
+	i := sort.Search(len(hist), func(i int) bool { return hist[i].Seq > since })
+	out := make([]Message, len(hist)-i)
+	copy(out, hist[i:])
+	return out, nil
+}
+
 // Close: すべての購読を終了し、リソースをクリーンアップ
 func (m *memoryPubSub) Close() error {
 	m.mu.Lock()
@@ -2,7 +2,9 @@ package pubsub
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -23,7 +25,7 @@ func TestMemoryPubSub_PublishSubscribe(t *testing.T) {
 	var receivedMu sync.Mutex
 	var receivedMessages [][]byte
 
-	handler := func(ch string, msg []byte) error {
+	handler := func(_ context.Context, ch string, msg []byte) error {
 		receivedMu.Lock()
 		defer receivedMu.Unlock()
 		receivedMessages = append(receivedMessages, msg)
@@ -89,7 +91,7 @@ func TestMemoryPubSub_MultipleSubscribers(t *testing.T) {
 		defer subCancel()
 
 		idx := i
-		handler := func(ch string, msg []byte) error {
+		handler := func(_ context.Context, ch string, msg []byte) error {
 			countersMu.Lock()
 			counters[idx]++
 			countersMu.Unlock()
@@ -158,3 +160,35 @@ func TestMemoryPubSub_Close(t *testing.T) {
 		t.Error("expected error after close, got nil")
 	}
 }
+
+func TestMemoryPubSub_Replay(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	ps := NewMemoryPubSub(logger)
+	defer ps.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"type":"game_event","room_id":"room-a"}`)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"type":"game_event","room_id":"room-b"}`)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	msgs, err := ps.(Replayer).Replay(ctx, "room-a", 1)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Seq != 2 || msgs[1].Seq != 3 {
+		t.Fatalf("unexpected replay: %+v", msgs)
+	}
+	if !strings.Contains(string(msgs[0].Payload), `"seq":2`) {
+		t.Fatalf("payload missing seq: %s", msgs[0].Payload)
+	}
+
+	msgs, err = ps.(Replayer).Replay(ctx, "room-b", 0)
+	if err != nil || len(msgs) != 1 || msgs[0].Seq != 1 {
+		t.Fatalf("unexpected replay for room-b: %+v err=%v", msgs, err)
+	}
+}
@@ -88,7 +88,7 @@ func (r *redisPubSub) Subscribe(ctx context.Context, channel string, handler Mes
 
 			// メッセージ処理
 			start := time.Now()
-			if err := handler(msg.Channel, []byte(msg.Payload)); err != nil {
+			if err := handler(ctx, msg.Channel, []byte(msg.Payload)); err != nil {
 				logger.Error("message handler error",
 					slog.String("channel", msg.Channel),
 					slog.Int("payload_size", len(msg.Payload)),
@@ -0,0 +1,41 @@
+package pubsub
+
+import "encoding/json"
+
+// SeqField: 連番を埋め込むペイロードのフィールド名
+// Unity は最後に受け取った値を /ws-unity?room_id=...&since=N で送り返すことで取りこぼしを再送させる。
+const SeqField = "seq"
+
+// roomIDOf: ペイロード (JSON オブジェクト) から room_id を取り出す (無ければ空文字)
+func roomIDOf(message []byte) string {
+	var envelope struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return ""
+	}
+	return envelope.RoomID
+}
+
+// withSeq: ペイロードに seq を埋め込む (JSON オブジェクト以外はそのまま返す)
+func withSeq(message []byte, seq int64) []byte {
+	return withField(message, SeqField, seq)
+}
+
+// withField: ペイロード (JSON オブジェクト) に1フィールドを追加・上書きする (JSON オブジェクト以外はそのまま返す)
+func withField(message []byte, key string, value interface{}) []byte {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(message, &payload); err != nil || payload == nil {
+		return message
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return message
+	}
+	payload[key] = raw
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return message
+	}
+	return out
+}
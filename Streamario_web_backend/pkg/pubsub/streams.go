@@ -0,0 +1,310 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Streams 実装の保持上限
+const (
+	streamChannelMaxLen = 10000          // チャネルストリームの概算最大長 (MAXLEN ~)
+	streamRoomMaxLen    = 1000           // ルーム再送ストリームの概算最大長
+	streamRetention     = 24 * time.Hour // 最終発行からストリームを保持する時間
+	streamReadCount     = 100            // XREADGROUP 1回あたりの最大取得数
+	streamBlock         = 2 * time.Second
+	streamStaleGroup    = 10 * time.Minute // 全 consumer がこの時間読み出していないグループは停止済みインスタンスの残骸として削除
+	streamRetryMax      = 30 * time.Second // 読み出し失敗時の再試行間隔の上限
+	streamCloseTimeout  = 2 * time.Second  // Close でのグループ削除の期限
+)
+
+// publishStreamScript: ルーム seq の採番とストリーム追記を原子的に行う
+// KEYS[1]=room:<id>:seq, KEYS[2]=room:<id>:stream, KEYS[3]=stream:<channel>
+// ARGV[1]=payload, ARGV[2]=roomID, ARGV[3]=ルームストリーム MAXLEN, ARGV[4]=チャネルストリーム MAXLEN, ARGV[5]=保持時間(ms)
+// ルームストリームは ID を "<seq>-0" とし、XRANGE で seq 範囲を直接指定できるようにする。
+// room_id が無い場合 (KEYS[1] が空文字) はチャネルストリームへの追記のみ。
+var publishStreamScript = redis.NewScript(`
+local seq = 0
+if KEYS[1] ~= '' then
+  seq = redis.call('INCR', KEYS[1])
+  redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], seq .. '-0', 'payload', ARGV[1])
+  redis.call('PEXPIRE', KEYS[2], ARGV[5])
+end
+redis.call('XADD', KEYS[3], 'MAXLEN', '~', ARGV[4], '*', 'room_id', ARGV[2], 'seq', seq, 'payload', ARGV[1])
+redis.call('PEXPIRE', KEYS[3], ARGV[5])
+return seq
+`)
+
+// redisStreamPubSub: Redis Streams + コンシューマグループによる永続・再送可能な実装
+// チャネルごとに stream:<channel> へ追記し、インスタンス (consumer) ごとのグループで読み出す。
+// 全インスタンスへのブロードキャストとなるよう、グループ名は consumer 名と同一にする。
+// consumer 名 (INSTANCE_ID) が再起動をまたいで同じなら、前回処理中に落ちた未 ACK 分を起動時に処理できる。
+// グループは Close で削除し、異常終了で残ったグループは他インスタンスの購読開始時に削除する (streamStaleGroup)。
+// Unity 宛てチャネルの room_id 付きメッセージは room:<id>:stream にも seq 付きで残し、Replay で再送する。
+type redisStreamPubSub struct {
+	rdb      *redis.Client
+	consumer string
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	groups map[string]bool // このインスタンスが作成/参加したグループのストリーム (Close で削除)
+}
+
+// NewRedisStreamPubSub: Redis Streams 実装を生成 (consumer はインスタンス識別子)
+func NewRedisStreamPubSub(rdb *redis.Client, consumer string, logger *slog.Logger) PubSub {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &redisStreamPubSub{rdb: rdb, consumer: consumer, logger: logger, groups: make(map[string]bool)}
+}
+
+func keyChannelStream(channel string) string { return "stream:" + channel }
+func keyRoomSeq(roomID string) string        { return fmt.Sprintf("room:%s:seq", roomID) }
+func keyRoomStream(roomID string) string     { return fmt.Sprintf("room:%s:stream", roomID) }
+
+// Publish: seq を採番してストリームへ追記
+func (r *redisStreamPubSub) Publish(ctx context.Context, channel string, message []byte) error {
+	logger := r.logger.With(
+		slog.String("op", "publish"),
+		slog.String("channel", channel),
+		slog.Int("message_size", len(message)),
+	)
+
+	roomID := roomIDOf(message)
+	seqKey, roomKey := "", ""
+	if roomID != "" && sequenced(channel) {
+		seqKey, roomKey = keyRoomSeq(roomID), keyRoomStream(roomID)
+	}
+
+	start := time.Now()
+	seq, err := publishStreamScript.Run(ctx, r.rdb,
+		[]string{seqKey, roomKey, keyChannelStream(channel)},
+		message, roomID, streamRoomMaxLen, streamChannelMaxLen, streamRetention.Milliseconds(),
+	).Int64()
+	if err != nil {
+		logger.Error("redis.xadd failed", slog.Any("error", err))
+		return fmt.Errorf("redis stream publish failed: %w", err)
+	}
+
+	logger.Debug("redis.xadd",
+		slog.String("room_id", roomID),
+		slog.Int64("seq", seq),
+		slog.Duration("elapsed", time.Since(start)),
+	)
+	return nil
+}
+
+// Subscribe: コンシューマグループでチャネルストリームを読み出す
+// 起動時は未 ACK (前回処理中に落ちた分) を先に処理し、その後新着を待つ。
+// 読み出し/グループ再作成の失敗は間隔を倍にしながら再試行し、context がキャンセルされるまでブロックし続ける。
+// グループを作成できずに購読を始められない場合のみエラーを返す。
+func (r *redisStreamPubSub) Subscribe(ctx context.Context, channel string, handler MessageHandler) error {
+	stream := keyChannelStream(channel)
+	logger := r.logger.With(
+		slog.String("op", "subscribe"),
+		slog.String("channel", channel),
+		slog.String("consumer", r.consumer),
+	)
+
+	logger.Info("starting subscription")
+	if err := r.ensureGroup(ctx, stream); err != nil {
+		logger.Error("subscription failed", slog.Any("error", err))
+		return fmt.Errorf("redis stream subscribe failed: %w", err)
+	}
+	logger.Info("subscription established")
+
+	// "0" = 自分宛ての未 ACK 分、">" = 新着
+	cursor := "0"
+	backoff := time.Second
+	for {
+		if err := ctx.Err(); err != nil {
+			logger.Info("subscription cancelled", slog.Any("reason", err))
+			return err
+		}
+
+		streams, err := r.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    r.consumer,
+			Consumer: r.consumer,
+			Streams:  []string{stream, cursor},
+			Count:    streamReadCount,
+			Block:    streamBlock,
+		}).Result()
+		if err != nil {
+			switch {
+			case errors.Is(err, redis.Nil):
+				continue
+			case ctx.Err() != nil:
+				logger.Info("subscription cancelled", slog.Any("reason", ctx.Err()))
+				return ctx.Err()
+			case strings.HasPrefix(err.Error(), "NOGROUP"):
+				// 保持期間切れ/停止済みとして削除された場合はグループを作り直す
+				if err := r.ensureGroup(ctx, stream); err != nil {
+					logger.Error("recreate consumer group failed", slog.Any("error", err), slog.Duration("backoff", backoff))
+				} else {
+					continue
+				}
+			default:
+				logger.Error("redis.xreadgroup failed", slog.Any("error", err), slog.Duration("backoff", backoff))
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, streamRetryMax)
+			continue
+		}
+		backoff = time.Second
+
+		received := 0
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				received++
+				r.handle(ctx, logger, channel, stream, msg, handler)
+			}
+		}
+		if cursor == "0" && received == 0 {
+			cursor = ">" // 未 ACK 分を処理し終えたら新着待ちへ
+		}
+	}
+}
+
+// handle: 1件分のハンドラ呼び出しと ACK
+// ハンドラのエラーはログのみ (購読は継続し、同じメッセージを再処理しない)
+func (r *redisStreamPubSub) handle(ctx context.Context, logger *slog.Logger, channel, stream string, msg redis.XMessage, handler MessageHandler) {
+	payload, _ := msg.Values["payload"].(string)
+	seq, _ := strconv.ParseInt(fmt.Sprint(msg.Values["seq"]), 10, 64)
+	message := []byte(payload)
+	if seq > 0 {
+		message = withSeq(message, seq)
+	}
+
+	start := time.Now()
+	if err := handler(ctx, channel, message); err != nil {
+		logger.Error("message handler error",
+			slog.String("stream_id", msg.ID),
+			slog.Int("payload_size", len(payload)),
+			slog.Any("error", err),
+			slog.Duration("elapsed", time.Since(start)),
+		)
+	} else {
+		logger.Debug("message handled",
+			slog.String("stream_id", msg.ID),
+			slog.Int64("seq", seq),
+			slog.Duration("elapsed", time.Since(start)),
+		)
+	}
+	if err := r.rdb.XAck(ctx, stream, r.consumer, msg.ID).Err(); err != nil && ctx.Err() == nil {
+		logger.Warn("redis.xack failed", slog.String("stream_id", msg.ID), slog.Any("error", err))
+	}
+}
+
+// ensureGroup: コンシューマグループを作成 (既存なら何もしない) し、停止済みインスタンスのグループを掃除する
+// 新規作成時は "$" から読み始める (購読開始前の古いメッセージは Replay で補う)
+func (r *redisStreamPubSub) ensureGroup(ctx context.Context, stream string) error {
+	err := r.rdb.XGroupCreateMkStream(ctx, stream, r.consumer, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	r.mu.Lock()
+	r.groups[stream] = true
+	r.mu.Unlock()
+	r.pruneGroups(ctx, stream)
+	return nil
+}
+
+// pruneGroups: 全 consumer が streamStaleGroup 以上読み出していないグループを削除 (異常終了したインスタンスの残骸)
+// 稼働中のインスタンスは streamBlock ごとに読み出すため対象にならない。失敗はログのみ。
+func (r *redisStreamPubSub) pruneGroups(ctx context.Context, stream string) {
+	groups, err := r.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		r.logger.Warn("redis.xinfo groups failed", slog.String("stream", stream), slog.Any("error", err))
+		return
+	}
+	for _, g := range groups {
+		if g.Name == r.consumer || g.Consumers == 0 {
+			continue
+		}
+		consumers, err := r.rdb.XInfoConsumers(ctx, stream, g.Name).Result()
+		if err != nil {
+			continue
+		}
+		stale := true
+		for _, c := range consumers {
+			if c.Idle < streamStaleGroup {
+				stale = false
+				break
+			}
+		}
+		if !stale {
+			continue
+		}
+		if err := r.rdb.XGroupDestroy(ctx, stream, g.Name).Err(); err != nil {
+			r.logger.Warn("redis.xgroup destroy failed", slog.String("stream", stream), slog.String("group", g.Name), slog.Any("error", err))
+			continue
+		}
+		r.logger.Info("stale consumer group removed", slog.String("stream", stream), slog.String("group", g.Name), slog.Int64("pending", g.Pending))
+	}
+}
+
+// Replay: room:<id>:stream から seq > since のメッセージを返す
+func (r *redisStreamPubSub) Replay(ctx context.Context, roomID string, since int64) ([]Message, error) {
+	logger := r.logger.With(
+		slog.String("op", "replay"),
+		slog.String("room_id", roomID),
+		slog.Int64("since", since),
+	)
+	if since < 0 {
+		since = 0
+	}
+
+	start := time.Now()
+	entries, err := r.rdb.XRange(ctx, keyRoomStream(roomID), strconv.FormatInt(since+1, 10), "+").Result()
+	if err != nil {
+		logger.Error("redis.xrange failed", slog.Any("error", err))
+		return nil, fmt.Errorf("redis stream replay failed: %w", err)
+	}
+
+	out := make([]Message, 0, len(entries))
+	for _, e := range entries {
+		seq, err := strconv.ParseInt(strings.TrimSuffix(e.ID, "-0"), 10, 64)
+		if err != nil {
+			continue
+		}
+		payload, _ := e.Values["payload"].(string)
+		out = append(out, Message{Seq: seq, Payload: withSeq([]byte(payload), seq)})
+	}
+
+	logger.Debug("redis.xrange", slog.Int("count", len(out)), slog.Duration("elapsed", time.Since(start)))
+	return out, nil
+}
+
+// Close: このインスタンスのコンシューマグループを削除 (Redis Client は外部管理のため閉じない)
+// 購読の停止後に呼ぶ。停止後にグループが残ると、追記のたびに誰も読まない未読が溜まり続ける。
+func (r *redisStreamPubSub) Close() error {
+	r.mu.Lock()
+	streams := make([]string, 0, len(r.groups))
+	for stream := range r.groups {
+		streams = append(streams, stream)
+	}
+	r.groups = make(map[string]bool)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamCloseTimeout)
+	defer cancel()
+	var errs []error
+	for _, stream := range streams {
+		// 保持期間切れでストリームごと消えていれば削除済みと同じ
+		if err := r.rdb.XGroupDestroy(ctx, stream, r.consumer).Err(); err != nil && !strings.Contains(err.Error(), "key to exist") {
+			errs = append(errs, fmt.Errorf("destroy consumer group on %s: %w", stream, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,214 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStreamPubSub(t *testing.T, consumer string) (PubSub, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewRedisStreamPubSub(rdb, consumer, logger), rdb
+}
+
+func seqOf(t *testing.T, message []byte) int64 {
+	t.Helper()
+	var payload struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(message, &payload); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	return payload.Seq
+}
+
+func TestRedisStreamPubSub_DeliversWithSeq(t *testing.T) {
+	ps, _ := newTestStreamPubSub(t, "inst-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var received [][]byte
+	subCtx, subCancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = ps.Subscribe(subCtx, ChannelGameEvents, func(_ context.Context, ch string, msg []byte) error {
+			mu.Lock()
+			received = append(received, msg)
+			mu.Unlock()
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, room := range []string{"room-a", "room-a", "room-b"} {
+		if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"type":"game_event","room_id":"`+room+`"}`)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	subCancel()
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(received))
+	}
+	// seq はルーム単位で採番される
+	want := []int64{1, 2, 1}
+	for i, msg := range received {
+		if got := seqOf(t, msg); got != want[i] {
+			t.Errorf("message %d: expected seq %d, got %d (%s)", i, want[i], got, msg)
+		}
+	}
+}
+
+func TestRedisStreamPubSub_Replay(t *testing.T) {
+	ps, _ := newTestStreamPubSub(t, "inst-1")
+	ctx := context.Background()
+
+	// 購読者不在 (Unity 再接続中) でも履歴に残る
+	for i := 0; i < 5; i++ {
+		if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"type":"game_event","room_id":"room-a"}`)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	msgs, err := ps.(Replayer).Replay(ctx, "room-a", 3)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Seq != 4 || msgs[1].Seq != 5 {
+		t.Fatalf("unexpected replay: %+v", msgs)
+	}
+	if got := seqOf(t, msgs[1].Payload); got != 5 {
+		t.Fatalf("payload seq mismatch: %d", got)
+	}
+
+	msgs, err = ps.(Replayer).Replay(ctx, "room-b", 0)
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("expected empty replay for unknown room, got %+v err=%v", msgs, err)
+	}
+}
+
+func TestRedisStreamPubSub_GroupLifecycle(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx := context.Background()
+	stream := keyChannelStream(ChannelGameEvents)
+	groupNames := func() map[string]bool {
+		groups, err := rdb.XInfoGroups(ctx, stream).Result()
+		if err != nil {
+			t.Fatalf("XInfoGroups failed: %v", err)
+		}
+		names := map[string]bool{}
+		for _, g := range groups {
+			names[g.Name] = true
+		}
+		return names
+	}
+	read := func(group string) {
+		// consumer は何か読み出した時点で作られる
+		id := rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"payload": "{}"}}).Val()
+		_ = rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: group, Consumer: group, Streams: []string{stream, ">"}, Block: -1}).Err()
+		// miniredis は XREADGROUP で idle を更新しないため、XCLAIM で最終読み出し時刻を記録する
+		_ = rdb.XClaim(ctx, &redis.XClaimArgs{Stream: stream, Group: group, Consumer: group, Messages: []string{id}}).Err()
+	}
+
+	// 異常終了したインスタンスのグループ (最後の読み出しから streamStaleGroup 経過) は次の購読開始時に消える
+	now := time.Now()
+	mr.SetTime(now)
+	crashed := NewRedisStreamPubSub(rdb, "crashed", logger).(*redisStreamPubSub)
+	if err := crashed.ensureGroup(ctx, stream); err != nil {
+		t.Fatalf("ensureGroup failed: %v", err)
+	}
+	read("crashed")
+	mr.SetTime(now.Add(streamStaleGroup + time.Minute))
+	live := NewRedisStreamPubSub(rdb, "live", logger).(*redisStreamPubSub)
+	if err := live.ensureGroup(ctx, stream); err != nil {
+		t.Fatalf("ensureGroup failed: %v", err)
+	}
+	read("live")
+	next := NewRedisStreamPubSub(rdb, "next", logger).(*redisStreamPubSub)
+	if err := next.ensureGroup(ctx, stream); err != nil {
+		t.Fatalf("ensureGroup failed: %v", err)
+	}
+	if names := groupNames(); names["crashed"] || !names["live"] || !names["next"] {
+		t.Fatalf("groups after prune = %v, want live and next", names)
+	}
+
+	// 停止時は自分のグループだけ削除する (再起動のたびにグループが増えない)
+	if err := next.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if names := groupNames(); names["next"] || !names["live"] {
+		t.Fatalf("groups after Close = %v, want only live", names)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatalf("second Close should be a no-op: %v", err)
+	}
+}
+
+func TestRedisStreamPubSub_RecoversPendingWithStableConsumer(t *testing.T) {
+	ps, rdb := newTestStreamPubSub(t, "inst-1")
+	ctx := context.Background()
+	stream := keyChannelStream(ChannelGameEvents)
+	if err := ps.(*redisStreamPubSub).ensureGroup(ctx, stream); err != nil {
+		t.Fatalf("ensureGroup failed: %v", err)
+	}
+	if err := ps.Publish(ctx, ChannelGameEvents, []byte(`{"type":"game_event","room_id":"room-a"}`)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	// 読み出した直後に落ちた (ACK していない)
+	if err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "inst-1", Consumer: "inst-1", Streams: []string{stream, ">"}, Block: -1}).Err(); err != nil {
+		t.Fatalf("XReadGroup failed: %v", err)
+	}
+
+	// 同じ INSTANCE_ID で再起動すると未 ACK 分から処理する
+	restarted := NewRedisStreamPubSub(rdb, "inst-1", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	subCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	got := make(chan int64, 1)
+	go func() {
+		_ = restarted.Subscribe(subCtx, ChannelGameEvents, func(_ context.Context, _ string, msg []byte) error {
+			got <- seqOf(t, msg)
+			cancel()
+			return nil
+		})
+	}()
+	select {
+	case seq := <-got:
+		if seq != 1 {
+			t.Fatalf("recovered seq = %d, want 1", seq)
+		}
+	case <-subCtx.Done():
+		t.Fatal("pending message was not recovered")
+	}
+}
@@ -0,0 +1,131 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceField: トレースコンテキスト (W3C traceparent / tracestate / baggage) を埋め込むペイロードのフィールド名
+// 購読側のハンドラへ渡す前に取り除くため、Unity や視聴者には届かない。
+const TraceField = "trace"
+
+// tracerName: Pub/Sub のスパンを記録するトレーサー名
+const tracerName = "streamerrio-backend/pkg/pubsub"
+
+// traced: 発行時にトレースコンテキストをペイロードへ注入し、受信時に取り出して同じトレースを継続するラッパ
+type traced struct {
+	PubSub
+	tracer trace.Tracer
+}
+
+// tracedReplayer: 元の実装が Replayer なら再送も委譲し、注入したフィールドを取り除く
+type tracedReplayer struct {
+	*traced
+	replayer Replayer
+}
+
+// WithTracing: ps をトレース伝播付きで包む (Replayer 実装であればそれも引き継ぐ)
+// トレーサーと伝播形式はグローバル設定 (otel.SetTracerProvider / SetTextMapPropagator) に従う。
+func WithTracing(ps PubSub) PubSub {
+	base := &traced{PubSub: ps, tracer: otel.Tracer(tracerName)}
+	if r, ok := ps.(Replayer); ok {
+		return &tracedReplayer{traced: base, replayer: r}
+	}
+	return base
+}
+
+// Publish: producer スパンを開始し、そのコンテキストをペイロードへ注入して発行
+func (p *traced) Publish(ctx context.Context, channel string, message []byte) error {
+	ctx, span := p.tracer.Start(ctx, "publish "+channel,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttrs(channel, message)...),
+	)
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		message = withField(message, TraceField, carrier)
+	}
+	if err := p.PubSub.Publish(ctx, channel, message); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Subscribe: 受信メッセージからトレースコンテキストを取り出し、consumer スパンの中でハンドラを呼ぶ
+func (p *traced) Subscribe(ctx context.Context, channel string, handler MessageHandler) error {
+	return p.PubSub.Subscribe(ctx, channel, func(ctx context.Context, ch string, message []byte) error {
+		carrier, message := extractTrace(message)
+		if carrier != nil {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+		}
+		ctx, span := p.tracer.Start(ctx, "process "+ch,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(messagingAttrs(ch, message)...),
+		)
+		defer span.End()
+
+		err := handler(ctx, ch, message)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	})
+}
+
+// Replay: 再送するメッセージからもトレースコンテキストを取り除く
+func (p *tracedReplayer) Replay(ctx context.Context, roomID string, since int64) ([]Message, error) {
+	msgs, err := p.replayer.Replay(ctx, roomID, since)
+	if err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		_, msgs[i].Payload = extractTrace(msgs[i].Payload)
+	}
+	return msgs, nil
+}
+
+// messagingAttrs: スパンに付けるチャネル / ルームの属性
+func messagingAttrs(channel string, message []byte) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "redis"),
+		attribute.String("messaging.destination.name", channel),
+	}
+	if roomID := roomIDOf(message); roomID != "" {
+		attrs = append(attrs, attribute.String("room_id", roomID))
+	}
+	return attrs
+}
+
+// extractTrace: ペイロードから TraceField を取り出し、取り除いたペイロードを返す
+// フィールドが無い (JSON オブジェクトでない場合も含む) ときは nil と元のペイロードを返す。
+func extractTrace(message []byte) (propagation.MapCarrier, []byte) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(message, &payload); err != nil || payload == nil {
+		return nil, message
+	}
+	raw, ok := payload[TraceField]
+	if !ok {
+		return nil, message
+	}
+	delete(payload, TraceField)
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil, message
+	}
+	var carrier propagation.MapCarrier
+	if err := json.Unmarshal(raw, &carrier); err != nil {
+		return nil, out
+	}
+	return carrier, out
+}
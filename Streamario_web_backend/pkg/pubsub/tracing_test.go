@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithTracingContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	ps := WithTracing(NewMemoryPubSub(logger))
+	defer ps.Close()
+	replayer, ok := ps.(Replayer)
+	if !ok {
+		t.Fatal("traced memory pubsub should still implement Replayer")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type received struct {
+		span trace.SpanContext
+		msg  []byte
+	}
+	got := make(chan received, 1)
+	go func() {
+		_ = ps.Subscribe(ctx, ChannelGameEvents, func(ctx context.Context, ch string, msg []byte) error {
+			got <- received{span: trace.SpanContextFromContext(ctx), msg: msg}
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	reqCtx, reqSpan := tp.Tracer("test").Start(ctx, "POST /api/rooms/:id/events")
+	if err := ps.Publish(reqCtx, ChannelGameEvents, []byte(`{"room_id":"room-a","type":"game_event"}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	reqSpan.End()
+
+	var r received
+	select {
+	case r = <-got:
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+	if r.span.TraceID() != reqSpan.SpanContext().TraceID() {
+		t.Fatalf("subscriber trace %s, want %s", r.span.TraceID(), reqSpan.SpanContext().TraceID())
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(r.msg, &payload); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := payload[TraceField]; ok {
+		t.Fatalf("trace field should be stripped before the handler: %s", r.msg)
+	}
+	if payload[SeqField] != float64(1) {
+		t.Fatalf("seq should survive: %s", r.msg)
+	}
+
+	msgs, err := replayer.Replay(ctx, "room-a", 0)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("replay: %v %v", msgs, err)
+	}
+	if err := json.Unmarshal(msgs[0].Payload, &payload); err != nil {
+		t.Fatalf("unmarshal replay: %v", err)
+	}
+	if _, ok := payload[TraceField]; ok {
+		t.Fatalf("trace field should be stripped from replays: %s", msgs[0].Payload)
+	}
+
+	time.Sleep(10 * time.Millisecond) // consumer スパンはハンドラから戻った後に終了する
+	kinds := map[trace.SpanKind]bool{}
+	for _, s := range recorder.Ended() {
+		kinds[s.SpanKind()] = true
+	}
+	if !kinds[trace.SpanKindProducer] || !kinds[trace.SpanKindConsumer] {
+		t.Fatalf("expected producer and consumer spans, got %v", kinds)
+	}
+}
@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// Registry: Unity WebSocket 接続の所有インスタンスを記録する共有レジストリ
+// 複数インスタンス構成で「どのインスタンスがどのルームの Unity ソケットを持っているか」を解決する。
+// エントリは TTL 付きで、保持インスタンスが Refresh (ハートビート) し続ける限り有効。
+type Registry interface {
+	// Claim: roomID の所有者を instanceID に設定 (再接続で別インスタンスへ移った場合は上書き)
+	Claim(ctx context.Context, roomID, instanceID string, ttl time.Duration) error
+
+	// Refresh: instanceID が所有する roomIDs の TTL を延長 (所有者が変わったルームは無視)
+	Refresh(ctx context.Context, instanceID string, roomIDs []string, ttl time.Duration) error
+
+	// Release: instanceID が所有者である場合のみ roomID のエントリを削除
+	Release(ctx context.Context, roomID, instanceID string) error
+
+	// Owner: roomID の所有インスタンスを取得 (存在しなければ ok=false)
+	Owner(ctx context.Context, roomID string) (instanceID string, ok bool, err error)
+
+	// List: クラスタ全体の有効なエントリ一覧
+	List(ctx context.Context) ([]Ownership, error)
+}
+
+// Ownership: ルームと所有インスタンスの対応
+type Ownership struct {
+	RoomID     string    `json:"room_id"`
+	InstanceID string    `json:"instance_id"`
+	ClaimedAt  time.Time `json:"claimed_at"`
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	Ownership
+	expiresAt time.Time
+}
+
+// memoryRegistry: テスト/単一インスタンス用のインメモリ実装
+type memoryRegistry struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry // roomID -> entry
+	now     func() time.Time
+}
+
+// NewMemoryRegistry: インメモリ実装を生成
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Claim: 所有者を上書き登録
+func (m *memoryRegistry) Claim(ctx context.Context, roomID, instanceID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.entries[roomID] = memoryEntry{
+		Ownership: Ownership{RoomID: roomID, InstanceID: instanceID, ClaimedAt: now},
+		expiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+// Refresh: 自インスタンス所有かつ有効なエントリのみ期限延長
+func (m *memoryRegistry) Refresh(ctx context.Context, instanceID string, roomIDs []string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for _, roomID := range roomIDs {
+		e, ok := m.entries[roomID]
+		if !ok || e.InstanceID != instanceID || !now.Before(e.expiresAt) {
+			continue
+		}
+		e.expiresAt = now.Add(ttl)
+		m.entries[roomID] = e
+	}
+	return nil
+}
+
+// Release: 所有者一致時のみ削除
+func (m *memoryRegistry) Release(ctx context.Context, roomID, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[roomID]; ok && e.InstanceID == instanceID {
+		delete(m.entries, roomID)
+	}
+	return nil
+}
+
+// Owner: 有効なエントリの所有者を返す (期限切れは削除)
+func (m *memoryRegistry) Owner(ctx context.Context, roomID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[roomID]
+	if !ok {
+		return "", false, nil
+	}
+	if !m.now().Before(e.expiresAt) {
+		delete(m.entries, roomID)
+		return "", false, nil
+	}
+	return e.InstanceID, true, nil
+}
+
+// List: 有効なエントリを roomID 順で返す
+func (m *memoryRegistry) List(ctx context.Context) ([]Ownership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	out := make([]Ownership, 0, len(m.entries))
+	for roomID, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, roomID)
+			continue
+		}
+		out = append(out, e.Ownership)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RoomID < out[j].RoomID })
+	return out, nil
+}
@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const ownerKeyPrefix = "ws:owner:"
+
+// refreshScript: 所有者が一致する場合のみ TTL を延長
+// KEYS[1]=所有者キー, ARGV[1]=instanceID, ARGV[2]=TTL(ms)
+var refreshScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'instance') == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript: 所有者が一致する場合のみ削除
+// KEYS[1]=所有者キー, ARGV[1]=instanceID
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'instance') == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// redisRegistry: Redis を利用した本番向け実装
+// ws:owner:<roomID> に HASH (instance / claimed) を TTL 付きで保存する。
+type redisRegistry struct {
+	rdb    *redis.Client
+	logger *slog.Logger
+}
+
+// NewRedisRegistry: Redis 実装を生成
+func NewRedisRegistry(rdb *redis.Client, logger *slog.Logger) Registry {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &redisRegistry{rdb: rdb, logger: logger}
+}
+
+func (r *redisRegistry) keyOwner(roomID string) string {
+	return ownerKeyPrefix + roomID
+}
+
+// Claim: 既存エントリを置き換えて所有者を登録
+func (r *redisRegistry) Claim(ctx context.Context, roomID, instanceID string, ttl time.Duration) error {
+	key := r.keyOwner(roomID)
+	logger := r.logger.With(
+		slog.String("op", "claim"),
+		slog.String("room_id", roomID),
+		slog.String("instance_id", instanceID),
+	)
+	start := time.Now()
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "instance", instanceID, "claimed", start.UnixMilli())
+	pipe.PExpire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Error("redis.hset failed", slog.Any("error", err))
+		return fmt.Errorf("registry claim failed: %w", err)
+	}
+	logger.Debug("redis.hset", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Refresh: 所有ルームの TTL をまとめて延長 (パイプラインで1往復)
+func (r *redisRegistry) Refresh(ctx context.Context, instanceID string, roomIDs []string, ttl time.Duration) error {
+	if len(roomIDs) == 0 {
+		return nil
+	}
+	logger := r.logger.With(
+		slog.String("op", "refresh"),
+		slog.String("instance_id", instanceID),
+		slog.Int("room_count", len(roomIDs)),
+	)
+	start := time.Now()
+	pipe := r.rdb.Pipeline()
+	for _, roomID := range roomIDs {
+		// パイプライン内では NOSCRIPT 時の EVAL フォールバックが効かないため Eval を使う
+		refreshScript.Eval(ctx, pipe, []string{r.keyOwner(roomID)}, instanceID, ttl.Milliseconds())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Error("redis.pexpire failed", slog.Any("error", err))
+		return fmt.Errorf("registry refresh failed: %w", err)
+	}
+	logger.Debug("redis.pexpire", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Release: 所有者一致時のみ削除
+func (r *redisRegistry) Release(ctx context.Context, roomID, instanceID string) error {
+	logger := r.logger.With(
+		slog.String("op", "release"),
+		slog.String("room_id", roomID),
+		slog.String("instance_id", instanceID),
+	)
+	start := time.Now()
+	if err := releaseScript.Run(ctx, r.rdb, []string{r.keyOwner(roomID)}, instanceID).Err(); err != nil {
+		logger.Error("redis.del failed", slog.Any("error", err))
+		return fmt.Errorf("registry release failed: %w", err)
+	}
+	logger.Debug("redis.del", slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Owner: 所有インスタンスを取得
+func (r *redisRegistry) Owner(ctx context.Context, roomID string) (string, bool, error) {
+	start := time.Now()
+	instanceID, err := r.rdb.HGet(ctx, r.keyOwner(roomID), "instance").Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		r.logger.Error("redis.hget failed", slog.String("op", "owner"), slog.String("room_id", roomID), slog.Any("error", err))
+		return "", false, fmt.Errorf("registry owner lookup failed: %w", err)
+	}
+	r.logger.Debug("redis.hget", slog.String("op", "owner"), slog.String("room_id", roomID), slog.String("instance_id", instanceID), slog.Duration("elapsed", time.Since(start)))
+	return instanceID, true, nil
+}
+
+// List: SCAN で ws:owner:* を列挙し、各エントリを取得
+func (r *redisRegistry) List(ctx context.Context) ([]Ownership, error) {
+	logger := r.logger.With(slog.String("op", "list"))
+	start := time.Now()
+	var keys []string
+	iter := r.rdb.Scan(ctx, 0, ownerKeyPrefix+"*", 200).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		logger.Error("redis.scan failed", slog.Any("error", err))
+		return nil, fmt.Errorf("registry list failed: %w", err)
+	}
+	if len(keys) == 0 {
+		return []Ownership{}, nil
+	}
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(ctx, key, "instance", "claimed")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Error("redis.hmget failed", slog.Any("error", err))
+		return nil, fmt.Errorf("registry list failed: %w", err)
+	}
+	out := make([]Ownership, 0, len(keys))
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) != 2 {
+			continue
+		}
+		instanceID, ok := vals[0].(string)
+		if !ok {
+			continue // SCAN と HMGET の間に失効した
+		}
+		o := Ownership{RoomID: strings.TrimPrefix(keys[i], ownerKeyPrefix), InstanceID: instanceID}
+		if s, ok := vals[1].(string); ok {
+			if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+				o.ClaimedAt = time.UnixMilli(ms)
+			}
+		}
+		out = append(out, o)
+	}
+	logger.Debug("redis.scan", slog.Int("count", len(out)), slog.Duration("elapsed", time.Since(start)))
+	return out, nil
+}
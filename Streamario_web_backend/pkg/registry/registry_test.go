@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// exerciseRegistry: 実装共通の振る舞い (Claim/Owner/Refresh/Release/List) を検証
+func exerciseRegistry(t *testing.T, reg Registry, expire func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+	ttl := 3 * time.Second
+
+	if _, ok, err := reg.Owner(ctx, "room-a"); err != nil || ok {
+		t.Fatalf("expected no owner, ok=%v err=%v", ok, err)
+	}
+	if err := reg.Claim(ctx, "room-a", "inst-1", ttl); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if err := reg.Claim(ctx, "room-b", "inst-2", ttl); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if owner, ok, err := reg.Owner(ctx, "room-a"); err != nil || !ok || owner != "inst-1" {
+		t.Fatalf("unexpected owner: %q ok=%v err=%v", owner, ok, err)
+	}
+
+	// 再接続で別インスタンスへ移った場合は上書きされ、旧所有者の Release は無視される
+	if err := reg.Claim(ctx, "room-a", "inst-2", ttl); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if err := reg.Release(ctx, "room-a", "inst-1"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if owner, ok, _ := reg.Owner(ctx, "room-a"); !ok || owner != "inst-2" {
+		t.Fatalf("stale release removed new owner: %q ok=%v", owner, ok)
+	}
+
+	list, err := reg.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", list)
+	}
+	for _, o := range list {
+		if o.InstanceID != "inst-2" || o.ClaimedAt.IsZero() {
+			t.Fatalf("unexpected entry: %+v", o)
+		}
+	}
+
+	// ハートビートは自インスタンス所有分のみ延長する
+	expire(2 * time.Second)
+	if err := reg.Refresh(ctx, "inst-2", []string{"room-a"}, ttl); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if err := reg.Refresh(ctx, "inst-1", []string{"room-b"}, ttl); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	expire(2 * time.Second)
+	if _, ok, _ := reg.Owner(ctx, "room-a"); !ok {
+		t.Fatalf("refreshed entry expired")
+	}
+	if _, ok, _ := reg.Owner(ctx, "room-b"); ok {
+		t.Fatalf("entry refreshed by non-owner should have expired")
+	}
+
+	if err := reg.Release(ctx, "room-a", "inst-2"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	list, err = reg.List(ctx)
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected empty list, got %+v err=%v", list, err)
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	reg := NewMemoryRegistry().(*memoryRegistry)
+	now := time.Unix(1_700_000_000, 0)
+	reg.now = func() time.Time { return now }
+	exerciseRegistry(t, reg, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestRedisRegistry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	exerciseRegistry(t, NewRedisRegistry(rdb, logger), mr.FastForward)
+}
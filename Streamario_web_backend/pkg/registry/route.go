@@ -0,0 +1,21 @@
+package registry
+
+import (
+	"context"
+
+	"streamerrio-backend/pkg/pubsub"
+)
+
+// ChannelFor: roomID 宛てメッセージの発行先チャネルを決定
+// 所有インスタンスが登録されていればそのインスタンス専用チャネル、
+// 不明 (未登録 / レジストリ未設定 / 参照失敗) なら全体ブロードキャストへフォールバックする。
+func ChannelFor(ctx context.Context, reg Registry, roomID string) string {
+	if reg == nil {
+		return pubsub.ChannelGameEvents
+	}
+	owner, ok, err := reg.Owner(ctx, roomID)
+	if err != nil || !ok {
+		return pubsub.ChannelGameEvents
+	}
+	return pubsub.InstanceChannel(owner)
+}
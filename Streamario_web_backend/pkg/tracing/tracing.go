@@ -0,0 +1,89 @@
+// Package tracing: OpenTelemetry のトレーサープロバイダ初期化
+// Init でグローバルの TracerProvider / TextMapPropagator を設定し、各パッケージは otel.Tracer(...) でスパンを記録する。
+// エクスポーターは OTLP (HTTP) / stdout / 無効 から選ぶ。送信先やサンプリングは標準の OTEL_* 環境変数に従う。
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// エクスポーター種別 (OTEL_TRACES_EXPORTER の値)
+const (
+	ExporterNone   = "none"   // スパンを記録しない (伝播のみ行う)
+	ExporterOTLP   = "otlp"   // OTLP/HTTP (OTEL_EXPORTER_OTLP_ENDPOINT など標準の環境変数で送信先を指定)
+	ExporterStdout = "stdout" // 標準出力へ JSON で書く (ローカル確認用)
+)
+
+// Config: トレース初期化の設定
+type Config struct {
+	Exporter       string // ExporterNone / ExporterOTLP / ExporterStdout
+	ServiceName    string
+	ServiceVersion string
+	InstanceID     string
+}
+
+// ValidExporter: 対応しているエクスポーター種別か ("console" は stdout の別名)
+func ValidExporter(name string) bool {
+	switch name {
+	case ExporterNone, ExporterOTLP, ExporterStdout, "console":
+		return true
+	}
+	return false
+}
+
+// Init: グローバルのトレーサープロバイダと伝播形式 (W3C Trace Context + Baggage) を設定
+// 返す関数は未送信のスパンを送り出してプロバイダを閉じる (停止時に呼ぶ)。
+// ExporterNone でも伝播形式は設定するため、上流から届いたトレースはそのまま下流へ引き継がれる。
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterStdout, "console":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("create stdout exporter: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+		semconv.ServiceInstanceID(cfg.InstanceID),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	// サンプラーは OTEL_TRACES_SAMPLER / OTEL_TRACES_SAMPLER_ARG (既定は parentbased_always_on) に従う
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
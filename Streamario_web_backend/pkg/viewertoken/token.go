@@ -0,0 +1,196 @@
+package viewertoken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 鍵の制約
+const minSecretLength = 32 // HMAC-SHA256 の鍵として最低限必要なバイト数
+
+// 検証エラー
+var (
+	ErrMalformed    = errors.New("malformed viewer token")
+	ErrUnknownKey   = errors.New("viewer token signed with unknown key")
+	ErrBadSignature = errors.New("viewer token signature mismatch")
+	ErrExpired      = errors.New("viewer token expired")
+)
+
+// keyIDPattern: 鍵 ID に許可する文字列 (トークン内の区切り "." を含まない)
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,32}$`)
+
+// Key: 署名鍵 (ID はトークンに埋め込み、ローテーション中の検証鍵の選択に使う)
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Claims: 検証済みトークンの内容
+type Claims struct {
+	ViewerID  string
+	KeyID     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Legacy    bool // 署名なしの旧 viewer_id Cookie から引き継いだ ID (本人確認されていない)
+}
+
+// payload: トークン本体の JSON (時刻は Unix 秒)
+type payload struct {
+	Sub string `json:"sub"`
+	Iat int64  `json:"iat"`
+	Exp int64  `json:"exp"`
+	Leg bool   `json:"leg,omitempty"`
+}
+
+// Signer: HMAC-SHA256 による視聴者トークンの発行・検証
+// トークン形式: <key_id>.<base64url(payload)>.<base64url(HMAC(key, key_id "." payload))>
+// 先頭の鍵で署名し、残りの鍵は検証のみに使う (鍵ローテーション中の旧トークンを受け付けるため)。
+type Signer struct {
+	keys []Key
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewSigner: 鍵一覧 (先頭が署名鍵) と有効期間から生成
+func NewSigner(keys []Key, ttl time.Duration) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one signing key is required")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token ttl must be positive")
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if !keyIDPattern.MatchString(k.ID) {
+			return nil, fmt.Errorf("invalid key id %q", k.ID)
+		}
+		if len(k.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret for key %q must be at least %d bytes", k.ID, minSecretLength)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+	}
+	return &Signer{keys: keys, ttl: ttl, now: time.Now}, nil
+}
+
+// ParseKeys: "id:secret,id2:secret2" 形式の鍵一覧を解析 (先頭が署名鍵)
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(part, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid key entry %q (want id:secret)", part)
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// TTL: トークンの有効期間
+func (s *Signer) TTL() time.Duration { return s.ttl }
+
+// Issue: 視聴者 ID に対するトークンを署名鍵で発行
+func (s *Signer) Issue(viewerID string) (string, Claims, error) {
+	return s.issue(viewerID, false)
+}
+
+// IssueLegacy: 旧 viewer_id Cookie から引き継いだ ID のトークンを発行 (Claims.Legacy 付き)
+// 旧 Cookie は署名が無く誰でも書き換えられるため、移行完了後は検証側でこの印の付いたトークンを拒否する。
+func (s *Signer) IssueLegacy(viewerID string) (string, Claims, error) {
+	return s.issue(viewerID, true)
+}
+
+func (s *Signer) issue(viewerID string, legacy bool) (string, Claims, error) {
+	if viewerID == "" {
+		return "", Claims{}, fmt.Errorf("viewer id is required")
+	}
+	key := s.keys[0]
+	now := s.now()
+	claims := Claims{ViewerID: viewerID, KeyID: key.ID, IssuedAt: now.Truncate(time.Second), ExpiresAt: now.Add(s.ttl).Truncate(time.Second), Legacy: legacy}
+	raw, err := json.Marshal(payload{Sub: viewerID, Iat: claims.IssuedAt.Unix(), Exp: claims.ExpiresAt.Unix(), Leg: legacy})
+	if err != nil {
+		return "", Claims{}, err
+	}
+	signed := key.ID + "." + base64.RawURLEncoding.EncodeToString(raw)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(key.Secret, signed)), claims, nil
+}
+
+// Verify: 署名と有効期限を検証して内容を返す
+func (s *Signer) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+	key, ok := s.key(parts[0])
+	if !ok {
+		return Claims{}, ErrUnknownKey
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	if !hmac.Equal(sig, sign(key.Secret, parts[0]+"."+parts[1])) {
+		return Claims{}, ErrBadSignature
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	var p payload
+	if err := json.Unmarshal(raw, &p); err != nil || p.Sub == "" {
+		return Claims{}, ErrMalformed
+	}
+	claims := Claims{ViewerID: p.Sub, KeyID: key.ID, IssuedAt: time.Unix(p.Iat, 0), ExpiresAt: time.Unix(p.Exp, 0), Legacy: p.Leg}
+	if !s.now().Before(claims.ExpiresAt) {
+		return Claims{}, ErrExpired
+	}
+	return claims, nil
+}
+
+// NeedsRefresh: 再発行すべきか (旧鍵で署名されている / 有効期間の半分を過ぎた)
+func (s *Signer) NeedsRefresh(c Claims) bool {
+	return c.KeyID != s.keys[0].ID || c.ExpiresAt.Sub(s.now()) < s.ttl/2
+}
+
+func (s *Signer) key(id string) (Key, bool) {
+	for _, k := range s.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func sign(secret []byte, data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// contextKey: context.Context に検証済みの視聴者を載せるキー
+type contextKey struct{}
+
+// NewContext: 検証済みの視聴者を context に載せる
+func NewContext(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext: context から検証済みの視聴者を取り出す (無ければ ok=false)
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(Claims)
+	return c, ok
+}
@@ -0,0 +1,106 @@
+package viewertoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	keyA = Key{ID: "a", Secret: []byte(strings.Repeat("a", 32))}
+	keyB = Key{ID: "b", Secret: []byte(strings.Repeat("b", 32))}
+)
+
+func newTestSigner(t *testing.T, now *time.Time, keys ...Key) *Signer {
+	t.Helper()
+	s, err := NewSigner(keys, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestSigner_IssueVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newTestSigner(t, &now, keyA)
+
+	token, issued, err := s.Issue("viewer-1")
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	claims, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims != issued || claims.ViewerID != "viewer-1" || claims.KeyID != "a" || claims.Legacy {
+		t.Fatalf("claims mismatch: got %+v, want %+v", claims, issued)
+	}
+
+	// 旧 Cookie 由来のトークンは印が署名ごと残る
+	legacy, _, _ := s.IssueLegacy("viewer-1")
+	if claims, err := s.Verify(legacy); err != nil || !claims.Legacy {
+		t.Errorf("legacy token: claims = %+v, err = %v; want Legacy", claims, err)
+	}
+
+	// 本体を別の視聴者に差し替えると署名が合わない
+	other, _, _ := s.Issue("viewer-2")
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+	if _, err := s.Verify(parts[0] + "." + otherParts[1] + "." + parts[2]); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered token: err = %v, want ErrBadSignature", err)
+	}
+	if _, err := s.Verify("garbage"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("malformed token: err = %v, want ErrMalformed", err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if _, err := s.Verify(token); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired token: err = %v, want ErrExpired", err)
+	}
+}
+
+func TestSigner_Rotation(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	old := newTestSigner(t, &now, keyA)
+	token, _, _ := old.Issue("viewer-1")
+
+	// 新しい鍵 b で署名し、a は検証のみ
+	rotated := newTestSigner(t, &now, keyB, keyA)
+	claims, err := rotated.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify with retired key failed: %v", err)
+	}
+	if !rotated.NeedsRefresh(claims) {
+		t.Errorf("token signed with retired key should be refreshed")
+	}
+	fresh, _, _ := rotated.Issue("viewer-1")
+	freshClaims, _ := rotated.Verify(fresh)
+	if freshClaims.KeyID != "b" || rotated.NeedsRefresh(freshClaims) {
+		t.Errorf("fresh token: %+v", freshClaims)
+	}
+
+	// a を外すと旧トークンは拒否される
+	retired := newTestSigner(t, &now, keyB)
+	if _, err := retired.Verify(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("removed key: err = %v, want ErrUnknownKey", err)
+	}
+
+	// 有効期間の半分を過ぎたら再発行
+	now = now.Add(13 * time.Hour)
+	if !rotated.NeedsRefresh(freshClaims) {
+		t.Errorf("token past half of its ttl should be refreshed")
+	}
+}
+
+func TestNewSigner_RejectsWeakKeys(t *testing.T) {
+	if _, err := NewSigner([]Key{{ID: "a", Secret: []byte("short")}}, time.Hour); err == nil {
+		t.Errorf("short secret accepted")
+	}
+	if _, err := NewSigner([]Key{{ID: "a.b", Secret: keyA.Secret}}, time.Hour); err == nil {
+		t.Errorf("key id with separator accepted")
+	}
+	if _, err := NewSigner([]Key{keyA, keyA}, time.Hour); err == nil {
+		t.Errorf("duplicate key id accepted")
+	}
+}